@@ -0,0 +1,150 @@
+package backend
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/99designs/keyring"
+)
+
+// AgeBackend keeps each item in a file encrypted with age to one or more recipients, which can be SSH keys.
+// Any recipient's identity decrypts the items, so the directory can be synced between machines and backed
+// up without sharing a passphrase. Items are encrypted and decrypted with the age command
+const AgeBackend = "age"
+
+type ageKeyring struct {
+	dir            string
+	recipients     []string
+	recipientsFile string
+	identity       string
+}
+
+func init() {
+	backends[AgeBackend] = func(cfg Config) (keyring.Keyring, error) {
+		if cfg.AgeDir == "" {
+			return nil, errors.New("No directory given for the age backend")
+		}
+		dir, err := expandHome(cfg.AgeDir)
+		if err != nil {
+			return nil, err
+		}
+		recipientsFile, err := expandHome(cfg.AgeRecipientsFile)
+		if err != nil {
+			return nil, err
+		}
+		identity, err := expandHome(cfg.AgeIdentity)
+		if err != nil {
+			return nil, err
+		}
+
+		return &ageKeyring{
+			dir:            dir,
+			recipients:     cfg.AgeRecipients,
+			recipientsFile: recipientsFile,
+			identity:       identity,
+		}, nil
+	}
+}
+
+func ageRecipientArgs(recipients []string, recipientsFile string) []string {
+	var args []string
+	for _, r := range recipients {
+		args = append(args, "--recipient", strings.TrimSpace(r))
+	}
+	if recipientsFile != "" {
+		args = append(args, "--recipients-file", recipientsFile)
+	}
+	return args
+}
+
+func runAge(stdin []byte, args ...string) ([]byte, error) {
+	if _, err := exec.LookPath("age"); err != nil {
+		return nil, fmt.Errorf("age is needed to use the age backend: %v", err)
+	}
+
+	cmd := exec.Command("age", args...)
+	cmd.Stdin = bytes.NewReader(stdin)
+	// age asks for the passphrase of an encrypted identity on the terminal
+	cmd.Stderr = os.Stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("age failed: %v", err)
+	}
+	return out, nil
+}
+
+func (k *ageKeyring) Get(key string) (keyring.Item, error) {
+	encrypted, _, err := readItemFile(k.dir, key, ".age")
+	if os.IsNotExist(err) {
+		return keyring.Item{}, keyring.ErrKeyNotFound
+	} else if err != nil {
+		return keyring.Item{}, err
+	}
+	if k.identity == "" {
+		return keyring.Item{}, errors.New("No age identity given to decrypt with, see --age-identity")
+	}
+
+	log.Printf("Decrypting %s with age", key)
+	data, err := runAge(encrypted, "--decrypt", "--identity", k.identity)
+	if err != nil {
+		return keyring.Item{}, err
+	}
+
+	var item keyring.Item
+	if err = json.Unmarshal(data, &item); err != nil {
+		return keyring.Item{}, err
+	}
+	return item, nil
+}
+
+func (k *ageKeyring) GetMetadata(key string) (keyring.Metadata, error) {
+	stat, err := statItemFile(k.dir, key, ".age")
+	if os.IsNotExist(err) {
+		return keyring.Metadata{}, keyring.ErrKeyNotFound
+	} else if err != nil {
+		return keyring.Metadata{}, err
+	}
+	return keyring.Metadata{Item: &keyring.Item{Key: key}, ModificationTime: stat.ModTime()}, nil
+}
+
+func (k *ageKeyring) Set(item keyring.Item) error {
+	args := ageRecipientArgs(k.recipients, k.recipientsFile)
+	if len(args) == 0 {
+		return errors.New("No age recipients given to encrypt to, see --age-recipient")
+	}
+	args = append([]string{"--encrypt"}, args...)
+
+	data, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+	log.Printf("Encrypting %s with age", item.Key)
+	b, err := runAge(data, args...)
+	if err != nil {
+		return err
+	}
+
+	if err = os.MkdirAll(k.dir, 0700); err != nil {
+		return err
+	}
+	return writeItemFile(k.dir, item.Key, ".age", b)
+}
+
+func (k *ageKeyring) Remove(key string) error {
+	err := removeItemFile(k.dir, key, ".age")
+	if os.IsNotExist(err) {
+		return keyring.ErrKeyNotFound
+	}
+	return err
+}
+
+func (k *ageKeyring) Keys() ([]string, error) {
+	return itemKeys(k.dir, ".age")
+}
@@ -0,0 +1,138 @@
+// +build !windows
+
+package backend_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/99designs/aws-vault/backend"
+	"github.com/99designs/keyring"
+)
+
+// fakeAge logs its arguments, "encrypts" by adding a header line and "decrypts" by removing it
+const fakeAge = `#!/bin/sh
+echo "$@" >> "$(dirname "$0")/args"
+case "$1" in
+--encrypt) echo "age-encrypted"; cat ;;
+--decrypt) sed 1d ;;
+esac
+`
+
+// fakeCommand puts an executable script on the PATH, it returns a function restoring the PATH
+func fakeCommand(t *testing.T, dir, name, script string) func() {
+	if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	path := os.Getenv("PATH")
+	os.Setenv("PATH", dir+string(os.PathListSeparator)+path)
+	return func() { os.Setenv("PATH", path) }
+}
+
+func TestAge(t *testing.T) {
+	dir, err := ioutil.TempDir("", "aws-vault-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer fakeCommand(t, dir, "age", fakeAge)()
+
+	k, err := backend.Open(backend.AgeBackend, backend.Config{
+		AgeDir:            filepath.Join(dir, "items"),
+		AgeRecipients:     []string{"age1llamas", " ssh-ed25519 AAAAalpacas "},
+		AgeRecipientsFile: filepath.Join(dir, "recipients"),
+		AgeIdentity:       filepath.Join(dir, "identity"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = k.Set(keyring.Item{Key: "work", Data: []byte("secret")}); err != nil {
+		t.Fatal(err)
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "items", "*.age"))
+	if err != nil || len(files) != 1 {
+		t.Fatalf("Expected one item file, got %v, %v", files, err)
+	}
+	b, err := ioutil.ReadFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), "\nage-encrypted\n") {
+		t.Fatalf("Expected the item to be stored as age output, got %q", b)
+	}
+
+	keys, err := k.Keys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 1 || keys[0] != "work" {
+		t.Fatalf("Expected the key work, got %v", keys)
+	}
+
+	item, err := k.Get("work")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if item.Key != "work" || string(item.Data) != "secret" {
+		t.Fatalf("Expected the stored item, got %+v", item)
+	}
+	if _, err = k.Get("personal"); err != keyring.ErrKeyNotFound {
+		t.Fatalf("Expected ErrKeyNotFound, got %v", err)
+	}
+	if _, err = k.GetMetadata("work"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = k.Remove("work"); err != nil {
+		t.Fatal(err)
+	}
+	if err = k.Remove("work"); err != keyring.ErrKeyNotFound {
+		t.Fatalf("Expected ErrKeyNotFound, got %v", err)
+	}
+
+	args, err := ioutil.ReadFile(filepath.Join(dir, "args"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "--encrypt --recipient age1llamas --recipient ssh-ed25519 AAAAalpacas --recipients-file " + filepath.Join(dir, "recipients") + "\n" +
+		"--decrypt --identity " + filepath.Join(dir, "identity") + "\n"
+	if string(args) != expected {
+		t.Fatalf("Expected age to be run with:\n%s\ngot:\n%s", expected, args)
+	}
+}
+
+func TestAgeNeedsRecipientsAndIdentity(t *testing.T) {
+	dir, err := ioutil.TempDir("", "aws-vault-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer fakeCommand(t, dir, "age", fakeAge)()
+
+	k, err := backend.Open(backend.AgeBackend, backend.Config{AgeDir: filepath.Join(dir, "items")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = k.Set(keyring.Item{Key: "work", Data: []byte("secret")}); err == nil {
+		t.Fatal("Expected an error without recipients")
+	}
+
+	k, err = backend.Open(backend.AgeBackend, backend.Config{AgeDir: filepath.Join(dir, "items"), AgeRecipients: []string{"age1llamas"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = k.Set(keyring.Item{Key: "work", Data: []byte("secret")}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = k.Get("work"); err == nil {
+		t.Fatal("Expected an error without an identity")
+	}
+
+	if _, err = backend.Open(backend.AgeBackend, backend.Config{}); err == nil {
+		t.Fatal("Expected an error without a directory")
+	}
+}
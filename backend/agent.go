@@ -0,0 +1,273 @@
+package backend
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// AgentCommand is the hidden command that runs the agent, it's started by the first process to unlock
+// an encrypted-file vault when EncryptedFileAgentTTL is set
+const AgentCommand = "encrypted-file-agent"
+
+// agentIdleTimeout is how long the agent waits for a key before exiting
+const agentIdleTimeout = 10 * time.Second
+
+type agentRequest struct {
+	Op    string        `json:"op"`
+	Vault string        `json:"vault"`
+	Key   []byte        `json:"key,omitempty"`
+	TTL   time.Duration `json:"ttl,omitempty"`
+}
+
+type agentResponse struct {
+	Key   []byte `json:"key,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// agentSocketPath is the unix socket the agent listens on, in a directory only the user can access
+func agentSocketPath() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	dir = filepath.Join(dir, "aws-vault", "agent")
+	if err = os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+	if err = os.Chmod(dir, 0700); err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "agent.sock"), nil
+}
+
+func agentCall(req agentRequest) (agentResponse, error) {
+	var resp agentResponse
+	path, err := agentSocketPath()
+	if err != nil {
+		return resp, err
+	}
+	conn, err := net.DialTimeout("unix", path, time.Second)
+	if err != nil {
+		log.Printf("Agent isn't running: %v", err)
+		return resp, errAgentNotRunning
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	if err = json.NewEncoder(conn).Encode(req); err != nil {
+		return resp, err
+	}
+	if err = json.NewDecoder(conn).Decode(&resp); err != nil {
+		return resp, err
+	}
+	if resp.Error != "" {
+		return resp, errors.New(resp.Error)
+	}
+	return resp, nil
+}
+
+// agentGetKey returns the key the agent holds for the vault, or nil if it has none or isn't running
+func agentGetKey(vault string) ([]byte, error) {
+	resp, err := agentCall(agentRequest{Op: "get", Vault: vault})
+	if err != nil {
+		if isAgentNotRunning(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return resp.Key, nil
+}
+
+// agentSetKey gives the agent the key for the vault to hold for ttl, starting the agent if it isn't running
+func agentSetKey(vault string, key []byte, ttl time.Duration) error {
+	req := agentRequest{Op: "set", Vault: vault, Key: key, TTL: ttl}
+	_, err := agentCall(req)
+	if err == nil || !isAgentNotRunning(err) {
+		return err
+	}
+
+	if err = startAgent(); err != nil {
+		return err
+	}
+	for i := 0; i < 20; i++ {
+		time.Sleep(100 * time.Millisecond)
+		if _, err = agentCall(req); err == nil || !isAgentNotRunning(err) {
+			return err
+		}
+	}
+	return fmt.Errorf("Agent didn't start: %v", err)
+}
+
+// LockAgent makes the agent forget the keys it holds and exit, so encrypted-file vaults need their
+// passphrase again. It returns false if the agent wasn't running
+func LockAgent() (bool, error) {
+	_, err := agentCall(agentRequest{Op: "lock"})
+	if isAgentNotRunning(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+var errAgentNotRunning = errors.New("The agent isn't running")
+
+func isAgentNotRunning(err error) bool {
+	return err == errAgentNotRunning
+}
+
+func startAgent() error {
+	self, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	log.Printf("Starting %s", AgentCommand)
+	cmd := exec.Command(self, AgentCommand)
+	detach(cmd)
+	if err = cmd.Start(); err != nil {
+		return err
+	}
+	return cmd.Process.Release()
+}
+
+// RunAgent holds encrypted-file vault keys in memory until their TTL passes, and exits when it holds none
+func RunAgent() error {
+	path, err := agentSocketPath()
+	if err != nil {
+		return err
+	}
+	// a socket left by an agent that died is removed, one that's running is left alone
+	if conn, err := net.Dial("unix", path); err == nil {
+		conn.Close()
+		return errors.New("The agent is already running")
+	}
+	os.Remove(path)
+
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return err
+	}
+	defer l.Close()
+	if err = os.Chmod(path, 0600); err != nil {
+		return err
+	}
+
+	// the agent outlives the terminal that started it
+	signal.Ignore(syscall.SIGHUP)
+
+	a := &agent{keys: map[string][]byte{}, listener: l}
+	a.idle = time.AfterFunc(agentIdleTimeout, a.stop)
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if a.isStopped() {
+				return nil
+			}
+			return err
+		}
+		go a.serve(conn)
+	}
+}
+
+type agent struct {
+	mu       sync.Mutex
+	keys     map[string][]byte
+	expiries map[string]*time.Timer
+	idle     *time.Timer
+	listener net.Listener
+	stopped  bool
+}
+
+func (a *agent) serve(conn net.Conn) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	var req agentRequest
+	if err := json.NewDecoder(bufio.NewReader(conn)).Decode(&req); err != nil {
+		return
+	}
+
+	var resp agentResponse
+	switch req.Op {
+	case "get":
+		resp.Key = a.get(req.Vault)
+	case "set":
+		a.set(req.Vault, req.Key, req.TTL)
+	case "lock":
+		a.lock()
+	default:
+		resp.Error = fmt.Sprintf("Unknown agent operation %q", req.Op)
+	}
+	json.NewEncoder(conn).Encode(resp)
+}
+
+func (a *agent) get(vault string) []byte {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.keys[vault]
+}
+
+func (a *agent) set(vault string, key []byte, ttl time.Duration) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.expiries == nil {
+		a.expiries = map[string]*time.Timer{}
+	}
+	if t, ok := a.expiries[vault]; ok {
+		t.Stop()
+	}
+	a.idle.Stop()
+	a.keys[vault] = key
+	a.expiries[vault] = time.AfterFunc(ttl, func() { a.expire(vault) })
+}
+
+func (a *agent) expire(vault string) {
+	a.mu.Lock()
+	delete(a.keys, vault)
+	delete(a.expiries, vault)
+	empty := len(a.keys) == 0
+	a.mu.Unlock()
+
+	if empty {
+		a.stop()
+	}
+}
+
+// lock forgets all the keys and stops the agent
+func (a *agent) lock() {
+	a.mu.Lock()
+	for vault, t := range a.expiries {
+		t.Stop()
+		delete(a.expiries, vault)
+	}
+	a.keys = map[string][]byte{}
+	a.mu.Unlock()
+
+	a.stop()
+}
+
+func (a *agent) stop() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if len(a.keys) == 0 && !a.stopped {
+		a.stopped = true
+		a.listener.Close()
+	}
+}
+
+func (a *agent) isStopped() bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.stopped
+}
@@ -0,0 +1,125 @@
+// +build !windows
+
+package backend
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+// startTestAgent runs an agent with its socket in a temporary cache directory, and returns a channel that
+// gets RunAgent's error when the agent exits
+func startTestAgent(t *testing.T) <-chan error {
+	errc := make(chan error, 1)
+	go func() { errc <- RunAgent() }()
+
+	for i := 0; i < 50; i++ {
+		if _, err := agentCall(agentRequest{Op: "get"}); !isAgentNotRunning(err) {
+			return errc
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatal("Agent didn't start")
+	return nil
+}
+
+func waitForAgentExit(t *testing.T, errc <-chan error) {
+	select {
+	case err := <-errc:
+		if err != nil {
+			t.Fatalf("Expected the agent to exit cleanly, got %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected the agent to exit")
+	}
+}
+
+func useTempCacheDir(t *testing.T) func() {
+	dir, err := ioutil.TempDir("", "aws-vault-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	home, cache := os.Getenv("HOME"), os.Getenv("XDG_CACHE_HOME")
+	os.Setenv("HOME", dir)
+	os.Setenv("XDG_CACHE_HOME", dir)
+
+	return func() {
+		os.Setenv("HOME", home)
+		os.Setenv("XDG_CACHE_HOME", cache)
+		os.RemoveAll(dir)
+	}
+}
+
+func TestAgent(t *testing.T) {
+	defer useTempCacheDir(t)()
+
+	locked, err := LockAgent()
+	if err != nil || locked {
+		t.Fatalf("Expected the agent not to be running, got %v, %v", locked, err)
+	}
+	if key, err := agentGetKey("/vaults/work"); err != nil || key != nil {
+		t.Fatalf("Expected no key without an agent, got %q, %v", key, err)
+	}
+
+	errc := startTestAgent(t)
+	if err = agentSetKey("/vaults/work", []byte("work-key"), time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if err = agentSetKey("/vaults/personal", []byte("personal-key"), 200*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+
+	for vault, expected := range map[string]string{
+		"/vaults/work":     "work-key",
+		"/vaults/personal": "personal-key",
+		"/vaults/other":    "",
+	} {
+		key, err := agentGetKey(vault)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(key) != expected {
+			t.Fatalf("Expected %q for %s, got %q", expected, vault, key)
+		}
+	}
+
+	time.Sleep(500 * time.Millisecond)
+	if key, err := agentGetKey("/vaults/personal"); err != nil || key != nil {
+		t.Fatalf("Expected the personal key to have expired, got %q, %v", key, err)
+	}
+	if key, err := agentGetKey("/vaults/work"); err != nil || string(key) != "work-key" {
+		t.Fatalf("Expected the work key to be kept, got %q, %v", key, err)
+	}
+
+	if _, err = agentCall(agentRequest{Op: "llamas"}); err == nil {
+		t.Fatal("Expected an unknown operation to fail")
+	}
+
+	locked, err = LockAgent()
+	if err != nil || !locked {
+		t.Fatalf("Expected the agent to be locked, got %v, %v", locked, err)
+	}
+	waitForAgentExit(t, errc)
+	if key, err := agentGetKey("/vaults/work"); err != nil || key != nil {
+		t.Fatalf("Expected no key after locking, got %q, %v", key, err)
+	}
+}
+
+func TestAgentExitsWhenKeysExpire(t *testing.T) {
+	defer useTempCacheDir(t)()
+
+	errc := startTestAgent(t)
+	if err := agentSetKey("/vaults/work", []byte("work-key"), 100*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	waitForAgentExit(t, errc)
+
+	// an agent can be started again once the last one has exited
+	errc = startTestAgent(t)
+	if _, err := LockAgent(); err != nil {
+		t.Fatal(err)
+	}
+	waitForAgentExit(t, errc)
+}
@@ -0,0 +1,13 @@
+// +build !windows
+
+package backend
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// detach starts the agent in a session of its own, so it isn't killed with the terminal's process group
+func detach(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+}
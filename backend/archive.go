@@ -0,0 +1,196 @@
+package backend
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"time"
+
+	"github.com/99designs/keyring"
+)
+
+// ArchiveVersion is the version of the archives written by WriteArchive. Older versions can still be read
+const ArchiveVersion = 1
+
+const archiveFormat = "aws-vault archive"
+
+// The most work an archive's header can ask for to derive its key, so a crafted archive can't use up all
+// the memory or CPU of the machine importing it. They're well above what parseArgon2Params is given in
+// practice
+const (
+	maxArchiveArgon2Memory  = 4 * 1024 * 1024 // KiB, 4GiB
+	maxArchiveArgon2Time    = 64
+	maxArchiveArgon2Threads = 64
+)
+
+// archive is a backup of stored credentials. The items are either sealed with a key derived from a
+// passphrase, the same way as in the encrypted-file backend, or the whole archive is encrypted with age
+type archive struct {
+	Format  string         `json:"format"`
+	Version int            `json:"version"`
+	Created time.Time      `json:"created"`
+	KDF     *header        `json:"kdf,omitempty"`
+	Sealed  []byte         `json:"sealed,omitempty"`
+	Items   []keyring.Item `json:"items,omitempty"`
+}
+
+// isAgeEncrypted returns whether data was encrypted by age, in its binary or armored format
+func isAgeEncrypted(data []byte) bool {
+	return bytes.HasPrefix(data, []byte("age-encryption.org/")) ||
+		bytes.HasPrefix(bytes.TrimSpace(data), []byte("-----BEGIN AGE ENCRYPTED FILE-----"))
+}
+
+// WriteArchive writes the items to w as an encrypted archive. If cfg has age recipients the archive is
+// encrypted to them, otherwise with a passphrase from cfg.PassphraseFunc and the cfg.EncryptedFileArgon2
+// parameters
+func WriteArchive(w io.Writer, items []keyring.Item, cfg Config) error {
+	a := archive{Format: archiveFormat, Version: ArchiveVersion, Created: time.Now().UTC()}
+
+	if recipients := ageRecipientArgs(cfg.AgeRecipients, cfg.AgeRecipientsFile); len(recipients) > 0 {
+		a.Items = items
+		data, err := json.Marshal(a)
+		if err != nil {
+			return err
+		}
+		log.Printf("Encrypting archive of %d items with age", len(items))
+		b, err := runAge(data, append([]string{"--encrypt", "--armor"}, recipients...)...)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(b)
+		return err
+	}
+
+	if cfg.PassphraseFunc == nil {
+		return errors.New("No passphrase prompt or age recipients given to encrypt the archive with")
+	}
+	if cfg.EncryptedFileArgon2 == "" {
+		cfg.EncryptedFileArgon2 = DefaultArgon2Params
+	}
+	h, err := parseArgon2Params(cfg.EncryptedFileArgon2)
+	if err != nil {
+		return err
+	}
+	h.Salt = make([]byte, 16)
+	if _, err = rand.Read(h.Salt); err != nil {
+		return err
+	}
+
+	passphrase, err := cfg.PassphraseFunc("Enter passphrase to encrypt the archive with")
+	if err != nil {
+		return err
+	}
+	confirm, err := cfg.PassphraseFunc("Enter passphrase again")
+	if err != nil {
+		return err
+	}
+	if passphrase != confirm {
+		return errors.New("Passphrases don't match")
+	}
+
+	aead, err := newAEAD(h.deriveKey(passphrase))
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(items)
+	if err != nil {
+		return err
+	}
+	if a.Sealed, err = seal(aead, data, archiveFormat); err != nil {
+		return err
+	}
+	a.KDF = &h
+
+	b, err := json.MarshalIndent(a, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(b, '\n'))
+	return err
+}
+
+// checkArchiveKDF returns an error if the argon2id parameters in an archive's header are invalid or
+// would take more than the maximum memory or time to derive the key with
+func checkArchiveKDF(h *header) error {
+	if h.KDF != "argon2id" {
+		return fmt.Errorf("Unsupported archive key derivation %q", h.KDF)
+	}
+	if h.Time == 0 || h.Threads == 0 || h.Memory < 8*uint32(h.Threads) || len(h.Salt) == 0 {
+		return errors.New("Invalid argon2 parameters in the archive")
+	}
+	if h.Memory > maxArchiveArgon2Memory || h.Time > maxArchiveArgon2Time || h.Threads > maxArchiveArgon2Threads {
+		return fmt.Errorf("The archive's argon2 parameters m=%d,t=%d,p=%d are over the maximum of m=%d,t=%d,p=%d",
+			h.Memory, h.Time, h.Threads, maxArchiveArgon2Memory, maxArchiveArgon2Time, maxArchiveArgon2Threads)
+	}
+	return nil
+}
+
+// ReadArchive reads the items in an archive written by WriteArchive. An archive encrypted with age is
+// decrypted with cfg.AgeIdentity, otherwise the passphrase is asked for with cfg.PassphraseFunc. An archive
+// that isn't encrypted at all is only read if cfg.AllowPlaintextArchive is set
+func ReadArchive(r io.Reader, cfg Config) ([]keyring.Item, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	ageEncrypted := isAgeEncrypted(data)
+	if ageEncrypted {
+		if cfg.AgeIdentity == "" {
+			return nil, errors.New("The archive is encrypted with age, give an identity to decrypt it with --age-identity")
+		}
+		identity, err := expandHome(cfg.AgeIdentity)
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("Decrypting archive with age")
+		if data, err = runAge(data, "--decrypt", "--identity", identity); err != nil {
+			return nil, err
+		}
+	}
+
+	var a archive
+	if err = json.Unmarshal(data, &a); err != nil || a.Format != archiveFormat {
+		return nil, errors.New("Not an aws-vault archive")
+	}
+	if a.Version > ArchiveVersion {
+		return nil, fmt.Errorf("The archive is version %d, a newer aws-vault is needed to read it", a.Version)
+	}
+	log.Printf("Reading version %d archive created %s", a.Version, a.Created.Format(time.RFC3339))
+
+	if a.KDF == nil {
+		if !ageEncrypted && !cfg.AllowPlaintextArchive {
+			return nil, errors.New("The archive isn't encrypted, use --allow-plaintext to import it anyway")
+		}
+		return a.Items, nil
+	}
+	if err = checkArchiveKDF(a.KDF); err != nil {
+		return nil, err
+	}
+	if cfg.PassphraseFunc == nil {
+		return nil, errors.New("No passphrase prompt given to decrypt the archive")
+	}
+	passphrase, err := cfg.PassphraseFunc("Enter passphrase to decrypt the archive")
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(a.KDF.deriveKey(passphrase))
+	if err != nil {
+		return nil, err
+	}
+	data, err = unseal(aead, a.Sealed, archiveFormat)
+	if err != nil {
+		return nil, errors.New("Incorrect passphrase for the archive")
+	}
+
+	var items []keyring.Item
+	if err = json.Unmarshal(data, &items); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
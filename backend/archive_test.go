@@ -0,0 +1,99 @@
+package backend_test
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/99designs/aws-vault/backend"
+	"github.com/99designs/keyring"
+)
+
+func archiveConfig(passphrase string) backend.Config {
+	return backend.Config{
+		EncryptedFileArgon2: "m=64,t=1,p=1",
+		PassphraseFunc: func(string) (string, error) {
+			return passphrase, nil
+		},
+	}
+}
+
+func TestArchive(t *testing.T) {
+	items := []keyring.Item{
+		{Key: "work", Data: []byte(`{"AccessKeyID":"ABC","SecretAccessKey":"XYZ"}`)},
+		{Key: "totp,work", Data: []byte("JBSWY3DPEHPK3PXP")},
+	}
+
+	var b bytes.Buffer
+	if err := backend.WriteArchive(&b, items, archiveConfig("llamas")); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(b.String(), "XYZ") {
+		t.Fatal("Expected the archive to be encrypted")
+	}
+
+	read, err := backend.ReadArchive(bytes.NewReader(b.Bytes()), archiveConfig("llamas"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(read, items) {
+		t.Fatalf("Expected %v, got %v", items, read)
+	}
+
+	if _, err = backend.ReadArchive(bytes.NewReader(b.Bytes()), archiveConfig("alpacas")); err == nil {
+		t.Fatal("Expected an error with the wrong passphrase")
+	}
+}
+
+func TestArchiveVersion(t *testing.T) {
+	_, err := backend.ReadArchive(strings.NewReader(`{"format":"aws-vault archive","version":2}`), archiveConfig("llamas"))
+	if err == nil || !strings.Contains(err.Error(), "newer") {
+		t.Fatalf("Expected an error about a newer version, got %v", err)
+	}
+
+	if _, err = backend.ReadArchive(strings.NewReader(`{"version":1}`), archiveConfig("llamas")); err == nil {
+		t.Fatal("Expected an error reading something that isn't an archive")
+	}
+}
+
+func TestArchivePlaintext(t *testing.T) {
+	plaintext := `{"format":"aws-vault archive","version":1,"items":[{"Key":"work","Data":"e30="}]}`
+
+	if _, err := backend.ReadArchive(strings.NewReader(plaintext), archiveConfig("llamas")); err == nil || !strings.Contains(err.Error(), "--allow-plaintext") {
+		t.Fatalf("Expected an error about --allow-plaintext, got %v", err)
+	}
+
+	cfg := archiveConfig("llamas")
+	cfg.AllowPlaintextArchive = true
+	items, err := backend.ReadArchive(strings.NewReader(plaintext), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 1 || items[0].Key != "work" {
+		t.Fatalf("Expected the work item, got %v", items)
+	}
+}
+
+func TestArchiveArgon2Limits(t *testing.T) {
+	for _, kdf := range []string{
+		`{"version":1,"kdf":"argon2id","salt":"c2FsdA==","memory":4294967295,"time":1,"threads":1}`,
+		`{"version":1,"kdf":"argon2id","salt":"c2FsdA==","memory":64,"time":4294967295,"threads":1}`,
+		`{"version":1,"kdf":"argon2id","salt":"c2FsdA==","memory":65536,"time":1,"threads":255}`,
+		`{"version":1,"kdf":"argon2id","salt":"c2FsdA==","memory":64,"time":1,"threads":0}`,
+	} {
+		called := false
+		cfg := archiveConfig("llamas")
+		cfg.PassphraseFunc = func(string) (string, error) {
+			called = true
+			return "llamas", nil
+		}
+		archive := `{"format":"aws-vault archive","version":1,"kdf":` + kdf + `,"sealed":"c2VhbGVk"}`
+		if _, err := backend.ReadArchive(strings.NewReader(archive), cfg); err == nil {
+			t.Fatalf("Expected an error reading an archive with kdf %s", kdf)
+		}
+		if called {
+			t.Fatalf("Expected no passphrase to be asked for with kdf %s", kdf)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+// Package backend provides secret backends that aren't part of the keyring library, and runs backend
+// plugins found on PATH. They're chosen by name with --backend, alongside the keyring backends
+package backend
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/99designs/keyring"
+)
+
+// Config configures the backends
+type Config struct {
+	// PassphraseFunc asks for the passphrase that unlocks a backend
+	PassphraseFunc keyring.PromptFunc
+
+	// EncryptedFileDir is the directory the encrypted-file backend keeps items in
+	EncryptedFileDir string
+
+	// EncryptedFileArgon2 are the argon2id parameters used to create an encrypted-file vault, e.g. "m=65536,t=3,p=4"
+	EncryptedFileArgon2 string
+
+	// EncryptedFileAgentTTL is how long the agent keeps an encrypted-file vault unlocked, zero disables the agent
+	EncryptedFileAgentTTL time.Duration
+
+	// TPMDir is the directory the tpm backend keeps items in
+	TPMDir string
+
+	// AgeDir is the directory the age backend keeps items in
+	AgeDir string
+
+	// AgeRecipients and AgeRecipientsFile are who age items are encrypted to, AgeIdentity decrypts them
+	AgeRecipients     []string
+	AgeRecipientsFile string
+	AgeIdentity       string
+
+	// GPGDir is the directory the gpg backend keeps items in, GPGRecipients who they're encrypted to
+	GPGDir        string
+	GPGRecipients []string
+
+	// OpVault is the 1Password vault the op backend keeps items in
+	OpVault string
+
+	// HashiCorpVaultAddr, HashiCorpVaultMount and HashiCorpVaultPath are the server, KV v2 mount and path in
+	// it the hashicorp-vault backend keeps items in
+	HashiCorpVaultAddr  string
+	HashiCorpVaultMount string
+	HashiCorpVaultPath  string
+
+	// HashiCorpVaultAuth is how to authenticate to HashiCorp Vault, token or oidc. HashiCorpVaultRole is the
+	// oidc role to sign in with, or "" for the default role
+	HashiCorpVaultAuth string
+	HashiCorpVaultRole string
+
+	// AllowPlaintextArchive lets ReadArchive read an archive that isn't encrypted
+	AllowPlaintextArchive bool
+
+	// MemoryItems is a JSON object of the keys and data the memory backend starts with
+	MemoryItems string
+}
+
+type opener func(cfg Config) (keyring.Keyring, error)
+
+var backends = map[string]opener{}
+
+// Available returns the names of the backends and plugins
+func Available() []string {
+	names := []string{}
+	for name := range backends {
+		names = append(names, name)
+	}
+	for name := range plugins() {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// IsBackend returns whether name is one of these backends or a plugin, rather than a keyring backend
+func IsBackend(name string) bool {
+	if _, ok := backends[name]; ok {
+		return true
+	}
+	_, ok := plugins()[name]
+	return ok
+}
+
+// PluginPath returns the path of the executable for the named plugin, if it's a plugin
+func PluginPath(name string) (string, bool) {
+	if _, ok := backends[name]; ok {
+		return "", false
+	}
+	path, ok := plugins()[name]
+	return path, ok
+}
+
+// Open opens the named backend or plugin
+func Open(name string, cfg Config) (keyring.Keyring, error) {
+	if open, ok := backends[name]; ok {
+		return open(cfg)
+	}
+	if path, ok := plugins()[name]; ok {
+		return &pluginKeyring{path: path}, nil
+	}
+	return nil, fmt.Errorf("Unknown backend %q", name)
+}
@@ -0,0 +1,335 @@
+package backend
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/99designs/aws-vault/logging"
+	"github.com/99designs/keyring"
+	"golang.org/x/crypto/argon2"
+)
+
+// EncryptedFileBackend keeps each item in a file encrypted with AES-256-GCM, with a key derived from a
+// passphrase with argon2id. It's for headless machines with no OS keychain
+const EncryptedFileBackend = "encrypted-file"
+
+// DefaultArgon2Params are the OWASP recommended argon2id parameters, 64MiB of memory and 3 passes
+const DefaultArgon2Params = "m=65536,t=3,p=4"
+
+const (
+	headerFile = ".vault"
+	verifier   = "aws-vault encrypted-file"
+)
+
+// header describes how the vault's key is derived, it's stored unencrypted in the vault directory
+type header struct {
+	Version int    `json:"version"`
+	KDF     string `json:"kdf"`
+	Salt    []byte `json:"salt,omitempty"`
+	Memory  uint32 `json:"memory,omitempty"`
+	Time    uint32 `json:"time,omitempty"`
+	Threads uint8  `json:"threads,omitempty"`
+
+	// Verifier is a known value sealed with the key, to tell a wrong passphrase from a corrupt item
+	Verifier []byte `json:"verifier,omitempty"`
+
+	// TPMPublic and TPMPrivate are the key sealed to the TPM, when the KDF is tpm2
+	TPMPublic  []byte `json:"tpm_public,omitempty"`
+	TPMPrivate []byte `json:"tpm_private,omitempty"`
+}
+
+func (h header) deriveKey(passphrase string) []byte {
+	return argon2.IDKey([]byte(passphrase), h.Salt, h.Time, h.Memory, h.Threads, 32)
+}
+
+// parseArgon2Params parses parameters in the PHC string format, e.g. "m=65536,t=3,p=4". Those left out
+// are the defaults
+func parseArgon2Params(s string) (header, error) {
+	h := header{Version: 1, KDF: "argon2id", Memory: 65536, Time: 3, Threads: 4}
+	for _, param := range strings.Split(s, ",") {
+		kv := strings.SplitN(strings.TrimSpace(param), "=", 2)
+		if len(kv) != 2 {
+			return h, fmt.Errorf("Invalid argon2 parameter %q, expected m=, t= or p=", param)
+		}
+		n, err := strconv.ParseUint(kv[1], 10, 32)
+		if err != nil || n == 0 {
+			return h, fmt.Errorf("Invalid argon2 parameter %q, expected a positive number", param)
+		}
+		switch kv[0] {
+		case "m":
+			h.Memory = uint32(n)
+		case "t":
+			h.Time = uint32(n)
+		case "p":
+			if n > 255 {
+				return h, fmt.Errorf("Invalid argon2 parameter %q, at most 255 threads can be used", param)
+			}
+			h.Threads = uint8(n)
+		default:
+			return h, fmt.Errorf("Invalid argon2 parameter %q, expected m=, t= or p=", param)
+		}
+	}
+	if h.Memory < 8*uint32(h.Threads) {
+		return h, fmt.Errorf("Invalid argon2 parameters %q, memory must be at least 8KiB per thread", s)
+	}
+	return h, nil
+}
+
+type encryptedFileKeyring struct {
+	dir            string
+	params         header
+	cfg            Config
+	aead           cipher.AEAD
+	passphraseFunc keyring.PromptFunc
+}
+
+func init() {
+	backends[EncryptedFileBackend] = func(cfg Config) (keyring.Keyring, error) {
+		if cfg.EncryptedFileDir == "" {
+			return nil, errors.New("No directory given for the encrypted-file backend")
+		}
+		if cfg.EncryptedFileArgon2 == "" {
+			cfg.EncryptedFileArgon2 = DefaultArgon2Params
+		}
+		params, err := parseArgon2Params(cfg.EncryptedFileArgon2)
+		if err != nil {
+			return nil, err
+		}
+
+		dir, err := expandHome(cfg.EncryptedFileDir)
+		if err != nil {
+			return nil, err
+		}
+
+		return &encryptedFileKeyring{
+			dir:            dir,
+			params:         params,
+			cfg:            cfg,
+			passphraseFunc: cfg.PassphraseFunc,
+		}, nil
+	}
+}
+
+// unlock derives the key from the passphrase, or gets it from the agent. A new vault is created with
+// the configured argon2 parameters, an existing one keeps those it was created with
+func (k *encryptedFileKeyring) unlock() error {
+	if k.aead != nil {
+		return nil
+	}
+	if err := os.MkdirAll(k.dir, 0700); err != nil {
+		return err
+	}
+
+	var h header
+	create := false
+	b, err := ioutil.ReadFile(filepath.Join(k.dir, headerFile))
+	if os.IsNotExist(err) {
+		create = true
+		h = k.params
+		if h.KDF != tpmKDF {
+			h.Salt = make([]byte, 16)
+			if _, err = rand.Read(h.Salt); err != nil {
+				return err
+			}
+		}
+	} else if err != nil {
+		return err
+	} else if err = json.Unmarshal(b, &h); err != nil {
+		return fmt.Errorf("Invalid vault header %s: %v", filepath.Join(k.dir, headerFile), err)
+	} else if h.Version != 1 || (h.KDF != "argon2id" && h.KDF != tpmKDF) {
+		return fmt.Errorf("Unsupported vault %s, version %d with %s", k.dir, h.Version, h.KDF)
+	}
+
+	var aead cipher.AEAD
+	var key []byte
+	derived := false
+	if !create {
+		key = k.agentKey()
+	}
+	if key != nil {
+		// the agent's key is only used if it unlocks this vault, it may be for one that was replaced
+		if aead, err = newAEAD(key); err != nil {
+			return err
+		}
+		if _, err = unseal(aead, h.Verifier, headerFile); err != nil {
+			log.Printf("Agent's key doesn't unlock %s", k.dir)
+			key = nil
+		}
+	}
+	if key == nil && h.KDF == tpmKDF {
+		if create {
+			key = make([]byte, 32)
+			if _, err = rand.Read(key); err != nil {
+				return err
+			}
+			log.Printf("Sealing key for %s to the TPM", k.dir)
+			if h.TPMPublic, h.TPMPrivate, err = tpmSeal(key); err != nil {
+				return err
+			}
+		} else {
+			log.Printf("Unsealing key for %s with the TPM", k.dir)
+			if key, err = tpmUnseal(h.TPMPublic, h.TPMPrivate); err != nil {
+				return err
+			}
+		}
+		if aead, err = newAEAD(key); err != nil {
+			return err
+		}
+	} else if key == nil {
+		if k.passphraseFunc == nil {
+			return fmt.Errorf("No passphrase prompt given to unlock %s", k.dir)
+		}
+		msg := "Enter passphrase to unlock " + k.dir
+		if create {
+			msg = "Enter passphrase to create " + k.dir
+		}
+		passphrase, err := k.passphraseFunc(msg)
+		if err != nil {
+			return err
+		}
+		log.Printf("Deriving key for %s with argon2id m=%d,t=%d,p=%d", k.dir, h.Memory, h.Time, h.Threads)
+		key = h.deriveKey(passphrase)
+		derived = true
+		if aead, err = newAEAD(key); err != nil {
+			return err
+		}
+	}
+
+	if create {
+		if h.Verifier, err = seal(aead, []byte(verifier), headerFile); err != nil {
+			return err
+		}
+		b, err := json.MarshalIndent(h, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err = writeFileAtomic(filepath.Join(k.dir, headerFile), b); err != nil {
+			return err
+		}
+	} else if _, err = unseal(aead, h.Verifier, headerFile); err != nil {
+		return fmt.Errorf("Incorrect passphrase for %s", k.dir)
+	}
+
+	k.aead = aead
+	if derived {
+		k.storeAgentKey(key)
+	}
+	return nil
+}
+
+func (k *encryptedFileKeyring) agentKey() []byte {
+	if k.cfg.EncryptedFileAgentTTL <= 0 {
+		return nil
+	}
+	key, err := agentGetKey(k.dir)
+	if err != nil {
+		logging.Warnf("Failed to get key from agent: %v", err)
+	}
+	return key
+}
+
+func (k *encryptedFileKeyring) storeAgentKey(key []byte) {
+	if k.cfg.EncryptedFileAgentTTL <= 0 {
+		return
+	}
+	if err := agentSetKey(k.dir, key, k.cfg.EncryptedFileAgentTTL); err != nil {
+		logging.Warnf("Failed to give key to agent: %v", err)
+	}
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// seal encrypts data with a random nonce, bound to the name of the file it's stored in so that
+// files can't be swapped
+func seal(aead cipher.AEAD, data []byte, name string) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, data, []byte(name)), nil
+}
+
+func unseal(aead cipher.AEAD, data []byte, name string) ([]byte, error) {
+	if len(data) < aead.NonceSize() {
+		return nil, errors.New("Encrypted data is too short")
+	}
+	return aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], []byte(name))
+}
+
+func (k *encryptedFileKeyring) Get(key string) (keyring.Item, error) {
+	// the name of the file is authenticated with the data, so it can't be moved to another key's file
+	b, name, err := readItemFile(k.dir, key, "")
+	if os.IsNotExist(err) {
+		return keyring.Item{}, keyring.ErrKeyNotFound
+	} else if err != nil {
+		return keyring.Item{}, err
+	}
+
+	if err = k.unlock(); err != nil {
+		return keyring.Item{}, err
+	}
+	data, err := unseal(k.aead, b, name)
+	if err != nil {
+		return keyring.Item{}, fmt.Errorf("Failed to decrypt %s: %v", key, err)
+	}
+
+	var item keyring.Item
+	if err = json.Unmarshal(data, &item); err != nil {
+		return keyring.Item{}, err
+	}
+	return item, nil
+}
+
+func (k *encryptedFileKeyring) GetMetadata(key string) (keyring.Metadata, error) {
+	stat, err := statItemFile(k.dir, key, "")
+	if os.IsNotExist(err) {
+		return keyring.Metadata{}, keyring.ErrKeyNotFound
+	} else if err != nil {
+		return keyring.Metadata{}, err
+	}
+	return keyring.Metadata{Item: &keyring.Item{Key: key}, ModificationTime: stat.ModTime()}, nil
+}
+
+func (k *encryptedFileKeyring) Set(item keyring.Item) error {
+	if err := k.unlock(); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+	b, err := seal(k.aead, data, itemFilename(item.Key, ""))
+	if err != nil {
+		return err
+	}
+	return writeItemFile(k.dir, item.Key, "", b)
+}
+
+func (k *encryptedFileKeyring) Remove(key string) error {
+	err := removeItemFile(k.dir, key, "")
+	if os.IsNotExist(err) {
+		return keyring.ErrKeyNotFound
+	}
+	return err
+}
+
+func (k *encryptedFileKeyring) Keys() ([]string, error) {
+	return itemKeys(k.dir, "")
+}
@@ -0,0 +1,108 @@
+package backend_test
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/99designs/aws-vault/backend"
+	"github.com/99designs/keyring"
+)
+
+func openEncryptedFile(t *testing.T, dir string, passphrase string) keyring.Keyring {
+	k, err := backend.Open(backend.EncryptedFileBackend, backend.Config{
+		EncryptedFileDir:    dir,
+		EncryptedFileArgon2: "m=64,t=1,p=1",
+		PassphraseFunc: func(string) (string, error) {
+			return passphrase, nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return k
+}
+
+func TestEncryptedFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "aws-vault-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	k := openEncryptedFile(t, dir, "llamas")
+	if err = k.Set(keyring.Item{Key: "work", Data: []byte("secret")}); err != nil {
+		t.Fatal(err)
+	}
+
+	item, err := openEncryptedFile(t, dir, "llamas").Get("work")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(item.Data) != "secret" {
+		t.Fatalf("Expected the stored data, got %q", item.Data)
+	}
+
+	if _, err = openEncryptedFile(t, dir, "alpacas").Get("work"); err == nil {
+		t.Fatal("Expected an error with the wrong passphrase")
+	}
+
+	keys, err := k.Keys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 1 || keys[0] != "work" {
+		t.Fatalf("Expected the key work, got %v", keys)
+	}
+
+	if err = k.Remove("work"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = k.Get("work"); err != keyring.ErrKeyNotFound {
+		t.Fatalf("Expected ErrKeyNotFound, got %v", err)
+	}
+}
+
+func TestEncryptedFileLongKey(t *testing.T) {
+	dir, err := ioutil.TempDir("", "aws-vault-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// longer than a filename can be once encoded
+	key := "session," + strings.Repeat("YXJuOmF3czppYW06OjEyMzQ1Njc4OTAxMjpyb2xlL2FkbWlu", 5)
+	k := openEncryptedFile(t, dir, "llamas")
+	if err = k.Set(keyring.Item{Key: key, Data: []byte("secret")}); err != nil {
+		t.Fatal(err)
+	}
+
+	keys, err := k.Keys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 1 || keys[0] != key {
+		t.Fatalf("Expected the long key, got %v", keys)
+	}
+	item, err := k.Get(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(item.Data) != "secret" {
+		t.Fatalf("Expected the stored data, got %q", item.Data)
+	}
+}
+
+func TestEncryptedFileArgon2Params(t *testing.T) {
+	for _, params := range []string{"m=64", "m=64,t=0,p=1", "m=64,t=1,p=1000", "x=1", "m=4,t=1,p=1"} {
+		_, err := backend.Open(backend.EncryptedFileBackend, backend.Config{EncryptedFileDir: "/tmp", EncryptedFileArgon2: params})
+		if params == "m=64" {
+			if err != nil {
+				t.Fatalf("Expected %q to be valid, got %v", params, err)
+			}
+		} else if err == nil {
+			t.Fatalf("Expected %q to be invalid", params)
+		}
+	}
+}
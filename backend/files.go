@@ -0,0 +1,199 @@
+package backend
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// expandHome replaces a leading ~ with the user's home directory
+func expandHome(path string) (string, error) {
+	if !strings.HasPrefix(path, "~") {
+		return path, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return home + path[1:], nil
+}
+
+// itemHeader starts each item file written by the file based backends, followed by the encoded key and a
+// newline, so the key can be listed without decrypting the rest of the file
+const itemHeader = "aws-vault-item:"
+
+// itemFilename is the name of the file an item is kept in by the file based backends. Keys can be any
+// length and contain any character, so files are named by a hash of the key, and the key is kept in the file
+func itemFilename(key string, ext string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:]) + ext
+}
+
+// legacyItemFilename is the name items were kept under before, the encoded key, which is too long for
+// the filesystem for long keys. These files have no header
+func legacyItemFilename(key string, ext string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(key)) + ext
+}
+
+func isItemFilename(name string, ext string) bool {
+	name = strings.TrimSuffix(name, ext)
+	if len(name) != sha256.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(name)
+	return err == nil
+}
+
+// readItemFile reads the data of key's item file in dir, and returns the name of the file it was read
+// from. An error satisfying os.IsNotExist is returned if there isn't one
+func readItemFile(dir string, key string, ext string) ([]byte, string, error) {
+	name := itemFilename(key, ext)
+	b, err := ioutil.ReadFile(filepath.Join(dir, name))
+	if os.IsNotExist(err) {
+		name = legacyItemFilename(key, ext)
+		b, err = ioutil.ReadFile(filepath.Join(dir, name))
+		return b, name, err
+	} else if err != nil {
+		return nil, name, err
+	}
+
+	fileKey, data, err := splitItemFile(b)
+	if err != nil {
+		return nil, name, fmt.Errorf("%s: %v", name, err)
+	}
+	if fileKey != key {
+		return nil, name, fmt.Errorf("%s holds %q rather than %q", name, fileKey, key)
+	}
+	return data, name, nil
+}
+
+func splitItemFile(b []byte) (string, []byte, error) {
+	i := bytes.IndexByte(b, '\n')
+	if !bytes.HasPrefix(b, []byte(itemHeader)) || i < 0 {
+		return "", nil, errors.New("Not an aws-vault item")
+	}
+	key, err := base64.RawURLEncoding.DecodeString(string(b[len(itemHeader):i]))
+	if err != nil {
+		return "", nil, errors.New("Not an aws-vault item")
+	}
+	return string(key), b[i+1:], nil
+}
+
+// writeItemFile writes the data of key's item file in dir, replacing any file it was kept in before
+func writeItemFile(dir string, key string, ext string, data []byte) error {
+	header := itemHeader + base64.RawURLEncoding.EncodeToString([]byte(key)) + "\n"
+	if err := writeFileAtomic(filepath.Join(dir, itemFilename(key, ext)), append([]byte(header), data...)); err != nil {
+		return err
+	}
+	os.Remove(filepath.Join(dir, legacyItemFilename(key, ext)))
+	return nil
+}
+
+// statItemFile returns the FileInfo of key's item file in dir
+func statItemFile(dir string, key string, ext string) (os.FileInfo, error) {
+	stat, err := os.Stat(filepath.Join(dir, itemFilename(key, ext)))
+	if os.IsNotExist(err) {
+		return os.Stat(filepath.Join(dir, legacyItemFilename(key, ext)))
+	}
+	return stat, err
+}
+
+// removeItemFile removes key's item file from dir, returning an error satisfying os.IsNotExist if there
+// isn't one
+func removeItemFile(dir string, key string, ext string) error {
+	err := os.Remove(filepath.Join(dir, itemFilename(key, ext)))
+	legacyErr := os.Remove(filepath.Join(dir, legacyItemFilename(key, ext)))
+	if os.IsNotExist(err) {
+		return legacyErr
+	}
+	return err
+}
+
+// itemKeys returns the keys of the items in dir, skipping hidden files
+func itemKeys(dir string, ext string) ([]string, error) {
+	files, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return []string{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	keys := []string{}
+	seen := map[string]bool{}
+	for _, f := range files {
+		if strings.HasPrefix(f.Name(), ".") || !strings.HasSuffix(f.Name(), ext) {
+			continue
+		}
+
+		key, ok := itemFileKey(dir, f.Name(), ext)
+		if !ok {
+			log.Printf("Ignoring %s in %s, it isn't an item", f.Name(), dir)
+			continue
+		}
+		if !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+// itemFileKey returns the key of the item kept in the file name, from its header, or from its name for
+// files written before there were headers
+func itemFileKey(dir string, name string, ext string) (string, bool) {
+	if isItemFilename(name, ext) {
+		if line, err := readItemHeader(filepath.Join(dir, name)); err == nil {
+			if key, _, err := splitItemFile(line); err == nil {
+				return key, true
+			}
+		}
+	}
+	key, err := base64.RawURLEncoding.DecodeString(strings.TrimSuffix(name, ext))
+	if err != nil {
+		return "", false
+	}
+	return string(key), true
+}
+
+// readItemHeader reads the first line of an item file, without reading the rest
+func readItemHeader(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	line, err := bufio.NewReader(f).ReadBytes('\n')
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	return line, nil
+}
+
+// writeFileAtomic writes the file readable only by the user, replacing any existing one in a single step
+func writeFileAtomic(path string, data []byte) error {
+	f, err := ioutil.TempFile(filepath.Dir(path), ".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err = f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
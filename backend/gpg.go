@@ -0,0 +1,159 @@
+package backend
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/99designs/keyring"
+)
+
+// GPGBackend keeps each item in a file encrypted with gpg to a set of recipients. Any recipient can decrypt
+// the items with their own key, so a vault on a shared machine can be used by several people. The recipients
+// are given with --gpg-recipient, or listed in a .gpg-id file in the vault directory
+const GPGBackend = "gpg"
+
+const gpgIDFile = ".gpg-id"
+
+type gpgKeyring struct {
+	dir        string
+	recipients []string
+}
+
+func init() {
+	backends[GPGBackend] = func(cfg Config) (keyring.Keyring, error) {
+		if cfg.GPGDir == "" {
+			return nil, errors.New("No directory given for the gpg backend")
+		}
+		dir, err := expandHome(cfg.GPGDir)
+		if err != nil {
+			return nil, err
+		}
+		return &gpgKeyring{dir: dir, recipients: cfg.GPGRecipients}, nil
+	}
+}
+
+func runGPG(stdin []byte, args ...string) ([]byte, error) {
+	if _, err := exec.LookPath("gpg"); err != nil {
+		return nil, fmt.Errorf("gpg is needed to use the gpg backend: %v", err)
+	}
+
+	cmd := exec.Command("gpg", append([]string{"--quiet", "--yes"}, args...)...)
+	cmd.Stdin = bytes.NewReader(stdin)
+	// gpg-agent asks for the key's passphrase with pinentry, which may use the terminal
+	cmd.Stderr = os.Stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("gpg failed: %v", err)
+	}
+	return out, nil
+}
+
+// recipientsList returns the configured recipients, or those in the vault's .gpg-id file
+func (k *gpgKeyring) recipientsList() ([]string, error) {
+	if len(k.recipients) > 0 {
+		return k.recipients, nil
+	}
+
+	f, err := os.Open(filepath.Join(k.dir, gpgIDFile))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("No gpg recipients given to encrypt to, see --gpg-recipient or create %s", filepath.Join(k.dir, gpgIDFile))
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	recipients := []string{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			recipients = append(recipients, line)
+		}
+	}
+	if len(recipients) == 0 {
+		return nil, fmt.Errorf("No gpg recipients in %s", filepath.Join(k.dir, gpgIDFile))
+	}
+	return recipients, scanner.Err()
+}
+
+func (k *gpgKeyring) Get(key string) (keyring.Item, error) {
+	encrypted, _, err := readItemFile(k.dir, key, ".gpg")
+	if os.IsNotExist(err) {
+		return keyring.Item{}, keyring.ErrKeyNotFound
+	} else if err != nil {
+		return keyring.Item{}, err
+	}
+
+	log.Printf("Decrypting %s with gpg", key)
+	data, err := runGPG(encrypted, "--decrypt")
+	if err != nil {
+		return keyring.Item{}, err
+	}
+
+	var item keyring.Item
+	if err = json.Unmarshal(data, &item); err != nil {
+		return keyring.Item{}, err
+	}
+	return item, nil
+}
+
+func (k *gpgKeyring) GetMetadata(key string) (keyring.Metadata, error) {
+	stat, err := statItemFile(k.dir, key, ".gpg")
+	if os.IsNotExist(err) {
+		return keyring.Metadata{}, keyring.ErrKeyNotFound
+	} else if err != nil {
+		return keyring.Metadata{}, err
+	}
+	return keyring.Metadata{Item: &keyring.Item{Key: key}, ModificationTime: stat.ModTime()}, nil
+}
+
+func (k *gpgKeyring) Set(item keyring.Item) error {
+	recipients, err := k.recipientsList()
+	if err != nil {
+		return err
+	}
+	args := []string{"--batch", "--encrypt", "--no-encrypt-to"}
+	for _, r := range recipients {
+		args = append(args, "--recipient", r)
+	}
+
+	data, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+	log.Printf("Encrypting %s with gpg to %s", item.Key, strings.Join(recipients, ", "))
+	b, err := runGPG(data, args...)
+	if err != nil {
+		return err
+	}
+
+	if err = os.MkdirAll(k.dir, 0700); err != nil {
+		return err
+	}
+	if err = writeItemFile(k.dir, item.Key, ".gpg", b); err != nil {
+		return err
+	}
+	// the item can only be decrypted by the recipients, so it can be read by others sharing the vault
+	return os.Chmod(filepath.Join(k.dir, itemFilename(item.Key, ".gpg")), 0640)
+}
+
+func (k *gpgKeyring) Remove(key string) error {
+	err := removeItemFile(k.dir, key, ".gpg")
+	if os.IsNotExist(err) {
+		return keyring.ErrKeyNotFound
+	}
+	return err
+}
+
+func (k *gpgKeyring) Keys() ([]string, error) {
+	return itemKeys(k.dir, ".gpg")
+}
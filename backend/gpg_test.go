@@ -0,0 +1,153 @@
+// +build !windows
+
+package backend_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/99designs/aws-vault/backend"
+	"github.com/99designs/keyring"
+)
+
+// fakeGPG logs its arguments, "encrypts" by adding a header line and "decrypts" by removing it
+const fakeGPG = `#!/bin/sh
+echo "$@" >> "$(dirname "$0")/args"
+case "$*" in
+*--encrypt*) echo "gpg-encrypted"; cat ;;
+*--decrypt*) sed 1d ;;
+esac
+`
+
+func TestGPG(t *testing.T) {
+	dir, err := ioutil.TempDir("", "aws-vault-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer fakeCommand(t, dir, "gpg", fakeGPG)()
+
+	k, err := backend.Open(backend.GPGBackend, backend.Config{
+		GPGDir:        filepath.Join(dir, "items"),
+		GPGRecipients: []string{"alice@example.com", "bob@example.com"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = k.Set(keyring.Item{Key: "work", Data: []byte("secret")}); err != nil {
+		t.Fatal(err)
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "items", "*.gpg"))
+	if err != nil || len(files) != 1 {
+		t.Fatalf("Expected one item file, got %v, %v", files, err)
+	}
+	stat, err := os.Stat(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stat.Mode().Perm() != 0640 {
+		t.Fatalf("Expected the item file to be readable by the group, got %v", stat.Mode())
+	}
+	b, err := ioutil.ReadFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), "\ngpg-encrypted\n") {
+		t.Fatalf("Expected the item to be stored as gpg output, got %q", b)
+	}
+
+	keys, err := k.Keys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 1 || keys[0] != "work" {
+		t.Fatalf("Expected the key work, got %v", keys)
+	}
+
+	item, err := k.Get("work")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if item.Key != "work" || string(item.Data) != "secret" {
+		t.Fatalf("Expected the stored item, got %+v", item)
+	}
+	if _, err = k.Get("personal"); err != keyring.ErrKeyNotFound {
+		t.Fatalf("Expected ErrKeyNotFound, got %v", err)
+	}
+
+	if err = k.Remove("work"); err != nil {
+		t.Fatal(err)
+	}
+	if err = k.Remove("work"); err != keyring.ErrKeyNotFound {
+		t.Fatalf("Expected ErrKeyNotFound, got %v", err)
+	}
+
+	args, err := ioutil.ReadFile(filepath.Join(dir, "args"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `--quiet --yes --batch --encrypt --no-encrypt-to --recipient alice@example.com --recipient bob@example.com
+--quiet --yes --decrypt
+`
+	if string(args) != expected {
+		t.Fatalf("Expected gpg to be run with:\n%s\ngot:\n%s", expected, args)
+	}
+}
+
+func TestGPGRecipientsFromGPGID(t *testing.T) {
+	dir, err := ioutil.TempDir("", "aws-vault-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer fakeCommand(t, dir, "gpg", fakeGPG)()
+
+	itemsDir := filepath.Join(dir, "items")
+	k, err := backend.Open(backend.GPGBackend, backend.Config{GPGDir: itemsDir})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = k.Set(keyring.Item{Key: "work", Data: []byte("secret")}); err == nil {
+		t.Fatal("Expected an error without recipients or a .gpg-id file")
+	}
+
+	if err = os.MkdirAll(itemsDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(filepath.Join(itemsDir, ".gpg-id"), []byte("# nobody yet\n\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err = k.Set(keyring.Item{Key: "work", Data: []byte("secret")}); err == nil {
+		t.Fatal("Expected an error with no recipients in the .gpg-id file")
+	}
+
+	if err = ioutil.WriteFile(filepath.Join(itemsDir, ".gpg-id"), []byte("# the team\nalice@example.com\n\n  bob@example.com  \n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err = k.Set(keyring.Item{Key: "work", Data: []byte("secret")}); err != nil {
+		t.Fatal(err)
+	}
+
+	args, err := ioutil.ReadFile(filepath.Join(dir, "args"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "--quiet --yes --batch --encrypt --no-encrypt-to --recipient alice@example.com --recipient bob@example.com\n"
+	if string(args) != expected {
+		t.Fatalf("Expected gpg to be run with:\n%s\ngot:\n%s", expected, args)
+	}
+
+	// the .gpg-id file isn't an item
+	keys, err := k.Keys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 1 || keys[0] != "work" {
+		t.Fatalf("Expected the key work, got %v", keys)
+	}
+}
@@ -0,0 +1,373 @@
+package backend
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/99designs/aws-vault/logging"
+	"github.com/99designs/keyring"
+	"github.com/skratchdot/open-golang/open"
+)
+
+// HashiCorpVaultBackend keeps items in a HashiCorp Vault KV version 2 secrets engine, so long-lived
+// credentials can be kept centrally. It authenticates with a token, or by signing in with OIDC
+const HashiCorpVaultBackend = "hashicorp-vault"
+
+// hashiCorpVaultOIDCRedirect is the redirect URI the vault CLI uses, which roles usually allow
+const hashiCorpVaultOIDCRedirect = "http://localhost:8250/oidc/callback"
+
+type hashiCorpVaultKeyring struct {
+	addr      string
+	mount     string
+	path      string
+	auth      string
+	role      string
+	namespace string
+	token     string
+	client    *http.Client
+}
+
+func init() {
+	backends[HashiCorpVaultBackend] = func(cfg Config) (keyring.Keyring, error) {
+		if cfg.HashiCorpVaultAddr == "" {
+			return nil, errors.New("No HashiCorp Vault address given, set VAULT_ADDR")
+		}
+		if cfg.HashiCorpVaultAuth != "" && cfg.HashiCorpVaultAuth != "token" && cfg.HashiCorpVaultAuth != "oidc" {
+			return nil, fmt.Errorf("Unknown HashiCorp Vault auth method %q, must be token or oidc", cfg.HashiCorpVaultAuth)
+		}
+		mount := cfg.HashiCorpVaultMount
+		if mount == "" {
+			mount = "secret"
+		}
+		return &hashiCorpVaultKeyring{
+			addr:      strings.TrimSuffix(cfg.HashiCorpVaultAddr, "/"),
+			mount:     strings.Trim(mount, "/"),
+			path:      strings.Trim(cfg.HashiCorpVaultPath, "/"),
+			auth:      cfg.HashiCorpVaultAuth,
+			role:      cfg.HashiCorpVaultRole,
+			namespace: os.Getenv("VAULT_NAMESPACE"),
+			client:    &http.Client{Timeout: 30 * time.Second},
+		}, nil
+	}
+}
+
+type hashiCorpVaultError struct {
+	StatusCode int
+	Errors     []string `json:"errors"`
+}
+
+func (e *hashiCorpVaultError) Error() string {
+	if len(e.Errors) == 0 {
+		return fmt.Sprintf("HashiCorp Vault returned %d", e.StatusCode)
+	}
+	return fmt.Sprintf("HashiCorp Vault returned %d: %s", e.StatusCode, strings.Join(e.Errors, ", "))
+}
+
+func (k *hashiCorpVaultKeyring) request(method string, path string, body interface{}, token string, out interface{}) error {
+	var r *bytes.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		r = bytes.NewReader(b)
+	} else {
+		r = bytes.NewReader(nil)
+	}
+
+	req, err := http.NewRequest(method, k.addr+"/v1/"+path, r)
+	if err != nil {
+		return err
+	}
+	if token != "" {
+		req.Header.Set("X-Vault-Token", token)
+	}
+	if k.namespace != "" {
+		req.Header.Set("X-Vault-Namespace", k.namespace)
+	}
+
+	log.Printf("HashiCorp Vault %s %s", method, req.URL.Path)
+	resp, err := k.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode >= 300 {
+		e := &hashiCorpVaultError{StatusCode: resp.StatusCode}
+		json.Unmarshal(b, e)
+		return e
+	}
+	if out != nil && len(b) > 0 {
+		return json.Unmarshal(b, out)
+	}
+	return nil
+}
+
+// call makes an authenticated request, signing in again with OIDC if the token has expired
+func (k *hashiCorpVaultKeyring) call(method string, path string, body interface{}, out interface{}) error {
+	token, err := k.getToken(false)
+	if err != nil {
+		return err
+	}
+	err = k.request(method, path, body, token, out)
+	if e, ok := err.(*hashiCorpVaultError); ok && e.StatusCode == http.StatusForbidden && k.auth == "oidc" {
+		log.Printf("HashiCorp Vault token was rejected, signing in again")
+		if token, err = k.getToken(true); err != nil {
+			return err
+		}
+		err = k.request(method, path, body, token, out)
+	}
+	return err
+}
+
+// itemPath is the path of the item's secret. Keys can contain slashes, which are kept in the secret's name
+// rather than making folders, so the name is escaped once for the name and again for the URL
+func (k *hashiCorpVaultKeyring) itemPath(kind string, key string) string {
+	p := k.mount + "/" + kind
+	if k.path != "" {
+		p += "/" + k.path
+	}
+	if key != "" {
+		p += "/" + url.PathEscape(url.PathEscape(key))
+	}
+	return p
+}
+
+func (k *hashiCorpVaultKeyring) Get(key string) (keyring.Item, error) {
+	var resp struct {
+		Data struct {
+			Data struct {
+				Value       string `json:"value"`
+				Label       string `json:"label"`
+				Description string `json:"description"`
+			} `json:"data"`
+		} `json:"data"`
+	}
+	err := k.call("GET", k.itemPath("data", key), nil, &resp)
+	if e, ok := err.(*hashiCorpVaultError); ok && e.StatusCode == http.StatusNotFound {
+		return keyring.Item{}, keyring.ErrKeyNotFound
+	} else if err != nil {
+		return keyring.Item{}, err
+	}
+
+	return keyring.Item{
+		Key:         key,
+		Data:        []byte(resp.Data.Data.Value),
+		Label:       resp.Data.Data.Label,
+		Description: resp.Data.Data.Description,
+	}, nil
+}
+
+func (k *hashiCorpVaultKeyring) GetMetadata(key string) (keyring.Metadata, error) {
+	var resp struct {
+		Data struct {
+			UpdatedTime time.Time `json:"updated_time"`
+		} `json:"data"`
+	}
+	err := k.call("GET", k.itemPath("metadata", key), nil, &resp)
+	if e, ok := err.(*hashiCorpVaultError); ok && e.StatusCode == http.StatusNotFound {
+		return keyring.Metadata{}, keyring.ErrKeyNotFound
+	} else if err != nil {
+		return keyring.Metadata{}, err
+	}
+	return keyring.Metadata{Item: &keyring.Item{Key: key}, ModificationTime: resp.Data.UpdatedTime}, nil
+}
+
+func (k *hashiCorpVaultKeyring) Set(item keyring.Item) error {
+	return k.call("POST", k.itemPath("data", item.Key), map[string]interface{}{
+		"data": map[string]string{
+			"value":       string(item.Data),
+			"label":       item.Label,
+			"description": item.Description,
+		},
+	}, nil)
+}
+
+func (k *hashiCorpVaultKeyring) Remove(key string) error {
+	if _, err := k.GetMetadata(key); err != nil {
+		return err
+	}
+	// deleting the metadata removes every version of the secret
+	return k.call("DELETE", k.itemPath("metadata", key), nil, nil)
+}
+
+func (k *hashiCorpVaultKeyring) Keys() ([]string, error) {
+	var resp struct {
+		Data struct {
+			Keys []string `json:"keys"`
+		} `json:"data"`
+	}
+	err := k.call("LIST", k.itemPath("metadata", ""), nil, &resp)
+	if e, ok := err.(*hashiCorpVaultError); ok && e.StatusCode == http.StatusNotFound {
+		return []string{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	keys := []string{}
+	for _, name := range resp.Data.Keys {
+		if strings.HasSuffix(name, "/") {
+			continue
+		}
+		key, err := url.PathUnescape(name)
+		if err != nil {
+			log.Printf("Ignoring %s, it isn't an item", name)
+			continue
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// getToken returns the token to authenticate with. With token auth it's $VAULT_TOKEN or the one the vault
+// CLI saved in ~/.vault-token, with oidc it's one got by signing in with the browser, cached until it expires
+func (k *hashiCorpVaultKeyring) getToken(refresh bool) (string, error) {
+	if k.token != "" && !refresh {
+		return k.token, nil
+	}
+
+	if k.auth == "oidc" {
+		cachePath, err := k.tokenCachePath()
+		if err != nil {
+			return "", err
+		}
+		if b, err := ioutil.ReadFile(cachePath); err == nil && !refresh {
+			k.token = strings.TrimSpace(string(b))
+			return k.token, nil
+		}
+		if k.token, err = k.oidcLogin(); err != nil {
+			return "", err
+		}
+		if err = ioutil.WriteFile(cachePath, []byte(k.token), 0600); err != nil {
+			logging.Warnf("Failed to cache HashiCorp Vault token: %v", err)
+		}
+		return k.token, nil
+	}
+
+	if token := os.Getenv("VAULT_TOKEN"); token != "" {
+		k.token = token
+		return k.token, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	b, err := ioutil.ReadFile(filepath.Join(home, ".vault-token"))
+	if err != nil {
+		return "", errors.New("No HashiCorp Vault token, set VAULT_TOKEN or sign in with vault login")
+	}
+	k.token = strings.TrimSpace(string(b))
+	return k.token, nil
+}
+
+func (k *hashiCorpVaultKeyring) tokenCachePath() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	dir = filepath.Join(dir, "aws-vault")
+	if err = os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(k.addr + "\n" + k.namespace + "\n" + k.role))
+	return filepath.Join(dir, "hashicorp-vault-token-"+hex.EncodeToString(sum[:8])), nil
+}
+
+// oidcLogin signs in with the oidc auth method, like vault login -method=oidc
+func (k *hashiCorpVaultKeyring) oidcLogin() (string, error) {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	clientNonce := hex.EncodeToString(nonce)
+
+	var authURL struct {
+		Data struct {
+			AuthURL string `json:"auth_url"`
+		} `json:"data"`
+	}
+	err := k.request("POST", "auth/oidc/oidc/auth_url", map[string]string{
+		"role":         k.role,
+		"redirect_uri": hashiCorpVaultOIDCRedirect,
+		"client_nonce": clientNonce,
+	}, "", &authURL)
+	if err != nil {
+		return "", err
+	}
+	if authURL.Data.AuthURL == "" {
+		return "", fmt.Errorf("HashiCorp Vault didn't return an OIDC sign in URL, check that %s is an allowed redirect URI of the role", hashiCorpVaultOIDCRedirect)
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:8250")
+	if err != nil {
+		return "", err
+	}
+	defer l.Close()
+
+	type result struct {
+		token string
+		err   error
+	}
+	results := make(chan result, 1)
+	go http.Serve(l, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/oidc/callback" {
+			http.NotFound(w, r)
+			return
+		}
+		var callback struct {
+			Auth struct {
+				ClientToken string `json:"client_token"`
+			} `json:"auth"`
+		}
+		q := r.URL.Query()
+		err := k.request("GET", "auth/oidc/oidc/callback?"+url.Values{
+			"state":        {q.Get("state")},
+			"code":         {q.Get("code")},
+			"id_token":     {q.Get("id_token")},
+			"client_nonce": {clientNonce},
+		}.Encode(), nil, "", &callback)
+		if err == nil && callback.Auth.ClientToken == "" {
+			err = errors.New("HashiCorp Vault didn't return a token")
+		}
+		if err != nil {
+			fmt.Fprintf(w, "Signing in to HashiCorp Vault failed: %v", err)
+		} else {
+			fmt.Fprint(w, "Signed in to HashiCorp Vault, you can close this window")
+		}
+		select {
+		case results <- result{callback.Auth.ClientToken, err}:
+		default:
+		}
+	}))
+
+	fmt.Fprintf(os.Stderr, "Complete the sign in to HashiCorp Vault in your browser, or open %s\n", authURL.Data.AuthURL)
+	if err = open.Run(authURL.Data.AuthURL); err != nil {
+		logging.Warnf("Failed to open browser: %v", err)
+	}
+
+	select {
+	case r := <-results:
+		return r.token, r.err
+	case <-time.After(2 * time.Minute):
+		return "", errors.New("Timed out waiting for the HashiCorp Vault sign in")
+	}
+}
@@ -0,0 +1,100 @@
+package backend_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/99designs/aws-vault/backend"
+	"github.com/99designs/keyring"
+)
+
+// kvServer is a minimal KV version 2 secrets engine mounted at secret/
+func kvServer(t *testing.T) *httptest.Server {
+	secrets := map[string]map[string]interface{}{}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "s.llamas" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		path := r.URL.Path
+		switch {
+		case r.Method == "LIST":
+			var keys []string
+			for name := range secrets {
+				keys = append(keys, strings.TrimPrefix(name, strings.TrimPrefix(path, "/v1/secret/metadata/")+"/"))
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{"keys": keys}})
+		case r.Method == "POST" && strings.HasPrefix(path, "/v1/secret/data/"):
+			var body struct {
+				Data map[string]interface{} `json:"data"`
+			}
+			json.NewDecoder(r.Body).Decode(&body)
+			secrets[strings.TrimPrefix(path, "/v1/secret/data/")] = body.Data
+		case r.Method == "GET" && strings.HasPrefix(path, "/v1/secret/data/"):
+			data, ok := secrets[strings.TrimPrefix(path, "/v1/secret/data/")]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{"data": data}})
+		case r.Method == "GET" && strings.HasPrefix(path, "/v1/secret/metadata/"):
+			if _, ok := secrets[strings.TrimPrefix(path, "/v1/secret/metadata/")]; !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{}})
+		case r.Method == "DELETE" && strings.HasPrefix(path, "/v1/secret/metadata/"):
+			delete(secrets, strings.TrimPrefix(path, "/v1/secret/metadata/"))
+		default:
+			t.Fatalf("Unexpected request %s %s", r.Method, path)
+		}
+	}))
+}
+
+func TestHashiCorpVault(t *testing.T) {
+	server := kvServer(t)
+	defer server.Close()
+
+	os.Setenv("VAULT_TOKEN", "s.llamas")
+	defer os.Unsetenv("VAULT_TOKEN")
+
+	k, err := backend.Open(backend.HashiCorpVaultBackend, backend.Config{
+		HashiCorpVaultAddr: server.URL,
+		HashiCorpVaultPath: "aws-vault",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key := "totp,arn:aws:iam::123456789012:mfa/jonsmith"
+	if err = k.Set(keyring.Item{Key: key, Data: []byte("secret")}); err != nil {
+		t.Fatal(err)
+	}
+
+	item, err := k.Get(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(item.Data) != "secret" {
+		t.Fatalf("Expected the stored data, got %q", item.Data)
+	}
+
+	keys, err := k.Keys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 1 || keys[0] != key {
+		t.Fatalf("Expected the key %s, got %v", key, keys)
+	}
+
+	if err = k.Remove(key); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = k.Get(key); err != keyring.ErrKeyNotFound {
+		t.Fatalf("Expected ErrKeyNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,262 @@
+package backend
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/99designs/keyring"
+)
+
+const integrityVerifier = "aws-vault integrity"
+
+// integrityIndex holds the HMAC of each item, with a key derived from the passphrase the same way as
+// the encrypted-file backend's
+type integrityIndex struct {
+	header
+	MACs map[string][]byte `json:"macs"`
+}
+
+// integrityKeyring checks the items of the file backend against an HMAC kept in an index beside its
+// directory, so an item that's corrupt or has been replaced is reported rather than used
+type integrityKeyring struct {
+	keyring    keyring.Keyring
+	path       string
+	prompt     keyring.PromptFunc
+	passphrase string
+	key        []byte
+}
+
+// WithIntegrity opens the file backend in dir with open, giving it a prompt that remembers the
+// passphrase so the HMAC key is derived from the same one
+func WithIntegrity(dir string, prompt keyring.PromptFunc, open func(keyring.PromptFunc) (keyring.Keyring, error)) (keyring.Keyring, error) {
+	return withIntegrity(dir, prompt, open)
+}
+
+func withIntegrity(dir string, prompt keyring.PromptFunc, open func(keyring.PromptFunc) (keyring.Keyring, error)) (*integrityKeyring, error) {
+	dir, err := expandHome(dir)
+	if err != nil {
+		return nil, err
+	}
+	k := &integrityKeyring{
+		path:   filepath.Clean(dir) + ".integrity",
+		prompt: prompt,
+	}
+	if k.keyring, err = open(k.ask); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// AddToIntegrityIndex adds the HMAC of each item of the file backend in dir that isn't in its integrity
+// index, creating the index if there isn't one, and returns how many were added. It's how stores from
+// before the index was kept are migrated, so it's only to be used once the items are known to be the
+// user's own. Items whose HMAC doesn't match are left alone
+func AddToIntegrityIndex(dir string, prompt keyring.PromptFunc, open func(keyring.PromptFunc) (keyring.Keyring, error)) (int, error) {
+	k, err := withIntegrity(dir, prompt, open)
+	if err != nil {
+		return 0, err
+	}
+	idx, _, err := k.load()
+	if err != nil {
+		return 0, err
+	}
+	if err = k.unlock(&idx); err != nil {
+		return 0, err
+	}
+
+	keys, err := k.keyring.Keys()
+	if err != nil {
+		return 0, err
+	}
+	added := 0
+	for _, key := range keys {
+		if _, ok := idx.MACs[key]; ok {
+			continue
+		}
+		item, err := k.keyring.Get(key)
+		if err != nil {
+			return added, err
+		}
+		if idx.MACs[key], err = k.itemMAC(item); err != nil {
+			return added, err
+		}
+		added++
+	}
+	return added, k.save(idx)
+}
+
+func (k *integrityKeyring) ask(prompt string) (string, error) {
+	passphrase, err := k.prompt(prompt)
+	if err == nil {
+		k.passphrase = passphrase
+	}
+	return passphrase, err
+}
+
+// load reads the index, or returns a new one if there isn't one, in which case exists is false
+func (k *integrityKeyring) load() (idx integrityIndex, exists bool, err error) {
+	b, err := ioutil.ReadFile(k.path)
+	if os.IsNotExist(err) {
+		idx.header, err = parseArgon2Params(DefaultArgon2Params)
+		if err != nil {
+			return idx, false, err
+		}
+		idx.Salt = make([]byte, 16)
+		if _, err = rand.Read(idx.Salt); err != nil {
+			return idx, false, err
+		}
+		idx.MACs = map[string][]byte{}
+		return idx, false, nil
+	} else if err != nil {
+		return idx, false, err
+	}
+	if err = json.Unmarshal(b, &idx); err != nil {
+		return idx, true, fmt.Errorf("Invalid integrity index %s: %v", k.path, err)
+	}
+	if idx.MACs == nil {
+		idx.MACs = map[string][]byte{}
+	}
+	return idx, true, nil
+}
+
+// unindexedError is returned for a store that has items but no index, which is either from before the
+// index was kept or has had its index removed, so none of its items can be trusted
+func (k *integrityKeyring) unindexedError() error {
+	return fmt.Errorf("The file backend has no integrity index %s, so its items can't be checked. If it was created "+
+		"by an older aws-vault and its items are yours, add them to the index with aws-vault migrate --add-integrity", k.path)
+}
+
+func (k *integrityKeyring) save(idx integrityIndex) error {
+	b, err := json.MarshalIndent(idx, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(k.path, b)
+}
+
+// unlock derives the HMAC key, asking for the passphrase if the file backend hasn't already
+func (k *integrityKeyring) unlock(idx *integrityIndex) error {
+	if k.key != nil {
+		return nil
+	}
+	if k.passphrase == "" {
+		if _, err := k.ask("Enter passphrase to unlock " + filepath.Dir(k.path)); err != nil {
+			return err
+		}
+	}
+
+	log.Printf("Deriving integrity key with argon2id m=%d,t=%d,p=%d", idx.Memory, idx.Time, idx.Threads)
+	key := idx.deriveKey(k.passphrase)
+	verifier := mac(key, []byte(integrityVerifier))
+	if idx.Verifier == nil {
+		idx.Verifier = verifier
+	} else if !hmac.Equal(idx.Verifier, verifier) {
+		return fmt.Errorf("Incorrect passphrase for the integrity index %s", k.path)
+	}
+	k.key = key
+	return nil
+}
+
+func mac(key []byte, data []byte) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+func (k *integrityKeyring) itemMAC(item keyring.Item) ([]byte, error) {
+	b, err := json.Marshal(item)
+	if err != nil {
+		return nil, err
+	}
+	return mac(k.key, b), nil
+}
+
+func (k *integrityKeyring) Get(key string) (keyring.Item, error) {
+	item, err := k.keyring.Get(key)
+	if err != nil {
+		return item, err
+	}
+
+	idx, exists, err := k.load()
+	if err != nil {
+		return keyring.Item{}, err
+	}
+	if !exists {
+		return keyring.Item{}, k.unindexedError()
+	}
+	if err = k.unlock(&idx); err != nil {
+		return keyring.Item{}, err
+	}
+	sum, err := k.itemMAC(item)
+	if err != nil {
+		return keyring.Item{}, err
+	}
+
+	expected, ok := idx.MACs[key]
+	if !ok {
+		return keyring.Item{}, fmt.Errorf("%s has no HMAC in the integrity index, so it wasn't stored by aws-vault", key)
+	}
+	if !hmac.Equal(expected, sum) {
+		return keyring.Item{}, fmt.Errorf("Integrity check of %s failed, it's corrupt or was changed outside aws-vault", key)
+	}
+	return item, nil
+}
+
+func (k *integrityKeyring) GetMetadata(key string) (keyring.Metadata, error) {
+	return k.keyring.GetMetadata(key)
+}
+
+func (k *integrityKeyring) Set(item keyring.Item) error {
+	idx, exists, err := k.load()
+	if err != nil {
+		return err
+	}
+	// the index is started by the first item of a new store, an older store has to be migrated first
+	if !exists {
+		keys, err := k.keyring.Keys()
+		if err != nil {
+			return err
+		}
+		if len(keys) > 0 {
+			return k.unindexedError()
+		}
+	}
+	if err = k.keyring.Set(item); err != nil {
+		return err
+	}
+
+	if err = k.unlock(&idx); err != nil {
+		return err
+	}
+	if idx.MACs[item.Key], err = k.itemMAC(item); err != nil {
+		return err
+	}
+	return k.save(idx)
+}
+
+func (k *integrityKeyring) Remove(key string) error {
+	if err := k.keyring.Remove(key); err != nil {
+		return err
+	}
+
+	idx, exists, err := k.load()
+	if err != nil {
+		return err
+	}
+	if _, ok := idx.MACs[key]; !exists || !ok {
+		return nil
+	}
+	delete(idx.MACs, key)
+	return k.save(idx)
+}
+
+func (k *integrityKeyring) Keys() ([]string, error) {
+	return k.keyring.Keys()
+}
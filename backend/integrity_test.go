@@ -0,0 +1,130 @@
+package backend_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/99designs/aws-vault/backend"
+	"github.com/99designs/keyring"
+)
+
+func TestIntegrity(t *testing.T) {
+	dir, err := ioutil.TempDir("", "aws-vault-integrity")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	prompts := 0
+	prompt := func(string) (string, error) {
+		prompts++
+		return "passphrase", nil
+	}
+	files := keyring.NewArrayKeyring(nil)
+	open := func(keyring.PromptFunc) (keyring.Keyring, error) {
+		return files, nil
+	}
+
+	k, err := backend.WithIntegrity(filepath.Join(dir, "keys"), prompt, open)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = k.Set(keyring.Item{Key: "work", Data: []byte("secret")}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(filepath.Join(dir, "keys.integrity")); err != nil {
+		t.Fatalf("Expected the index beside the directory: %v", err)
+	}
+
+	k, err = backend.WithIntegrity(filepath.Join(dir, "keys"), prompt, open)
+	if err != nil {
+		t.Fatal(err)
+	}
+	item, err := k.Get("work")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(item.Data) != "secret" {
+		t.Fatalf("Expected the item's data, got %s", item.Data)
+	}
+	if prompts != 2 {
+		t.Fatalf("Expected the passphrase to be asked for once per open, got %d prompts", prompts)
+	}
+
+	// an item changed without going through the index is rejected
+	if err = files.Set(keyring.Item{Key: "work", Data: []byte("tampered")}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = k.Get("work"); err == nil {
+		t.Fatal("Expected the changed item to fail its integrity check")
+	}
+
+	// so is an item added without going through the index
+	if err = files.Set(keyring.Item{Key: "added", Data: []byte("unknown")}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = k.Get("added"); err == nil {
+		t.Fatal("Expected an item with no HMAC to fail its integrity check")
+	}
+	if err = files.Remove("added"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = k.Remove("work"); err != nil {
+		t.Fatal(err)
+	}
+	if err = k.Set(keyring.Item{Key: "work", Data: []byte("again")}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = k.Get("work"); err != nil {
+		t.Fatal(err)
+	}
+
+	wrong := func(string) (string, error) { return "wrong", nil }
+	k, err = backend.WithIntegrity(filepath.Join(dir, "keys"), wrong, open)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = k.Get("work"); err == nil {
+		t.Fatal("Expected an error for the wrong passphrase")
+	}
+}
+
+func TestIntegrityOfOlderStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "aws-vault-integrity")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	prompt := func(string) (string, error) { return "passphrase", nil }
+	files := keyring.NewArrayKeyring([]keyring.Item{{Key: "work", Data: []byte("secret")}})
+	open := func(keyring.PromptFunc) (keyring.Keyring, error) {
+		return files, nil
+	}
+
+	// a store without an index isn't trusted, whether it's from an older version or the index was removed
+	k, err := backend.WithIntegrity(filepath.Join(dir, "keys"), prompt, open)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = k.Get("work"); err == nil {
+		t.Fatal("Expected an item without an index to fail its integrity check")
+	}
+	if err = k.Set(keyring.Item{Key: "other", Data: []byte("secret")}); err == nil {
+		t.Fatal("Expected items not to be added to a store without an index")
+	}
+
+	added, err := backend.AddToIntegrityIndex(filepath.Join(dir, "keys"), prompt, open)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if added != 1 {
+		t.Fatalf("Expected 1 item to be added to the index, got %d", added)
+	}
+	if _, err = k.Get("work"); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,51 @@
+package backend
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/99designs/keyring"
+)
+
+// MemoryBackend keeps items in memory, so nothing is read from or left on the machine. It starts with the
+// items in Config.MemoryItems, and anything stored is gone when aws-vault exits. It's for tests and
+// short lived CI jobs
+const MemoryBackend = "memory"
+
+func init() {
+	backends[MemoryBackend] = func(cfg Config) (keyring.Keyring, error) {
+		items, err := parseMemoryItems(cfg.MemoryItems)
+		if err != nil {
+			return nil, err
+		}
+		return keyring.NewArrayKeyring(items), nil
+	}
+}
+
+// parseMemoryItems parses a JSON object of keys and the data stored for them. Data given as a JSON string
+// is stored as the string, e.g. a TOTP secret keyed by vault.TotpKey of its MFA serial, anything else as
+// its JSON, e.g. credentials:
+//
+//	{"ci": {"AccessKeyID": "AKIA...", "SecretAccessKey": "..."},
+//	 "totp,YXJuOmF3czppYW06OjEyMzQ1Njc4OTAxMjptZmEvY2k": "JBSWY3DPEHPK3PXP"}
+func parseMemoryItems(s string) ([]keyring.Item, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	var values map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(s), &values); err != nil {
+		return nil, fmt.Errorf("Invalid items for the memory backend, expected a JSON object: %v", err)
+	}
+
+	items := []keyring.Item{}
+	for key, value := range values {
+		data := []byte(value)
+		var str string
+		if err := json.Unmarshal(value, &str); err == nil {
+			data = []byte(str)
+		}
+		items = append(items, keyring.Item{Key: key, Data: data})
+	}
+	return items, nil
+}
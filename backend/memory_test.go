@@ -0,0 +1,36 @@
+package backend_test
+
+import (
+	"testing"
+
+	"github.com/99designs/aws-vault/backend"
+)
+
+func TestMemory(t *testing.T) {
+	k, err := backend.Open(backend.MemoryBackend, backend.Config{
+		MemoryItems: `{"ci": {"AccessKeyID": "ABC", "SecretAccessKey": "XYZ"}, "totp,ci": "JBSWY3DPEHPK3PXP"}`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	item, err := k.Get("ci")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(item.Data) != `{"AccessKeyID": "ABC", "SecretAccessKey": "XYZ"}` {
+		t.Fatalf("Expected the credentials JSON, got %s", item.Data)
+	}
+
+	item, err = k.Get("totp,ci")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(item.Data) != "JBSWY3DPEHPK3PXP" {
+		t.Fatalf("Expected the TOTP secret, got %s", item.Data)
+	}
+
+	if _, err = backend.Open(backend.MemoryBackend, backend.Config{MemoryItems: `[]`}); err == nil {
+		t.Fatal("Expected an error for items that aren't a JSON object")
+	}
+}
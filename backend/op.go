@@ -0,0 +1,201 @@
+package backend
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os/exec"
+	"strings"
+
+	"github.com/99designs/keyring"
+)
+
+// OpBackend keeps items in a 1Password vault with the op CLI, as API credential items tagged aws-vault and
+// titled with the item's key. op talks to a Connect server instead of the 1Password app when
+// OP_CONNECT_HOST and OP_CONNECT_TOKEN are set
+const OpBackend = "op"
+
+const (
+	opTag   = "aws-vault"
+	opField = "credential"
+)
+
+type opKeyring struct {
+	vault string
+	ids   map[string]string
+}
+
+type opItem struct {
+	ID    string `json:"id"`
+	Title string `json:"title"`
+}
+
+func init() {
+	backends[OpBackend] = func(cfg Config) (keyring.Keyring, error) {
+		if cfg.OpVault == "" {
+			return nil, errors.New("No 1Password vault given for the op backend, see --op-vault")
+		}
+		return &opKeyring{vault: cfg.OpVault}, nil
+	}
+}
+
+func (k *opKeyring) op(args ...string) ([]byte, error) {
+	return k.opWithInput(nil, args...)
+}
+
+// opWithInput runs op with input on its stdin, which is how secrets are given to it
+func (k *opKeyring) opWithInput(input []byte, args ...string) ([]byte, error) {
+	if _, err := exec.LookPath("op"); err != nil {
+		return nil, fmt.Errorf("The 1Password CLI op is needed to use the op backend: %v", err)
+	}
+	log.Printf("Running op %s", strings.Join(args, " "))
+
+	cmd := exec.Command("op", append(args, "--vault", k.vault)...)
+	if input != nil {
+		cmd.Stdin = bytes.NewReader(input)
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("op failed: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
+
+// itemIDs returns the ids of the aws-vault items in the vault by title, titles can contain characters
+// that op doesn't accept in references so items are accessed by id
+func (k *opKeyring) itemIDs() (map[string]string, error) {
+	if k.ids != nil {
+		return k.ids, nil
+	}
+
+	out, err := k.op("item", "list", "--tags", opTag, "--format", "json")
+	if err != nil {
+		return nil, err
+	}
+	var items []opItem
+	if err = json.Unmarshal(out, &items); err != nil {
+		return nil, fmt.Errorf("Unexpected output from op item list: %v", err)
+	}
+
+	k.ids = map[string]string{}
+	for _, item := range items {
+		k.ids[item.Title] = item.ID
+	}
+	return k.ids, nil
+}
+
+func (k *opKeyring) itemID(key string) (string, error) {
+	ids, err := k.itemIDs()
+	if err != nil {
+		return "", err
+	}
+	id, ok := ids[key]
+	if !ok {
+		return "", keyring.ErrKeyNotFound
+	}
+	return id, nil
+}
+
+func (k *opKeyring) Get(key string) (keyring.Item, error) {
+	id, err := k.itemID(key)
+	if err != nil {
+		return keyring.Item{}, err
+	}
+
+	out, err := k.op("item", "get", id, "--fields", "label="+opField, "--format", "json", "--reveal")
+	if err != nil {
+		return keyring.Item{}, err
+	}
+	var field struct {
+		Value string `json:"value"`
+	}
+	if err = json.Unmarshal(out, &field); err != nil {
+		return keyring.Item{}, fmt.Errorf("Unexpected output from op item get: %v", err)
+	}
+
+	var item keyring.Item
+	if err = json.Unmarshal([]byte(field.Value), &item); err != nil {
+		return keyring.Item{}, err
+	}
+	return item, nil
+}
+
+func (k *opKeyring) GetMetadata(key string) (keyring.Metadata, error) {
+	if _, err := k.itemID(key); err != nil {
+		return keyring.Metadata{}, err
+	}
+	return keyring.Metadata{Item: &keyring.Item{Key: key}}, nil
+}
+
+func (k *opKeyring) Set(item keyring.Item) error {
+	data, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+
+	// the item is created from a template piped to op, so the credentials aren't in op's arguments or a file
+	template, err := json.Marshal(map[string]interface{}{
+		"title":    item.Key,
+		"category": "API_CREDENTIAL",
+		"tags":     []string{opTag},
+		"fields": []map[string]string{
+			{"id": opField, "label": opField, "type": "CONCEALED", "value": string(data)},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	// op has no way to replace a field without passing its value as an argument, so a new item is created
+	// and then the old one is removed
+	oldID, err := k.itemID(item.Key)
+	if err != nil && err != keyring.ErrKeyNotFound {
+		return err
+	}
+	out, err := k.opWithInput(template, "item", "create", "--format", "json")
+	if err != nil {
+		return err
+	}
+	if oldID != "" {
+		if _, err = k.op("item", "delete", oldID); err != nil {
+			return err
+		}
+	}
+
+	var created opItem
+	if err = json.Unmarshal(out, &created); err == nil && k.ids != nil {
+		k.ids[item.Key] = created.ID
+	} else {
+		k.ids = nil
+	}
+	return nil
+}
+
+func (k *opKeyring) Remove(key string) error {
+	id, err := k.itemID(key)
+	if err != nil {
+		return err
+	}
+	if _, err = k.op("item", "delete", id); err != nil {
+		return err
+	}
+	delete(k.ids, key)
+	return nil
+}
+
+func (k *opKeyring) Keys() ([]string, error) {
+	ids, err := k.itemIDs()
+	if err != nil {
+		return nil, err
+	}
+	keys := []string{}
+	for key := range ids {
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
@@ -0,0 +1,136 @@
+// +build !windows
+
+package backend_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/99designs/aws-vault/backend"
+	"github.com/99designs/keyring"
+)
+
+// fakeOp holds one item, work, logs its arguments and keeps the template piped to item create
+const fakeOp = `#!/bin/sh
+echo "$@" >> "$(dirname "$0")/args"
+case "$1 $2" in
+"item list") echo '[{"id":"abc123","title":"work"}]' ;;
+"item get") echo '{"id":"credential","label":"credential","value":"{\"Key\":\"work\",\"Data\":\"c2VjcmV0\"}"}' ;;
+"item create") cat > "$(dirname "$0")/template"; echo '{"id":"def456","title":"work"}' ;;
+"item delete") ;;
+*) echo "unknown command" >&2; exit 1 ;;
+esac
+`
+
+func TestOp(t *testing.T) {
+	dir, err := ioutil.TempDir("", "aws-vault-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer fakeCommand(t, dir, "op", fakeOp)()
+
+	k, err := backend.Open(backend.OpBackend, backend.Config{OpVault: "Private"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keys, err := k.Keys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 1 || keys[0] != "work" {
+		t.Fatalf("Expected the key work, got %v", keys)
+	}
+
+	item, err := k.Get("work")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if item.Key != "work" || string(item.Data) != "secret" {
+		t.Fatalf("Expected the stored item, got %+v", item)
+	}
+	if _, err = k.Get("personal"); err != keyring.ErrKeyNotFound {
+		t.Fatalf("Expected ErrKeyNotFound, got %v", err)
+	}
+
+	// the item is replaced by a new one, which is then the one removed
+	if err = k.Set(keyring.Item{Key: "work", Data: []byte("new-secret")}); err != nil {
+		t.Fatal(err)
+	}
+	if err = k.Remove("work"); err != nil {
+		t.Fatal(err)
+	}
+	if err = k.Remove("work"); err != keyring.ErrKeyNotFound {
+		t.Fatalf("Expected ErrKeyNotFound, got %v", err)
+	}
+
+	args, err := ioutil.ReadFile(filepath.Join(dir, "args"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `item list --tags aws-vault --format json --vault Private
+item get abc123 --fields label=credential --format json --reveal --vault Private
+item create --format json --vault Private
+item delete abc123 --vault Private
+item delete def456 --vault Private
+`
+	if string(args) != expected {
+		t.Fatalf("Expected op to be run with:\n%s\ngot:\n%s", expected, args)
+	}
+
+	b, err := ioutil.ReadFile(filepath.Join(dir, "template"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var template struct {
+		Title    string
+		Category string
+		Tags     []string
+		Fields   []struct {
+			ID    string
+			Type  string
+			Value string
+		}
+	}
+	if err = json.Unmarshal(b, &template); err != nil {
+		t.Fatal(err)
+	}
+	if template.Title != "work" || template.Category != "API_CREDENTIAL" || len(template.Tags) != 1 || template.Tags[0] != "aws-vault" {
+		t.Fatalf("Unexpected item template %s", b)
+	}
+	if len(template.Fields) != 1 || template.Fields[0].ID != "credential" || template.Fields[0].Type != "CONCEALED" {
+		t.Fatalf("Expected a concealed credential field, got %s", b)
+	}
+	if err = json.Unmarshal([]byte(template.Fields[0].Value), &item); err != nil {
+		t.Fatal(err)
+	}
+	if string(item.Data) != "new-secret" {
+		t.Fatalf("Expected the new item in the template, got %+v", item)
+	}
+}
+
+func TestOpFailure(t *testing.T) {
+	dir, err := ioutil.TempDir("", "aws-vault-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer fakeCommand(t, dir, "op", "#!/bin/sh\necho 'You are not currently signed in.' >&2\nexit 1\n")()
+
+	k, err := backend.Open(backend.OpBackend, backend.Config{OpVault: "Private"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = k.Keys(); err == nil || !strings.Contains(err.Error(), "You are not currently signed in.") {
+		t.Fatalf("Expected op's error output in the error, got %v", err)
+	}
+
+	if _, err = backend.Open(backend.OpBackend, backend.Config{}); err == nil {
+		t.Fatal("Expected an error without a vault")
+	}
+}
@@ -0,0 +1,175 @@
+package backend
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/99designs/aws-vault/logging"
+	"github.com/99designs/keyring"
+)
+
+// PluginPrefix is the prefix of the executables on PATH that are backend plugins. aws-vault-backend-NAME
+// is used with --backend=NAME
+const PluginPrefix = "aws-vault-backend-"
+
+// PluginRequest is written to a plugin's stdin, it's run with the operation as its argument too
+type PluginRequest struct {
+	// Op is get, set, remove or keys
+	Op   string      `json:"op"`
+	Key  string      `json:"key,omitempty"`
+	Item *PluginItem `json:"item,omitempty"`
+}
+
+// PluginItem is a stored item, Data is base64 encoded in JSON
+type PluginItem struct {
+	Key         string `json:"key"`
+	Data        []byte `json:"data"`
+	Label       string `json:"label,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+// PluginResponse is read from a plugin's stdout. A plugin that fails writes Error, or a message to
+// stderr and exits non-zero. A get or remove of a key that doesn't exist sets NotFound
+type PluginResponse struct {
+	Item     *PluginItem `json:"item,omitempty"`
+	Keys     []string    `json:"keys,omitempty"`
+	NotFound bool        `json:"not_found,omitempty"`
+	Error    string      `json:"error,omitempty"`
+}
+
+// plugins returns the backend plugins on PATH by name, the first found with a name wins. Plugins can't
+// replace built in backends
+func plugins() map[string]string {
+	found := map[string]string{}
+	for _, dir := range filepath.SplitList(os.Getenv("PATH")) {
+		files, err := ioutil.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, f := range files {
+			name := f.Name()
+			if !strings.HasPrefix(name, PluginPrefix) || f.IsDir() {
+				continue
+			}
+			if runtime.GOOS == "windows" {
+				ext := strings.ToLower(filepath.Ext(name))
+				if ext != ".exe" && ext != ".bat" && ext != ".cmd" {
+					continue
+				}
+				name = strings.TrimSuffix(name, filepath.Ext(name))
+			} else if f.Mode()&0111 == 0 {
+				continue
+			}
+			name = strings.TrimPrefix(name, PluginPrefix)
+			if isBuiltin(name) {
+				logging.Warnf("Ignoring backend plugin %s, it has the name of a built in backend", f.Name())
+				continue
+			}
+			if _, ok := found[name]; !ok && name != "" {
+				found[name] = filepath.Join(dir, f.Name())
+			}
+		}
+	}
+	return found
+}
+
+func isBuiltin(name string) bool {
+	if _, ok := backends[name]; ok {
+		return true
+	}
+	for _, t := range []keyring.BackendType{keyring.SecretServiceBackend, keyring.KeychainBackend,
+		keyring.KWalletBackend, keyring.WinCredBackend, keyring.FileBackend, keyring.PassBackend} {
+		if name == string(t) {
+			return true
+		}
+	}
+	return false
+}
+
+type pluginKeyring struct {
+	path string
+}
+
+func (k *pluginKeyring) call(req PluginRequest) (PluginResponse, error) {
+	var resp PluginResponse
+	b, err := json.Marshal(req)
+	if err != nil {
+		return resp, err
+	}
+
+	log.Printf("Running backend plugin %s %s", k.path, req.Op)
+	cmd := exec.Command(k.path, req.Op)
+	cmd.Stdin = bytes.NewReader(b)
+	// plugins can prompt, e.g. to unlock
+	cmd.Stderr = os.Stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		return resp, fmt.Errorf("Backend plugin %s failed: %v", filepath.Base(k.path), err)
+	}
+	if err = json.Unmarshal(out, &resp); err != nil {
+		return resp, fmt.Errorf("Backend plugin %s returned invalid JSON: %v", filepath.Base(k.path), err)
+	}
+	if resp.Error != "" {
+		return resp, errors.New(resp.Error)
+	}
+	if resp.NotFound {
+		return resp, keyring.ErrKeyNotFound
+	}
+	return resp, nil
+}
+
+func (k *pluginKeyring) Get(key string) (keyring.Item, error) {
+	resp, err := k.call(PluginRequest{Op: "get", Key: key})
+	if err != nil {
+		return keyring.Item{}, err
+	}
+	if resp.Item == nil {
+		return keyring.Item{}, fmt.Errorf("Backend plugin %s returned no item for %s", filepath.Base(k.path), key)
+	}
+	return keyring.Item{
+		Key:         key,
+		Data:        resp.Item.Data,
+		Label:       resp.Item.Label,
+		Description: resp.Item.Description,
+	}, nil
+}
+
+func (k *pluginKeyring) GetMetadata(key string) (keyring.Metadata, error) {
+	return keyring.Metadata{}, keyring.ErrMetadataNeedsCredentials
+}
+
+func (k *pluginKeyring) Set(item keyring.Item) error {
+	_, err := k.call(PluginRequest{Op: "set", Key: item.Key, Item: &PluginItem{
+		Key:         item.Key,
+		Data:        item.Data,
+		Label:       item.Label,
+		Description: item.Description,
+	}})
+	return err
+}
+
+func (k *pluginKeyring) Remove(key string) error {
+	_, err := k.call(PluginRequest{Op: "remove", Key: key})
+	return err
+}
+
+func (k *pluginKeyring) Keys() ([]string, error) {
+	resp, err := k.call(PluginRequest{Op: "keys"})
+	if err != nil {
+		return nil, err
+	}
+	if resp.Keys == nil {
+		return []string{}, nil
+	}
+	return resp.Keys, nil
+}
@@ -0,0 +1,92 @@
+// +build !windows
+
+package backend_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/99designs/aws-vault/backend"
+	"github.com/99designs/keyring"
+)
+
+// llamasPlugin holds one item, work, and logs the requests it gets
+const llamasPlugin = `#!/bin/sh
+cat >> "$(dirname "$0")/requests"
+echo >> "$(dirname "$0")/requests"
+case "$1" in
+keys) echo '{"keys":["work"]}' ;;
+get) echo '{"item":{"key":"work","data":"c2VjcmV0"}}' ;;
+set) echo '{}' ;;
+remove) echo '{"not_found":true}' ;;
+esac
+`
+
+func TestPlugin(t *testing.T) {
+	dir, err := ioutil.TempDir("", "aws-vault-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err = ioutil.WriteFile(filepath.Join(dir, "aws-vault-backend-llamas"), []byte(llamasPlugin), 0755); err != nil {
+		t.Fatal(err)
+	}
+	// a plugin can't replace a built in backend
+	if err = ioutil.WriteFile(filepath.Join(dir, "aws-vault-backend-file"), []byte(llamasPlugin), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	path := os.Getenv("PATH")
+	defer os.Setenv("PATH", path)
+	os.Setenv("PATH", dir+string(os.PathListSeparator)+path)
+
+	if !backend.IsBackend("llamas") {
+		t.Fatalf("Expected the llamas plugin to be found, got %v", backend.Available())
+	}
+	if backend.IsBackend("file") {
+		t.Fatal("Expected the file plugin to be ignored")
+	}
+
+	k, err := backend.Open("llamas", backend.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keys, err := k.Keys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 1 || keys[0] != "work" {
+		t.Fatalf("Expected the key work, got %v", keys)
+	}
+
+	item, err := k.Get("work")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(item.Data) != "secret" {
+		t.Fatalf("Expected the stored data, got %q", item.Data)
+	}
+
+	if err = k.Set(keyring.Item{Key: "work", Data: []byte("secret")}); err != nil {
+		t.Fatal(err)
+	}
+	if err = k.Remove("personal"); err != keyring.ErrKeyNotFound {
+		t.Fatalf("Expected ErrKeyNotFound, got %v", err)
+	}
+
+	requests, err := ioutil.ReadFile(filepath.Join(dir, "requests"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"op":"keys"}
+{"op":"get","key":"work"}
+{"op":"set","key":"work","item":{"key":"work","data":"c2VjcmV0"}}
+{"op":"remove","key":"personal"}
+`
+	if string(requests) != expected {
+		t.Fatalf("Expected requests:\n%s\ngot:\n%s", expected, requests)
+	}
+}
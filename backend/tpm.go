@@ -0,0 +1,123 @@
+package backend
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/99designs/keyring"
+)
+
+// TPMBackend keeps items encrypted like the encrypted-file backend, but with a random key sealed to the
+// machine's TPM 2.0 instead of one derived from a passphrase. The vault can only be unlocked on the
+// machine it was created on, so a copy of it is useless. The key is sealed and unsealed with tpm2-tools
+const TPMBackend = "tpm"
+
+const tpmKDF = "tpm2"
+
+func init() {
+	backends[TPMBackend] = func(cfg Config) (keyring.Keyring, error) {
+		if cfg.TPMDir == "" {
+			return nil, errors.New("No directory given for the tpm backend")
+		}
+		dir, err := expandHome(cfg.TPMDir)
+		if err != nil {
+			return nil, err
+		}
+
+		// unsealing is cheap, so the key isn't kept in an agent
+		cfg.EncryptedFileAgentTTL = 0
+
+		return &encryptedFileKeyring{
+			dir:    dir,
+			params: header{Version: 1, KDF: tpmKDF},
+			cfg:    cfg,
+		}, nil
+	}
+}
+
+// tpm2 runs a tpm2-tools command in dir
+func tpm2(dir string, stdin []byte, name string, args ...string) ([]byte, error) {
+	if _, err := exec.LookPath(name); err != nil {
+		return nil, fmt.Errorf("tpm2-tools is needed to use the tpm backend: %v", err)
+	}
+
+	cmd := exec.Command(name, args...)
+	cmd.Dir = dir
+	cmd.Stdin = bytes.NewReader(stdin)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("%s failed: %v: %s", name, err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
+
+// tpmPrimary creates the primary key under the owner hierarchy that keys are sealed with. It's derived
+// from the TPM's seed, so the same key is created each time
+func tpmPrimary(dir string) error {
+	_, err := tpm2(dir, nil, "tpm2_createprimary", "--quiet", "--hierarchy", "o", "--key-context", "primary.ctx")
+	return err
+}
+
+// tpmSeal seals the key to the TPM, returning the public and private parts of the sealed object
+func tpmSeal(key []byte) (public []byte, private []byte, err error) {
+	dir, err := ioutil.TempDir("", "aws-vault-tpm")
+	if err != nil {
+		return nil, nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	if err = tpmPrimary(dir); err != nil {
+		return nil, nil, err
+	}
+	if _, err = tpm2(dir, key, "tpm2_create", "--quiet", "--parent-context", "primary.ctx",
+		"--sealing-input", "-", "--public", "seal.pub", "--private", "seal.priv"); err != nil {
+		return nil, nil, err
+	}
+
+	if public, err = ioutil.ReadFile(filepath.Join(dir, "seal.pub")); err != nil {
+		return nil, nil, err
+	}
+	if private, err = ioutil.ReadFile(filepath.Join(dir, "seal.priv")); err != nil {
+		return nil, nil, err
+	}
+	return public, private, nil
+}
+
+// tpmUnseal loads the sealed object and unseals the key, which only works with the TPM that sealed it
+func tpmUnseal(public []byte, private []byte) ([]byte, error) {
+	if len(public) == 0 || len(private) == 0 {
+		return nil, errors.New("The vault has no key sealed to a TPM")
+	}
+
+	dir, err := ioutil.TempDir("", "aws-vault-tpm")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	if err = ioutil.WriteFile(filepath.Join(dir, "seal.pub"), public, 0600); err != nil {
+		return nil, err
+	}
+	if err = ioutil.WriteFile(filepath.Join(dir, "seal.priv"), private, 0600); err != nil {
+		return nil, err
+	}
+
+	if err = tpmPrimary(dir); err != nil {
+		return nil, err
+	}
+	// loading fails if the object was sealed by another TPM
+	if _, err = tpm2(dir, nil, "tpm2_load", "--quiet", "--parent-context", "primary.ctx",
+		"--public", "seal.pub", "--private", "seal.priv", "--key-context", "seal.ctx"); err != nil {
+		return nil, fmt.Errorf("Failed to unseal the key, the vault may have been created on another machine: %v", err)
+	}
+	return tpm2(dir, nil, "tpm2_unseal", "--quiet", "--object-context", "seal.ctx")
+}
@@ -0,0 +1,80 @@
+// +build !windows
+
+package backend_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/99designs/aws-vault/backend"
+	"github.com/99designs/keyring"
+)
+
+// fakeTPM stands in for tpm2-tools. Sealed objects only load while the TPM file they were sealed
+// with is unchanged, like objects sealed to another machine's TPM
+var fakeTPM = map[string]string{
+	"tpm2_createprimary": "#!/bin/sh\necho primary > primary.ctx\n",
+	"tpm2_create":        "#!/bin/sh\ncat > seal.priv\ncp \"$(dirname \"$0\")/tpm\" seal.pub\n",
+	"tpm2_load":          "#!/bin/sh\ncmp -s seal.pub \"$(dirname \"$0\")/tpm\" || exit 1\ncp seal.priv seal.ctx\n",
+	"tpm2_unseal":        "#!/bin/sh\ncat seal.ctx\n",
+}
+
+func TestTPM(t *testing.T) {
+	dir, err := ioutil.TempDir("", "aws-vault-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	bin := filepath.Join(dir, "bin")
+	if err = os.Mkdir(bin, 0700); err != nil {
+		t.Fatal(err)
+	}
+	for name, script := range fakeTPM {
+		if err = ioutil.WriteFile(filepath.Join(bin, name), []byte(script), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = ioutil.WriteFile(filepath.Join(bin, "tpm"), []byte("llamas"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	path := os.Getenv("PATH")
+	defer os.Setenv("PATH", path)
+	os.Setenv("PATH", bin+string(os.PathListSeparator)+path)
+
+	cfg := backend.Config{TPMDir: filepath.Join(dir, "vault")}
+	k, err := backend.Open(backend.TPMBackend, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = k.Set(keyring.Item{Key: "work", Data: []byte("secret")}); err != nil {
+		t.Fatal(err)
+	}
+
+	k, err = backend.Open(backend.TPMBackend, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	item, err := k.Get("work")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(item.Data) != "secret" {
+		t.Fatalf("Expected the stored data, got %q", item.Data)
+	}
+
+	// another TPM can't unseal the key
+	if err = ioutil.WriteFile(filepath.Join(bin, "tpm"), []byte("alpacas"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	k, err = backend.Open(backend.TPMBackend, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = k.Get("work"); err == nil {
+		t.Fatal("Expected an error unsealing with another TPM")
+	}
+}
@@ -0,0 +1,58 @@
+// +build ignore
+
+// gen-completions writes the scripts in completions/ into cli/completion_scripts.go, for aws-vault completion
+// to output. It's run by go generate in cli, so the scripts are only ever edited in completions/
+//
+//	go generate ./cli
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/format"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"strings"
+)
+
+var scripts = []struct {
+	shell string
+	path  string
+}{
+	{"bash", "bash/aws-vault"},
+	{"zsh", "zsh/_aws-vault"},
+	{"fish", "fish/aws-vault.fish"},
+}
+
+func main() {
+	dir := flag.String("dir", "../completions", "Directory of the completion scripts")
+	out := flag.String("o", "completion_scripts.go", "Go file to write")
+	flag.Parse()
+
+	var buf bytes.Buffer
+	buf.WriteString("// Code generated by go run bin/gen-completions.go; DO NOT EDIT.\n\n")
+	buf.WriteString("package cli\n\n")
+	buf.WriteString("// completionScripts are the scripts in completions/, which hand completion back to aws-vault --completion-bash\n")
+	buf.WriteString("var completionScripts = map[string]string{\n")
+	for _, s := range scripts {
+		b, err := ioutil.ReadFile(filepath.Join(*dir, s.path))
+		if err != nil {
+			log.Fatal(err)
+		}
+		if strings.Contains(string(b), "`") {
+			log.Fatalf("%s can't contain a backquote", s.path)
+		}
+		fmt.Fprintf(&buf, "\t%q: `%s`,\n", s.shell, b)
+	}
+	buf.WriteString("}\n")
+
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err = ioutil.WriteFile(*out, src, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
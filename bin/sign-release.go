@@ -0,0 +1,68 @@
+// +build ignore
+
+// sign-release signs a release's SHA256SUMS with the ed25519 release signing key, for aws-vault upgrade
+// to check. It's run with go run, so releases can be signed on any host that can build aws-vault
+//
+//	go run bin/sign-release.go -key release-signing-key -generate
+//	go run bin/sign-release.go -key release-signing-key -public
+//	go run bin/sign-release.go -key release-signing-key -version v5.1.0 SHA256SUMS > SHA256SUMS.sig
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/ed25519"
+)
+
+func main() {
+	keyFile := flag.String("key", "release-signing-key", "File the base64 encoded private key seed is kept in")
+	generate := flag.Bool("generate", false, "Generate a new key")
+	public := flag.Bool("public", false, "Print the base64 encoded public key")
+	version := flag.String("version", "", "The version being released, which is signed with the checksums")
+	flag.Parse()
+
+	if *generate {
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			log.Fatal(err)
+		}
+		seed := base64.StdEncoding.EncodeToString(key.Seed())
+		if err = ioutil.WriteFile(*keyFile, []byte(seed+"\n"), 0600); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	b, err := ioutil.ReadFile(*keyFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	seed, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(b)))
+	if err != nil || len(seed) != ed25519.SeedSize {
+		log.Fatalf("%s isn't a base64 encoded ed25519 seed", *keyFile)
+	}
+	key := ed25519.NewKeyFromSeed(seed)
+
+	if *public {
+		fmt.Println(base64.StdEncoding.EncodeToString(key.Public().(ed25519.PublicKey)))
+		return
+	}
+
+	if *version == "" || flag.NArg() != 1 {
+		log.Fatal("Usage: sign-release -key FILE -version VERSION SHA256SUMS")
+	}
+	sums, err := ioutil.ReadFile(flag.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+	// the same message as releaseSignedMessage in cli/upgrade.go
+	message := append([]byte("aws-vault "+*version+"\n"), sums...)
+	os.Stdout.Write(ed25519.Sign(key, message))
+}
@@ -1,9 +1,13 @@
 package cli
 
 import (
+	"encoding/csv"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"log"
 	"os"
+	"strings"
 
 	"github.com/99designs/aws-vault/prompt"
 	"github.com/99designs/aws-vault/vault"
@@ -16,7 +20,14 @@ type AddCommandInput struct {
 	ProfileName string
 	Keyring     keyring.Keyring
 	FromEnv     bool
+	FromStdin   bool
+	FromCSV     string
+	Generate    bool
+	From        string
+	IamUser     string
 	AddConfig   bool
+	ExternalID  bool
+	Totp        bool
 }
 
 func ConfigureAddCommand(app *kingpin.Application) {
@@ -25,17 +36,51 @@ func ConfigureAddCommand(app *kingpin.Application) {
 	cmd := app.Command("add", "Adds credentials, prompts if none provided")
 	cmd.Arg("profile", "Name of the profile").
 		Required().
+		PreAction(resolveProfileAlias(&input.ProfileName)).
 		StringVar(&input.ProfileName)
 
 	cmd.Flag("env", "Read the credentials from the environment").
 		BoolVar(&input.FromEnv)
 
+	cmd.Flag("stdin", "Read the access key id and secret access key from stdin, separated by whitespace").
+		BoolVar(&input.FromStdin)
+
+	cmd.Flag("csv", "Read the credentials from an accessKeys.csv file downloaded from the AWS console").
+		PlaceHolder("FILE").
+		StringVar(&input.FromCSV)
+
+	cmd.Flag("generate", "Create a new access key with the credentials of --from and store it, instead of reading one").
+		BoolVar(&input.Generate)
+
+	cmd.Flag("from", "Profile whose credentials create the access key with --generate, e.g. one assuming an admin role").
+		HintAction(profileNamesHint).
+		PreAction(resolveProfileAlias(&input.From)).
+		StringVar(&input.From)
+
+	cmd.Flag("iam-user", "IAM user to create the access key for with --generate, by default the user of --from").
+		StringVar(&input.IamUser)
+
 	cmd.Flag("add-config", "Add a profile to ~/.aws/config if one doesn't exist").
 		Default("true").
 		BoolVar(&input.AddConfig)
 
+	cmd.Flag("external-id", "Add an external id instead of credentials, for config to reference as keyring://<name>").
+		BoolVar(&input.ExternalID)
+
+	cmd.Flag("totp", "Add the secret of the profile's virtual MFA device instead of credentials, so tokens are generated").
+		BoolVar(&input.Totp)
+
 	cmd.Action(func(c *kingpin.ParseContext) error {
+		checkWritable(app, "add credentials")
 		input.Keyring = keyringImpl
+		if input.ExternalID {
+			AddExternalIDCommand(app, input)
+			return nil
+		}
+		if input.Totp {
+			AddTotpCommand(app, input)
+			return nil
+		}
 		AddCommand(app, input)
 		return nil
 	})
@@ -56,7 +101,44 @@ func AddCommand(app *kingpin.Application, input AddCommandInput) {
 		return
 	}
 
-	if input.FromEnv {
+	sources := 0
+	for _, set := range []bool{input.FromEnv, input.FromStdin, input.FromCSV != "", input.Generate} {
+		if set {
+			sources++
+		}
+	}
+	if sources > 1 {
+		app.Fatalf("Only one of --env, --stdin, --csv and --generate can be used")
+		return
+	}
+	if !input.Generate && (input.From != "" || input.IamUser != "") {
+		app.Fatalf("--from and --iam-user are only used with --generate")
+		return
+	}
+
+	var deleteGeneratedKey func() error
+	if input.Generate {
+		creds, deleteKey, err := generateAccessKey(input)
+		if err != nil {
+			app.Fatalf(err.Error())
+			return
+		}
+		accessKeyId, secretKey = creds.AccessKeyID, creds.SecretAccessKey
+		deleteGeneratedKey = deleteKey
+	} else if input.FromStdin || input.FromCSV != "" {
+		var creds credentials.Value
+		var err error
+		if input.FromStdin {
+			creds, err = readCredentials(os.Stdin)
+		} else {
+			creds, err = readCredentialsCSVFile(input.FromCSV)
+		}
+		if err != nil {
+			app.Fatalf(err.Error())
+			return
+		}
+		accessKeyId, secretKey = creds.AccessKeyID, creds.SecretAccessKey
+	} else if input.FromEnv {
 		if accessKeyId = os.Getenv("AWS_ACCESS_KEY_ID"); accessKeyId == "" {
 			app.Fatalf("Missing value for AWS_ACCESS_KEY_ID")
 			return
@@ -81,6 +163,14 @@ func AddCommand(app *kingpin.Application, input AddCommandInput) {
 	provider := vault.NewMasterCredentialsProvider(input.Keyring, input.ProfileName)
 
 	if err := provider.Store(creds); err != nil {
+		if deleteGeneratedKey != nil {
+			if deleteErr := deleteGeneratedKey(); deleteErr != nil {
+				app.Fatalf("Failed to store the new access key %s (%v), and deleting it failed, delete it in IAM: %v", accessKeyId, err, deleteErr)
+				return
+			}
+			app.Fatalf("Failed to store the new access key %s, deleted it again: %v", accessKeyId, err)
+			return
+		}
 		app.Fatalf(err.Error())
 		return
 	}
@@ -105,3 +195,125 @@ func AddCommand(app *kingpin.Application, input AddCommandInput) {
 		}
 	}
 }
+
+func AddExternalIDCommand(app *kingpin.Application, input AddCommandInput) {
+	externalID, err := prompt.TerminalPrompt("Enter External ID: ")
+	if err != nil {
+		app.Fatalf(err.Error())
+		return
+	}
+
+	if err = vault.StoreExternalID(input.Keyring, input.ProfileName, externalID); err != nil {
+		app.Fatalf(err.Error())
+		return
+	}
+
+	fmt.Printf("Added external id %q in vault, use it with external_id = keyring://%s\n", input.ProfileName, input.ProfileName)
+}
+
+func AddTotpCommand(app *kingpin.Application, input AddCommandInput) {
+	config := vault.Config{}
+	if err := configLoader.LoadFromProfile(input.ProfileName, &config); err != nil {
+		app.Fatalf("%v", err)
+		return
+	}
+	if config.MfaSerial == "" {
+		app.Fatalf("Profile %q has no mfa_serial to add a TOTP secret for", input.ProfileName)
+		return
+	}
+
+	secret, err := prompt.TerminalPrompt(fmt.Sprintf("Enter TOTP secret for %s: ", config.MfaSerial))
+	if err != nil {
+		app.Fatalf(err.Error())
+		return
+	}
+
+	if err = vault.StoreTotpSecret(input.Keyring, config.MfaSerial, secret); err != nil {
+		app.Fatalf(err.Error())
+		return
+	}
+
+	fmt.Printf("Added TOTP secret for %s in vault, tokens will be generated for it\n", config.MfaSerial)
+}
+
+// generateAccessKey creates an access key with the credentials of the --from profile, returning a func to delete it
+func generateAccessKey(input AddCommandInput) (credentials.Value, func() error, error) {
+	if input.From == "" {
+		return credentials.Value{}, nil, fmt.Errorf("--generate needs a profile to create the access key with, use --from")
+	}
+
+	config := vault.Config{}
+	configureCredentials(&config)
+	config.MfaDeviceSelector = mfaDeviceSelector(input.From)
+	if err := configLoader.LoadFromProfile(input.From, &config); err != nil {
+		return credentials.Value{}, nil, err
+	}
+	if config.CredentialsName == input.ProfileName {
+		return credentials.Value{}, nil, fmt.Errorf("Profile %q gets its credentials from %q, so they'd be replaced by the new access key. Use rotate instead", input.From, input.ProfileName)
+	}
+
+	creds, userName, deleteKey, err := vault.GenerateAccessKey(input.Keyring, &config, input.IamUser)
+	if err != nil {
+		return creds, nil, fmt.Errorf("Failed to create an access key: %v", err)
+	}
+	fmt.Printf("Created access key %s for IAM user %s\n", creds.AccessKeyID, userName)
+	return creds, deleteKey, nil
+}
+
+// readCredentials reads an access key id and secret access key separated by whitespace, e.g. on two lines
+func readCredentials(r io.Reader) (credentials.Value, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return credentials.Value{}, err
+	}
+	fields := strings.Fields(string(b))
+	if len(fields) != 2 {
+		return credentials.Value{}, fmt.Errorf("Expected an access key id and a secret access key, got %d values", len(fields))
+	}
+	return credentials.Value{AccessKeyID: fields[0], SecretAccessKey: fields[1]}, nil
+}
+
+func readCredentialsCSVFile(path string) (credentials.Value, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return credentials.Value{}, err
+	}
+	defer f.Close()
+
+	creds, err := readCredentialsCSV(f)
+	if err != nil {
+		return creds, fmt.Errorf("Invalid credentials file %s: %v", path, err)
+	}
+	return creds, nil
+}
+
+// readCredentialsCSV reads the credentials file downloaded from the AWS console. It has a header row,
+// and the credentials of a new user have their name and password too
+func readCredentialsCSV(r io.Reader) (credentials.Value, error) {
+	rows, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return credentials.Value{}, err
+	}
+	if len(rows) != 2 {
+		return credentials.Value{}, fmt.Errorf("Expected a header and one row of credentials, got %d rows", len(rows))
+	}
+
+	idColumn, secretColumn := -1, -1
+	for i, name := range rows[0] {
+		// Excel and the console write a byte order mark at the start
+		switch strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff"))) {
+		case "access key id":
+			idColumn = i
+		case "secret access key":
+			secretColumn = i
+		}
+	}
+	if idColumn < 0 || secretColumn < 0 {
+		return credentials.Value{}, fmt.Errorf("Missing Access key ID or Secret access key column")
+	}
+
+	return credentials.Value{
+		AccessKeyID:     strings.TrimSpace(rows[1][idColumn]),
+		SecretAccessKey: strings.TrimSpace(rows[1][secretColumn]),
+	}, nil
+}
@@ -5,6 +5,7 @@ import (
 	"log"
 	"os"
 
+	"github.com/99designs/keyring"
 	kingpin "gopkg.in/alecthomas/kingpin.v2"
 )
 
@@ -34,3 +35,32 @@ func ExampleAddCommand() {
 	// Output:
 	// Added credentials to profile "foo" in vault
 }
+
+func ExampleAddCommand_csv() {
+	f, err := ioutil.TempFile("", "aws-config")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+
+	csvFile, err := ioutil.TempFile("", "accessKeys.csv")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer os.Remove(csvFile.Name())
+	csvFile.WriteString("\ufeffAccess key ID,Secret access key\r\nAKIAIOSFODNN7EXAMPLE,wJalrXUtnFEMI/K7MDENG/bPxRfiCYEXAMPLEKEY\r\n")
+	csvFile.Close()
+
+	os.Setenv("AWS_CONFIG_FILE", f.Name())
+	defer os.Unsetenv("AWS_CONFIG_FILE")
+
+	keyringImpl = keyring.NewArrayKeyring(nil)
+
+	app := kingpin.New(`aws-vault`, ``)
+	ConfigureGlobals(app)
+	ConfigureAddCommand(app)
+	kingpin.MustParse(app.Parse([]string{"add", "--csv", csvFile.Name(), "--no-add-config", "foo"}))
+
+	// Output:
+	// Added credentials to profile "foo" in vault
+}
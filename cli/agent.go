@@ -0,0 +1,18 @@
+package cli
+
+import (
+	"github.com/99designs/aws-vault/backend"
+	kingpin "gopkg.in/alecthomas/kingpin.v2"
+)
+
+func ConfigureEncryptedFileAgentCommand(app *kingpin.Application) {
+	cmd := app.Command(backend.AgentCommand, "Keep encrypted-file vaults unlocked, it's started when needed").
+		Hidden()
+
+	cmd.Action(func(c *kingpin.ParseContext) error {
+		if err := backend.RunAgent(); err != nil {
+			app.Fatalf("Agent failed: %v", err)
+		}
+		return nil
+	})
+}
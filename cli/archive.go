@@ -0,0 +1,183 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/99designs/aws-vault/backend"
+	"github.com/99designs/aws-vault/vault"
+	"github.com/99designs/keyring"
+	"golang.org/x/crypto/ssh/terminal"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+type ExportVaultCommandInput struct {
+	Keyring keyring.Keyring
+	Output  string
+	Config  backend.Config
+}
+
+type ImportVaultCommandInput struct {
+	Keyring        keyring.Keyring
+	Input          string
+	Overwrite      bool
+	AllowPlaintext bool
+	Config         backend.Config
+}
+
+func ConfigureExportVaultCommand(app *kingpin.Application) {
+	input := ExportVaultCommandInput{}
+
+	cmd := app.Command("export-vault", "Write an encrypted archive of stored credentials, for backups and moving to another machine")
+
+	cmd.Flag("output", "File to write the archive to, instead of stdout").
+		Short('o').
+		StringVar(&input.Output)
+
+	cmd.Action(func(c *kingpin.ParseContext) error {
+		input.Keyring = keyringImpl
+		input.Config = archiveConfig()
+		ExportVaultCommand(app, input)
+		return nil
+	})
+}
+
+func ConfigureImportVaultCommand(app *kingpin.Application) {
+	input := ImportVaultCommandInput{}
+
+	cmd := app.Command("import-vault", "Store the credentials in an archive written by export-vault")
+
+	cmd.Arg("file", "Archive to import, instead of stdin").
+		StringVar(&input.Input)
+
+	cmd.Flag("overwrite", "Replace credentials that are already stored").
+		BoolVar(&input.Overwrite)
+
+	cmd.Flag("allow-plaintext", "Import an archive that isn't encrypted").
+		BoolVar(&input.AllowPlaintext)
+
+	cmd.Action(func(c *kingpin.ParseContext) error {
+		checkWritable(app, "import credentials")
+		input.Keyring = keyringImpl
+		input.Config = archiveConfig()
+		input.Config.AllowPlaintextArchive = input.AllowPlaintext
+		ImportVaultCommand(app, input)
+		return nil
+	})
+}
+
+// archiveConfig configures the archive to be encrypted with age if recipients are given, otherwise
+// with a passphrase
+func archiveConfig() backend.Config {
+	return backend.Config{
+		PassphraseFunc:      archivePassphrasePrompt,
+		EncryptedFileArgon2: GlobalFlags.EncryptedFileArgon2,
+		AgeRecipients:       GlobalFlags.AgeRecipients,
+		AgeRecipientsFile:   GlobalFlags.AgeRecipientsFile,
+		AgeIdentity:         GlobalFlags.AgeIdentity,
+	}
+}
+
+func archivePassphrasePrompt(prompt string) (string, error) {
+	if passphrase := os.Getenv("AWS_VAULT_ARCHIVE_PASSPHRASE"); passphrase != "" {
+		return passphrase, nil
+	}
+
+	fmt.Fprintf(os.Stderr, "%s: ", prompt)
+	b, err := terminal.ReadPassword(int(os.Stdin.Fd()))
+	if err != nil {
+		return "", err
+	}
+	fmt.Fprintln(os.Stderr)
+	return string(b), nil
+}
+
+func ExportVaultCommand(app *kingpin.Application, input ExportVaultCommandInput) {
+	keys, err := input.Keyring.Keys()
+	if err != nil {
+		app.Fatalf(err.Error())
+		return
+	}
+	sort.Strings(keys)
+
+	items := []keyring.Item{}
+	for _, key := range keys {
+		if vault.IsSessionKey(key) {
+			continue
+		}
+		item, err := input.Keyring.Get(key)
+		if err != nil {
+			app.Fatalf("Failed to read %s: %v", key, err)
+			return
+		}
+		items = append(items, item)
+	}
+
+	var w io.Writer = os.Stdout
+	if input.Output != "" {
+		f, err := os.OpenFile(input.Output, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if err != nil {
+			app.Fatalf(err.Error())
+			return
+		}
+		defer f.Close()
+		w = f
+	}
+
+	if err = backend.WriteArchive(w, items, input.Config); err != nil {
+		if input.Output != "" {
+			os.Remove(input.Output)
+		}
+		app.Fatalf("Failed to write the archive: %v", err)
+		return
+	}
+	infof("Exported %d credentials\n", len(items))
+}
+
+func ImportVaultCommand(app *kingpin.Application, input ImportVaultCommandInput) {
+	var r io.Reader = os.Stdin
+	if input.Input != "" {
+		f, err := os.Open(input.Input)
+		if err != nil {
+			app.Fatalf(err.Error())
+			return
+		}
+		defer f.Close()
+		r = f
+	}
+
+	items, err := backend.ReadArchive(r, input.Config)
+	if err != nil {
+		app.Fatalf("Failed to read the archive: %v", err)
+		return
+	}
+
+	existing, err := input.Keyring.Keys()
+	if err != nil {
+		app.Fatalf(err.Error())
+		return
+	}
+
+	imported, skipped := 0, 0
+	for _, item := range items {
+		if contains(existing, item.Key) && !input.Overwrite {
+			fmt.Printf("Skipped %s, it's already stored\n", item.Key)
+			skipped++
+			continue
+		}
+		if err = input.Keyring.Set(item); err != nil {
+			app.Fatalf("Failed to store %s: %v", item.Key, err)
+			return
+		}
+		fmt.Printf("Imported %s\n", item.Key)
+		imported++
+	}
+
+	fmt.Printf("Imported %d credentials", imported)
+	if skipped > 0 {
+		fmt.Printf(", skipped %d that were already stored (use --overwrite to replace them)", skipped)
+	}
+	fmt.Println()
+}
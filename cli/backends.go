@@ -0,0 +1,68 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/99designs/aws-vault/backend"
+	"github.com/99designs/keyring"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+type BackendsCommandInput struct {
+	Backend string
+}
+
+func ConfigureBackendsCommand(app *kingpin.Application) {
+	input := BackendsCommandInput{}
+
+	cmd := app.Command("backends", "List the secret backends available on this platform, and which is used by default")
+
+	cmd.Action(func(c *kingpin.ParseContext) error {
+		input.Backend = GlobalFlags.Backend
+		BackendsCommand(app, input)
+		return nil
+	})
+}
+
+func BackendsCommand(app *kingpin.Application, input BackendsCommandInput) {
+	// without --backend, the keyring library uses the first of its backends that opens
+	defaultBackend := input.Backend
+	if defaultBackend == "" {
+		if available := keyring.AvailableBackends(); len(available) > 0 {
+			defaultBackend = string(available[0])
+		}
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 18, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "Backend\tDefault\tProvided by\t")
+	fmt.Fprintln(w, "=======\t=======\t===========\t")
+
+	for _, name := range keyring.AvailableBackends() {
+		fmt.Fprintf(w, "%s\t%s\t%s\t\n", name, backendDefaultMarker(string(name), defaultBackend), "keyring")
+	}
+	for _, name := range backend.Available() {
+		providedBy := "aws-vault"
+		if path, ok := backend.PluginPath(name); ok {
+			providedBy = "plugin " + path
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t\n", name, backendDefaultMarker(name, defaultBackend), providedBy)
+	}
+
+	if err := w.Flush(); err != nil {
+		app.Fatalf("%v", err)
+		return
+	}
+
+	if input.Backend == "" && len(keyring.AvailableBackends()) > 1 {
+		fmt.Printf("\nIf %s can't be opened, the next keyring backend that can is used. Choose one with --backend or AWS_VAULT_BACKEND.\n", defaultBackend)
+	}
+}
+
+func backendDefaultMarker(name, defaultBackend string) string {
+	if name == defaultBackend {
+		return "*"
+	}
+	return ""
+}
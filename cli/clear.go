@@ -0,0 +1,49 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/99designs/aws-vault/vault"
+	"github.com/99designs/keyring"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+type ClearCommandInput struct {
+	ProfileName string
+	Keyring     keyring.Keyring
+}
+
+func ConfigureClearCommand(app *kingpin.Application) {
+	input := ClearCommandInput{}
+
+	cmd := app.Command("clear", "Remove cached sessions and role credentials, of every profile or just one")
+
+	cmd.Arg("profile", "Name of the profile, otherwise the sessions of every profile are removed").
+		HintAction(profileNamesHint).
+		PreAction(resolveProfileAlias(&input.ProfileName)).
+		StringVar(&input.ProfileName)
+
+	cmd.Action(func(c *kingpin.ParseContext) error {
+		checkWritable(app, "remove sessions")
+		input.Keyring = keyringImpl
+		ClearCommand(app, input)
+		return nil
+	})
+}
+
+func ClearCommand(app *kingpin.Application, input ClearCommandInput) {
+	sessions := vault.NewKeyringSessions(input.Keyring)
+
+	var n int
+	var err error
+	if input.ProfileName != "" {
+		n, err = sessions.Delete(input.ProfileName)
+	} else {
+		n, err = sessions.DeleteAll()
+	}
+	if err != nil {
+		app.Fatalf(err.Error())
+		return
+	}
+	fmt.Printf("Cleared %d sessions.\n", n)
+}
@@ -0,0 +1,61 @@
+package cli
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// clipboardCommands returns the commands that copy their stdin to the clipboard and paste it to stdout
+func clipboardCommands() (copyArgs []string, pasteArgs []string, err error) {
+	switch runtime.GOOS {
+	case "darwin":
+		return []string{"pbcopy"}, []string{"pbpaste"}, nil
+	case "windows":
+		return []string{"clip.exe"}, []string{"powershell.exe", "-NoProfile", "-Command", "Get-Clipboard -Raw"}, nil
+	}
+
+	if os.Getenv("WAYLAND_DISPLAY") != "" {
+		if _, err := exec.LookPath("wl-copy"); err == nil {
+			return []string{"wl-copy"}, []string{"wl-paste", "--no-newline"}, nil
+		}
+	}
+	if _, err := exec.LookPath("xclip"); err == nil {
+		return []string{"xclip", "-selection", "clipboard"}, []string{"xclip", "-selection", "clipboard", "-o"}, nil
+	}
+	if _, err := exec.LookPath("xsel"); err == nil {
+		return []string{"xsel", "--clipboard", "--input"}, []string{"xsel", "--clipboard", "--output"}, nil
+	}
+	return nil, nil, errors.New("No clipboard tool found, install wl-clipboard, xclip or xsel")
+}
+
+// copyToClipboard puts s on the system clipboard
+func copyToClipboard(s string) error {
+	copyArgs, _, err := clipboardCommands()
+	if err != nil {
+		return err
+	}
+	cmd := exec.Command(copyArgs[0], copyArgs[1:]...)
+	cmd.Stdin = strings.NewReader(s)
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+// clearClipboard empties the clipboard if it still holds s, so something copied since isn't lost
+func clearClipboard(s string) error {
+	_, pasteArgs, err := clipboardCommands()
+	if err != nil {
+		return err
+	}
+	current, err := exec.Command(pasteArgs[0], pasteArgs[1:]...).Output()
+	if err != nil {
+		return err
+	}
+	if string(bytes.TrimRight(current, "\r\n")) != s {
+		return nil
+	}
+	return copyToClipboard("")
+}
@@ -0,0 +1,22 @@
+package cli
+
+import (
+	"os"
+
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+const (
+	colorRed    = "\x1b[31m"
+	colorYellow = "\x1b[33m"
+	colorReset  = "\x1b[0m"
+)
+
+// useColor returns whether to colour output written to f. It's only done on a terminal, and not when
+// NO_COLOR is set (see https://no-color.org) or TERM is dumb
+func useColor(f *os.File) bool {
+	if os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	return terminal.IsTerminal(int(f.Fd()))
+}
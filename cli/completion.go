@@ -0,0 +1,108 @@
+package cli
+
+//go:generate go run ../bin/gen-completions.go
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"sort"
+
+	"github.com/99designs/aws-vault/backend"
+	"github.com/99designs/aws-vault/vault"
+	"github.com/99designs/keyring"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+// listableBackends are the backends whose keys are listed without unlocking anything, e.g. from the names of
+// files. Others, like the keychain, could show an unlock dialog each time tab is pressed
+var listableBackends = []string{
+	string(keyring.FileBackend),
+	string(keyring.PassBackend),
+	string(keyring.WinCredBackend),
+	backend.EncryptedFileBackend,
+	backend.TPMBackend,
+	backend.AgeBackend,
+	backend.GPGBackend,
+	backend.MemoryBackend,
+}
+
+// completing is set while profile names are completed, so that backends fail rather than prompt for a passphrase
+var completing bool
+
+type CompletionCommandInput struct {
+	Shell string
+}
+
+func ConfigureCompletionCommand(app *kingpin.Application) {
+	input := CompletionCommandInput{}
+
+	cmd := app.Command("completion", "Output the script for shell completion of commands, flags and profile names")
+
+	cmd.Arg("shell", "Shell to output the completion script of").
+		Required().
+		EnumVar(&input.Shell, "bash", "zsh", "fish")
+
+	cmd.Action(func(c *kingpin.ParseContext) error {
+		CompletionCommand(app, input)
+		return nil
+	})
+}
+
+func CompletionCommand(app *kingpin.Application, input CompletionCommandInput) {
+	fmt.Print(completionScripts[input.Shell])
+}
+
+// resolveProfileAlias replaces a profile alias given as an arg or flag with the name of the profile. It's
+// a PreAction so that it runs after the config file is loaded and before the command
+func resolveProfileAlias(name *string) kingpin.Action {
+	return func(c *kingpin.ParseContext) error {
+		if awsConfigFile != nil {
+			*name = awsConfigFile.ResolveAlias(*name)
+		}
+		return nil
+	}
+}
+
+// profileNamesHint completes the profiles and aliases in the config file, and with a backend that's listed
+// without unlocking, the credentials stored without one. Hints are given before the PreAction runs, so the
+// config and backend are opened here
+func profileNamesHint() []string {
+	log.SetOutput(ioutil.Discard)
+
+	configFile := awsConfigFile
+	if configFile == nil {
+		var err error
+		if configFile, err = vault.LoadConfigFromEnv(); err != nil {
+			return nil
+		}
+	}
+	names := configFile.ProfileNames()
+	for _, profile := range configFile.ProfileSections() {
+		names = append(names, profile.Aliases()...)
+	}
+
+	if !contains(listableBackends, GlobalFlags.Backend) {
+		sort.Strings(names)
+		return names
+	}
+
+	completing = true
+	defer func() { completing = false }()
+
+	if k, err := openBackend(GlobalFlags.Backend); err == nil {
+		if keys, err := k.Keys(); err == nil {
+			for _, key := range keys {
+				if vault.IsCredentialsKey(key) && !contains(names, key) {
+					names = append(names, key)
+				}
+			}
+		}
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+var errCompleting = errors.New("Can't ask for a passphrase while completing")
@@ -0,0 +1,105 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/99designs/aws-vault/vault"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+type ConfigureProfileCommandInput struct {
+	ProfileName string
+	As          string
+	Write       bool
+}
+
+func ConfigureConfigureProfileCommand(app *kingpin.Application) {
+	input := ConfigureProfileCommandInput{}
+
+	cmd := app.Command("configure-profile", "Print or write the config file section that gets a profile's credentials from aws-vault with credential_process")
+
+	cmd.Flag("as", "Name of the profile to configure, instead of the profile itself").
+		PlaceHolder("NAME").
+		StringVar(&input.As)
+
+	cmd.Flag("write", "Write the section to the config file instead of printing it").
+		BoolVar(&input.Write)
+
+	cmd.Arg("profile", "Name of the profile whose credentials to use").
+		Required().
+		HintAction(profileNamesHint).
+		PreAction(resolveProfileAlias(&input.ProfileName)).
+		StringVar(&input.ProfileName)
+
+	cmd.Action(func(c *kingpin.ParseContext) error {
+		ConfigureProfileCommand(app, input)
+		return nil
+	})
+}
+
+func ConfigureProfileCommand(app *kingpin.Application, input ConfigureProfileCommandInput) {
+	config := vault.Config{}
+	if err := configLoader.LoadFromProfile(input.ProfileName, &config); err != nil {
+		app.Fatalf("%v", err)
+		return
+	}
+
+	name := input.ProfileName
+	if input.As != "" {
+		name = input.As
+	}
+	// SDKs get credentials from these keys themselves before trying credential_process
+	if section, ok := awsConfigFile.ProfileSection(name); ok {
+		for _, v := range [][2]string{
+			{"role_arn", section.RoleARN},
+			{"source_profile", section.SourceProfile},
+			{"web_identity_token_file", section.WebIdentityTokenFile},
+		} {
+			if v[1] != "" {
+				app.Fatalf("Profile %s has %s, so SDKs would use it instead of credential_process. Use --as to configure another profile, e.g. --as %s-vault",
+					name, v[0], input.ProfileName)
+				return
+			}
+		}
+	}
+
+	process := "aws-vault exec " + input.ProfileName + " --json"
+	if GlobalFlags.PromptDriver != "" {
+		process += " --prompt=" + GlobalFlags.PromptDriver
+	}
+	usesMfa := config.MfaSerial != "" || len(config.MfaSerials) > 0
+	if usesMfa && config.MfaProcess == "" && (GlobalFlags.PromptDriver == "" || GlobalFlags.PromptDriver == "terminal") && config.PromptDriver == "terminal" {
+		fmt.Fprintf(os.Stderr, "Profile %s uses MFA, and credential_process can't prompt for a token on the terminal. "+
+			"Choose another prompt driver with --prompt, one of %v\n", input.ProfileName, promptsAvailable)
+	}
+
+	values := [][2]string{{"credential_process", process}}
+	if name != input.ProfileName && config.Region != "" {
+		values = append(values, [2]string{"region", config.Region})
+	}
+
+	if !input.Write {
+		fmt.Printf("[%s]\n", profileSection(name))
+		for _, v := range values {
+			fmt.Printf("%s = %s\n", v[0], v[1])
+		}
+		return
+	}
+
+	for _, v := range values {
+		if err := awsConfigFile.SetProfileValue(name, v[0], v[1]); err != nil {
+			app.Fatalf("%v", err)
+			return
+		}
+	}
+	fmt.Printf("Wrote profile %s to %s\n", name, awsConfigFile.Path)
+}
+
+// profileSection returns the section name of a profile in the config file
+func profileSection(name string) string {
+	if name == "default" {
+		return name
+	}
+	return "profile " + name
+}
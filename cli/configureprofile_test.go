@@ -0,0 +1,38 @@
+package cli
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+
+	"github.com/99designs/keyring"
+	kingpin "gopkg.in/alecthomas/kingpin.v2"
+)
+
+func ExampleConfigureProfileCommand() {
+	f, err := ioutil.TempFile("", "aws-config")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString("[profile llamas]\nregion = us-west-2\nrole_arn = arn:aws:iam::123456789012:role/llamas\n")
+	f.Close()
+
+	os.Setenv("AWS_CONFIG_FILE", f.Name())
+	defer os.Unsetenv("AWS_CONFIG_FILE")
+
+	awsConfigFile = nil
+	keyringImpl = keyring.NewArrayKeyring(nil)
+
+	app := kingpin.New(`aws-vault`, ``)
+	ConfigureGlobals(app)
+	ConfigureConfigureProfileCommand(app)
+	kingpin.MustParse(app.Parse([]string{
+		"configure-profile", "--as", "llamas-sdk", "llamas",
+	}))
+
+	// Output:
+	// [profile llamas-sdk]
+	// credential_process = aws-vault exec llamas --json
+	// region = us-west-2
+}
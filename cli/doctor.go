@@ -0,0 +1,241 @@
+package cli
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/99designs/aws-vault/backend"
+	"github.com/99designs/aws-vault/vault"
+	"github.com/99designs/keyring"
+	"github.com/mitchellh/go-homedir"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+const (
+	// AWS rejects requests signed more than 5 minutes from its clock
+	maxClockSkew  = 5 * time.Minute
+	warnClockSkew = time.Minute
+)
+
+type DoctorCommandInput struct {
+	StsEndpoint string
+}
+
+type doctorLevel string
+
+const (
+	doctorOK   doctorLevel = "ok"
+	doctorWarn doctorLevel = "warn"
+	doctorFail doctorLevel = "FAIL"
+)
+
+// doctorFinding is the result of a check, with a hint on how to fix it if it isn't ok
+type doctorFinding struct {
+	Level   doctorLevel
+	Message string
+	Hint    string
+}
+
+func ConfigureDoctorCommand(app *kingpin.Application) {
+	input := DoctorCommandInput{}
+
+	cmd := app.Command("doctor", "Check the backend, config file, clock and connection to AWS for common problems")
+
+	cmd.Flag("sts-endpoint", "STS endpoint to check the connection and clock against").
+		Default("https://sts.amazonaws.com").
+		StringVar(&input.StsEndpoint)
+
+	cmd.Action(func(c *kingpin.ParseContext) error {
+		DoctorCommand(app, input)
+		return nil
+	})
+}
+
+func DoctorCommand(app *kingpin.Application, input DoctorCommandInput) {
+	var findings []doctorFinding
+	report := func(f ...doctorFinding) {
+		for _, finding := range f {
+			fmt.Printf("[%-4s] %s\n", finding.Level, finding.Message)
+			if finding.Hint != "" && finding.Level != doctorOK {
+				fmt.Printf("       %s\n", finding.Hint)
+			}
+		}
+		findings = append(findings, f...)
+	}
+
+	configFile, configFindings := doctorConfig()
+	report(configFindings...)
+
+	k, backendFindings := doctorBackend()
+	report(backendFindings...)
+
+	if configFile != nil && k != nil {
+		report(doctorProfiles(configFile, k)...)
+	}
+
+	report(doctorSts(input.StsEndpoint)...)
+
+	failed := 0
+	for _, f := range findings {
+		if f.Level == doctorFail {
+			failed++
+		}
+	}
+	if failed > 0 {
+		app.Fatalf("%d problems found", failed)
+	}
+}
+
+func doctorConfig() (*vault.ConfigFile, []doctorFinding) {
+	path, err := vault.ConfigPath()
+	if err != nil {
+		return nil, []doctorFinding{{doctorFail, fmt.Sprintf("Can't find the config file: %v", err), "Set AWS_CONFIG_FILE to its path"}}
+	}
+	configFile, err := vault.LoadConfig(path)
+	if err != nil {
+		return nil, []doctorFinding{{doctorFail, strings.TrimSpace(err.Error()), "Fix the syntax of " + path + ", it's an INI file"}}
+	}
+	awsConfigFile = configFile
+	configLoader = &vault.ConfigLoader{File: configFile}
+
+	return configFile, []doctorFinding{{doctorOK, fmt.Sprintf("Config file %s has %d profiles", path, len(configFile.ProfileNames())), ""}}
+}
+
+// backendDir returns the directory the selected backend keeps items in, if it's a file based one
+func backendDir(name string) string {
+	switch name {
+	case string(keyring.FileBackend):
+		return GlobalFlags.FileDir
+	case backend.EncryptedFileBackend:
+		return GlobalFlags.EncryptedFilePath
+	case backend.AgeBackend:
+		return GlobalFlags.AgePath
+	case backend.TPMBackend:
+		return GlobalFlags.TPMPath
+	}
+	return ""
+}
+
+func doctorBackend() (keyring.Keyring, []doctorFinding) {
+	var findings []doctorFinding
+
+	name := GlobalFlags.Backend
+	if name == "" {
+		if available := keyring.AvailableBackends(); len(available) > 0 {
+			name = string(available[0])
+		}
+	}
+	if name == "" {
+		return nil, []doctorFinding{{doctorFail, "No backends are available on this platform", "Use --backend to choose one of " + strings.Join(availableBackends(), ", ")}}
+	}
+
+	if dir := backendDir(name); dir != "" && runtime.GOOS != "windows" {
+		if path, err := homedir.Expand(dir); err == nil {
+			if stat, err := os.Stat(path); err == nil && stat.Mode().Perm()&0077 != 0 {
+				findings = append(findings, doctorFinding{doctorWarn,
+					fmt.Sprintf("%s can be read by other users, it has mode %s", path, stat.Mode().Perm()),
+					"Run chmod 700 " + path})
+			}
+		}
+	}
+
+	if usesKeychain(name) {
+		findings = append(findings, doctorKeychain(GlobalFlags.KeychainName)...)
+	}
+
+	k, err := openKeyring()
+	if err != nil {
+		return nil, append(findings, doctorFinding{doctorFail, fmt.Sprintf("Can't open the %s backend: %v", name, err),
+			"Check it's installed and set up, or choose another with --backend, see aws-vault backends"})
+	}
+	keys, err := k.Keys()
+	if err != nil {
+		return nil, append(findings, doctorFinding{doctorFail, fmt.Sprintf("Can't list the credentials in the %s backend: %v", name, err),
+			"Check it's unlocked and that you have permission to read it"})
+	}
+
+	credentials := 0
+	for _, key := range keys {
+		if vault.IsCredentialsKey(key) {
+			credentials++
+		}
+	}
+	return k, append(findings, doctorFinding{doctorOK, fmt.Sprintf("Backend %s has %d credentials", name, credentials), ""})
+}
+
+func doctorProfiles(configFile *vault.ConfigFile, k keyring.Keyring) []doctorFinding {
+	var findings []doctorFinding
+
+	keys, err := k.Keys()
+	if err != nil {
+		return nil
+	}
+
+	for _, profileName := range configFile.ProfileNames() {
+		config := vault.Config{}
+		if err := configLoader.LoadFromProfile(profileName, &config); err != nil {
+			findings = append(findings, doctorFinding{doctorFail, fmt.Sprintf("Profile %s: %v", profileName, err), ""})
+			continue
+		}
+		if err := config.Validate(); err != nil {
+			findings = append(findings, doctorFinding{doctorFail, fmt.Sprintf("Profile %s: %v", profileName, err), ""})
+			continue
+		}
+		// Every profile gets its credentials from the keyring, except those that assume a role with a web
+		// identity token
+		if config.SourceCredentials == nil && config.WebIdentityTokenFile == "" && !contains(keys, config.CredentialsName) {
+			findings = append(findings, doctorFinding{doctorWarn,
+				fmt.Sprintf("Profile %s uses credentials %s, which aren't stored", profileName, config.CredentialsName),
+				"Add them with aws-vault add " + config.CredentialsName})
+		}
+	}
+
+	if len(findings) == 0 {
+		findings = append(findings, doctorFinding{doctorOK, "Profiles are valid", ""})
+	}
+	return findings
+}
+
+func doctorSts(endpoint string) []doctorFinding {
+	client := &http.Client{
+		Timeout: 10 * time.Second,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	start := time.Now()
+	resp, err := client.Head(endpoint)
+	if err != nil {
+		return []doctorFinding{{doctorFail, fmt.Sprintf("Can't reach STS at %s: %v", endpoint, err),
+			"Check your network connection, and HTTPS_PROXY if you use a proxy"}}
+	}
+	resp.Body.Close()
+	elapsed := time.Since(start)
+
+	findings := []doctorFinding{{doctorOK, fmt.Sprintf("STS at %s is reachable, in %s", endpoint, elapsed.Round(time.Millisecond)), ""}}
+
+	serverTime, err := http.ParseTime(resp.Header.Get("Date"))
+	if err != nil {
+		return append(findings, doctorFinding{doctorWarn, "Can't check the clock, STS didn't send the time", ""})
+	}
+	// the Date header has a resolution of a second, and is from some time during the request
+	skew := start.Add(elapsed / 2).Sub(serverTime).Round(time.Second)
+	abs := skew
+	if abs < 0 {
+		abs = -abs
+	}
+
+	msg := fmt.Sprintf("Clock is %s off from AWS", abs)
+	switch {
+	case abs > maxClockSkew:
+		return append(findings, doctorFinding{doctorFail, msg + ", so requests will be rejected", "Sync the clock, e.g. by enabling NTP"})
+	case abs > warnClockSkew:
+		return append(findings, doctorFinding{doctorWarn, msg, "Sync the clock, e.g. by enabling NTP"})
+	}
+	return append(findings, doctorFinding{doctorOK, msg, ""})
+}
@@ -0,0 +1,26 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/99designs/aws-vault/vault"
+)
+
+// printCredentialsPlan prints the steps of getting credentials for --dry-run
+func printCredentialsPlan(profileName string, plan vault.CredentialsPlan) {
+	fmt.Printf("Dry run for %s, getting credentials with: %s\n", profileName, plan.Path)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	for i, step := range plan.Steps {
+		fmt.Fprintf(w, "%d. %s\n", i+1, step.Description)
+		if step.Call != "" {
+			fmt.Fprintf(w, "   %s\n", step.Call)
+		}
+		for _, param := range step.Params {
+			fmt.Fprintf(w, "     %s\t%s\n", param[0], param[1])
+		}
+	}
+	w.Flush()
+}
@@ -0,0 +1,48 @@
+package cli
+
+import (
+	"github.com/aws/aws-sdk-go/aws/credentials"
+)
+
+type envVar struct {
+	Key   string
+	Value string
+}
+
+// legacyCredentialEnvKeys are read by tools that predate the standard variable names, like the
+// Java SDK (AWS_ACCESS_KEY, AWS_SECRET_KEY) and the EC2 API tools (EC2_*, AWS_DELEGATION_TOKEN)
+var legacyCredentialEnvKeys = []string{
+	"AWS_ACCESS_KEY",
+	"AWS_SECRET_KEY",
+	"AWS_DELEGATION_TOKEN",
+	"EC2_ACCESS_KEY",
+	"EC2_SECRET_KEY",
+}
+
+// credentialEnvVars returns the environment variables that hold the credentials in the given env_format
+func credentialEnvVars(val credentials.Value, format string) []envVar {
+	vars := []envVar{
+		{"AWS_ACCESS_KEY_ID", val.AccessKeyID},
+		{"AWS_SECRET_ACCESS_KEY", val.SecretAccessKey},
+	}
+	if val.SessionToken != "" {
+		vars = append(vars,
+			envVar{"AWS_SESSION_TOKEN", val.SessionToken},
+			envVar{"AWS_SECURITY_TOKEN", val.SessionToken},
+		)
+	}
+
+	if format == "legacy" {
+		vars = append(vars,
+			envVar{"AWS_ACCESS_KEY", val.AccessKeyID},
+			envVar{"AWS_SECRET_KEY", val.SecretAccessKey},
+			envVar{"EC2_ACCESS_KEY", val.AccessKeyID},
+			envVar{"EC2_SECRET_KEY", val.SecretAccessKey},
+		)
+		if val.SessionToken != "" {
+			vars = append(vars, envVar{"AWS_DELEGATION_TOKEN", val.SessionToken})
+		}
+	}
+
+	return vars
+}
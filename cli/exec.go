@@ -2,30 +2,45 @@ package cli
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"os"
 	"os/exec"
 	"os/signal"
 	"strings"
-	"syscall"
+	"time"
 
+	"github.com/99designs/aws-vault/logging"
 	"github.com/99designs/aws-vault/prompt"
 	"github.com/99designs/aws-vault/server"
+	"github.com/99designs/aws-vault/telemetry"
 	"github.com/99designs/aws-vault/vault"
 	"github.com/99designs/keyring"
+	"github.com/aws/aws-sdk-go/aws/credentials"
 	"gopkg.in/alecthomas/kingpin.v2"
 )
 
 type ExecCommandInput struct {
-	ProfileName      string
-	Command          string
-	Args             []string
-	Keyring          keyring.Keyring
-	StartServer      bool
-	CredentialHelper bool
-	Signals          chan os.Signal
-	Config           vault.Config
+	ProfileName       string
+	Command           string
+	Args              []string
+	Keyring           keyring.Keyring
+	StartServer       bool
+	Ec2Server         bool
+	EcsServer         bool
+	BackgroundRefresh bool
+	ServerScope       string
+	CredentialHelper  bool
+	Force             bool
+	Chained           bool
+	KeepEnv           bool
+	CleanEnv          bool
+	StrictEnv         bool
+	DryRun            bool
+	LoginShell        bool
+	Signals           chan os.Signal
+	Config            vault.Config
 }
 
 // json metadata for AWS credential process. Ref: https://docs.aws.amazon.com/cli/latest/topic/config-vars.html#sourcing-credentials-from-external-processes
@@ -56,17 +71,36 @@ func ConfigureExecCommand(app *kingpin.Application) {
 		Envar("AWS_ASSUME_ROLE_TTL").
 		DurationVar(&input.Config.AssumeRoleDuration)
 
-	cmd.Flag("mfa-token", "The mfa token to use").
-		Short('m').
-		StringVar(&input.Config.MfaToken)
-
 	cmd.Flag("mfa-serial-override", "Deprecated, use --mfa-serial instead").
 		Hidden().
 		StringVar(&input.Config.MfaSerial)
 
+	cmd.Flag("region", "The region to use for STS and to give the command, instead of the profile's, AWS_REGION or AWS_DEFAULT_REGION").
+		StringVar(&input.Config.Region)
+
 	cmd.Flag("mfa-serial", "The identification number of the MFA device to use").
 		StringVar(&input.Config.MfaSerial)
 
+	cmd.Flag("mfa-device", "The name or serial of the MFA device to use when mfa_serials lists several").
+		StringVar(&input.Config.MfaDevice)
+
+	cmd.Flag("role-arn", "Assume this role with the profile's credentials, instead of the profile's role_arn").
+		StringVar(&input.Config.RoleARN)
+
+	cmd.Flag("external-id", "The external id to assume the role with").
+		StringVar(&input.Config.ExternalID)
+
+	cmd.Flag("assume-root", "Create a task-scoped root session in this member account with sts:AssumeRoot").
+		PlaceHolder("ACCOUNT-ID").
+		StringVar(&input.Config.AssumeRootTarget)
+
+	cmd.Flag("root-task-policy", "The root task policy name or ARN to scope the root session to").
+		Default("IAMAuditRootUserCredentials").
+		StringVar(&input.Config.RootTaskPolicy)
+
+	cmd.Flag("env-format", "The set of environment variables to put the credentials in: standard or legacy").
+		EnumVar(&input.Config.EnvFormat, "standard", "legacy")
+
 	cmd.Flag("json", "AWS credential helper. Ref: https://docs.aws.amazon.com/cli/latest/topic/config-vars.html#sourcing-credentials-from-external-processes").
 		Short('j').
 		BoolVar(&input.CredentialHelper)
@@ -75,13 +109,50 @@ func ConfigureExecCommand(app *kingpin.Application) {
 		Short('s').
 		BoolVar(&input.StartServer)
 
+	cmd.Flag("ecs-server", "Serve credentials to the command from a local container credentials endpoint, the same as --server --server-scope=child").
+		BoolVar(&input.EcsServer)
+
+	cmd.Flag("ec2-server", "Serve credentials to the command from a local EC2 metadata endpoint that doesn't need root, instead of its environment").
+		BoolVar(&input.Ec2Server)
+
+	cmd.Flag("server-scope", "Who can fetch credentials from --server: child (only the command, via a token, the default) or host (any local process)").
+		Envar("AWS_VAULT_SERVER_SCOPE").
+		EnumVar(&input.ServerScope, "host", "child")
+
+	cmd.Flag("background-refresh", "Refresh credentials served by --server in the background before they expire").
+		Envar("AWS_VAULT_BACKGROUND_REFRESH").
+		BoolVar(&input.BackgroundRefresh)
+
+	cmd.Flag("keep-env", "Keep AWS credential and profile variables that are already set in the command's environment").
+		BoolVar(&input.KeepEnv)
+
+	cmd.Flag("clean-env", "Remove all AWS_* variables that are already set from the command's environment").
+		BoolVar(&input.CleanEnv)
+
+	cmd.Flag("strict-env", "Fail if AWS credential or profile variables are already set in the environment").
+		BoolVar(&input.StrictEnv)
+
+	cmd.Flag("dry-run", "Print how credentials would be got, including the STS calls and cached sessions used, without getting them").
+		BoolVar(&input.DryRun)
+
+	cmd.Flag("login-shell", "Run the default shell as an interactive login shell, with the profile in its prompt").
+		Envar("AWS_VAULT_LOGIN_SHELL").
+		BoolVar(&input.LoginShell)
+
+	cmd.Flag("force", "Start a new session even when run inside another aws-vault exec").
+		BoolVar(&input.Force)
+
+	cmd.Flag("chained", "Assume the profile's role with the credentials of the enclosing aws-vault exec").
+		BoolVar(&input.Chained)
+
 	cmd.Arg("profile", "Name of the profile").
 		Required().
-		HintAction(awsConfigFile.ProfileNames).
+		HintAction(profileNamesHint).
+		PreAction(resolveProfileAlias(&input.ProfileName)).
 		StringVar(&input.ProfileName)
 
-	cmd.Arg("cmd", "Command to execute").
-		Default(os.Getenv("SHELL")).
+	cmd.Arg("cmd", "Command to execute, instead of $SHELL").
+		Default(defaultShell()).
 		StringVar(&input.Command)
 
 	cmd.Arg("args", "Command arguments").
@@ -89,46 +160,146 @@ func ConfigureExecCommand(app *kingpin.Application) {
 
 	cmd.Action(func(c *kingpin.ParseContext) error {
 		input.Keyring = keyringImpl
-		input.Config.MfaPrompt = prompt.Method(GlobalFlags.PromptDriver)
-		input.Signals = make(chan os.Signal)
+		configureCredentials(&input.Config)
+		input.Config.MfaDeviceSelector = mfaDeviceSelector(input.ProfileName)
+		input.Signals = make(chan os.Signal, 1)
+		if input.EcsServer {
+			input.StartServer = true
+			input.ServerScope = "child"
+		}
 		ExecCommand(app, input)
 		return nil
 	})
 }
 
 func ExecCommand(app *kingpin.Application, input ExecCommandInput) {
-	if os.Getenv("AWS_VAULT") != "" {
-		app.Fatalf("aws-vault sessions should be nested with care, unset $AWS_VAULT to force")
+	if input.Force && input.Chained {
+		app.Fatalf("Only one of --force and --chained can be used")
+		return
+	}
+	if countTrue(input.KeepEnv, input.CleanEnv, input.StrictEnv) > 1 {
+		app.Fatalf("Only one of --keep-env, --clean-env and --strict-env can be used")
 		return
 	}
+	if input.StrictEnv && !input.Chained {
+		if keys := setEnvKeys(parentCredentialEnvKeys); len(keys) > 0 {
+			app.Fatalf("%s already set in the environment, unset them or use --keep-env or --clean-env", strings.Join(keys, ", "))
+			return
+		}
+	}
+	if outer := os.Getenv("AWS_VAULT"); outer != "" && !input.Force && !input.Chained {
+		app.Fatalf("Already in an aws-vault session for %s, and the credentials of nested sessions expire confusingly. "+
+			"Use --chained to assume %s's role from this session, or --force to start a new one anyway", outer, input.ProfileName)
+		return
+	}
+	if input.Chained {
+		creds, err := enclosingSessionCredentials()
+		if err != nil {
+			app.Fatalf("%v", err)
+			return
+		}
+		input.Config.SourceCredentials = &creds
+	}
 
 	var setEnv = true
 
-	if input.Config.NoSession && input.StartServer {
+	if input.Config.NoSession && (input.StartServer || input.Ec2Server) {
 		app.Fatalf("Can't start a credential server without a session")
 		return
 	}
+	if input.StartServer && input.Ec2Server {
+		app.Fatalf("Only one of --server, --ecs-server and --ec2-server can be used")
+		return
+	}
+	if input.Ec2Server && input.ServerScope == "child" {
+		app.Fatalf("--ec2-server can't be limited to the command with --server-scope=child, as the EC2 metadata protocol has no way to pass it a secret. Use --ecs-server instead")
+		return
+	}
+	if input.ServerScope == "" {
+		input.ServerScope = "child"
+	}
+
+	if !input.Chained && !input.CredentialHelper && !input.DryRun && canRunProfileWizard() {
+		if exists, err := profileExists(input.Keyring, input.ProfileName); err == nil && !exists {
+			created, err := runProfileWizard(input.Keyring, input.ProfileName)
+			if err != nil {
+				app.Fatalf("%v", err)
+				return
+			}
+			if !created {
+				exitStatus = ExitProfileNotFound
+				app.Fatalf("Profile %s doesn't exist, add it with aws-vault add %s", input.ProfileName, input.ProfileName)
+				return
+			}
+		}
+	}
 
 	err := configLoader.LoadFromProfile(input.ProfileName, &input.Config)
 	if err != nil {
 		app.Fatalf("%v", err)
 	}
 
-	creds, err := vault.NewTempCredentials(input.Keyring, &input.Config)
+	if input.Chained && input.Config.RoleARN == "" {
+		app.Fatalf("Profile %s has no role_arn to assume with --chained", input.ProfileName)
+		return
+	}
+
+	if input.CredentialHelper && input.Config.NoExport {
+		app.Fatalf("Profile %q has no_export set, credentials can't be written out with --json", input.ProfileName)
+		return
+	}
+
+	provider, err := vault.NewTempCredentialsProvider(input.Keyring, &input.Config)
 	if err != nil {
 		app.Fatalf("%v", err)
 	}
+	if input.DryRun {
+		plan, err := provider.Plan()
+		if err != nil {
+			app.Fatalf("%v", err)
+			return
+		}
+		printCredentialsPlan(input.ProfileName, plan)
+		fmt.Printf("Then run %s\n", strings.Join(append([]string{input.Command}, input.Args...), " "))
+		return
+	}
+	creds := credentials.NewCredentials(provider)
 
 	val, err := creds.Get()
 	if err != nil {
-		app.Fatalf(FormatCredentialError(err, input.Config.CredentialsName))
+		fatalCredentialError(app, err, input.ProfileName, input.Config.CredentialsName)
 	}
 
-	if input.StartServer {
-		if err := server.StartCredentialsServer(creds); err != nil {
-			app.Fatalf("Failed to start credential server: %v", err)
+	var serverToken *server.Token
+	var ec2Endpoint string
+	if input.StartServer || input.Ec2Server {
+		var serverCreds server.Credentials = creds
+		if input.BackgroundRefresh {
+			if serverCreds, err = vault.NewBackgroundRefreshingCredentials(creds); err != nil {
+				fatalCredentialError(app, err, input.ProfileName, input.Config.CredentialsName)
+			}
+		}
+
+		// the token is needed to refresh or stop the server even when any process can get credentials
+		if serverToken, err = server.NewToken(); err != nil {
+			app.Fatalf("Failed to create credential server token: %v", err)
+		}
+		defer serverToken.Remove()
+
+		if input.Ec2Server {
+			if ec2Endpoint, err = server.StartEc2CredentialsServer(serverCreds, serverToken); err != nil {
+				app.Fatalf("Failed to start the EC2 metadata server: %v", err)
+			}
 		} else {
-			setEnv = false
+			anyProcess := input.ServerScope == "host"
+			if err := server.StartCredentialsServer(serverCreds, input.Config.CredentialsName, provider.ForceRefresh, serverToken, anyProcess); err != nil {
+				app.Fatalf("Failed to start credential server: %v", err)
+			}
+		}
+		setEnv = false
+
+		if input.Config.PromptDriver == "notify" {
+			go notifyBeforeExpiry(serverCreds, input.ProfileName)
 		}
 	}
 
@@ -154,42 +325,110 @@ func ExecCommand(app *kingpin.Application, input ExecCommandInput) {
 	} else {
 
 		env := environ(os.Environ())
+		if input.CleanEnv {
+			env.UnsetAWS()
+		}
+		if !input.KeepEnv {
+			for _, key := range parentCredentialEnvKeys {
+				env.Unset(key)
+			}
+		}
 		env.Set("AWS_VAULT", input.ProfileName)
 
-		env.Unset("AWS_ACCESS_KEY_ID")
-		env.Unset("AWS_SECRET_ACCESS_KEY")
-		env.Unset("AWS_CREDENTIAL_FILE")
-		env.Unset("AWS_DEFAULT_PROFILE")
-		env.Unset("AWS_PROFILE")
-
 		if input.Config.Region != "" {
 			log.Printf("Setting subprocess env: AWS_DEFAULT_REGION=%s, AWS_REGION=%s", input.Config.Region, input.Config.Region)
 			env.Set("AWS_DEFAULT_REGION", input.Config.Region)
 			env.Set("AWS_REGION", input.Config.Region)
 		}
 
+		if input.StartServer && input.ServerScope == "child" {
+			log.Println("Setting subprocess env: AWS_CONTAINER_CREDENTIALS_FULL_URI, AWS_CONTAINER_AUTHORIZATION_TOKEN, AWS_CONTAINER_AUTHORIZATION_TOKEN_FILE")
+			for key, val := range serverToken.Env() {
+				env.Set(key, val)
+			}
+		}
+
+		if ec2Endpoint != "" {
+			log.Printf("Setting subprocess env: AWS_EC2_METADATA_SERVICE_ENDPOINT=%s", ec2Endpoint)
+			env.Set("AWS_EC2_METADATA_SERVICE_ENDPOINT", ec2Endpoint)
+			env.Unset("AWS_EC2_METADATA_DISABLED")
+		}
+
 		if setEnv {
-			log.Println("Setting subprocess env: AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY")
-			env.Set("AWS_ACCESS_KEY_ID", val.AccessKeyID)
-			env.Set("AWS_SECRET_ACCESS_KEY", val.SecretAccessKey)
-
-			if val.SessionToken != "" {
-				log.Println("Setting subprocess env: AWS_SESSION_TOKEN, AWS_SECURITY_TOKEN")
-				env.Set("AWS_SESSION_TOKEN", val.SessionToken)
-				env.Set("AWS_SECURITY_TOKEN", val.SessionToken)
+			for _, v := range credentialEnvVars(val, input.Config.EnvFormat) {
+				log.Printf("Setting subprocess env: %s", v.Key)
+				env.Set(v.Key, v.Value)
+			}
+			// for aws-vault status, and tools that show when credentials expire
+			if expiration, err := creds.ExpiresAt(); err == nil && !expiration.IsZero() {
+				log.Printf("Setting subprocess env: AWS_CREDENTIAL_EXPIRATION=%s", expiration.UTC().Format(time.RFC3339))
+				env.Set("AWS_CREDENTIAL_EXPIRATION", expiration.UTC().Format(time.RFC3339))
 			}
 		}
 
-		cmd := exec.Command(input.Command, input.Args...)
+		args := input.Args
+		var shell shellSetup
+		if input.LoginShell && input.Command == defaultShell() && len(input.Args) == 0 {
+			if shell, err = loginShellSetup(input.Command, input.ProfileName); err != nil {
+				app.Fatalf("Failed to set up the login shell: %v", err)
+			}
+			defer shell.cleanup()
+			args = shell.Args
+			for key, val := range shell.Env {
+				log.Printf("Setting subprocess env: %s", key)
+				env.Set(key, val)
+			}
+		} else if input.LoginShell {
+			log.Printf("Not running a login shell, as a command was given")
+		}
+
+		cmd := exec.Command(input.Command, args...)
 		cmd.Env = env
 		cmd.Stdin = os.Stdin
 		cmd.Stdout = os.Stdout
 		cmd.Stderr = os.Stderr
-		signal.Notify(input.Signals, os.Interrupt, os.Kill)
+		signal.Notify(input.Signals, forwardedSignals...)
 
-		if err := cmd.Start(); err != nil {
-			app.Fatalf("%v", err)
+		// the command may run for a long time and we exit with its status, so export spans now
+		telemetry.Flush()
+
+		span := telemetry.Start("exec.command", map[string]string{"process.command": input.Command})
+		if err := startCommand(cmd); err != nil {
+			span.End(err)
+			fatalCommandError(app, err)
+		}
+
+		session := execSession{
+			Pid:             os.Getpid(),
+			ChildPid:        cmd.Process.Pid,
+			Command:         strings.Join(append([]string{input.Command}, input.Args...), " "),
+			ProfileName:     input.ProfileName,
+			CredentialsName: input.Config.CredentialsName,
+			Server:          input.StartServer || input.Ec2Server,
+			Started:         time.Now(),
+		}
+		if session.PidStarted, err = processStarted(session.Pid); err != nil {
+			logging.Warnf("Can't tell when aws-vault started: %v", err)
 		}
+		if session.ChildStarted, err = processStarted(session.ChildPid); err != nil {
+			logging.Warnf("Can't tell when %s started: %v", input.Command, err)
+		}
+		if input.StartServer {
+			session.ServerURL = server.LocalServerURL
+		} else if input.Ec2Server {
+			session.ServerURL = ec2Endpoint
+		}
+		if serverToken != nil {
+			session.ServerTokenFile = serverToken.Path
+		}
+		if setEnv && !input.Config.NoSession {
+			if session.Expiration, err = creds.ExpiresAt(); err != nil {
+				logging.Warnf("Error getting credential expiration: %v", err)
+			}
+		}
+		registerExecSession(session)
+		defer unregisterExecSession(session.Pid)
+
 		// wait for the command to finish
 		waitCh := make(chan error, 1)
 		go func() {
@@ -200,15 +439,19 @@ func ExecCommand(app *kingpin.Application, input ExecCommandInput) {
 		for {
 			select {
 			case sig := <-input.Signals:
-				if err = cmd.Process.Signal(sig); err != nil {
+				if err = forwardSignal(cmd.Process, sig); err != nil {
 					app.Errorf("%v", err)
-					break
 				}
 			case err := <-waitCh:
-				var waitStatus syscall.WaitStatus
+				span.End(err)
 				if exitError, ok := err.(*exec.ExitError); ok {
-					waitStatus = exitError.Sys().(syscall.WaitStatus)
-					os.Exit(waitStatus.ExitStatus())
+					unregisterExecSession(session.Pid)
+					if serverToken != nil {
+						serverToken.Remove()
+					}
+					shell.cleanup()
+					fmt.Fprint(os.Stderr, telemetry.Summary())
+					os.Exit(exitCode(exitError.ProcessState))
 				}
 				if err != nil {
 					app.Fatalf("%v", err)
@@ -219,6 +462,75 @@ func ExecCommand(app *kingpin.Application, input ExecCommandInput) {
 	}
 }
 
+// parentCredentialEnvKeys are removed from the command's environment unless --keep-env is given, as
+// tools would use them instead of, or mixed with, the credentials exec gives it
+var parentCredentialEnvKeys = append([]string{
+	"AWS_ACCESS_KEY_ID",
+	"AWS_SECRET_ACCESS_KEY",
+	"AWS_SESSION_TOKEN",
+	"AWS_SECURITY_TOKEN",
+	"AWS_CREDENTIAL_EXPIRATION",
+	"AWS_CREDENTIAL_FILE",
+	"AWS_DEFAULT_PROFILE",
+	"AWS_PROFILE",
+}, legacyCredentialEnvKeys...)
+
+// setEnvKeys returns which of keys are set in the environment
+func setEnvKeys(keys []string) []string {
+	var set []string
+	for _, key := range keys {
+		if _, ok := os.LookupEnv(key); ok {
+			set = append(set, key)
+		}
+	}
+	return set
+}
+
+func countTrue(b ...bool) int {
+	n := 0
+	for _, v := range b {
+		if v {
+			n++
+		}
+	}
+	return n
+}
+
+// enclosingSessionCredentials returns the credentials an enclosing aws-vault exec put in the environment
+func enclosingSessionCredentials() (credentials.Value, error) {
+	creds := credentials.Value{
+		AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	}
+	if creds.AccessKeyID == "" || creds.SecretAccessKey == "" {
+		return creds, errors.New("--chained needs the credentials of the enclosing session in AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY, " +
+			"which aren't set when it serves them with --server or --ec2-server")
+	}
+	return creds, nil
+}
+
+// sessionExpiryWarning is how long before the served credentials expire to warn that they're about to
+const sessionExpiryWarning = 5 * time.Minute
+
+// notifyBeforeExpiry raises a desktop notification when the credentials served by --server are about to
+// expire, as refreshing them may need an MFA token
+func notifyBeforeExpiry(creds server.Credentials, profileName string) {
+	var warned time.Time
+	for range time.Tick(30 * time.Second) {
+		expiration, err := creds.ExpiresAt()
+		remaining := time.Until(expiration)
+		if err != nil || expiration.Equal(warned) || remaining > sessionExpiryWarning || remaining <= 0 {
+			continue
+		}
+		warned = expiration
+		msg := fmt.Sprintf("The session for %s expires in %d minutes", profileName, int(remaining.Round(time.Minute).Minutes()))
+		if err := prompt.Notify("aws-vault", msg); err != nil {
+			logging.Warnf("Failed to show notification: %v", err)
+		}
+	}
+}
+
 // environ is a slice of strings representing the environment, in the form "key=value".
 type environ []string
 
@@ -233,6 +545,17 @@ func (e *environ) Unset(key string) {
 	}
 }
 
+// UnsetAWS removes the AWS_* variables, apart from aws-vault's own AWS_VAULT_* settings
+func (e *environ) UnsetAWS() {
+	kept := (*e)[:0]
+	for _, kv := range *e {
+		if !strings.HasPrefix(kv, "AWS_") || strings.HasPrefix(kv, "AWS_VAULT_") {
+			kept = append(kept, kv)
+		}
+	}
+	*e = kept
+}
+
 // Set adds an environment variable, replacing any existing ones of the same key
 func (e *environ) Set(key, val string) {
 	e.Unset(key)
@@ -1,6 +1,8 @@
 package cli
 
 import (
+	"os"
+
 	kingpin "gopkg.in/alecthomas/kingpin.v2"
 
 	"github.com/99designs/aws-vault/vault"
@@ -23,3 +25,41 @@ func ExampleExecCommand() {
 	// Output:
 	// ABC
 }
+
+func ExampleExecCommand_legacyEnvFormat() {
+	awsConfigFile = &vault.ConfigFile{}
+	keyringImpl = keyring.NewArrayKeyring([]keyring.Item{
+		{Key: "llamas", Data: []byte(`{"AccessKeyID":"ABC","SecretAccessKey":"XYZ"}`)},
+	})
+
+	app := kingpin.New("aws-vault", "")
+	ConfigureGlobals(app)
+	ConfigureExecCommand(app)
+	kingpin.MustParse(app.Parse([]string{
+		"--debug", "exec", "--no-session", "--env-format=legacy", "llamas", "--", "sh", "-c", "echo $AWS_ACCESS_KEY $EC2_SECRET_KEY",
+	}))
+
+	// Output:
+	// ABC XYZ
+}
+
+func ExampleExecCommand_cleanEnv() {
+	awsConfigFile = &vault.ConfigFile{}
+	keyringImpl = keyring.NewArrayKeyring([]keyring.Item{
+		{Key: "llamas", Data: []byte(`{"AccessKeyID":"ABC","SecretAccessKey":"XYZ"}`)},
+	})
+	os.Setenv("AWS_SDK_LOAD_CONFIG", "1")
+	os.Setenv("AWS_SESSION_TOKEN", "stale")
+	defer os.Unsetenv("AWS_SDK_LOAD_CONFIG")
+	defer os.Unsetenv("AWS_SESSION_TOKEN")
+
+	app := kingpin.New("aws-vault", "")
+	ConfigureGlobals(app)
+	ConfigureExecCommand(app)
+	kingpin.MustParse(app.Parse([]string{
+		"--debug", "exec", "--no-session", "--clean-env", "llamas", "--", "sh", "-c", "echo $AWS_ACCESS_KEY_ID [$AWS_SDK_LOAD_CONFIG] [$AWS_SESSION_TOKEN]",
+	}))
+
+	// Output:
+	// ABC [] []
+}
@@ -0,0 +1,64 @@
+// +build !windows
+
+package cli
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// forwardedSignals are passed on to the command run by exec
+var forwardedSignals = []os.Signal{
+	syscall.SIGINT,
+	syscall.SIGTERM,
+	syscall.SIGHUP,
+	syscall.SIGQUIT,
+	syscall.SIGWINCH,
+	syscall.SIGUSR1,
+	syscall.SIGUSR2,
+}
+
+// defaultShell is the command exec runs when none is given
+func defaultShell() string {
+	if shell := os.Getenv("SHELL"); shell != "" {
+		return shell
+	}
+	return "/bin/sh"
+}
+
+// inForegroundGroup returns whether aws-vault, and so the command it runs, are in the foreground process
+// group of the terminal
+func inForegroundGroup() bool {
+	pgrp, err := unix.IoctlGetInt(int(os.Stdin.Fd()), unix.TIOCGPGRP)
+	return err == nil && pgrp == unix.Getpgrp()
+}
+
+// forwardSignal passes the signal on to the command. The terminal sends Ctrl-C, Ctrl-\ and window size
+// changes to its whole foreground process group, so those already reach a command in the foreground
+// and aren't sent twice
+func forwardSignal(p *os.Process, sig os.Signal) error {
+	switch sig {
+	case syscall.SIGINT, syscall.SIGQUIT, syscall.SIGWINCH:
+		if inForegroundGroup() {
+			return nil
+		}
+	}
+	return p.Signal(sig)
+}
+
+func startCommand(cmd *exec.Cmd) error {
+	return cmd.Start()
+}
+
+// exitCode returns the command's exit status, or 128 plus the signal number if it was killed by a
+// signal, the same as a shell
+func exitCode(state *os.ProcessState) int {
+	ws := state.Sys().(syscall.WaitStatus)
+	if ws.Signaled() {
+		return 128 + int(ws.Signal())
+	}
+	return ws.ExitStatus()
+}
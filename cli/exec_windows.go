@@ -0,0 +1,83 @@
+// +build windows
+
+package cli
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+	"unsafe"
+
+	"github.com/99designs/aws-vault/logging"
+	"golang.org/x/sys/windows"
+)
+
+// defaultShell is the command exec runs when none is given. SHELL is set by Git Bash and MSYS2, otherwise
+// it's the shell cmd.exe would run
+func defaultShell() string {
+	if shell := os.Getenv("SHELL"); shell != "" {
+		return shell
+	}
+	if comspec := os.Getenv("COMSPEC"); comspec != "" {
+		return comspec
+	}
+	return "cmd.exe"
+}
+
+// forwardedSignals are caught by exec while the command runs, so aws-vault waits for the command to
+// exit and exits with its status. Ctrl-C, Ctrl-Break and closing the console are sent by the console to
+// every process attached to it, so the command gets them without being sent them
+var forwardedSignals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+
+func forwardSignal(p *os.Process, sig os.Signal) error {
+	return nil
+}
+
+// commandJob is kept open while aws-vault runs, when it's closed the processes in it are killed
+var commandJob windows.Handle
+
+// startCommand starts the command in a job object, so that it and any processes it starts are killed
+// when aws-vault exits, like a process group being sent a signal
+func startCommand(cmd *exec.Cmd) error {
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	if err := assignJob(cmd.Process.Pid); err != nil {
+		logging.Warnf("Failed to put the command in a job object: %v", err)
+	}
+	return nil
+}
+
+func assignJob(pid int) error {
+	job, err := windows.CreateJobObject(nil, nil)
+	if err != nil {
+		return err
+	}
+	info := windows.JOBOBJECT_EXTENDED_LIMIT_INFORMATION{
+		BasicLimitInformation: windows.JOBOBJECT_BASIC_LIMIT_INFORMATION{
+			LimitFlags: windows.JOB_OBJECT_LIMIT_KILL_ON_JOB_CLOSE,
+		},
+	}
+	if _, err = windows.SetInformationJobObject(job, windows.JobObjectExtendedLimitInformation,
+		uintptr(unsafe.Pointer(&info)), uint32(unsafe.Sizeof(info))); err != nil {
+		windows.CloseHandle(job)
+		return err
+	}
+
+	p, err := windows.OpenProcess(windows.PROCESS_SET_QUOTA|windows.PROCESS_TERMINATE, false, uint32(pid))
+	if err != nil {
+		windows.CloseHandle(job)
+		return err
+	}
+	defer windows.CloseHandle(p)
+	if err = windows.AssignProcessToJobObject(job, p); err != nil {
+		windows.CloseHandle(job)
+		return err
+	}
+	commandJob = job
+	return nil
+}
+
+func exitCode(state *os.ProcessState) int {
+	return state.ExitCode()
+}
@@ -0,0 +1,65 @@
+package cli
+
+import (
+	"os/exec"
+
+	"github.com/99designs/aws-vault/vault"
+	"github.com/99designs/keyring"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+// Exit codes, so that scripts can tell why aws-vault failed without parsing its error message. The
+// command run by exec exits with its own status, which aws-vault exits with too
+const (
+	ExitError              = 1
+	ExitProfileNotFound    = 3
+	ExitCredentialsMissing = 4
+	ExitMfa                = 5
+	ExitAccessDenied       = 6
+	ExitCommandNotRunnable = 126
+	ExitCommandNotFound    = 127
+)
+
+// exitStatus is what a fatal error exits with, set just before calling app.Fatalf
+var exitStatus = ExitError
+
+// ExitStatus returns the status to exit with, given the one kingpin terminates with
+func ExitStatus(code int) int {
+	if code == ExitError {
+		return exitStatus
+	}
+	return code
+}
+
+// credentialErrorStatus returns the exit code for an error getting credentials for a profile
+func credentialErrorStatus(err error, profileName string) int {
+	switch {
+	case err == keyring.ErrKeyNotFound:
+		if awsConfigFile != nil {
+			if _, ok := awsConfigFile.ProfileSection(profileName); !ok {
+				return ExitProfileNotFound
+			}
+		}
+		return ExitCredentialsMissing
+	case vault.IsMfaError(err):
+		return ExitMfa
+	case vault.IsAccessDeniedError(err):
+		return ExitAccessDenied
+	}
+	return ExitError
+}
+
+// fatalCredentialError exits with the error got getting credentials for a profile
+func fatalCredentialError(app *kingpin.Application, err error, profileName string, credentialsName string) {
+	exitStatus = credentialErrorStatus(err, profileName)
+	app.Fatalf(FormatCredentialError(err, credentialsName))
+}
+
+// fatalCommandError exits with the error starting the command run by exec
+func fatalCommandError(app *kingpin.Application, err error) {
+	exitStatus = ExitCommandNotRunnable
+	if execErr, ok := err.(*exec.Error); ok && execErr.Err == exec.ErrNotFound {
+		exitStatus = ExitCommandNotFound
+	}
+	app.Fatalf("%v", err)
+}
@@ -0,0 +1,198 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/99designs/aws-vault/vault"
+	"github.com/99designs/keyring"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+type ExportCommandInput struct {
+	ProfileName string
+	Format      string
+	Keyring     keyring.Keyring
+	Config      vault.Config
+}
+
+// exportFormats are the syntaxes export can write credentials in
+var exportFormats = []string{"env", "fish", "powershell", "json", "ini"}
+
+func ConfigureExportCommand(app *kingpin.Application) {
+	input := ExportCommandInput{}
+
+	cmd := app.Command("export", "Print temporary credentials in the syntax of a shell, as JSON or as a credentials file section")
+
+	cmd.Flag("format", fmt.Sprintf("Syntax to print the credentials in %v", exportFormats)).
+		Default("env").
+		EnumVar(&input.Format, exportFormats...)
+
+	cmd.Flag("no-session", "Use root credentials, no session created").
+		Short('n').
+		BoolVar(&input.Config.NoSession)
+
+	cmd.Flag("session-ttl", "Expiration time for aws session").
+		Default("4h").
+		Envar("AWS_SESSION_TTL").
+		Short('t').
+		DurationVar(&input.Config.SessionDuration)
+
+	cmd.Flag("assume-role-ttl", "Expiration time for aws assumed role").
+		Default("15m").
+		Envar("AWS_ASSUME_ROLE_TTL").
+		DurationVar(&input.Config.AssumeRoleDuration)
+
+	cmd.Flag("region", "The region to use for STS and to export, instead of the profile's, AWS_REGION or AWS_DEFAULT_REGION").
+		StringVar(&input.Config.Region)
+
+	cmd.Flag("mfa-serial", "The identification number of the MFA device to use").
+		StringVar(&input.Config.MfaSerial)
+
+	cmd.Flag("mfa-device", "The name or serial of the MFA device to use when mfa_serials lists several").
+		StringVar(&input.Config.MfaDevice)
+
+	cmd.Flag("env-format", "The set of environment variables to put the credentials in: standard or legacy").
+		EnumVar(&input.Config.EnvFormat, "standard", "legacy")
+
+	cmd.Arg("profile", "Name of the profile").
+		Required().
+		HintAction(profileNamesHint).
+		PreAction(resolveProfileAlias(&input.ProfileName)).
+		StringVar(&input.ProfileName)
+
+	cmd.Action(func(c *kingpin.ParseContext) error {
+		input.Keyring = keyringImpl
+		configureCredentials(&input.Config)
+		input.Config.MfaDeviceSelector = mfaDeviceSelector(input.ProfileName)
+		ExportCommand(app, input)
+		return nil
+	})
+}
+
+func ExportCommand(app *kingpin.Application, input ExportCommandInput) {
+	if err := configLoader.LoadFromProfile(input.ProfileName, &input.Config); err != nil {
+		app.Fatalf("%v", err)
+		return
+	}
+	if input.Config.NoExport {
+		app.Fatalf("Profile %q has no_export set, credentials can't be exported", input.ProfileName)
+		return
+	}
+
+	creds, err := vault.NewTempCredentials(input.Keyring, &input.Config)
+	if err != nil {
+		app.Fatalf("%v", err)
+		return
+	}
+	val, err := creds.Get()
+	if err != nil {
+		fatalCredentialError(app, err, input.ProfileName, input.Config.CredentialsName)
+		return
+	}
+
+	var expiration time.Time
+	if !input.Config.NoSession {
+		if expiration, err = creds.ExpiresAt(); err != nil {
+			app.Fatalf("Error getting credential expiration: %v", err)
+			return
+		}
+	}
+
+	if err = writeExport(os.Stdout, input.Format, input.ProfileName, input.Config, val, expiration); err != nil {
+		app.Fatalf("%v", err)
+		return
+	}
+}
+
+// writeExport writes the credentials in format. expiration is zero for credentials that don't expire
+func writeExport(w io.Writer, format string, profileName string, config vault.Config, val credentials.Value, expiration time.Time) error {
+	switch format {
+	case "json":
+		data := AwsCredentialHelperData{
+			Version:         1,
+			AccessKeyID:     val.AccessKeyID,
+			SecretAccessKey: val.SecretAccessKey,
+			SessionToken:    val.SessionToken,
+		}
+		if !expiration.IsZero() {
+			data.Expiration = expiration.UTC().Format("2006-01-02T15:04:05Z")
+		}
+		b, err := json.MarshalIndent(&data, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "%s\n", b)
+		return err
+
+	case "ini":
+		fmt.Fprintf(w, "[%s]\n", profileName)
+		fmt.Fprintf(w, "aws_access_key_id = %s\n", val.AccessKeyID)
+		fmt.Fprintf(w, "aws_secret_access_key = %s\n", val.SecretAccessKey)
+		if val.SessionToken != "" {
+			fmt.Fprintf(w, "aws_session_token = %s\n", val.SessionToken)
+		}
+		if config.Region != "" {
+			fmt.Fprintf(w, "region = %s\n", config.Region)
+		}
+		return nil
+	}
+
+	vars := credentialEnvVars(val, config.EnvFormat)
+	var unset []string
+	if !expiration.IsZero() {
+		vars = append(vars, envVar{"AWS_CREDENTIAL_EXPIRATION", expiration.UTC().Format(time.RFC3339)})
+	} else {
+		unset = append(unset, "AWS_CREDENTIAL_EXPIRATION")
+	}
+	// long-term credentials have no token, so one left from an earlier export would be sent along with them
+	if val.SessionToken == "" {
+		unset = append(unset, "AWS_SESSION_TOKEN", "AWS_SECURITY_TOKEN")
+		if config.EnvFormat == "legacy" {
+			unset = append(unset, "AWS_DELEGATION_TOKEN")
+		}
+	}
+	if config.Region != "" {
+		vars = append(vars, envVar{"AWS_DEFAULT_REGION", config.Region}, envVar{"AWS_REGION", config.Region})
+	}
+
+	for _, v := range vars {
+		var err error
+		switch format {
+		case "fish":
+			_, err = fmt.Fprintf(w, "set -gx %s %s;\n", v.Key, shellQuote(v.Value))
+		case "powershell":
+			_, err = fmt.Fprintf(w, "$env:%s = '%s'\n", v.Key, strings.Replace(v.Value, "'", "''", -1))
+		default:
+			_, err = fmt.Fprintf(w, "export %s=%s\n", v.Key, shellQuote(v.Value))
+		}
+		if err != nil {
+			return err
+		}
+	}
+	for _, key := range unset {
+		var err error
+		switch format {
+		case "fish":
+			_, err = fmt.Fprintf(w, "set -e %s;\n", key)
+		case "powershell":
+			_, err = fmt.Fprintf(w, "Remove-Item Env:%s -ErrorAction SilentlyContinue\n", key)
+		default:
+			_, err = fmt.Fprintf(w, "unset %s\n", key)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// shellQuote single quotes s for POSIX shells and fish
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
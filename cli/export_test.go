@@ -0,0 +1,73 @@
+package cli
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+
+	"github.com/99designs/keyring"
+	kingpin "gopkg.in/alecthomas/kingpin.v2"
+)
+
+func ExampleExportCommand() {
+	f, err := ioutil.TempFile("", "aws-config")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString("[profile llamas]\nregion = us-west-2\n")
+	f.Close()
+
+	os.Setenv("AWS_CONFIG_FILE", f.Name())
+	defer os.Unsetenv("AWS_CONFIG_FILE")
+
+	awsConfigFile = nil
+	keyringImpl = keyring.NewArrayKeyring([]keyring.Item{
+		{Key: "llamas", Data: []byte(`{"AccessKeyID":"ABC","SecretAccessKey":"XYZ"}`)},
+	})
+
+	app := kingpin.New(`aws-vault`, ``)
+	ConfigureGlobals(app)
+	ConfigureExportCommand(app)
+	kingpin.MustParse(app.Parse([]string{
+		"export", "--no-session", "--format", "ini", "llamas",
+	}))
+
+	// Output:
+	// [llamas]
+	// aws_access_key_id = ABC
+	// aws_secret_access_key = XYZ
+	// region = us-west-2
+}
+
+func ExampleExportCommand_unsetsSessionToken() {
+	f, err := ioutil.TempFile("", "aws-config")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString("[profile llamas]\n")
+	f.Close()
+
+	os.Setenv("AWS_CONFIG_FILE", f.Name())
+	defer os.Unsetenv("AWS_CONFIG_FILE")
+
+	awsConfigFile = nil
+	keyringImpl = keyring.NewArrayKeyring([]keyring.Item{
+		{Key: "llamas", Data: []byte(`{"AccessKeyID":"ABC","SecretAccessKey":"XYZ"}`)},
+	})
+
+	app := kingpin.New(`aws-vault`, ``)
+	ConfigureGlobals(app)
+	ConfigureExportCommand(app)
+	kingpin.MustParse(app.Parse([]string{
+		"export", "--no-session", "llamas",
+	}))
+
+	// Output:
+	// export AWS_ACCESS_KEY_ID='ABC'
+	// export AWS_SECRET_ACCESS_KEY='XYZ'
+	// unset AWS_CREDENTIAL_EXPIRATION
+	// unset AWS_SESSION_TOKEN
+	// unset AWS_SECURITY_TOKEN
+}
@@ -0,0 +1,105 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/99designs/aws-vault/prompt"
+	"github.com/99designs/aws-vault/vault"
+	"github.com/99designs/keyring"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// profileExists is true if the profile is in the config file or has credentials stored
+func profileExists(k keyring.Keyring, profileName string) (bool, error) {
+	if _, ok := awsConfigFile.ProfileSection(profileName); ok {
+		return true, nil
+	}
+	keys, err := k.Keys()
+	if err != nil {
+		return false, err
+	}
+	return contains(keys, profileName), nil
+}
+
+// canRunProfileWizard is true if someone is at the terminal to answer the wizard's questions,
+// and its answers can be saved
+func canRunProfileWizard() bool {
+	return !GlobalFlags.ReadOnly && terminal.IsTerminal(int(os.Stdin.Fd())) && terminal.IsTerminal(int(os.Stderr.Fd()))
+}
+
+// runProfileWizard offers to create a profile that doesn't exist, by asking for its credentials or
+// the role it assumes, then writing it to the config file. It returns false if the offer is declined
+func runProfileWizard(k keyring.Keyring, profileName string) (bool, error) {
+	fmt.Fprintf(os.Stderr, "Profile %s isn't in %s and has no stored credentials.\n", profileName, awsConfigFile.Path)
+	answer, err := prompt.TerminalPrompt("Create it now? [Y/n] ")
+	if err != nil {
+		return false, err
+	}
+	if answer != "" && !strings.HasPrefix(strings.ToLower(answer), "y") {
+		return false, nil
+	}
+
+	section := vault.ProfileSection{Name: profileName}
+	var creds *credentials.Value
+
+	method, err := prompt.TerminalPrompt("Use (1) an access key, or (2) a role assumed with another profile's credentials? [1] ")
+	if err != nil {
+		return false, err
+	}
+	switch method {
+	case "", "1":
+		creds = &credentials.Value{}
+		if creds.AccessKeyID, err = prompt.TerminalPrompt("Access Key ID: "); err != nil {
+			return false, err
+		}
+		fmt.Fprint(os.Stderr, "Secret Access Key: ")
+		secret, err := terminal.ReadPassword(int(os.Stdin.Fd()))
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return false, err
+		}
+		creds.SecretAccessKey = strings.TrimSpace(string(secret))
+		if creds.AccessKeyID == "" || creds.SecretAccessKey == "" {
+			return false, fmt.Errorf("An access key ID and secret access key are both needed")
+		}
+	case "2":
+		if section.RoleARN, err = prompt.TerminalPrompt("Role ARN: "); err != nil {
+			return false, err
+		}
+		if !strings.HasPrefix(section.RoleARN, "arn:") {
+			return false, fmt.Errorf("%q isn't a role ARN, they look like arn:aws:iam::123456789012:role/name", section.RoleARN)
+		}
+		if section.SourceProfile, err = prompt.TerminalPrompt("Profile whose credentials assume the role: "); err != nil {
+			return false, err
+		}
+		if exists, err := profileExists(k, section.SourceProfile); err != nil {
+			return false, err
+		} else if !exists || section.SourceProfile == profileName {
+			return false, fmt.Errorf("Profile %q doesn't exist, create it first with aws-vault add", section.SourceProfile)
+		}
+	default:
+		return false, fmt.Errorf("Expected 1 or 2, got %q", method)
+	}
+
+	if section.MfaSerial, err = prompt.TerminalPrompt("MFA device serial or ARN, if MFA is needed: "); err != nil {
+		return false, err
+	}
+	if section.Region, err = prompt.TerminalPrompt("Region, if the profile has one: "); err != nil {
+		return false, err
+	}
+
+	if creds != nil {
+		if err = vault.NewMasterCredentialsProvider(k, profileName).Store(*creds); err != nil {
+			return false, err
+		}
+		infof("Added credentials to profile %q in vault\n", profileName)
+	}
+	if err = awsConfigFile.Add(section); err != nil {
+		return false, fmt.Errorf("Error adding profile: %v", err)
+	}
+	infof("Added profile %s to %s\n", profileName, awsConfigFile.Path)
+	return true, nil
+}
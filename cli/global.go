@@ -5,8 +5,12 @@ import (
 	"io/ioutil"
 	"log"
 	"os"
+	"time"
 
+	"github.com/99designs/aws-vault/backend"
+	"github.com/99designs/aws-vault/logging"
 	"github.com/99designs/aws-vault/prompt"
+	"github.com/99designs/aws-vault/telemetry"
 	"github.com/99designs/aws-vault/vault"
 	"github.com/99designs/keyring"
 	"golang.org/x/crypto/ssh/terminal"
@@ -24,31 +28,103 @@ var (
 	promptsAvailable = prompt.Available()
 )
 
-var GlobalFlags struct {
-	Debug        bool
-	Backend      string
-	PromptDriver string
-	KeychainName string
-	PassDir      string
-	PassCmd      string
-	PassPrefix   string
+type globalFlags struct {
+	Debug                   bool
+	LogFormat               string
+	Quiet                   bool
+	CheckUpdate             bool
+	Backend                 string
+	ReadOnly                bool
+	Vault                   string
+	FileDir                 string
+	PromptDriver            string
+	KeychainName            string
+	KeychainTimeout         time.Duration
+	KeychainAccess          string
+	KeychainTrustedApps     []string
+	PassDir                 string
+	PassCmd                 string
+	PassPrefix              string
+	SecretServiceCollection string
+	KWalletFolder           string
+	WinCredPrefix           string
+	FilePivSlot             string
+	EncryptedFilePath       string
+	EncryptedFileArgon2     string
+	EncryptedFileAgentTTL   time.Duration
+	TPMPath                 string
+	AgePath                 string
+	AgeRecipients           []string
+	AgeRecipientsFile       string
+	AgeIdentity             string
+	GPGPath                 string
+	GPGRecipients           []string
+	OpVault                 string
+	HashiCorpVaultAddr      string
+	HashiCorpVaultMount     string
+	HashiCorpVaultPath      string
+	HashiCorpVaultAuth      string
+	HashiCorpVaultRole      string
+	Pkcs11Module            string
+	OtlpEndpoint            string
+	Time                    bool
+	MfaToken                string
+	PromptTimeout           time.Duration
+	SessionBackend          string
+	SessionDir              string
 }
 
-func ConfigureGlobals(app *kingpin.Application) {
-	backendsAvailable := []string{}
+var GlobalFlags globalFlags
+
+// availableBackends returns the names of the keyring backends, and those provided by aws-vault and plugins
+func availableBackends() []string {
+	names := []string{}
 	for _, backendType := range keyring.AvailableBackends() {
-		backendsAvailable = append(backendsAvailable, string(backendType))
+		names = append(names, string(backendType))
 	}
+	return append(names, backend.Available()...)
+}
+
+func ConfigureGlobals(app *kingpin.Application) {
+	backendsAvailable := availableBackends()
 
 	app.Flag("debug", "Show debugging output").
 		BoolVar(&GlobalFlags.Debug)
 
+	app.Flag("log-format", fmt.Sprintf("Format of the debugging output %v", logFormats)).
+		Default("text").
+		Envar("AWS_VAULT_LOG_FORMAT").
+		EnumVar(&GlobalFlags.LogFormat, logFormats...)
+
+	app.Flag("quiet", "Don't print informational messages to stderr, only prompts and errors").
+		Envar("AWS_VAULT_QUIET").
+		BoolVar(&GlobalFlags.Quiet)
+
+	app.Flag("check-update", "Say when a newer release of aws-vault is available, checking GitHub at most once a day").
+		Envar("AWS_VAULT_CHECK_UPDATE").
+		BoolVar(&GlobalFlags.CheckUpdate)
+
 	app.Flag("backend", fmt.Sprintf("Secret backend to use %v", backendsAvailable)).
 		Envar("AWS_VAULT_BACKEND").
 		EnumVar(&GlobalFlags.Backend, backendsAvailable...)
 
-	app.Flag("prompt", fmt.Sprintf("Prompt driver to use %v", promptsAvailable)).
-		Default("terminal").
+	app.Flag("session-backend", fmt.Sprintf("Secret backend to cache sessions in, instead of the backend credentials are in %v", backendsAvailable)).
+		Envar("AWS_VAULT_SESSION_BACKEND").
+		EnumVar(&GlobalFlags.SessionBackend, backendsAvailable...)
+
+	app.Flag("session-dir", "Directory file based session backends keep sessions in, instead of the user's cache directory").
+		Envar("AWS_VAULT_SESSION_DIR").
+		StringVar(&GlobalFlags.SessionDir)
+
+	app.Flag("read-only", "Fail anything that would store or remove credentials or sessions").
+		Envar("AWS_VAULT_READONLY").
+		BoolVar(&GlobalFlags.ReadOnly)
+
+	app.Flag("vault", "Name of the vault to use, keeping its credentials apart from those of other vaults").
+		Envar("AWS_VAULT_VAULT").
+		StringVar(&GlobalFlags.Vault)
+
+	app.Flag("prompt", fmt.Sprintf("Prompt driver to use %v, instead of the profile's prompt or terminal", promptsAvailable)).
 		Envar("AWS_VAULT_PROMPT").
 		EnumVar(&GlobalFlags.PromptDriver, promptsAvailable...)
 
@@ -57,6 +133,19 @@ func ConfigureGlobals(app *kingpin.Application) {
 		Envar("AWS_VAULT_KEYCHAIN_NAME").
 		StringVar(&GlobalFlags.KeychainName)
 
+	app.Flag("keychain-timeout", "Lock the macOS keychain, and forget the file backend passphrase, after this long unused").
+		Envar("AWS_VAULT_KEYCHAIN_TIMEOUT").
+		DurationVar(&GlobalFlags.KeychainTimeout)
+
+	app.Flag("keychain-access", fmt.Sprintf("Whether macOS asks before aws-vault reads its keychain items %v", keychainAccessModes)).
+		Default(keychainTrusted).
+		Envar("AWS_VAULT_KEYCHAIN_ACCESS").
+		EnumVar(&GlobalFlags.KeychainAccess, keychainAccessModes...)
+
+	app.Flag("keychain-trusted-app", "Path of another application that can read the keychain items without asking, can be repeated").
+		PlaceHolder("PATH").
+		StringsVar(&GlobalFlags.KeychainTrustedApps)
+
 	app.Flag("pass-dir", "Pass password store directory").
 		Envar("AWS_VAULT_PASS_PASSWORD_STORE_DIR").
 		StringVar(&GlobalFlags.PassDir)
@@ -69,55 +158,208 @@ func ConfigureGlobals(app *kingpin.Application) {
 		Envar("AWS_VAULT_PASS_PREFIX").
 		StringVar(&GlobalFlags.PassPrefix)
 
+	app.Flag("secret-service-collection", "Name of the secret-service collection to use, e.g. login to use the one unlocked when you log in").
+		Default("awsvault").
+		Envar("AWS_VAULT_SECRET_SERVICE_COLLECTION").
+		StringVar(&GlobalFlags.SecretServiceCollection)
+
+	app.Flag("kwallet-folder", "Name of the folder in the aws-vault KWallet wallet to use").
+		Default("aws-vault").
+		Envar("AWS_VAULT_KWALLET_FOLDER").
+		StringVar(&GlobalFlags.KWalletFolder)
+
+	app.Flag("wincred-prefix", "Prefix of the Windows Credential Manager targets credentials are stored under").
+		Default("aws-vault").
+		Envar("AWS_VAULT_WINCRED_PREFIX").
+		StringVar(&GlobalFlags.WinCredPrefix)
+
+	app.Flag("file-piv-slot", "YubiKey PIV slot used to unlock the file backend instead of a passphrase").
+		Envar("AWS_VAULT_FILE_PIV_SLOT").
+		StringVar(&GlobalFlags.FilePivSlot)
+
+	app.Flag("encrypted-file-path", "Directory the encrypted-file backend keeps credentials in").
+		Default("~/.awsvault/encrypted/").
+		Envar("AWS_VAULT_ENCRYPTED_FILE_PATH").
+		StringVar(&GlobalFlags.EncryptedFilePath)
+
+	app.Flag("encrypted-file-argon2", "Argon2id parameters to create an encrypted-file vault with, as memory in KiB, passes and threads").
+		Default(backend.DefaultArgon2Params).
+		Envar("AWS_VAULT_ENCRYPTED_FILE_ARGON2").
+		StringVar(&GlobalFlags.EncryptedFileArgon2)
+
+	app.Flag("encrypted-file-agent-ttl", "Keep the encrypted-file backend unlocked in an agent process for this long").
+		Envar("AWS_VAULT_ENCRYPTED_FILE_AGENT_TTL").
+		DurationVar(&GlobalFlags.EncryptedFileAgentTTL)
+
+	app.Flag("tpm-path", "Directory the tpm backend keeps credentials in").
+		Default("~/.awsvault/tpm/").
+		Envar("AWS_VAULT_TPM_PATH").
+		StringVar(&GlobalFlags.TPMPath)
+
+	app.Flag("age-path", "Directory the age backend keeps credentials in").
+		Default("~/.awsvault/age/").
+		Envar("AWS_VAULT_AGE_PATH").
+		StringVar(&GlobalFlags.AgePath)
+
+	app.Flag("age-recipient", "Public key or SSH key to encrypt credentials to with the age backend, can be repeated").
+		StringsVar(&GlobalFlags.AgeRecipients)
+
+	app.Flag("age-recipients-file", "File of public keys or SSH keys to encrypt credentials to with the age backend").
+		Envar("AWS_VAULT_AGE_RECIPIENTS_FILE").
+		StringVar(&GlobalFlags.AgeRecipientsFile)
+
+	app.Flag("age-identity", "Identity file, or SSH private key, to decrypt credentials with the age backend").
+		Envar("AWS_VAULT_AGE_IDENTITY").
+		StringVar(&GlobalFlags.AgeIdentity)
+
+	app.Flag("gpg-path", "Directory the gpg backend keeps credentials in").
+		Default("~/.awsvault/gpg/").
+		Envar("AWS_VAULT_GPG_PATH").
+		StringVar(&GlobalFlags.GPGPath)
+
+	app.Flag("gpg-recipient", "GPG key to encrypt credentials to with the gpg backend, can be repeated").
+		StringsVar(&GlobalFlags.GPGRecipients)
+
+	app.Flag("op-vault", "The 1Password vault the op backend keeps credentials in").
+		Envar("AWS_VAULT_OP_VAULT").
+		StringVar(&GlobalFlags.OpVault)
+
+	app.Flag("hashicorp-vault-addr", "Address of the HashiCorp Vault server the hashicorp-vault backend uses").
+		Envar("VAULT_ADDR").
+		StringVar(&GlobalFlags.HashiCorpVaultAddr)
+
+	app.Flag("hashicorp-vault-mount", "The KV version 2 secrets engine the hashicorp-vault backend keeps credentials in").
+		Default("secret").
+		Envar("AWS_VAULT_HASHICORP_VAULT_MOUNT").
+		StringVar(&GlobalFlags.HashiCorpVaultMount)
+
+	app.Flag("hashicorp-vault-path", "Path in the secrets engine the hashicorp-vault backend keeps credentials under").
+		Default("aws-vault").
+		Envar("AWS_VAULT_HASHICORP_VAULT_PATH").
+		StringVar(&GlobalFlags.HashiCorpVaultPath)
+
+	app.Flag("hashicorp-vault-auth", "How the hashicorp-vault backend authenticates: token or oidc").
+		Default("token").
+		Envar("AWS_VAULT_HASHICORP_VAULT_AUTH").
+		EnumVar(&GlobalFlags.HashiCorpVaultAuth, "token", "oidc")
+
+	app.Flag("hashicorp-vault-role", "The oidc role the hashicorp-vault backend signs in with").
+		Envar("AWS_VAULT_HASHICORP_VAULT_ROLE").
+		StringVar(&GlobalFlags.HashiCorpVaultRole)
+
+	app.Flag("pkcs11-module", "Keep master credentials and TOTP secrets on the PKCS#11 token this module drives, e.g. opensc-pkcs11.so").
+		Envar("AWS_VAULT_PKCS11_MODULE").
+		StringVar(&GlobalFlags.Pkcs11Module)
+
+	app.Flag("otlp-endpoint", "Export trace spans of keyring access and AWS API calls to this OpenTelemetry collector").
+		Envar("AWS_VAULT_OTLP_ENDPOINT").
+		StringVar(&GlobalFlags.OtlpEndpoint)
+
+	app.Flag("time", "Print a summary of where the time went to stderr on exit: keyring access, MFA prompts, each AWS call and the command exec runs").
+		Envar("AWS_VAULT_TIME").
+		BoolVar(&GlobalFlags.Time)
+
+	app.Flag("mfa-token", "The mfa token to use, or - to read it from stdin").
+		Short('m').
+		Envar("AWS_VAULT_MFA_TOKEN").
+		StringVar(&GlobalFlags.MfaToken)
+
+	app.Flag("prompt-timeout", "Fail if no MFA token is entered within this time, e.g. 30s").
+		Envar("AWS_VAULT_PROMPT_TIMEOUT").
+		DurationVar(&GlobalFlags.PromptTimeout)
+
 	app.PreAction(func(c *kingpin.ParseContext) (err error) {
 		if !GlobalFlags.Debug {
 			log.SetOutput(ioutil.Discard)
 		} else {
+			log.SetFlags(0)
+			log.SetOutput(&logWriter{out: os.Stderr, format: GlobalFlags.LogFormat})
 			keyring.Debug = true
 		}
-		if keyringImpl == nil {
-			var allowedBackends []keyring.BackendType
-			if GlobalFlags.Backend != "" {
-				allowedBackends = append(allowedBackends, keyring.BackendType(GlobalFlags.Backend))
+		if GlobalFlags.Quiet {
+			vault.Messages = ioutil.Discard
+		}
+		if GlobalFlags.OtlpEndpoint != "" && c.SelectedCommand != nil {
+			telemetry.Enable(GlobalFlags.OtlpEndpoint, c.SelectedCommand.FullCommand())
+		}
+		if GlobalFlags.Time && c.SelectedCommand != nil {
+			telemetry.EnableTiming(c.SelectedCommand.FullCommand())
+		}
+		// doctor reports problems with the config file and backend itself, lock doesn't need to open
+		// the backend it's locking, status only reads the environment and upgrade only replaces the binary
+		var command string
+		if c.SelectedCommand != nil {
+			command = c.SelectedCommand.FullCommand()
+		}
+		if GlobalFlags.CheckUpdate && command != "upgrade" {
+			notifyNewVersion()
+		}
+		if command == "upgrade" {
+			return nil
+		}
+		doctor := command == "doctor"
+		if awsConfigFile == nil {
+			if awsConfigFile, err = vault.LoadConfigFromEnv(); err != nil && !doctor {
+				return err
 			}
-			keyringImpl, err = keyring.Open(keyring.Config{
-				ServiceName:              "aws-vault",
-				AllowedBackends:          allowedBackends,
-				KeychainName:             GlobalFlags.KeychainName,
-				FileDir:                  "~/.awsvault/keys/",
-				FilePasswordFunc:         fileKeyringPassphrasePrompt,
-				PassDir:                  GlobalFlags.PassDir,
-				PassCmd:                  GlobalFlags.PassCmd,
-				PassPrefix:               GlobalFlags.PassPrefix,
-				LibSecretCollectionName:  "awsvault",
-				KWalletAppID:             "aws-vault",
-				KWalletFolder:            "aws-vault",
-				KeychainTrustApplication: true,
-				WinCredPrefix:            "aws-vault",
-			})
-			if err != nil {
+		}
+		configLoader = &vault.ConfigLoader{File: awsConfigFile}
+		if GlobalFlags.FileDir == "" {
+			GlobalFlags.FileDir = defaultFileDir
+		}
+		if GlobalFlags.Vault != "" && awsConfigFile != nil {
+			v, _ := awsConfigFile.VaultSection(GlobalFlags.Vault)
+			if err = applyVault(v, backendsAvailable); err != nil {
 				return err
 			}
 		}
-		if awsConfigFile == nil {
-			awsConfigFile, err = vault.LoadConfigFromEnv()
+		if keyringImpl == nil && !doctor && command != "lock" && command != "status" && command != "show" {
+			if GlobalFlags.KeychainTimeout > 0 {
+				if usesKeychain(GlobalFlags.Backend) {
+					if err = setKeychainTimeout(GlobalFlags.KeychainName, GlobalFlags.KeychainTimeout); err != nil {
+						logging.Warnf("Failed to set the keychain timeout: %v", err)
+					}
+				}
+				keyringImpl, err = newRelockingKeyring(openKeyring, GlobalFlags.KeychainTimeout)
+			} else {
+				keyringImpl, err = openKeyring()
+			}
+			if err != nil {
+				return err
+			}
+			if GlobalFlags.ReadOnly {
+				keyringImpl = readOnlyKeyring{keyringImpl}
+			}
+			if telemetry.Enabled() {
+				keyringImpl = telemetry.Keyring(keyringImpl, GlobalFlags.Backend)
+			}
 		}
-		configLoader = &vault.ConfigLoader{File: awsConfigFile}
-		return err
+		return nil
 	})
 }
 
+// infof writes an informational message to stderr, unless --quiet is given. Prompts and errors are
+// always written
+func infof(format string, a ...interface{}) {
+	if !GlobalFlags.Quiet {
+		fmt.Fprintf(os.Stderr, format, a...)
+	}
+}
+
 func fileKeyringPassphrasePrompt(prompt string) (string, error) {
 	if password := os.Getenv("AWS_VAULT_FILE_PASSPHRASE"); password != "" {
 		return password, nil
 	}
+	if completing {
+		return "", errCompleting
+	}
 
 	fmt.Fprintf(os.Stderr, "%s: ", prompt)
 	b, err := terminal.ReadPassword(int(os.Stdin.Fd()))
 	if err != nil {
 		return "", err
 	}
-	fmt.Println()
+	fmt.Fprintln(os.Stderr)
 	return string(b), nil
 }
 
@@ -125,3 +367,108 @@ func fileKeyringPassphrasePrompt(prompt string) (string, error) {
 func FormatCredentialError(err error, credentialsName string) string {
 	return fmt.Sprintf("Failed to get credentials for %s: %v", credentialsName, err)
 }
+
+// openKeyring opens the backend selected by the global flags
+func openKeyring() (keyring.Keyring, error) {
+	k, err := openBackend(GlobalFlags.Backend)
+	if err != nil || GlobalFlags.SessionBackend == "" {
+		return k, err
+	}
+	return openSessionStore(k)
+}
+
+// openBackend opens the named backend, configured by the global flags. With no name the first
+// keyring backend that opens is used
+func openBackend(name string) (keyring.Keyring, error) {
+	return openBackendWith(name, GlobalFlags)
+}
+
+// filePassphraseFunc returns how the passphrase of the file based backends is asked for
+func filePassphraseFunc(flags globalFlags) keyring.PromptFunc {
+	if flags.FilePivSlot != "" {
+		return pivPassphrasePrompt(flags.FilePivSlot, fileKeyringPassphrasePrompt)
+	}
+	return fileKeyringPassphrasePrompt
+}
+
+// keyringOpener returns a function that opens the keyring library's backend b, configured by flags, with
+// a prompt for the file backend's passphrase
+func keyringOpener(b keyring.BackendType, flags globalFlags) func(keyring.PromptFunc) (keyring.Keyring, error) {
+	return func(prompt keyring.PromptFunc) (keyring.Keyring, error) {
+		return keyring.Open(keyring.Config{
+			ServiceName:              "aws-vault",
+			AllowedBackends:          []keyring.BackendType{b},
+			KeychainName:             flags.KeychainName,
+			FileDir:                  flags.FileDir,
+			FilePasswordFunc:         prompt,
+			PassDir:                  flags.PassDir,
+			PassCmd:                  flags.PassCmd,
+			PassPrefix:               flags.PassPrefix,
+			LibSecretCollectionName:  flags.SecretServiceCollection,
+			KWalletAppID:             "aws-vault",
+			KWalletFolder:            flags.KWalletFolder,
+			KeychainTrustApplication: flags.KeychainAccess != keychainConfirm,
+			WinCredPrefix:            flags.WinCredPrefix,
+		})
+	}
+}
+
+// openBackendWith opens the named backend configured by flags
+func openBackendWith(name string, flags globalFlags) (k keyring.Keyring, err error) {
+	filePasswordFunc := filePassphraseFunc(flags)
+	if backend.IsBackend(name) {
+		k, err = backend.Open(name, backend.Config{
+			PassphraseFunc:        filePasswordFunc,
+			EncryptedFileDir:      flags.EncryptedFilePath,
+			EncryptedFileArgon2:   flags.EncryptedFileArgon2,
+			EncryptedFileAgentTTL: flags.EncryptedFileAgentTTL,
+			TPMDir:                flags.TPMPath,
+			AgeDir:                flags.AgePath,
+			AgeRecipients:         flags.AgeRecipients,
+			AgeRecipientsFile:     flags.AgeRecipientsFile,
+			AgeIdentity:           flags.AgeIdentity,
+			GPGDir:                flags.GPGPath,
+			GPGRecipients:         flags.GPGRecipients,
+			OpVault:               flags.OpVault,
+			HashiCorpVaultAddr:    flags.HashiCorpVaultAddr,
+			HashiCorpVaultMount:   flags.HashiCorpVaultMount,
+			HashiCorpVaultPath:    flags.HashiCorpVaultPath,
+			HashiCorpVaultAuth:    flags.HashiCorpVaultAuth,
+			HashiCorpVaultRole:    flags.HashiCorpVaultRole,
+			// there's no flag for these, as they'd be visible in the process list
+			MemoryItems: os.Getenv("AWS_VAULT_MEMORY_ITEMS"),
+		})
+	} else {
+		// with no name the first keyring backend that opens is used, which is tried here rather than by
+		// keyring so the file backend always has its integrity checked
+		candidates := keyring.AvailableBackends()
+		if name != "" {
+			candidates = []keyring.BackendType{keyring.BackendType(name)}
+		}
+		err = keyring.ErrNoAvailImpl
+		for _, b := range candidates {
+			if b == keyring.FileBackend {
+				k, err = backend.WithIntegrity(flags.FileDir, filePasswordFunc, keyringOpener(b, flags))
+			} else {
+				k, err = keyringOpener(b, flags)(filePasswordFunc)
+			}
+			if err == nil {
+				name = string(b)
+				break
+			}
+			logging.Warnf("Failed to open %s: %v", b, err)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if usesKeychain(name) {
+		if k, err = keychainAccess(k, flags.KeychainName, flags.KeychainAccess, flags.KeychainTrustedApps); err != nil {
+			return nil, err
+		}
+	}
+	if flags.Pkcs11Module != "" {
+		k = newPkcs11Keyring(k, flags.Pkcs11Module, flags.Vault)
+	}
+	return k, nil
+}
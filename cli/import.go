@@ -0,0 +1,137 @@
+package cli
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/99designs/aws-vault/vault"
+	"github.com/99designs/keyring"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+type ImportCommandInput struct {
+	ProfileNames []string
+	Keyring      keyring.Keyring
+	File         string
+	CommentOut   bool
+	Overwrite    bool
+	AddConfig    bool
+}
+
+func ConfigureImportCommand(app *kingpin.Application) {
+	input := ImportCommandInput{}
+
+	cmd := app.Command("import", "Store the access keys in the plaintext shared credentials file, ~/.aws/credentials")
+
+	cmd.Arg("profiles", "Profiles to import, by default every profile with an access key").
+		StringsVar(&input.ProfileNames)
+
+	cmd.Flag("file", "Shared credentials file to import from").
+		Envar("AWS_SHARED_CREDENTIALS_FILE").
+		StringVar(&input.File)
+
+	cmd.Flag("comment-out", "Comment out the imported profiles in the shared credentials file").
+		BoolVar(&input.CommentOut)
+
+	cmd.Flag("overwrite", "Replace credentials that are already stored").
+		BoolVar(&input.Overwrite)
+
+	cmd.Flag("add-config", "Add a profile to ~/.aws/config for each imported one that doesn't exist").
+		Default("true").
+		BoolVar(&input.AddConfig)
+
+	cmd.Action(func(c *kingpin.ParseContext) (err error) {
+		checkWritable(app, "import credentials")
+		if input.File == "" {
+			if input.File, err = vault.SharedCredentialsPath(); err != nil {
+				app.Fatalf("%v", err)
+				return nil
+			}
+		}
+		input.Keyring = keyringImpl
+		ImportCommand(app, input)
+		return nil
+	})
+}
+
+func ImportCommand(app *kingpin.Application, input ImportCommandInput) {
+	shared, err := vault.LoadSharedCredentials(input.File)
+	if err != nil {
+		app.Fatalf("%v", err)
+		return
+	}
+
+	existing, err := input.Keyring.Keys()
+	if err != nil {
+		app.Fatalf(err.Error())
+		return
+	}
+
+	for _, profileName := range input.ProfileNames {
+		found := false
+		for _, c := range shared {
+			found = found || c.ProfileName == profileName
+		}
+		if !found {
+			app.Fatalf("%s has no access key for profile %q", input.File, profileName)
+			return
+		}
+	}
+
+	var imported []string
+	skipped := 0
+	for _, c := range shared {
+		if len(input.ProfileNames) > 0 && !contains(input.ProfileNames, c.ProfileName) {
+			continue
+		}
+		if c.SessionToken != "" {
+			fmt.Printf("Skipped %s, it has temporary credentials\n", c.ProfileName)
+			skipped++
+			continue
+		}
+		if c.SecretAccessKey == "" {
+			fmt.Printf("Skipped %s, it has no secret access key\n", c.ProfileName)
+			skipped++
+			continue
+		}
+		if contains(existing, c.ProfileName) && !input.Overwrite {
+			fmt.Printf("Skipped %s, it's already stored\n", c.ProfileName)
+			skipped++
+			continue
+		}
+
+		provider := vault.NewMasterCredentialsProvider(input.Keyring, c.ProfileName)
+		if err = provider.Store(credentials.Value{AccessKeyID: c.AccessKeyID, SecretAccessKey: c.SecretAccessKey}); err != nil {
+			app.Fatalf("Failed to store %s: %v", c.ProfileName, err)
+			return
+		}
+		if n, _ := vault.NewKeyringSessions(input.Keyring).Delete(c.ProfileName); n > 0 {
+			log.Printf("Deleted %d existing sessions of %s", n, c.ProfileName)
+		}
+		fmt.Printf("Imported %s\n", c.ProfileName)
+		imported = append(imported, c.ProfileName)
+
+		if _, hasProfile := awsConfigFile.ProfileSection(c.ProfileName); !hasProfile && input.AddConfig {
+			log.Printf("Adding profile %s to config at %s", c.ProfileName, awsConfigFile.Path)
+			if err = awsConfigFile.Add(vault.ProfileSection{Name: c.ProfileName}); err != nil {
+				app.Fatalf("Error adding profile: %v", err)
+				return
+			}
+		}
+	}
+
+	fmt.Printf("Imported %d profiles", len(imported))
+	if skipped > 0 {
+		fmt.Printf(", skipped %d", skipped)
+	}
+	fmt.Println()
+
+	if input.CommentOut && len(imported) > 0 {
+		if err = vault.CommentOutSharedCredentials(input.File, imported); err != nil {
+			app.Fatalf("Failed to comment out the imported profiles in %s: %v", input.File, err)
+			return
+		}
+		fmt.Printf("Commented out the imported profiles in %s\n", input.File)
+	}
+}
@@ -0,0 +1,149 @@
+package cli
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/99designs/aws-vault/vault"
+	"github.com/99designs/keyring"
+)
+
+const (
+	// keychainTrusted items can be read by aws-vault without asking
+	keychainTrusted = "trusted"
+	// keychainConfirm items need the user to allow each read
+	keychainConfirm = "confirm"
+	// keychainConfirmCredentials needs the user to allow reads of credentials, but not of sessions,
+	// so a cached session is used without asking
+	keychainConfirmCredentials = "confirm-credentials"
+)
+
+var keychainAccessModes = []string{keychainTrusted, keychainConfirm, keychainConfirmCredentials}
+
+// relockingKeyring reopens the keyring once it has gone unused for the timeout. Backends like file
+// keep their passphrase for as long as they're open, so in a long running process such as
+// exec --server this means the passphrase has to be entered again after a period of inactivity.
+type relockingKeyring struct {
+	mu       sync.Mutex
+	open     func() (keyring.Keyring, error)
+	timeout  time.Duration
+	keyring  keyring.Keyring
+	lastUsed time.Time
+}
+
+func newRelockingKeyring(open func() (keyring.Keyring, error), timeout time.Duration) (keyring.Keyring, error) {
+	k, err := open()
+	if err != nil {
+		return nil, err
+	}
+	return &relockingKeyring{open: open, timeout: timeout, keyring: k, lastUsed: time.Now()}, nil
+}
+
+func (r *relockingKeyring) current() (keyring.Keyring, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if time.Since(r.lastUsed) > r.timeout {
+		log.Printf("Keyring unused for over %s, reopening it", r.timeout)
+		k, err := r.open()
+		if err != nil {
+			return nil, err
+		}
+		r.keyring = k
+	}
+	r.lastUsed = time.Now()
+	return r.keyring, nil
+}
+
+func (r *relockingKeyring) Get(key string) (keyring.Item, error) {
+	k, err := r.current()
+	if err != nil {
+		return keyring.Item{}, err
+	}
+	return k.Get(key)
+}
+
+func (r *relockingKeyring) GetMetadata(key string) (keyring.Metadata, error) {
+	k, err := r.current()
+	if err != nil {
+		return keyring.Metadata{}, err
+	}
+	return k.GetMetadata(key)
+}
+
+func (r *relockingKeyring) Set(item keyring.Item) error {
+	k, err := r.current()
+	if err != nil {
+		return err
+	}
+	return k.Set(item)
+}
+
+func (r *relockingKeyring) Remove(key string) error {
+	k, err := r.current()
+	if err != nil {
+		return err
+	}
+	return k.Remove(key)
+}
+
+func (r *relockingKeyring) Keys() ([]string, error) {
+	k, err := r.current()
+	if err != nil {
+		return nil, err
+	}
+	return k.Keys()
+}
+
+// usesKeychain returns whether the selected backend is the macOS keychain, which is the
+// default where it's available
+func usesKeychain(backendName string) bool {
+	if backendName != "" {
+		return backendName == string(keyring.KeychainBackend)
+	}
+	available := keyring.AvailableBackends()
+	return len(available) > 0 && available[0] == keyring.KeychainBackend
+}
+
+// keychainAccess sets the access of the items stored in the keychain, as keyring only trusts aws-vault
+// or nothing for all of them
+func keychainAccess(k keyring.Keyring, name string, mode string, trustedApps []string) (keyring.Keyring, error) {
+	if len(trustedApps) > 0 {
+		if mode != keychainTrusted {
+			return nil, fmt.Errorf("--keychain-trusted-app can't be used with --keychain-access=%s, aws-vault is trusted along with the applications", mode)
+		}
+		apps := []string{}
+		for _, app := range trustedApps {
+			path, err := filepath.Abs(app)
+			if err != nil {
+				return nil, err
+			}
+			if _, err = os.Stat(path); err != nil {
+				return nil, fmt.Errorf("Invalid trusted application: %v", err)
+			}
+			apps = append(apps, path)
+		}
+		return newTrustingKeychain(k, name, apps), nil
+	}
+	if mode == keychainConfirmCredentials {
+		return confirmCredentialsKeyring{k}, nil
+	}
+	return k, nil
+}
+
+// confirmCredentialsKeyring stores credentials, TOTP secrets and external IDs so that macOS asks before
+// each read, and sessions and metadata so that they're read without asking
+type confirmCredentialsKeyring struct {
+	keyring.Keyring
+}
+
+func (k confirmCredentialsKeyring) Set(item keyring.Item) error {
+	if !vault.IsSessionKey(item.Key) && !vault.IsMetadataKey(item.Key) {
+		item.KeychainNotTrustApplication = true
+	}
+	return k.Keyring.Set(item)
+}
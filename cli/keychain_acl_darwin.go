@@ -0,0 +1,57 @@
+// +build darwin,cgo
+
+package cli
+
+import (
+	"fmt"
+
+	"github.com/99designs/keyring"
+	gokeychain "github.com/keybase/go-keychain"
+)
+
+// trustingKeychain stores items in the keychain so that the trusted applications, as well as
+// aws-vault, can read them without asking
+type trustingKeychain struct {
+	keyring.Keyring
+	path string
+	apps []string
+}
+
+func newTrustingKeychain(k keyring.Keyring, name string, apps []string) keyring.Keyring {
+	// keyring names the keychain the same way
+	return &trustingKeychain{Keyring: k, path: name + ".keychain", apps: apps}
+}
+
+func (k *trustingKeychain) Set(item keyring.Item) error {
+	kc := gokeychain.NewWithPath(k.path)
+	if err := kc.Status(); err != nil {
+		// keyring creates the keychain, asking for its password, when it first stores an item
+		if err = k.Keyring.Set(item); err != nil {
+			return err
+		}
+	}
+
+	// keyring leaves the access of an item alone when it's updated, so it's replaced instead
+	if err := k.Keyring.Remove(item.Key); err != nil && err != keyring.ErrKeyNotFound && err != gokeychain.ErrorItemNotFound {
+		return err
+	}
+
+	kcItem := gokeychain.NewItem()
+	kcItem.SetSecClass(gokeychain.SecClassGenericPassword)
+	kcItem.SetService("aws-vault")
+	kcItem.SetAccount(item.Key)
+	kcItem.SetLabel(item.Label)
+	kcItem.SetDescription(item.Description)
+	kcItem.SetData(item.Data)
+	kcItem.UseKeychain(kc)
+	// go-keychain trusts aws-vault along with the applications
+	kcItem.SetAccess(&gokeychain.Access{
+		Label:               item.Label,
+		TrustedApplications: k.apps,
+	})
+
+	if err := gokeychain.AddItem(kcItem); err != nil {
+		return fmt.Errorf("Failed to add %s to the keychain: %v", item.Key, err)
+	}
+	return nil
+}
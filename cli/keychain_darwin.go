@@ -0,0 +1,83 @@
+// +build darwin
+
+package cli
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// keychainPath returns the path of the named keychain, which has a different extension on older
+// versions of macOS
+func keychainPath(name string) (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(home, "Library", "Keychains", name+".keychain-db")
+	if _, err = os.Stat(path); os.IsNotExist(err) {
+		path = filepath.Join(home, "Library", "Keychains", name+".keychain")
+	}
+	return path, nil
+}
+
+// setKeychainTimeout sets the keychain to lock after the timeout of inactivity and when the
+// machine sleeps
+func setKeychainTimeout(name string, timeout time.Duration) error {
+	path, err := keychainPath(name)
+	if err != nil {
+		return err
+	}
+
+	seconds := int(timeout.Seconds())
+	if seconds < 1 {
+		seconds = 1
+	}
+	out, err := exec.Command("security", "set-keychain-settings", "-l", "-u", "-t", strconv.Itoa(seconds), path).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("security set-keychain-settings failed: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// lockKeychain locks the keychain, so it needs the user's password before credentials can be read
+func lockKeychain(name string) error {
+	path, err := keychainPath(name)
+	if err != nil {
+		return err
+	}
+	out, err := exec.Command("security", "lock-keychain", path).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("security lock-keychain failed: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// doctorKeychain checks that the keychain locks itself, so credentials aren't readable for as long as
+// the user is logged in
+func doctorKeychain(name string) []doctorFinding {
+	path, err := keychainPath(name)
+	if err != nil {
+		return nil
+	}
+	if _, err = os.Stat(path); os.IsNotExist(err) {
+		return []doctorFinding{{doctorOK, fmt.Sprintf("Keychain %s will be created when credentials are added", name), ""}}
+	}
+
+	out, err := exec.Command("security", "show-keychain-info", path).CombinedOutput()
+	if err != nil {
+		return []doctorFinding{{doctorFail, fmt.Sprintf("Can't read keychain %s: %s", path, strings.TrimSpace(string(out))),
+			"Check the keychain isn't damaged with Keychain Access, or use another with --keychain"}}
+	}
+	info := string(out)
+	if strings.Contains(info, "no-timeout") && !strings.Contains(info, "lock-on-sleep") {
+		return []doctorFinding{{doctorWarn, fmt.Sprintf("Keychain %s stays unlocked until you log out", name),
+			"Lock it after a while with --keychain-timeout, e.g. --keychain-timeout=15m"}}
+	}
+	return []doctorFinding{{doctorOK, fmt.Sprintf("Keychain %s locks itself (%s)", name, strings.TrimSpace(info[strings.LastIndex(info, "\"")+1:])), ""}}
+}
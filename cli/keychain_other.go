@@ -0,0 +1,20 @@
+// +build !darwin
+
+package cli
+
+import "time"
+
+// setKeychainTimeout does nothing, as the keychain is only available on macOS
+func setKeychainTimeout(name string, timeout time.Duration) error {
+	return nil
+}
+
+// lockKeychain does nothing, as the keychain is only available on macOS
+func lockKeychain(name string) error {
+	return nil
+}
+
+// doctorKeychain has nothing to check, as the keychain is only available on macOS
+func doctorKeychain(name string) []doctorFinding {
+	return nil
+}
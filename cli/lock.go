@@ -0,0 +1,80 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/99designs/aws-vault/backend"
+	"github.com/99designs/aws-vault/server"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+type LockCommandInput struct {
+	KeychainName string
+	Keychain     bool
+}
+
+func ConfigureLockCommand(app *kingpin.Application) {
+	input := LockCommandInput{}
+
+	app.Command("lock", "Lock the keychain, forget cached encrypted-file passphrases and stop credential servers").
+		Action(func(c *kingpin.ParseContext) error {
+			input.KeychainName = GlobalFlags.KeychainName
+			input.Keychain = usesKeychain(GlobalFlags.Backend)
+			LockCommand(app, input)
+			return nil
+		})
+}
+
+func LockCommand(app *kingpin.Application, input LockCommandInput) {
+	failed, locked := false, 0
+
+	if input.Keychain {
+		if err := lockKeychain(input.KeychainName); err != nil {
+			app.Errorf("Failed to lock keychain %s: %v", input.KeychainName, err)
+			failed = true
+		} else {
+			fmt.Printf("Locked keychain %s\n", input.KeychainName)
+			locked++
+		}
+	}
+
+	if running, err := backend.LockAgent(); err != nil {
+		app.Errorf("Failed to stop %s: %v", backend.AgentCommand, err)
+		failed = true
+	} else if running {
+		fmt.Println("Forgot cached encrypted-file passphrases")
+		locked++
+	}
+
+	sessions, err := execSessions()
+	if err != nil {
+		app.Fatalf("%v", err)
+		return
+	}
+	for _, s := range sessions {
+		if !s.Server {
+			continue
+		}
+		// only the server is stopped, the command keeps running but can't get credentials anymore
+		if s.ServerURL == "" {
+			app.Errorf("Can't stop the credential server for %q, it was started by an older aws-vault", s.Command)
+			failed = true
+			continue
+		}
+		if err = server.StopCredentialsServer(s.ServerURL, s.Pid, s.ServerTokenFile); err != nil {
+			app.Errorf("Failed to stop the credential server for %q: %v", s.Command, err)
+			failed = true
+			continue
+		}
+		fmt.Printf("Stopped the credential server for %q using profile %s\n", s.Command, s.ProfileName)
+		locked++
+	}
+
+	if failed {
+		app.Fatalf("Not everything could be locked")
+		return
+	}
+	if locked == 0 {
+		fmt.Println("Nothing was unlocked")
+	}
+}
@@ -0,0 +1,91 @@
+package cli
+
+import (
+	"encoding/json"
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/99designs/aws-vault/logging"
+)
+
+// logFormats are the formats --debug output can be written in
+var logFormats = []string{"text", "json"}
+
+var (
+	// access key ids aren't secret, but only the end is needed to tell them apart
+	accessKeyIDPattern = regexp.MustCompile(`\b(?:AKIA|ASIA|AIDA|AROA)[A-Z0-9]{16}\b`)
+
+	// values given for a field named like a secret, e.g. SecretAccessKey: xyz or aws_session_token=xyz
+	secretFieldPattern = regexp.MustCompile(`(?i)((?:secret_?access_?key|secret_?key|session_?token|security_?token|session_?key|signin_?token|token_?code|passphrase|password|pin)"?\s*[:=]\s*"?)[^\s",}&]+`)
+
+	// a secret access key is 40 characters of base64, and a session token hundreds
+	secretPattern = regexp.MustCompile(`[A-Za-z0-9/+]{40,}=*`)
+
+	logComponentPattern = regexp.MustCompile(`^\[(\w+)\] `)
+)
+
+// redact removes key material from a log message
+func redact(msg string) string {
+	msg = accessKeyIDPattern.ReplaceAllStringFunc(msg, func(id string) string {
+		return id[:4] + strings.Repeat("*", 12) + id[16:]
+	})
+	msg = secretFieldPattern.ReplaceAllString(msg, "${1}REDACTED")
+	return secretPattern.ReplaceAllStringFunc(msg, func(s string) string {
+		if n := len(strings.TrimRight(s, "=")); n == 40 || n >= 100 {
+			return "REDACTED"
+		}
+		return s
+	})
+}
+
+type logEntry struct {
+	Time      string `json:"time"`
+	Level     string `json:"level"`
+	Component string `json:"component,omitempty"`
+	Message   string `json:"msg"`
+}
+
+// logWriter is the output of the standard logger with --debug. Every line is redacted, and written as text
+// or as a JSON object
+type logWriter struct {
+	mu     sync.Mutex
+	out    io.Writer
+	format string
+}
+
+func (w *logWriter) Write(p []byte) (int, error) {
+	entry := logEntry{
+		Time:    time.Now().Format(time.RFC3339Nano),
+		Message: redact(strings.TrimRight(string(p), "\n")),
+	}
+	if m := logComponentPattern.FindStringSubmatch(entry.Message); m != nil {
+		entry.Component = m[1]
+		entry.Message = entry.Message[len(m[0]):]
+	}
+	entry.Level, entry.Message = logging.Level(entry.Message)
+
+	var line []byte
+	if w.format == "json" {
+		b, err := json.Marshal(entry)
+		if err != nil {
+			return 0, err
+		}
+		line = append(b, '\n')
+	} else {
+		text := time.Now().Format("2006/01/02 15:04:05 ") + strings.ToUpper(entry.Level) + " "
+		if entry.Component != "" {
+			text += "[" + entry.Component + "] "
+		}
+		line = []byte(text + entry.Message + "\n")
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if _, err := w.out.Write(line); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
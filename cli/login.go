@@ -7,16 +7,16 @@ import (
 	"log"
 	"net/http"
 	"net/url"
+	"os"
+	"os/signal"
 	"strings"
+	"syscall"
 	"time"
 
-	"github.com/99designs/aws-vault/prompt"
+	"github.com/99designs/aws-vault/stsclient"
 	"github.com/99designs/aws-vault/vault"
 	"github.com/99designs/keyring"
-	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/credentials"
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/sts"
 	"github.com/skratchdot/open-golang/open"
 	"gopkg.in/alecthomas/kingpin.v2"
 )
@@ -27,8 +27,11 @@ type LoginCommandInput struct {
 	ProfileName             string
 	Keyring                 keyring.Keyring
 	UseStdout               bool
+	Clipboard               bool
+	ClipboardClear          time.Duration
 	FederationTokenDuration time.Duration
 	Path                    string
+	DryRun                  bool
 	Config                  vault.Config
 }
 
@@ -36,22 +39,45 @@ func ConfigureLoginCommand(app *kingpin.Application) {
 	input := LoginCommandInput{}
 
 	cmd := app.Command("login", "Generate a login link for the AWS Console")
-	cmd.Flag("no-session", "Use root credentials, no session created").
+	cmd.Flag("no-session", "Assume the profile's role with root credentials, no session created").
 		Short('n').
 		BoolVar(&input.Config.NoSession)
 
 	cmd.Arg("profile", "Name of the profile").
 		Required().
-		HintAction(awsConfigFile.ProfileNames).
+		HintAction(profileNamesHint).
+		PreAction(resolveProfileAlias(&input.ProfileName)).
 		StringVar(&input.ProfileName)
 
-	cmd.Flag("mfa-token", "The mfa token to use").
+	// -t predates the global --mfa-token flag
+	cmd.Flag("token", "The mfa token to use").
 		Short('t').
+		Hidden().
 		StringVar(&input.Config.MfaToken)
 
+	cmd.Flag("region", "The region to use for STS and to open the console in, instead of the profile's, AWS_REGION or AWS_DEFAULT_REGION").
+		StringVar(&input.Config.Region)
+
 	cmd.Flag("mfa-serial", "The identification number of the MFA device to use").
 		StringVar(&input.Config.MfaSerial)
 
+	cmd.Flag("mfa-device", "The name or serial of the MFA device to use when mfa_serials lists several").
+		StringVar(&input.Config.MfaDevice)
+
+	cmd.Flag("role-arn", "Assume this role with the profile's credentials, instead of the profile's role_arn").
+		StringVar(&input.Config.RoleARN)
+
+	cmd.Flag("external-id", "The external id to assume the role with").
+		StringVar(&input.Config.ExternalID)
+
+	cmd.Flag("assume-root", "Create a task-scoped root session in this member account with sts:AssumeRoot").
+		PlaceHolder("ACCOUNT-ID").
+		StringVar(&input.Config.AssumeRootTarget)
+
+	cmd.Flag("root-task-policy", "The root task policy name or ARN to scope the root session to").
+		Default("IAMAuditRootUserCredentials").
+		StringVar(&input.Config.RootTaskPolicy)
+
 	cmd.Flag("path", "The AWS service you would like access").
 		StringVar(&input.Path)
 
@@ -70,8 +96,23 @@ func ConfigureLoginCommand(app *kingpin.Application) {
 		Short('s').
 		BoolVar(&input.UseStdout)
 
+	cmd.Flag("clipboard", "Copy login URL to the clipboard instead of opening in default browser").
+		BoolVar(&input.Clipboard)
+
+	cmd.Flag("clipboard-clear", "How long to wait before clearing the login URL from the clipboard, 0 to leave it").
+		Default("30s").
+		DurationVar(&input.ClipboardClear)
+
+	cmd.Flag("dry-run", "Print how the login URL would be created, including the STS calls and cached sessions used, without creating it").
+		BoolVar(&input.DryRun)
+
 	cmd.Action(func(c *kingpin.ParseContext) error {
-		input.Config.MfaPrompt = prompt.Method(GlobalFlags.PromptDriver)
+		if input.UseStdout && input.Clipboard {
+			app.Fatalf("--stdout and --clipboard can't be used together")
+			return nil
+		}
+		configureCredentials(&input.Config)
+		input.Config.MfaDeviceSelector = mfaDeviceSelector(input.ProfileName)
 		input.Keyring = keyringImpl
 		LoginCommand(app, input)
 		return nil
@@ -84,23 +125,51 @@ func LoginCommand(app *kingpin.Application, input LoginCommandInput) {
 		return
 	}
 
+	err := configLoader.LoadFromProfile(input.ProfileName, &input.Config)
+	if err != nil {
+		app.Fatalf("%v", err)
+		return
+	}
+
+	// the login URL holds the credentials, so it's only opened in the browser for no_export profiles
+	if input.Config.NoExport && input.Clipboard {
+		app.Fatalf("Profile %q has no_export set, the login URL can't be copied to the clipboard", input.ProfileName)
+		return
+	}
+	if input.Config.NoExport && input.UseStdout {
+		app.Fatalf("Profile %q has no_export set, the login URL can't be printed", input.ProfileName)
+		return
+	}
+
+	// a session token can't be used to call GetFederationToken, so without a role to assume the master
+	// credentials are used whether or not --no-session is given
 	if input.Config.RoleARN == "" {
 		input.Config.NoSession = true
 	}
 
-	err := configLoader.LoadFromProfile(input.ProfileName, &input.Config)
+	provider, err := vault.NewTempCredentialsProvider(input.Keyring, &input.Config)
 	if err != nil {
 		app.Fatalf("%v", err)
 	}
-
-	creds, err := vault.NewTempCredentials(input.Keyring, &input.Config)
+	httpClient, err := vault.NewHTTPClient(&input.Config)
 	if err != nil {
 		app.Fatalf("%v", err)
+		return
 	}
+	if input.DryRun {
+		plan, err := provider.Plan()
+		if err != nil {
+			app.Fatalf("%v", err)
+			return
+		}
+		printCredentialsPlan(input.ProfileName, loginPlan(plan, input))
+		return
+	}
+	creds := credentials.NewCredentials(provider)
 
 	val, err := creds.Get()
 	if err != nil {
-		app.Fatalf(FormatCredentialError(err, input.Config.CredentialsName))
+		fatalCredentialError(app, err, input.ProfileName, input.Config.CredentialsName)
 	}
 
 	isFederated := false
@@ -108,7 +177,7 @@ func LoginCommand(app *kingpin.Application, input LoginCommandInput) {
 	// if AssumeRole isn't used, GetFederationToken has to be used for IAM credentials
 	if val.SessionToken == "" {
 		log.Printf("No session token found, calling GetFederationToken")
-		stsCreds, err := getFederationToken(val, input.FederationTokenDuration, input.Config.Region)
+		stsCreds, err := getFederationToken(httpClient, val, input.FederationTokenDuration, input.Config.Region)
 		if err != nil {
 			app.Fatalf("Failed to call GetFederationToken: %v\n"+
 				"Login for non-assumed roles depends on permission to call sts:GetFederationToken", err)
@@ -152,7 +221,7 @@ func LoginCommand(app *kingpin.Application, input LoginCommandInput) {
 
 	req.URL.RawQuery = q.Encode()
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := httpClient.Do(req)
 	if err != nil {
 		app.Fatalf("Failed to create federated token: %v", err)
 		return
@@ -191,19 +260,66 @@ func LoginCommand(app *kingpin.Application, input LoginCommandInput) {
 		url.QueryEscape(signinToken),
 	)
 
-	if input.UseStdout {
+	if input.Clipboard {
+		if err = copyToClipboard(loginURL); err != nil {
+			app.Fatalf("Failed to copy the login URL to the clipboard: %v", err)
+			return
+		}
+		if input.ClipboardClear > 0 {
+			infof("Copied the login URL to the clipboard, it will be cleared in %s\n", input.ClipboardClear)
+			waitToClearClipboard(input.ClipboardClear)
+			if err = clearClipboard(loginURL); err != nil {
+				app.Fatalf("Failed to clear the clipboard: %v", err)
+			}
+		}
+	} else if input.UseStdout {
 		fmt.Println(loginURL)
 	} else if err = open.Run(loginURL); err != nil {
+		if input.Config.NoExport {
+			app.Fatalf("Failed to open the login URL: %v", err)
+			return
+		}
 		log.Println(err)
 		fmt.Println(loginURL)
 	}
 }
 
-func getFederationToken(creds credentials.Value, d time.Duration, region string) (*sts.Credentials, error) {
-	sess := session.Must(session.NewSession(aws.NewConfig().WithCredentials(credentials.NewStaticCredentialsFromCreds(creds)).WithRegion(region)))
-	client := sts.New(sess)
+// loginPlan adds the steps of creating the login URL to the plan of getting credentials
+func loginPlan(plan vault.CredentialsPlan, input LoginCommandInput) vault.CredentialsPlan {
+	config := input.Config
+	federated := config.NoSession && config.RoleARN == "" && config.AssumeRootTarget == "" && config.WebIdentityTokenFile == ""
+	if federated {
+		plan.Steps = append(plan.Steps,
+			vault.PlanStep{Description: "Look up the IAM user name of the credentials", Call: "iam:GetUser"},
+			vault.PlanStep{
+				Description: "Create a federation token, as the credentials have no session token",
+				Call:        "sts:GetFederationToken",
+				Params: [][2]string{
+					{"Name", "<IAM user name, up to 32 characters>"},
+					{"DurationSeconds", fmt.Sprintf("%.f", input.FederationTokenDuration.Seconds())},
+					{"Policy", allowAllIAMPolicy},
+				},
+			})
+	}
+
+	loginURLPrefix, destination := generateLoginURL(config.Region, input.Path)
+	signin := vault.PlanStep{
+		Description: "Create a sign-in token at " + loginURLPrefix,
+		Call:        "signin:getSigninToken",
+		Params:      [][2]string{{"Session", "<the credentials>"}},
+	}
+	if config.NoSession && !federated {
+		signin.Params = append(signin.Params, [2]string{"SessionDuration", fmt.Sprintf("%.f", input.FederationTokenDuration.Seconds())})
+	}
+	plan.Steps = append(plan.Steps, signin, vault.PlanStep{Description: "Log into " + destination})
+	return plan
+}
 
-	currentUsername, err := vault.GetUsernameFromSession(sess)
+func getFederationToken(httpClient *http.Client, creds credentials.Value, d time.Duration, region string) (*stsclient.Credentials, error) {
+	client := stsclient.New(credentials.NewStaticCredentialsFromCreds(creds), region)
+	client.HTTPClient = httpClient
+
+	currentUsername, err := vault.GetUsername(client)
 	if err != nil {
 		return nil, err
 	}
@@ -213,18 +329,11 @@ func getFederationToken(creds credentials.Value, d time.Duration, region string)
 		currentUsername = currentUsername[0:32]
 	}
 
-	params := &sts.GetFederationTokenInput{
-		Name:            aws.String(currentUsername),
-		DurationSeconds: aws.Int64(int64(d.Seconds())),
-		Policy:          aws.String(allowAllIAMPolicy),
-	}
-
-	resp, err := client.GetFederationToken(params)
-	if err != nil {
-		return nil, err
-	}
-
-	return resp.Credentials, nil
+	return client.GetFederationToken(stsclient.GetFederationTokenInput{
+		Name:            currentUsername,
+		DurationSeconds: int64(d.Seconds()),
+		Policy:          allowAllIAMPolicy,
+	})
 }
 
 func generateLoginURL(region string, path string) (string, string) {
@@ -255,3 +364,15 @@ func generateLoginURL(region string, path string) (string, string) {
 	}
 	return loginURLPrefix, destination
 }
+
+// waitToClearClipboard waits for d, or until interrupted, so the clipboard is cleared either way
+func waitToClearClipboard(d time.Duration) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	select {
+	case <-time.After(d):
+	case <-signals:
+	}
+}
@@ -0,0 +1,49 @@
+package cli
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+
+	"github.com/99designs/keyring"
+	kingpin "gopkg.in/alecthomas/kingpin.v2"
+)
+
+func exampleNoExportLogin(args ...string) {
+	f, err := ioutil.TempFile("", "aws-config")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString("[profile llamas]\nno_export = true\n")
+	f.Close()
+
+	os.Setenv("AWS_CONFIG_FILE", f.Name())
+	defer os.Unsetenv("AWS_CONFIG_FILE")
+
+	awsConfigFile = nil
+	keyringImpl = keyring.NewArrayKeyring([]keyring.Item{
+		{Key: "llamas", Data: []byte(`{"AccessKeyID":"ABC","SecretAccessKey":"XYZ"}`)},
+	})
+
+	app := kingpin.New(`aws-vault`, ``)
+	app.Terminate(nil)
+	app.ErrorWriter(os.Stdout)
+	ConfigureGlobals(app)
+	ConfigureLoginCommand(app)
+	kingpin.MustParse(app.Parse(append([]string{"login"}, args...)))
+}
+
+func ExampleLoginCommand_noExportClipboard() {
+	exampleNoExportLogin("--clipboard", "llamas")
+
+	// Output:
+	// aws-vault: error: Profile "llamas" has no_export set, the login URL can't be copied to the clipboard
+}
+
+func ExampleLoginCommand_noExportStdout() {
+	exampleNoExportLogin("--stdout", "llamas")
+
+	// Output:
+	// aws-vault: error: Profile "llamas" has no_export set, the login URL can't be printed
+}
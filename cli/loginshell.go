@@ -0,0 +1,134 @@
+package cli
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// shellSetup is how exec --login-shell starts the default shell, so it reads the user's login files and
+// marks its prompt with the profile
+type shellSetup struct {
+	Args []string
+	Env  map[string]string
+
+	// TempDir holds startup files written for the shell, and is removed when it exits
+	TempDir string
+}
+
+func (s shellSetup) cleanup() {
+	if s.TempDir != "" {
+		os.RemoveAll(s.TempDir)
+	}
+}
+
+// bashStartup reads the files bash reads as a login shell, as bash ignores --rcfile when it's one
+const bashStartup = `# written by aws-vault exec --login-shell
+if [ -f /etc/profile ]; then . /etc/profile; fi
+for f in ~/.bash_profile ~/.bash_login ~/.profile; do
+	if [ -f "$f" ]; then . "$f"; break; fi
+done
+PS1="(aws-vault:$AWS_VAULT) $PS1"
+`
+
+// zshStartup is read by zsh from ZDOTDIR. It restores ZDOTDIR straight away and reads the user's .zshenv, so
+// the rest of their files are read as usual, even if their .zshenv changes ZDOTDIR. The prompt is marked from
+// a precmd hook, as it'd be replaced by a theme set in .zshrc
+const zshStartup = `# written by aws-vault exec --login-shell
+if [ -n "$AWS_VAULT_ZDOTDIR_SET" ]; then ZDOTDIR="$AWS_VAULT_ZDOTDIR"; else unset ZDOTDIR; fi
+unset AWS_VAULT_ZDOTDIR AWS_VAULT_ZDOTDIR_SET
+if [ -f "${ZDOTDIR:-$HOME}/.zshenv" ]; then . "${ZDOTDIR:-$HOME}/.zshenv"; fi
+__aws_vault_prompt() {
+	[[ $PROMPT == "(aws-vault:$AWS_VAULT) "* ]] || PROMPT="(aws-vault:$AWS_VAULT) $PROMPT"
+}
+autoload -Uz add-zsh-hook
+add-zsh-hook precmd __aws_vault_prompt
+`
+
+// shStartup is read by POSIX shells from ENV once they've read their login files, and reads the user's own
+// ENV file
+const shStartup = `# written by aws-vault exec --login-shell
+ENV="$AWS_VAULT_ENV"
+unset AWS_VAULT_ENV
+if [ -n "$ENV" ] && [ -f "$ENV" ]; then . "$ENV"; fi
+PS1="(aws-vault:$AWS_VAULT) $PS1"
+`
+
+const fishStartup = `functions -c fish_prompt __aws_vault_fish_prompt
+function fish_prompt; echo -n "(aws-vault:$AWS_VAULT) "; __aws_vault_fish_prompt; end`
+
+const powershellStartup = `$awsVaultPrompt = $function:prompt
+function global:prompt { "(aws-vault:$env:AWS_VAULT) " + (& $awsVaultPrompt) }`
+
+// loginShellSetup returns how to start shell as an interactive login shell with the profile in its prompt
+func loginShellSetup(shell string, profileName string) (shellSetup, error) {
+	marker := "(aws-vault:" + profileName + ") "
+
+	switch name := strings.TrimSuffix(strings.ToLower(filepath.Base(shell)), ".exe"); name {
+	case "bash":
+		dir, err := writeStartupFiles(map[string]string{"bashrc": bashStartup})
+		if err != nil {
+			return shellSetup{}, err
+		}
+		return shellSetup{Args: []string{"--rcfile", filepath.Join(dir, "bashrc"), "-i"}, TempDir: dir}, nil
+
+	case "zsh":
+		dir, err := writeStartupFiles(map[string]string{".zshenv": zshStartup})
+		if err != nil {
+			return shellSetup{}, err
+		}
+		env := map[string]string{"ZDOTDIR": dir}
+		if zdotdir, ok := os.LookupEnv("ZDOTDIR"); ok {
+			env["AWS_VAULT_ZDOTDIR"] = zdotdir
+			env["AWS_VAULT_ZDOTDIR_SET"] = "1"
+		}
+		return shellSetup{Args: []string{"-l", "-i"}, Env: env, TempDir: dir}, nil
+
+	case "fish":
+		return shellSetup{Args: []string{"-l", "-i", "-C", fishStartup}}, nil
+
+	case "powershell", "pwsh":
+		return shellSetup{Args: []string{"-NoExit", "-Command", powershellStartup}}, nil
+
+	case "cmd":
+		prompt := os.Getenv("PROMPT")
+		if prompt == "" {
+			prompt = "$P$G"
+		}
+		return shellSetup{Env: map[string]string{"PROMPT": marker + prompt}}, nil
+
+	case "sh", "dash", "ksh", "mksh", "ash":
+		dir, err := writeStartupFiles(map[string]string{"env": shStartup})
+		if err != nil {
+			return shellSetup{}, err
+		}
+		env := map[string]string{"ENV": filepath.Join(dir, "env"), "AWS_VAULT_ENV": os.Getenv("ENV")}
+		return shellSetup{Args: []string{"-l", "-i"}, Env: env, TempDir: dir}, nil
+	}
+
+	// other shells may read PS1 from the environment, unless their startup files set it
+	return shellSetup{Args: []string{"-i"}, Env: map[string]string{"PS1": marker + shellPS1()}}, nil
+}
+
+// writeStartupFiles writes the files, by name, to a new temporary directory
+func writeStartupFiles(files map[string]string) (string, error) {
+	dir, err := ioutil.TempDir("", "aws-vault-shell")
+	if err != nil {
+		return "", err
+	}
+	for name, content := range files {
+		if err = ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0600); err != nil {
+			os.RemoveAll(dir)
+			return "", err
+		}
+	}
+	return dir, nil
+}
+
+func shellPS1() string {
+	if ps1 := os.Getenv("PS1"); ps1 != "" {
+		return ps1
+	}
+	return "$ "
+}
@@ -1,10 +1,15 @@
 package cli
 
 import (
+	"bufio"
+	"encoding/json"
 	"fmt"
+	"io"
 	"os"
+	"strconv"
 	"strings"
 	"text/tabwriter"
+	"time"
 
 	"github.com/99designs/aws-vault/vault"
 	"github.com/99designs/keyring"
@@ -16,6 +21,10 @@ type LsCommandInput struct {
 	OnlyProfiles    bool
 	OnlySessions    bool
 	OnlyCredentials bool
+	ShowMetadata    bool
+	StaleAfter      time.Duration
+	JSON            bool
+	TSV             bool
 }
 
 func ConfigureListCommand(app *kingpin.Application) {
@@ -33,7 +42,24 @@ func ConfigureListCommand(app *kingpin.Application) {
 	cmd.Flag("credentials", "Show only the credential names").
 		BoolVar(&input.OnlyCredentials)
 
+	cmd.Flag("metadata", "Show when credentials were added, last used and last rotated").
+		BoolVar(&input.ShowMetadata)
+
+	cmd.Flag("stale-after", "Flag credentials whose access key is older than this as stale").
+		Default("2160h").
+		DurationVar(&input.StaleAfter)
+
+	cmd.Flag("json", "Output the profiles, credentials and sessions as JSON").
+		BoolVar(&input.JSON)
+
+	cmd.Flag("tsv", "Output a row of tab separated values per profile, with a header").
+		BoolVar(&input.TSV)
+
 	cmd.Action(func(c *kingpin.ParseContext) error {
+		if input.JSON && input.TSV {
+			app.Fatalf("--json and --tsv can't be used together")
+			return nil
+		}
 		input.Keyring = keyringImpl
 		LsCommand(app, input)
 		return nil
@@ -63,7 +89,7 @@ func LsCommand(app *kingpin.Application, input LsCommandInput) {
 	for _, c := range keys {
 		if vault.IsSessionKey(c) {
 			sessionNames = append(sessionNames, c)
-		} else {
+		} else if vault.IsCredentialsKey(c) {
 			credentialsNames = append(credentialsNames, c)
 		}
 	}
@@ -82,6 +108,11 @@ func LsCommand(app *kingpin.Application, input LsCommandInput) {
 		return
 	}
 
+	if input.ShowMetadata {
+		listMetadata(app, input, credentialsNames)
+		return
+	}
+
 	if input.OnlySessions {
 		for _, c := range sessionNames {
 			fmt.Printf("%s\n", c)
@@ -95,58 +126,252 @@ func LsCommand(app *kingpin.Application, input LsCommandInput) {
 		return
 	}
 
-	w := tabwriter.NewWriter(os.Stdout, 25, 4, 2, ' ', 0)
-	fmt.Fprintln(w, "Profile\tCredentials\tSessions\t")
-	fmt.Fprintln(w, "=======\t===========\t========\t")
+	entries := listEntries(input, credentialsNames, sessions)
+
+	switch {
+	case input.JSON:
+		err = writeListJSON(os.Stdout, entries)
+	case input.TSV:
+		err = writeListTSV(os.Stdout, entries)
+	default:
+		if err = writeListTable(os.Stdout, entries, useColor(os.Stdout)); err == nil && len(keys) == 0 {
+			app.Fatalf("No credentials found")
+			return
+		}
+	}
+	if err != nil {
+		app.Fatalf("%v", err)
+		return
+	}
+}
+
+// listEntry is a row of list, either a profile or credentials that don't have a profile
+type listEntry struct {
+	Profile     string        `json:"profile,omitempty"`
+	Credentials string        `json:"credentials,omitempty"`
+	Stored      bool          `json:"stored"`
+	Stale       bool          `json:"stale"`
+	Sessions    []listSession `json:"sessions"`
+}
+
+type listSession struct {
+	Expiration time.Time `json:"expiration"`
+	ExpiresIn  int64     `json:"expires_in"`
+	RoleARN    string    `json:"role_arn,omitempty"`
+	MfaSerial  string    `json:"mfa_serial,omitempty"`
+
+	// expiring is whether the session is within its expiration window, so the next command will replace it
+	expiring bool
+}
+
+func (s listSession) label(color bool) string {
+	label := "expired"
+	if ttl := sessionTTL(s.Expiration); ttl != "expired" {
+		label = "expires in " + ttl
+	}
+	if s.RoleARN != "" {
+		label += " (role)"
+	}
+	if s.MfaSerial != "" {
+		label += " (mfa)"
+	}
+
+	switch {
+	case color && s.ExpiresIn <= 0:
+		return colorRed + label + colorReset
+	case color && s.expiring:
+		return colorYellow + label + colorReset
+	}
+	return label
+}
+
+func listEntries(input LsCommandInput, credentialsNames []string, sessions []vault.KeyringSession) []listEntry {
+	entries := []listEntry{}
 
 	// list out known profiles first
 	for _, profileName := range awsConfigFile.ProfileNames() {
-		fmt.Fprintf(w, "%s\t", profileName)
-
 		config := vault.Config{}
 		configLoader.LoadFromProfile(profileName, &config)
 
-		if contains(credentialsNames, config.CredentialsName) {
-			fmt.Fprintf(w, "%s\t", config.CredentialsName)
-		} else if config.CredentialsName != "" {
-			fmt.Fprintf(w, "%s (missing)\t", config.CredentialsName)
-		} else {
-			fmt.Fprintf(w, "-\t")
+		entry := listEntry{
+			Profile:     profileName,
+			Credentials: config.CredentialsName,
+			Stored:      contains(credentialsNames, config.CredentialsName),
+			Sessions:    []listSession{},
 		}
+		entry.Stale = entry.Stored && isStale(input, config.CredentialsName)
 
-		var sessionLabels []string
 		for _, sess := range sessions {
 			if profileName == sess.ProfileName {
-				label := fmt.Sprintf("%d", sess.Expiration.Unix())
-				if sess.MfaSerial != "" {
-					label += " (mfa)"
+				window := config.SessionExpirationWindow
+				if sess.RoleARN != "" {
+					window = config.RoleExpirationWindow
 				}
-				sessionLabels = append(sessionLabels, label)
+				entry.Sessions = append(entry.Sessions, listSession{
+					Expiration: sess.Expiration,
+					ExpiresIn:  int64(time.Until(sess.Expiration).Seconds()),
+					RoleARN:    sess.RoleARN,
+					MfaSerial:  sess.MfaSerial,
+					expiring:   time.Until(sess.Expiration) < window,
+				})
 			}
 		}
-
-		if len(sessions) > 0 {
-			fmt.Fprintf(w, "%s\t\n", strings.Join(sessionLabels, ", "))
-		} else {
-			fmt.Fprintf(w, "-\t\n")
-		}
+		entries = append(entries, entry)
 	}
 
 	// show credentials that don't have profiles
 	for _, credentialName := range credentialsNames {
 		_, ok := awsConfigFile.ProfileSection(credentialName)
 		if !ok {
-			fmt.Fprintf(w, "-\t%s\t-\t\n", credentialName)
+			entries = append(entries, listEntry{
+				Credentials: credentialName,
+				Stored:      true,
+				Stale:       isStale(input, credentialName),
+				Sessions:    []listSession{},
+			})
 		}
 	}
 
-	if err = w.Flush(); err != nil {
-		app.Fatalf("%v", err)
-		return
+	return entries
+}
+
+// writeListTable writes entries as a table. With color, expired sessions are red and those within their
+// expiration window yellow. They're in the last column, as tabwriter counts the escape codes as text
+func writeListTable(out io.Writer, entries []listEntry, color bool) error {
+	w := tabwriter.NewWriter(out, 25, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "Profile\tCredentials\tSessions\t")
+	fmt.Fprintln(w, "=======\t===========\t========\t")
+
+	for _, entry := range entries {
+		profile, credentials, sessions := "-", "-", "-"
+		if entry.Profile != "" {
+			profile = entry.Profile
+		}
+		if entry.Stored {
+			credentials = entry.Credentials
+			if entry.Stale {
+				credentials += " (stale)"
+			}
+		} else if entry.Credentials != "" {
+			credentials = entry.Credentials + " (missing)"
+		}
+		if len(entry.Sessions) > 0 {
+			var labels []string
+			for _, sess := range entry.Sessions {
+				labels = append(labels, sess.label(color))
+			}
+			sessions = strings.Join(labels, ", ")
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t\n", profile, credentials, sessions)
 	}
 
-	if len(keys) == 0 {
-		app.Fatalf("No credentials found")
-		return
+	return w.Flush()
+}
+
+func writeListJSON(out io.Writer, entries []listEntry) error {
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(entries)
+}
+
+// writeListTSV writes a row per profile, with the number of sessions that haven't expired and how many
+// seconds the longest lasting one has left
+func writeListTSV(out io.Writer, entries []listEntry) error {
+	w := bufio.NewWriter(out)
+	fmt.Fprintln(w, "profile\tcredentials\tstored\tstale\tsessions\texpires_in")
+
+	for _, entry := range entries {
+		active, expiresIn := 0, ""
+		var longest int64
+		for _, sess := range entry.Sessions {
+			if sess.ExpiresIn > 0 {
+				active++
+				if sess.ExpiresIn > longest {
+					longest = sess.ExpiresIn
+				}
+			}
+		}
+		if active > 0 {
+			expiresIn = strconv.FormatInt(longest, 10)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%t\t%t\t%d\t%s\n", entry.Profile, entry.Credentials, entry.Stored, entry.Stale, active, expiresIn)
+	}
+
+	return w.Flush()
+}
+
+// sessionTTL returns how long a cached session has left, to the minute
+func sessionTTL(expiration time.Time) string {
+	ttl := time.Until(expiration)
+	if ttl <= 0 {
+		return "expired"
+	}
+	if ttl < time.Minute {
+		return "<1m"
+	}
+	return strings.TrimSuffix(ttl.Round(time.Minute).String(), "0s")
+}
+
+// isStale returns whether the access key of credentials is older than --stale-after
+func isStale(input LsCommandInput, credentialsName string) bool {
+	if input.StaleAfter <= 0 {
+		return false
+	}
+	m, ok, err := vault.LoadCredentialsMetadata(input.Keyring, credentialsName)
+	if err != nil || !ok || m.KeyCreated().IsZero() {
+		return false
+	}
+	return time.Since(m.KeyCreated()) > input.StaleAfter
+}
+
+// staleLabel returns " (stale)" for credentials whose access key is older than --stale-after
+func staleLabel(input LsCommandInput, credentialsName string) string {
+	if isStale(input, credentialsName) {
+		return " (stale)"
+	}
+	return ""
+}
+
+func formatMetadataTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Local().Format("2006-01-02 15:04")
+}
+
+// formatMetadataDate is for LastUsed, which is only updated once a day
+func formatMetadataDate(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.UTC().Format("2006-01-02")
+}
+
+func listMetadata(app *kingpin.Application, input LsCommandInput, credentialsNames []string) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "Credentials\tAccess key\tAdded\tLast rotated\tLast used\tKey age\t")
+	fmt.Fprintln(w, "===========\t==========\t=====\t============\t=========\t=======\t")
+
+	for _, name := range credentialsNames {
+		m, ok, err := vault.LoadCredentialsMetadata(input.Keyring, name)
+		if err != nil {
+			app.Fatalf("%v", err)
+			return
+		}
+		if !ok {
+			fmt.Fprintf(w, "%s\t-\t-\t-\t-\t-\t\n", name)
+			continue
+		}
+
+		age := "-"
+		if !m.KeyCreated().IsZero() {
+			age = fmt.Sprintf("%dd%s", int(time.Since(m.KeyCreated()).Hours()/24), staleLabel(input, name))
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t\n", name, m.AccessKeyID, formatMetadataTime(m.Created),
+			formatMetadataTime(m.LastRotated), formatMetadataDate(m.LastUsed), age)
+	}
+
+	if err := w.Flush(); err != nil {
+		app.Fatalf("%v", err)
 	}
 }
@@ -1,6 +1,10 @@
 package cli
 
 import (
+	"io/ioutil"
+	"log"
+	"os"
+
 	kingpin "gopkg.in/alecthomas/kingpin.v2"
 
 	"github.com/99designs/keyring"
@@ -21,3 +25,30 @@ func ExampleLsCommand() {
 	// Output:
 	// llamas
 }
+
+func ExampleLsCommand_tsv() {
+	f, err := ioutil.TempFile("", "aws-config")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+
+	os.Setenv("AWS_CONFIG_FILE", f.Name())
+	defer os.Unsetenv("AWS_CONFIG_FILE")
+
+	awsConfigFile = nil
+	keyringImpl = keyring.NewArrayKeyring([]keyring.Item{
+		{Key: "llamas", Data: []byte(`{"AccessKeyID":"ABC","SecretAccessKey":"XYZ"}`)},
+	})
+
+	app := kingpin.New(`aws-vault`, ``)
+	ConfigureGlobals(app)
+	ConfigureListCommand(app)
+	kingpin.MustParse(app.Parse([]string{
+		"list", "--tsv", "--stale-after", "0",
+	}))
+
+	// Output:
+	// profile	credentials	stored	stale	sessions	expires_in
+	// 	llamas	true	false	0
+}
@@ -0,0 +1,77 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/99designs/aws-vault/logging"
+	"github.com/99designs/aws-vault/prompt"
+	"github.com/99designs/aws-vault/vault"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// mfaDeviceSelector returns a selector that asks the user to choose one of the MFA devices, and offers
+// to save the choice to the profile if it was discovered. Returns nil if there's no terminal to ask on.
+func mfaDeviceSelector(profileName string) vault.MfaDeviceSelector {
+	if !terminal.IsTerminal(int(os.Stdin.Fd())) {
+		return nil
+	}
+
+	return func(serials []string, discovered bool) (string, error) {
+		serial := serials[0]
+
+		if len(serials) > 1 && GlobalFlags.MfaToken != "" {
+			return "", fmt.Errorf("An MFA token was given, but there are %d MFA devices. Choose the device it's from with --mfa-device", len(serials))
+		}
+		if len(serials) > 1 {
+			fmt.Fprintf(os.Stderr, "MFA is required, choose from %d MFA devices:\n", len(serials))
+			for i, s := range serials {
+				fmt.Fprintf(os.Stderr, "  %d) %s\n", i+1, s)
+			}
+			r, err := prompt.TerminalPrompt(fmt.Sprintf("Select an MFA device [1-%d]: ", len(serials)))
+			if err != nil {
+				return "", err
+			}
+			n, err := strconv.Atoi(r)
+			if err != nil || n < 1 || n > len(serials) {
+				return "", fmt.Errorf("Invalid MFA device selection %q", r)
+			}
+			serial = serials[n-1]
+		} else {
+			infof("MFA is required, using MFA device %s\n", serial)
+		}
+
+		// with --mfa-token nothing is asked, so it can be used in scripts run from a terminal
+		if !discovered || GlobalFlags.MfaToken != "" {
+			return serial, nil
+		}
+
+		r, err := prompt.TerminalPrompt(fmt.Sprintf("Save mfa_serial to profile %q in %s? (Y|n) ", profileName, awsConfigFile.Path))
+		if err != nil {
+			return "", err
+		}
+		if r != "N" && r != "n" {
+			if err = awsConfigFile.SetProfileValue(profileName, "mfa_serial", serial); err != nil {
+				logging.Warnf("Failed to save mfa_serial: %v", err)
+			}
+		}
+
+		return serial, nil
+	}
+}
+
+// configureCredentials sets how MFA tokens are got, from --mfa-token or the --prompt driver, and that
+// sessions aren't cached with --read-only. Without --prompt, the profile's prompt is used
+func configureCredentials(config *vault.Config) {
+	config.NoSessionCache = GlobalFlags.ReadOnly
+	config.MfaPromptTimeout = GlobalFlags.PromptTimeout
+	if GlobalFlags.MfaToken == "-" {
+		config.MfaTokenProvider = prompt.StdinMfaPrompt
+		return
+	}
+	if config.MfaToken == "" {
+		config.MfaToken = GlobalFlags.MfaToken
+	}
+	config.PromptDriver = GlobalFlags.PromptDriver
+}
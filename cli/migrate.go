@@ -0,0 +1,139 @@
+package cli
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/99designs/aws-vault/backend"
+	"github.com/99designs/aws-vault/vault"
+	"github.com/99designs/keyring"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+type MigrateCommandInput struct {
+	From         keyring.Keyring
+	To           keyring.Keyring
+	FromBackend  string
+	ToBackend    string
+	Sessions     bool
+	Overwrite    bool
+	AddIntegrity bool
+}
+
+func ConfigureMigrateCommand(app *kingpin.Application) {
+	input := MigrateCommandInput{}
+	backendsAvailable := availableBackends()
+
+	cmd := app.Command("migrate", "Copy stored credentials from one backend to another")
+
+	cmd.Flag("from", fmt.Sprintf("Backend to copy from %v, defaults to the backend in use", backendsAvailable)).
+		EnumVar(&input.FromBackend, backendsAvailable...)
+
+	cmd.Flag("to", fmt.Sprintf("Backend to copy to %v", backendsAvailable)).
+		EnumVar(&input.ToBackend, backendsAvailable...)
+
+	cmd.Flag("sessions", "Copy cached sessions too").
+		BoolVar(&input.Sessions)
+
+	cmd.Flag("overwrite", "Replace credentials that are already in the backend copied to").
+		BoolVar(&input.Overwrite)
+
+	cmd.Flag("add-integrity", "Add the items of a file backend created by an older aws-vault to its integrity index, instead of copying anything").
+		BoolVar(&input.AddIntegrity)
+
+	cmd.Action(func(c *kingpin.ParseContext) (err error) {
+		checkWritable(app, "migrate credentials")
+		if input.AddIntegrity {
+			AddIntegrityCommand(app)
+			return nil
+		}
+		if input.ToBackend == "" {
+			app.Fatalf("required flag --to not provided")
+			return nil
+		}
+		if input.FromBackend == "" {
+			input.From = keyringImpl
+			input.FromBackend = GlobalFlags.Backend
+		} else if input.From, err = openBackend(input.FromBackend); err != nil {
+			app.Fatalf("Failed to open %s: %v", input.FromBackend, err)
+			return nil
+		}
+		if input.FromBackend == input.ToBackend {
+			app.Fatalf("Can't migrate %s to itself", input.ToBackend)
+			return nil
+		}
+		if input.To, err = openBackend(input.ToBackend); err != nil {
+			app.Fatalf("Failed to open %s: %v", input.ToBackend, err)
+			return nil
+		}
+		MigrateCommand(app, input)
+		return nil
+	})
+}
+
+func MigrateCommand(app *kingpin.Application, input MigrateCommandInput) {
+	fromName := input.FromBackend
+	if fromName == "" {
+		fromName = "the default backend"
+	}
+
+	keys, err := input.From.Keys()
+	if err != nil {
+		app.Fatalf("Failed to list the keys in %s: %v", fromName, err)
+		return
+	}
+	sort.Strings(keys)
+	existing, err := input.To.Keys()
+	if err != nil {
+		app.Fatalf("Failed to list the keys in %s: %v", input.ToBackend, err)
+		return
+	}
+
+	copied, sessions, skipped := 0, 0, 0
+	for _, key := range keys {
+		isSession := vault.IsSessionKey(key)
+		if isSession && !input.Sessions {
+			continue
+		}
+		if contains(existing, key) && !input.Overwrite && !isSession {
+			fmt.Printf("Skipped %s, it's already in %s\n", key, input.ToBackend)
+			skipped++
+			continue
+		}
+
+		item, err := input.From.Get(key)
+		if err != nil {
+			app.Fatalf("Failed to read %s from %s: %v", key, fromName, err)
+			return
+		}
+		if err = input.To.Set(item); err != nil {
+			app.Fatalf("Failed to write %s to %s: %v", key, input.ToBackend, err)
+			return
+		}
+
+		if isSession {
+			sessions++
+		} else {
+			fmt.Printf("Copied %s\n", key)
+			copied++
+		}
+	}
+
+	fmt.Printf("Copied %d credentials and %d sessions to %s", copied, sessions, input.ToBackend)
+	if skipped > 0 {
+		fmt.Printf(", skipped %d that were already there (use --overwrite to replace them)", skipped)
+	}
+	fmt.Println()
+}
+
+// AddIntegrityCommand adds the items of the file backend to its integrity index, which older versions
+// didn't keep, so they can be used again
+func AddIntegrityCommand(app *kingpin.Application) {
+	added, err := backend.AddToIntegrityIndex(GlobalFlags.FileDir, filePassphraseFunc(GlobalFlags),
+		keyringOpener(keyring.FileBackend, GlobalFlags))
+	if err != nil {
+		app.Fatalf("Failed to add the file backend's items to its integrity index: %v", err)
+		return
+	}
+	fmt.Printf("Added %d items to the integrity index\n", added)
+}
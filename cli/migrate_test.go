@@ -0,0 +1,30 @@
+package cli
+
+import (
+	"github.com/99designs/keyring"
+	kingpin "gopkg.in/alecthomas/kingpin.v2"
+)
+
+func ExampleMigrateCommand() {
+	from := keyring.NewArrayKeyring([]keyring.Item{
+		{Key: "llamas", Data: []byte(`{"AccessKeyID":"ABC","SecretAccessKey":"XYZ"}`)},
+		{Key: "alpacas", Data: []byte(`{"AccessKeyID":"DEF","SecretAccessKey":"UVW"}`)},
+		{Key: "session,bGxhbWFz,,1572281751", Data: []byte(`{}`)},
+	})
+	to := keyring.NewArrayKeyring([]keyring.Item{
+		{Key: "alpacas", Data: []byte(`{"AccessKeyID":"GHI","SecretAccessKey":"RST"}`)},
+	})
+
+	app := kingpin.New(`aws-vault`, ``)
+	MigrateCommand(app, MigrateCommandInput{
+		From:        from,
+		To:          to,
+		FromBackend: "keychain",
+		ToBackend:   "pass",
+	})
+
+	// Output:
+	// Skipped alpacas, it's already in pass
+	// Copied llamas
+	// Copied 1 credentials and 0 sessions to pass, skipped 1 that were already there (use --overwrite to replace them)
+}
@@ -0,0 +1,71 @@
+package cli
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/99designs/keyring"
+)
+
+// pivChallenge is signed by the PIV key to derive the file backend passphrase. RSA PKCS#1 v1.5
+// signatures are deterministic, so the same key always produces the same passphrase.
+const pivChallenge = "aws-vault file backend passphrase v1"
+
+// pivPassphrasePrompt returns a passphrase func that derives the passphrase from a signature
+// made by the key in the given YubiKey PIV slot. If yubico-piv-tool isn't available on this
+// platform it gracefully falls back to the provided prompt.
+func pivPassphrasePrompt(slot string, fallback keyring.PromptFunc) keyring.PromptFunc {
+	return func(prompt string) (string, error) {
+		if _, err := exec.LookPath("yubico-piv-tool"); err != nil {
+			log.Printf("yubico-piv-tool not found, falling back to passphrase prompt")
+			return fallback(prompt)
+		}
+		return pivPassphrase(slot)
+	}
+}
+
+func pivPassphrase(slot string) (string, error) {
+	f, err := ioutil.TempFile("", "aws-vault-piv")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err = f.WriteString(pivChallenge); err != nil {
+		return "", err
+	}
+	f.Close()
+
+	infof("Unlocking vault with YubiKey PIV slot %s (touch may be required)\n", slot)
+
+	cmd := exec.Command("yubico-piv-tool",
+		"--action=verify-pin",
+		"--action=sign",
+		"--slot="+slot,
+		"--algorithm=RSA2048",
+		"--hash=SHA256",
+		"--input="+f.Name(),
+		"--output=-",
+	)
+	cmd.Stdin = os.Stdin
+	cmd.Stderr = os.Stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("Failed to sign with YubiKey PIV slot %s: %v", slot, err)
+	}
+
+	sig := strings.TrimSpace(string(out))
+	if sig == "" {
+		return "", fmt.Errorf("YubiKey PIV slot %s returned an empty signature", slot)
+	}
+
+	sum := sha256.Sum256([]byte(sig))
+	return hex.EncodeToString(sum[:]), nil
+}
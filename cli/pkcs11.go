@@ -0,0 +1,219 @@
+package cli
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"github.com/99designs/aws-vault/vault"
+	"github.com/99designs/keyring"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// pkcs11LabelPrefix is prepended to keyring keys to label the data objects on the token. Objects of a
+// vault chosen with --vault are labelled aws-vault/<vault>: instead
+const pkcs11LabelPrefix = "aws-vault:"
+
+// inKeyring returns whether the key is kept in the software keyring rather than on the token
+func inKeyring(key string) bool {
+	return vault.IsSessionKey(key) || vault.IsMetadataKey(key)
+}
+
+// pkcs11Keyring keeps master credentials and TOTP secrets as private data objects on a PKCS#11 token,
+// so they're only readable with the token and its PIN. Sessions and metadata are written often, so
+// they stay in the software keyring. Objects are accessed with OpenSC's pkcs11-tool.
+type pkcs11Keyring struct {
+	keyring keyring.Keyring
+	module  string
+	prefix  string
+	pin     string
+	labels  []string
+}
+
+func newPkcs11Keyring(k keyring.Keyring, module, vaultName string) keyring.Keyring {
+	prefix := pkcs11LabelPrefix
+	if vaultName != "" {
+		prefix = "aws-vault/" + vaultName + ":"
+	}
+	return &pkcs11Keyring{keyring: k, module: module, prefix: prefix}
+}
+
+func (p *pkcs11Keyring) run(args ...string) ([]byte, error) {
+	return p.runWithInput(nil, args...)
+}
+
+// runWithInput runs pkcs11-tool with input on its stdin, so secrets are never written to a file
+func (p *pkcs11Keyring) runWithInput(input []byte, args ...string) ([]byte, error) {
+	if _, err := exec.LookPath("pkcs11-tool"); err != nil {
+		return nil, fmt.Errorf("pkcs11-tool from OpenSC is needed to use a PKCS#11 token: %v", err)
+	}
+	if p.pin == "" {
+		pin, err := pkcs11Pin()
+		if err != nil {
+			return nil, err
+		}
+		p.pin = pin
+	}
+
+	// the PIN is passed in the environment so it isn't visible in the process list
+	cmd := exec.Command("pkcs11-tool", append([]string{"--module", p.module, "--login", "--pin", "env:AWS_VAULT_PKCS11_PIN"}, args...)...)
+	cmd.Env = append(os.Environ(), "AWS_VAULT_PKCS11_PIN="+p.pin)
+	if input != nil {
+		cmd.Stdin = bytes.NewReader(input)
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("pkcs11-tool failed: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
+
+func pkcs11Pin() (string, error) {
+	if pin := os.Getenv("AWS_VAULT_PKCS11_PIN"); pin != "" {
+		return pin, nil
+	}
+
+	fmt.Fprint(os.Stderr, "Enter PIN for PKCS#11 token: ")
+	b, err := terminal.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// tokenKeys returns the keys of the aws-vault data objects on the token
+func (p *pkcs11Keyring) tokenKeys() ([]string, error) {
+	if p.labels != nil {
+		return p.labels, nil
+	}
+
+	out, err := p.run("--list-objects", "--type", "data")
+	if err != nil {
+		return nil, err
+	}
+
+	keys := []string{}
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(line, "label:") {
+			continue
+		}
+		label := strings.Trim(strings.TrimSpace(strings.TrimPrefix(line, "label:")), "'")
+		if strings.HasPrefix(label, p.prefix) {
+			keys = append(keys, strings.TrimPrefix(label, p.prefix))
+		}
+	}
+	p.labels = keys
+	return keys, nil
+}
+
+func (p *pkcs11Keyring) onToken(key string) (bool, error) {
+	keys, err := p.tokenKeys()
+	if err != nil {
+		return false, err
+	}
+	for _, k := range keys {
+		if k == key {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (p *pkcs11Keyring) Get(key string) (keyring.Item, error) {
+	if inKeyring(key) {
+		return p.keyring.Get(key)
+	}
+	if ok, err := p.onToken(key); err != nil || !ok {
+		if err == nil {
+			err = keyring.ErrKeyNotFound
+		}
+		return keyring.Item{}, err
+	}
+
+	// without --output-file the object is written to stdout
+	log.Printf("Reading %s from PKCS#11 token", key)
+	data, err := p.run("--read-object", "--type", "data", "--label", p.prefix+key)
+	if err != nil {
+		return keyring.Item{}, err
+	}
+	return keyring.Item{Key: key, Data: data}, nil
+}
+
+func (p *pkcs11Keyring) GetMetadata(key string) (keyring.Metadata, error) {
+	if inKeyring(key) {
+		return p.keyring.GetMetadata(key)
+	}
+	if ok, err := p.onToken(key); err != nil || !ok {
+		if err == nil {
+			err = keyring.ErrKeyNotFound
+		}
+		return keyring.Metadata{}, err
+	}
+	return keyring.Metadata{Item: &keyring.Item{Key: key}}, nil
+}
+
+func (p *pkcs11Keyring) Set(item keyring.Item) error {
+	if inKeyring(item.Key) {
+		return p.keyring.Set(item)
+	}
+
+	// pkcs11-tool only writes objects from a file, which is given its stdin so the secret isn't written to disk
+	if runtime.GOOS == "windows" {
+		return fmt.Errorf("Writing to a PKCS#11 token isn't supported on Windows, add the credentials on another OS")
+	}
+
+	// pkcs11-tool adds objects rather than replacing them, so remove any existing one first
+	if err := p.Remove(item.Key); err != nil && err != keyring.ErrKeyNotFound {
+		return err
+	}
+
+	log.Printf("Writing %s to PKCS#11 token", item.Key)
+	p.labels = nil
+	_, err := p.runWithInput(item.Data, "--write-object", "/dev/stdin", "--type", "data", "--label", p.prefix+item.Key,
+		"--application-label", "aws-vault", "--private")
+	return err
+}
+
+func (p *pkcs11Keyring) Remove(key string) error {
+	if inKeyring(key) {
+		return p.keyring.Remove(key)
+	}
+	if ok, err := p.onToken(key); err != nil || !ok {
+		if err == nil {
+			err = keyring.ErrKeyNotFound
+		}
+		return err
+	}
+
+	p.labels = nil
+	_, err := p.run("--delete-object", "--type", "data", "--label", p.prefix+key)
+	return err
+}
+
+func (p *pkcs11Keyring) Keys() ([]string, error) {
+	keys, err := p.tokenKeys()
+	if err != nil {
+		return nil, err
+	}
+	keyringKeys, err := p.keyring.Keys()
+	if err != nil {
+		return nil, err
+	}
+	for _, k := range keyringKeys {
+		if inKeyring(k) {
+			keys = append(keys, k)
+		}
+	}
+	return keys, nil
+}
@@ -0,0 +1,222 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/99designs/aws-vault/logging"
+	"github.com/99designs/aws-vault/server"
+	"github.com/mitchellh/go-homedir"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+// execSession is recorded by each running exec so that ps can list them
+type execSession struct {
+	Pid             int       `json:"pid"`
+	ChildPid        int       `json:"child_pid"`
+	Command         string    `json:"command"`
+	ProfileName     string    `json:"profile"`
+	CredentialsName string    `json:"credentials"`
+	Server          bool      `json:"server"`
+	ServerURL       string    `json:"server_url,omitempty"`
+	ServerTokenFile string    `json:"server_token_file,omitempty"`
+	Started         time.Time `json:"started"`
+	Expiration      time.Time `json:"expiration,omitempty"`
+
+	// PidStarted and ChildStarted are when the processes started, as returned by processStarted, so a
+	// process that's later given the same pid isn't mistaken for them
+	PidStarted   string `json:"pid_started,omitempty"`
+	ChildStarted string `json:"child_started,omitempty"`
+}
+
+// sameProcess returns whether pid is still the process that started at started
+func sameProcess(pid int, started string) bool {
+	if started == "" {
+		return false
+	}
+	current, err := processStarted(pid)
+	if err != nil {
+		logging.Warnf("Can't tell when process %d started: %v", pid, err)
+		return false
+	}
+	return current == started
+}
+
+func execSessionsDir() (string, error) {
+	home, err := homedir.Dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".awsvault", "exec"), nil
+}
+
+func execSessionPath(pid int) (string, error) {
+	dir, err := execSessionsDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, strconv.Itoa(pid)+".json"), nil
+}
+
+// registerExecSession records a running exec, failures are only logged as ps is informational
+func registerExecSession(s execSession) {
+	path, err := execSessionPath(s.Pid)
+	if err != nil {
+		logging.Warnf("Failed to register exec session: %v", err)
+		return
+	}
+	if err = os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		logging.Warnf("Failed to register exec session: %v", err)
+		return
+	}
+	b, err := json.Marshal(s)
+	if err != nil {
+		logging.Warnf("Failed to register exec session: %v", err)
+		return
+	}
+	if err = ioutil.WriteFile(path, b, 0600); err != nil {
+		logging.Warnf("Failed to register exec session: %v", err)
+	}
+}
+
+func unregisterExecSession(pid int) {
+	if path, err := execSessionPath(pid); err == nil {
+		os.Remove(path)
+	}
+}
+
+// execSessions returns the running exec sessions, cleaning up after any that exited without unregistering
+func execSessions() ([]execSession, error) {
+	dir, err := execSessionsDir()
+	if err != nil {
+		return nil, err
+	}
+	files, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var sessions []execSession
+	for _, f := range files {
+		if !strings.HasSuffix(f.Name(), ".json") {
+			continue
+		}
+		path := filepath.Join(dir, f.Name())
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		var s execSession
+		if err = json.Unmarshal(b, &s); err != nil {
+			logging.Warnf("Ignoring invalid exec session %s: %v", path, err)
+			continue
+		}
+		if !processRunning(s.Pid) || (s.PidStarted != "" && !sameProcess(s.Pid, s.PidStarted)) {
+			log.Printf("Removing exec session for exited process %d", s.Pid)
+			os.Remove(path)
+			continue
+		}
+		sessions = append(sessions, s)
+	}
+	return sessions, nil
+}
+
+type PsCommandInput struct {
+	Terminate int
+	Refresh   int
+}
+
+func ConfigurePsCommand(app *kingpin.Application) {
+	input := PsCommandInput{}
+
+	cmd := app.Command("ps", "List running exec sessions and the credentials they hold")
+
+	cmd.Flag("terminate", "Terminate the command run by the exec session with this PID").
+		PlaceHolder("PID").
+		IntVar(&input.Terminate)
+
+	cmd.Flag("refresh", "Refresh the credentials served by the exec --server session with this PID").
+		PlaceHolder("PID").
+		IntVar(&input.Refresh)
+
+	cmd.Action(func(c *kingpin.ParseContext) error {
+		PsCommand(app, input)
+		return nil
+	})
+}
+
+func findExecSession(app *kingpin.Application, sessions []execSession, pid int) execSession {
+	for _, s := range sessions {
+		if s.Pid == pid {
+			return s
+		}
+	}
+	app.Fatalf("No running exec session with PID %d", pid)
+	return execSession{}
+}
+
+func PsCommand(app *kingpin.Application, input PsCommandInput) {
+	sessions, err := execSessions()
+	if err != nil {
+		app.Fatalf("%v", err)
+		return
+	}
+
+	if input.Terminate != 0 {
+		s := findExecSession(app, sessions, input.Terminate)
+		if !sameProcess(s.ChildPid, s.ChildStarted) {
+			app.Fatalf("The command of exec session %d has exited, or can't be told apart from a process given its PID since", s.Pid)
+			return
+		}
+		if err = terminateProcess(s.ChildPid); err != nil {
+			app.Fatalf("Failed to terminate %q: %v", s.Command, err)
+			return
+		}
+		fmt.Printf("Terminated %q using profile %s\n", s.Command, s.ProfileName)
+		return
+	}
+
+	if input.Refresh != 0 {
+		s := findExecSession(app, sessions, input.Refresh)
+		if !s.Server {
+			app.Fatalf("Exec session %d has credentials in its environment, only --server sessions can be refreshed", s.Pid)
+			return
+		}
+		if err = server.RefreshCredentialsServer(s.CredentialsName, s.ServerTokenFile); err != nil {
+			app.Fatalf("%v", err)
+			return
+		}
+		fmt.Printf("Refreshed credentials served to %q using profile %s\n", s.Command, s.ProfileName)
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 10, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "PID\tProfile\tMode\tStarted\tExpires\tCommand\t")
+	fmt.Fprintln(w, "===\t=======\t====\t=======\t=======\t=======\t")
+
+	for _, s := range sessions {
+		mode, expires := "env", s.Expiration.Format(time.RFC3339)
+		if s.Server {
+			mode, expires = "server", "auto-refreshed"
+		} else if s.Expiration.IsZero() {
+			expires = "-"
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\t\n",
+			s.Pid, s.ProfileName, mode, s.Started.Format(time.RFC3339), expires, s.Command)
+	}
+
+	if err = w.Flush(); err != nil {
+		app.Fatalf("%v", err)
+		return
+	}
+}
@@ -0,0 +1,23 @@
+// +build darwin
+
+package cli
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"golang.org/x/sys/unix"
+)
+
+// processStarted returns when the process started, to tell it apart from a later process given the same pid
+func processStarted(pid int) (string, error) {
+	// a kinfo_proc starts with p_starttime, a timeval
+	b, err := unix.SysctlRaw("kern.proc.pid", pid)
+	if err != nil {
+		return "", err
+	}
+	if len(b) < 12 {
+		return "", fmt.Errorf("No process with PID %d", pid)
+	}
+	return fmt.Sprintf("%d.%06d", binary.LittleEndian.Uint64(b[0:8]), binary.LittleEndian.Uint32(b[8:12])), nil
+}
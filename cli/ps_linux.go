@@ -0,0 +1,26 @@
+// +build linux
+
+package cli
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+)
+
+// processStarted returns when the process started, in clock ticks since boot, to tell it apart from a
+// later process given the same pid
+func processStarted(pid int) (string, error) {
+	b, err := ioutil.ReadFile("/proc/" + strconv.Itoa(pid) + "/stat")
+	if err != nil {
+		return "", err
+	}
+	// the command name in brackets can contain spaces, so fields are counted from after it
+	stat := string(b)
+	fields := strings.Fields(stat[strings.LastIndex(stat, ")")+1:])
+	if len(fields) < 20 {
+		return "", fmt.Errorf("Unexpected /proc/%d/stat", pid)
+	}
+	return fields[19], nil
+}
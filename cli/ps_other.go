@@ -0,0 +1,13 @@
+// +build !linux,!darwin,!windows
+
+package cli
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// processStarted would return when the process started, which isn't supported on this OS
+func processStarted(pid int) (string, error) {
+	return "", fmt.Errorf("Can't tell when a process started on %s", runtime.GOOS)
+}
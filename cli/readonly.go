@@ -0,0 +1,35 @@
+package cli
+
+import (
+	"errors"
+	"log"
+
+	"github.com/99designs/keyring"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+var errReadOnly = errors.New("aws-vault is read-only (--read-only), nothing can be stored or removed")
+
+// readOnlyKeyring fails anything that would write to the keyring, for shared hosts where the
+// credentials are managed by someone else
+type readOnlyKeyring struct {
+	keyring.Keyring
+}
+
+func (r readOnlyKeyring) Set(item keyring.Item) error {
+	log.Printf("Not storing %s, read-only", item.Key)
+	return errReadOnly
+}
+
+func (r readOnlyKeyring) Remove(key string) error {
+	log.Printf("Not removing %s, read-only", key)
+	return errReadOnly
+}
+
+// checkWritable fails commands that write to the keyring straight away in read-only mode, rather than
+// after prompting for anything
+func checkWritable(app *kingpin.Application, command string) {
+	if GlobalFlags.ReadOnly {
+		app.Fatalf("Can't %s, aws-vault is read-only (--read-only)", command)
+	}
+}
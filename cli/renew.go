@@ -0,0 +1,88 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/99designs/aws-vault/vault"
+	"github.com/99designs/keyring"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+type RenewCommandInput struct {
+	ProfileName string
+	Keyring     keyring.Keyring
+	Config      vault.Config
+}
+
+func ConfigureRenewCommand(app *kingpin.Application) {
+	input := RenewCommandInput{}
+
+	cmd := app.Command("renew", "Replace a profile's cached session with a new one, asking for an MFA token if needed")
+
+	cmd.Flag("session-ttl", "Expiration time for aws session").
+		Default("4h").
+		Envar("AWS_SESSION_TTL").
+		Short('t').
+		DurationVar(&input.Config.SessionDuration)
+
+	cmd.Flag("assume-role-ttl", "Expiration time for aws assumed role").
+		Default("15m").
+		Envar("AWS_ASSUME_ROLE_TTL").
+		DurationVar(&input.Config.AssumeRoleDuration)
+
+	cmd.Flag("region", "The region to use for STS, instead of the profile's, AWS_REGION or AWS_DEFAULT_REGION").
+		StringVar(&input.Config.Region)
+
+	cmd.Flag("mfa-serial", "The identification number of the MFA device to use").
+		StringVar(&input.Config.MfaSerial)
+
+	cmd.Flag("mfa-device", "The name or serial of the MFA device to use when mfa_serials lists several").
+		StringVar(&input.Config.MfaDevice)
+
+	cmd.Arg("profile", "Name of the profile").
+		Required().
+		HintAction(profileNamesHint).
+		PreAction(resolveProfileAlias(&input.ProfileName)).
+		StringVar(&input.ProfileName)
+
+	cmd.Action(func(c *kingpin.ParseContext) error {
+		checkWritable(app, "store sessions")
+		input.Keyring = keyringImpl
+		configureCredentials(&input.Config)
+		input.Config.MfaDeviceSelector = mfaDeviceSelector(input.ProfileName)
+		RenewCommand(app, input)
+		return nil
+	})
+}
+
+func RenewCommand(app *kingpin.Application, input RenewCommandInput) {
+	if err := configLoader.LoadFromProfile(input.ProfileName, &input.Config); err != nil {
+		app.Fatalf("%v", err)
+		return
+	}
+	if input.Config.NoSession && !input.Config.AssumeRoleWithMfa {
+		app.Fatalf("Profile %s doesn't use a session, so there's nothing to renew", input.ProfileName)
+		return
+	}
+
+	provider, err := vault.NewTempCredentialsProvider(input.Keyring, &input.Config)
+	if err != nil {
+		app.Fatalf("%v", err)
+		return
+	}
+	provider.ForceRefresh()
+
+	creds := credentials.NewCredentials(provider)
+	if _, err = creds.Get(); err != nil {
+		fatalCredentialError(app, err, input.ProfileName, input.Config.CredentialsName)
+		return
+	}
+
+	expiration, err := creds.ExpiresAt()
+	if err != nil {
+		app.Fatalf("%v", err)
+		return
+	}
+	fmt.Printf("Renewed the session for %s, its credentials expire in %s\n", input.ProfileName, sessionTTL(expiration))
+}
@@ -23,7 +23,8 @@ func ConfigureRemoveCommand(app *kingpin.Application) {
 
 	cmd.Arg("profile", "Name of the profile").
 		Required().
-		HintAction(awsConfigFile.ProfileNames).
+		HintAction(profileNamesHint).
+		PreAction(resolveProfileAlias(&input.ProfileName)).
 		StringVar(&input.ProfileName)
 
 	cmd.Flag("sessions-only", "Only remove sessions, leave credentials intact").
@@ -31,6 +32,7 @@ func ConfigureRemoveCommand(app *kingpin.Application) {
 		BoolVar(&input.SessionsOnly)
 
 	cmd.Action(func(c *kingpin.ParseContext) error {
+		checkWritable(app, "remove credentials")
 		input.Keyring = keyringImpl
 		RemoveCommand(app, input)
 		return nil
@@ -38,7 +40,27 @@ func ConfigureRemoveCommand(app *kingpin.Application) {
 }
 
 func RemoveCommand(app *kingpin.Application, input RemoveCommandInput) {
+	profileNames := []string{input.ProfileName}
+
 	if !input.SessionsOnly {
+		config := vault.Config{}
+		if err := configLoader.LoadFromProfile(input.ProfileName, &config); err == nil &&
+			config.CredentialsName != "" && config.CredentialsName != input.ProfileName {
+			app.Fatalf("Profile %q uses credentials from %q. Try removing %q instead, or use --sessions-only",
+				input.ProfileName, config.CredentialsName, config.CredentialsName)
+			return
+		}
+
+		keys, err := input.Keyring.Keys()
+		if err != nil {
+			app.Fatalf(err.Error())
+			return
+		}
+		if !contains(keys, input.ProfileName) {
+			app.Fatalf("No credentials are stored for %q", input.ProfileName)
+			return
+		}
+
 		provider := vault.NewMasterCredentialsProvider(input.Keyring, input.ProfileName)
 		r, err := prompt.TerminalPrompt(fmt.Sprintf("Delete credentials for profile %q? (Y|n)", input.ProfileName))
 		if err != nil {
@@ -53,14 +75,38 @@ func RemoveCommand(app *kingpin.Application, input RemoveCommandInput) {
 			return
 		}
 		fmt.Printf("Deleted credentials.\n")
+
+		// sessions of the profiles using the credentials go with them
+		profileNames = append(profileNames, profilesUsingCredentials(input.ProfileName, input.ProfileName)...)
 	}
 
 	sessions := vault.NewKeyringSessions(input.Keyring)
 
-	n, err := sessions.Delete(input.ProfileName)
-	if err != nil {
-		app.Fatalf(err.Error())
-		return
+	deleted := 0
+	for _, profileName := range profileNames {
+		n, err := sessions.Delete(profileName)
+		if err != nil {
+			app.Fatalf(err.Error())
+			return
+		}
+		deleted += n
+	}
+	fmt.Printf("Deleted %d sessions.\n", deleted)
+}
+
+// profilesUsingCredentials returns the profiles in the config file, other than except, that get their
+// credentials from credentialsName
+func profilesUsingCredentials(credentialsName string, except string) []string {
+	var profileNames []string
+	for _, profileName := range awsConfigFile.ProfileNames() {
+		if profileName == except {
+			continue
+		}
+		config := vault.Config{}
+		if err := configLoader.LoadFromProfile(profileName, &config); err != nil || config.CredentialsName != credentialsName {
+			continue
+		}
+		profileNames = append(profileNames, profileName)
 	}
-	fmt.Printf("Deleted %d sessions.\n", n)
+	return profileNames
 }
@@ -2,8 +2,10 @@ package cli
 
 import (
 	"fmt"
+	"log"
 
-	"github.com/99designs/aws-vault/prompt"
+	"github.com/99designs/aws-vault/logging"
+	"github.com/99designs/aws-vault/server"
 	"github.com/99designs/aws-vault/vault"
 	"github.com/99designs/keyring"
 	"gopkg.in/alecthomas/kingpin.v2"
@@ -18,25 +20,33 @@ type RotateCommandInput struct {
 func ConfigureRotateCommand(app *kingpin.Application) {
 	input := RotateCommandInput{}
 
-	cmd := app.Command("rotate", "Rotates credentials")
+	cmd := app.Command("rotate", "Rotates credentials, creating a new access key and deleting the old one once the new one works")
 	cmd.Arg("profile", "Name of the profile").
 		Required().
-		HintAction(awsConfigFile.ProfileNames).
+		HintAction(profileNamesHint).
+		PreAction(resolveProfileAlias(&input.ProfileName)).
 		StringVar(&input.ProfileName)
 
-	cmd.Flag("mfa-token", "The mfa token to use").
+	// -t predates the global --mfa-token flag
+	cmd.Flag("token", "The mfa token to use").
 		Short('t').
+		Hidden().
 		StringVar(&input.Config.MfaToken)
 
 	cmd.Flag("mfa-serial", "The identification number of the MFA device to use").
 		StringVar(&input.Config.MfaSerial)
 
+	cmd.Flag("mfa-device", "The name or serial of the MFA device to use when mfa_serials lists several").
+		StringVar(&input.Config.MfaDevice)
+
 	cmd.Flag("no-session", "Use root credentials, no session created").
 		Short('n').
 		BoolVar(&input.Config.NoSession)
 
 	cmd.Action(func(c *kingpin.ParseContext) error {
-		input.Config.MfaPrompt = prompt.Method(GlobalFlags.PromptDriver)
+		checkWritable(app, "rotate credentials")
+		configureCredentials(&input.Config)
+		input.Config.MfaDeviceSelector = mfaDeviceSelector(input.ProfileName)
 		input.Keyring = keyringImpl
 		RotateCommand(app, input)
 		return nil
@@ -50,11 +60,37 @@ func RotateCommand(app *kingpin.Application, input RotateCommandInput) {
 	}
 
 	fmt.Printf("Rotating credentials for profile %q (takes 10-20 seconds)\n", input.ProfileName)
-	if err := vault.Rotate(input.ProfileName, input.Keyring, &input.Config); err != nil {
+	if err := vault.Rotate(input.ProfileName, input.Keyring, &input.Config, refreshCredentialsServer); err != nil {
 		fmt.Println("Rotation failed. Try using --no-session")
 		app.Fatalf(err.Error())
 		return
 	}
 
+	// sessions of other profiles using the credentials came from the old access key
+	sessions := vault.NewKeyringSessions(input.Keyring)
+	for _, profileName := range profilesUsingCredentials(input.Config.CredentialsName, input.ProfileName) {
+		if n, err := sessions.Delete(profileName); err != nil {
+			logging.Warnf("Failed to delete sessions of %s: %v", profileName, err)
+		} else if n > 0 {
+			log.Printf("Deleted %d sessions of %s", n, profileName)
+		}
+	}
+
 	fmt.Printf("Done!\n")
 }
+
+// refreshCredentialsServer hands rotated credentials over to the exec --server serving them, if any, with
+// the token of the server that exec registered
+func refreshCredentialsServer(credentialsName string) error {
+	sessions, err := execSessions()
+	if err != nil {
+		return err
+	}
+	tokenFile := ""
+	for _, s := range sessions {
+		if s.ServerURL == server.LocalServerURL {
+			tokenFile = s.ServerTokenFile
+		}
+	}
+	return server.RefreshCredentialsServer(credentialsName, tokenFile)
+}
@@ -0,0 +1,129 @@
+package cli
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+
+	"github.com/99designs/aws-vault/vault"
+	"github.com/99designs/keyring"
+)
+
+// sessionFlags configures the session backend so it keeps sessions apart from credentials, even when
+// it's the same kind of backend. File based backends keep them in the session directory, and the
+// others in a keychain, collection or prefix named for sessions
+func sessionFlags() (globalFlags, error) {
+	flags := GlobalFlags
+
+	dir := flags.SessionDir
+	if dir == "" {
+		cache, err := os.UserCacheDir()
+		if err != nil {
+			return flags, err
+		}
+		dir = filepath.Join(cache, "aws-vault", "sessions")
+		if flags.Vault != "" {
+			dir = filepath.Join(dir, flags.Vault)
+		}
+	}
+	flags.FileDir = dir
+	flags.EncryptedFilePath = dir
+	flags.TPMPath = dir
+	flags.AgePath = dir
+	flags.GPGPath = dir
+
+	flags.KeychainName += "-sessions"
+	flags.SecretServiceCollection += "-sessions"
+	flags.KWalletFolder += "-sessions"
+	flags.WinCredPrefix += "-sessions"
+	flags.PassPrefix = path.Join(flags.PassPrefix, "sessions")
+	flags.HashiCorpVaultPath = path.Join(flags.HashiCorpVaultPath, "sessions")
+
+	// sessions are temporary, so aren't worth a PIN or a confirmation each time they're read
+	flags.Pkcs11Module = ""
+	flags.KeychainAccess = keychainTrusted
+	flags.KeychainTrustedApps = nil
+
+	return flags, nil
+}
+
+// openSessionStore opens the session backend, and returns a keyring that keeps sessions in it and
+// everything else in k
+func openSessionStore(k keyring.Keyring) (keyring.Keyring, error) {
+	flags, err := sessionFlags()
+	if err != nil {
+		return nil, err
+	}
+	sessions, err := openBackendWith(flags.SessionBackend, flags)
+	if err != nil {
+		return nil, err
+	}
+	return &sessionStoreKeyring{keyring: k, sessions: sessions}, nil
+}
+
+// sessionStoreKeyring keeps cached sessions in a separate store from master credentials. Sessions are
+// read far more often than credentials, so reading them from a lighter store, such as an encrypted file
+// in a tmpfs, avoids unlocking the keychain or token credentials are kept in each time. Sessions cached in
+// the keyring before the session store was used are still found there, until they expire or are removed.
+type sessionStoreKeyring struct {
+	keyring  keyring.Keyring
+	sessions keyring.Keyring
+}
+
+func (s *sessionStoreKeyring) store(key string) keyring.Keyring {
+	if vault.IsSessionKey(key) {
+		return s.sessions
+	}
+	return s.keyring
+}
+
+func (s *sessionStoreKeyring) Get(key string) (keyring.Item, error) {
+	item, err := s.store(key).Get(key)
+	if err == keyring.ErrKeyNotFound && vault.IsSessionKey(key) {
+		return s.keyring.Get(key)
+	}
+	return item, err
+}
+
+func (s *sessionStoreKeyring) GetMetadata(key string) (keyring.Metadata, error) {
+	md, err := s.store(key).GetMetadata(key)
+	if err == keyring.ErrKeyNotFound && vault.IsSessionKey(key) {
+		return s.keyring.GetMetadata(key)
+	}
+	return md, err
+}
+
+func (s *sessionStoreKeyring) Set(item keyring.Item) error {
+	return s.store(item.Key).Set(item)
+}
+
+func (s *sessionStoreKeyring) Remove(key string) error {
+	err := s.store(key).Remove(key)
+	if err == keyring.ErrKeyNotFound && vault.IsSessionKey(key) {
+		return s.keyring.Remove(key)
+	}
+	return err
+}
+
+// Keys returns the keys of the keyring and the sessions from the session store, including sessions
+// cached in the keyring before the session store was used, so they're listed and can be cleared
+func (s *sessionStoreKeyring) Keys() ([]string, error) {
+	keys, err := s.keyring.Keys()
+	if err != nil {
+		return nil, err
+	}
+	sessionKeys, err := s.sessions.Keys()
+	if err != nil {
+		return nil, err
+	}
+
+	all := keys
+	for _, key := range sessionKeys {
+		if vault.IsSessionKey(key) && !contains(all, key) {
+			all = append(all, key)
+		}
+	}
+	sort.Strings(all)
+	return all, nil
+}
@@ -0,0 +1,195 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/99designs/aws-vault/vault"
+	"github.com/99designs/keyring"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+type ShowCommandInput struct {
+	ProfileName string
+	Keyring     keyring.Keyring
+	Config      vault.Config
+	CheckStored bool
+}
+
+func ConfigureShowCommand(app *kingpin.Application) {
+	input := ShowCommandInput{}
+
+	cmd := app.Command("show", "Show the settings exec would use for a profile, after merging the config file, environment and flags")
+
+	cmd.Flag("no-session", "Use root credentials, no session created").
+		Short('n').
+		BoolVar(&input.Config.NoSession)
+
+	cmd.Flag("session-ttl", "Expiration time for aws session").
+		Default("4h").
+		Envar("AWS_SESSION_TTL").
+		Short('t').
+		DurationVar(&input.Config.SessionDuration)
+
+	cmd.Flag("assume-role-ttl", "Expiration time for aws assumed role").
+		Default("15m").
+		Envar("AWS_ASSUME_ROLE_TTL").
+		DurationVar(&input.Config.AssumeRoleDuration)
+
+	cmd.Flag("region", "The region to use, instead of the profile's, AWS_REGION or AWS_DEFAULT_REGION").
+		StringVar(&input.Config.Region)
+
+	cmd.Flag("mfa-serial", "The identification number of the MFA device to use").
+		StringVar(&input.Config.MfaSerial)
+
+	cmd.Flag("mfa-device", "The name or serial of the MFA device to use when mfa_serials lists several").
+		StringVar(&input.Config.MfaDevice)
+
+	cmd.Flag("role-arn", "Assume this role with the profile's credentials, instead of the profile's role_arn").
+		StringVar(&input.Config.RoleARN)
+
+	cmd.Flag("external-id", "The external id to assume the role with").
+		StringVar(&input.Config.ExternalID)
+
+	cmd.Flag("check-stored", "Open the backend to check the profile's credentials are stored, which can mean unlocking it").
+		BoolVar(&input.CheckStored)
+
+	cmd.Arg("profile", "Name of the profile").
+		Required().
+		HintAction(profileNamesHint).
+		PreAction(resolveProfileAlias(&input.ProfileName)).
+		StringVar(&input.ProfileName)
+
+	cmd.Action(func(c *kingpin.ParseContext) (err error) {
+		// the backend isn't opened for show unless it's needed, as it can ask to be unlocked
+		if input.CheckStored && keyringImpl == nil {
+			if keyringImpl, err = openKeyring(); err != nil {
+				app.Fatalf("%v", err)
+				return nil
+			}
+		}
+		input.Keyring = keyringImpl
+		configureCredentials(&input.Config)
+		ShowCommand(app, input)
+		return nil
+	})
+}
+
+func ShowCommand(app *kingpin.Application, input ShowCommandInput) {
+	config := input.Config
+	if err := configLoader.LoadFromProfile(input.ProfileName, &config); err != nil {
+		app.Fatalf("%v", err)
+		return
+	}
+
+	backendName := GlobalFlags.Backend
+	if backendName == "" {
+		if available := keyring.AvailableBackends(); len(available) > 0 {
+			backendName = string(available[0])
+		}
+	}
+	if GlobalFlags.SessionBackend != "" {
+		backendName += ", sessions in " + GlobalFlags.SessionBackend
+	}
+
+	stored := "not checked, use --check-stored"
+	if input.CheckStored {
+		if keys, err := input.Keyring.Keys(); err != nil {
+			stored = fmt.Sprintf("can't list the backend: %v", err)
+		} else if contains(keys, config.CredentialsName) {
+			stored = "stored"
+		} else {
+			stored = "not stored"
+		}
+	}
+
+	_, inConfig := awsConfigFile.ProfileSection(input.ProfileName)
+	chain := strings.Join(configLoader.ProfileChain(), " -> ")
+	if !inConfig {
+		chain = "none, it isn't in " + awsConfigFile.Path
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	row := func(name string, value interface{}) {
+		fmt.Fprintf(w, "%s\t%v\n", name, value)
+	}
+	row("Profile", input.ProfileName)
+	row("Read from", chain)
+	row("Credentials", fmt.Sprintf("%s (%s)", config.CredentialsName, stored))
+	row("Backend", backendName)
+	row("Region", orNone(config.Region))
+	row("Method", credentialMethod(config))
+	row("Role ARN", orNone(config.RoleARN))
+	if config.RoleARN != "" {
+		row("Role session name", orNone(config.RoleSessionName))
+		row("External ID", orNone(config.ExternalID))
+	}
+	row("MFA serial", orNone(config.MfaSerial))
+	if len(config.MfaSerials) > 0 {
+		row("MFA serials", strings.Join(config.MfaSerials, ", "))
+	}
+	if config.MfaProcess != "" {
+		row("MFA process", config.MfaProcess)
+	}
+	row("Prompt", config.PromptDriver)
+	if !config.NoSession {
+		row("Session duration", config.SessionDuration)
+	}
+	if config.RoleARN != "" {
+		row("Assume role duration", config.AssumeRoleDuration)
+	}
+	row("Expiration windows", fmt.Sprintf("session %s, role %s", config.SessionExpirationWindow, config.RoleExpirationWindow))
+	if config.WebIdentityTokenFile != "" {
+		row("Web identity token file", config.WebIdentityTokenFile)
+	}
+	if config.PostureHook != "" {
+		row("Posture hook", config.PostureHook)
+	}
+	row("Env format", orDefault(config.EnvFormat, "standard"))
+	row("No export", config.NoExport)
+	if config.CABundle != "" {
+		row("CA bundle", config.CABundle)
+	}
+	if config.HTTPSProxy != "" {
+		row("HTTPS proxy", config.HTTPSProxy)
+	}
+	if config.ConnectTimeout != 0 || config.RequestTimeout != 0 {
+		row("Timeouts", fmt.Sprintf("connect %s, request %s", config.ConnectTimeout, config.RequestTimeout))
+	}
+
+	if err := w.Flush(); err != nil {
+		app.Fatalf("%v", err)
+	}
+}
+
+// credentialMethod describes the STS calls exec makes to get credentials for config
+func credentialMethod(config vault.Config) string {
+	switch {
+	case config.WebIdentityTokenFile != "":
+		return "AssumeRoleWithWebIdentity"
+	case config.AssumeRootTarget != "":
+		return "AssumeRoot"
+	case config.NoSession && config.RoleARN == "":
+		return "stored credentials, no session"
+	case config.NoSession:
+		return "AssumeRole with the stored credentials"
+	case config.AssumeRoleWithMfa && config.RoleARN != "":
+		return "AssumeRole with MFA, cached"
+	case config.RoleARN == "":
+		return "GetSessionToken, cached"
+	}
+	return "GetSessionToken, cached, then AssumeRole"
+}
+
+func orNone(s string) string {
+	return orDefault(s, "none")
+}
+
+func orDefault(s string, def string) string {
+	if s == "" {
+		return def
+	}
+	return s
+}
@@ -0,0 +1,65 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+type StatusCommandInput struct {
+	PromptFormat bool
+}
+
+func ConfigureStatusCommand(app *kingpin.Application) {
+	input := StatusCommandInput{}
+
+	cmd := app.Command("status", "Show the profile of the aws-vault exec session this is run in, and when its credentials expire")
+
+	cmd.Flag("prompt-format", "Print just the profile and time left, or nothing outside a session, for a shell prompt").
+		BoolVar(&input.PromptFormat)
+
+	cmd.Action(func(c *kingpin.ParseContext) error {
+		StatusCommand(app, input)
+		return nil
+	})
+}
+
+// StatusCommand only reads the environment exec gave the shell, not the backend, so it's fast enough to
+// run for every prompt
+func StatusCommand(app *kingpin.Application, input StatusCommandInput) {
+	profileName := os.Getenv("AWS_VAULT")
+
+	var expiration time.Time
+	if s := os.Getenv("AWS_CREDENTIAL_EXPIRATION"); s != "" {
+		var err error
+		if expiration, err = time.Parse(time.RFC3339, s); err != nil {
+			app.Fatalf("Invalid AWS_CREDENTIAL_EXPIRATION: %v", err)
+			return
+		}
+	}
+
+	if input.PromptFormat {
+		if profileName == "" {
+			return
+		}
+		if expiration.IsZero() {
+			fmt.Println(profileName)
+		} else {
+			fmt.Printf("%s %s\n", profileName, sessionTTL(expiration))
+		}
+		return
+	}
+
+	switch {
+	case profileName == "":
+		fmt.Println("Not in an aws-vault exec session")
+	case expiration.IsZero():
+		fmt.Printf("In an aws-vault exec session for %s, its credentials don't expire or are served by --server\n", profileName)
+	case time.Now().After(expiration):
+		fmt.Printf("In an aws-vault exec session for %s, its credentials expired at %s\n", profileName, expiration.Local().Format(time.Kitchen))
+	default:
+		fmt.Printf("In an aws-vault exec session for %s, its credentials expire in %s at %s\n", profileName, sessionTTL(expiration), expiration.Local().Format(time.Kitchen))
+	}
+}
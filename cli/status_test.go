@@ -0,0 +1,27 @@
+package cli
+
+import (
+	"os"
+	"time"
+
+	"github.com/99designs/aws-vault/vault"
+	kingpin "gopkg.in/alecthomas/kingpin.v2"
+)
+
+func ExampleStatusCommand() {
+	awsConfigFile = &vault.ConfigFile{}
+	os.Setenv("AWS_VAULT", "llamas")
+	os.Setenv("AWS_CREDENTIAL_EXPIRATION", time.Now().Add(90*time.Minute+20*time.Second).UTC().Format(time.RFC3339))
+	defer os.Unsetenv("AWS_VAULT")
+	defer os.Unsetenv("AWS_CREDENTIAL_EXPIRATION")
+
+	app := kingpin.New("aws-vault", "")
+	ConfigureGlobals(app)
+	ConfigureStatusCommand(app)
+	kingpin.MustParse(app.Parse([]string{
+		"status", "--prompt-format",
+	}))
+
+	// Output:
+	// llamas 1h30m
+}
@@ -0,0 +1,361 @@
+package cli
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/99designs/aws-vault/logging"
+	"github.com/mitchellh/go-homedir"
+	"golang.org/x/crypto/ed25519"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+const (
+	latestReleaseURL = "https://api.github.com/repos/99designs/aws-vault/releases/latest"
+
+	// checksumsAsset lists the SHA-256 checksum of each binary in a release, and is signed along with the
+	// release's version by checksumsSigAsset
+	checksumsAsset    = "SHA256SUMS"
+	checksumsSigAsset = "SHA256SUMS.sig"
+
+	updateCheckFile     = "~/.awsvault/latest-version"
+	updateCheckInterval = 24 * time.Hour
+)
+
+// Version is the version of aws-vault, set by main
+var Version = "dev"
+
+// ReleasePublicKey is the base64 encoded ed25519 public key that release checksums are signed with,
+// provided at compile time
+var ReleasePublicKey = ""
+
+type UpgradeCommandInput struct {
+	Check bool
+	Force bool
+}
+
+type release struct {
+	TagName string `json:"tag_name"`
+	Assets  []struct {
+		Name string `json:"name"`
+		URL  string `json:"browser_download_url"`
+	} `json:"assets"`
+}
+
+func (r release) assetURL(name string) (string, error) {
+	for _, a := range r.Assets {
+		if a.Name == name {
+			return a.URL, nil
+		}
+	}
+	return "", fmt.Errorf("Release %s has no %s", r.TagName, name)
+}
+
+func ConfigureUpgradeCommand(app *kingpin.Application) {
+	input := UpgradeCommandInput{}
+
+	cmd := app.Command("upgrade", "Replace aws-vault with the latest release from GitHub, after verifying its signed checksum")
+
+	cmd.Flag("check", "Only check whether a newer release is available").
+		BoolVar(&input.Check)
+
+	cmd.Flag("force", "Install the latest release even if it isn't newer than this version").
+		BoolVar(&input.Force)
+
+	cmd.Action(func(c *kingpin.ParseContext) error {
+		UpgradeCommand(app, input)
+		return nil
+	})
+}
+
+func UpgradeCommand(app *kingpin.Application, input UpgradeCommandInput) {
+	client := &http.Client{Timeout: 5 * time.Minute}
+
+	latest, err := latestRelease(client)
+	if err != nil {
+		app.Fatalf("Failed to check for a new release: %v", err)
+		return
+	}
+
+	if _, ok := parseVersion(Version); !ok && !input.Force {
+		app.Fatalf("This is a development build of aws-vault, use --force to replace it with %s", latest.TagName)
+		return
+	}
+	if !input.Force && !isNewerVersion(latest.TagName, Version) {
+		fmt.Printf("aws-vault %s is the latest release\n", Version)
+		return
+	}
+	if input.Check {
+		fmt.Printf("aws-vault %s is available, you have %s. Run aws-vault upgrade to install it\n", latest.TagName, Version)
+		return
+	}
+
+	if ReleasePublicKey == "" {
+		app.Fatalf("This build of aws-vault has no release signing key to verify upgrades with, " +
+			"download the release from https://github.com/99designs/aws-vault/releases instead")
+		return
+	}
+	publicKey, err := base64.StdEncoding.DecodeString(ReleasePublicKey)
+	if err != nil || len(publicKey) != ed25519.PublicKeySize {
+		app.Fatalf("The release signing key of this build is invalid")
+		return
+	}
+
+	exe, err := os.Executable()
+	if err == nil {
+		exe, err = filepath.EvalSymlinks(exe)
+	}
+	if err != nil {
+		app.Fatalf("Can't find the aws-vault binary to replace: %v", err)
+		return
+	}
+	if strings.Contains(exe, "/Cellar/") || strings.Contains(exe, "/Caskroom/") {
+		app.Fatalf("%s was installed with Homebrew, upgrade it with brew upgrade aws-vault instead", exe)
+		return
+	}
+
+	binary, err := downloadRelease(client, latest, ed25519.PublicKey(publicKey))
+	if err != nil {
+		app.Fatalf("%v", err)
+		return
+	}
+
+	if err = replaceExecutable(exe, binary); err != nil {
+		app.Fatalf("Failed to replace %s: %v", exe, err)
+		return
+	}
+	fmt.Printf("Upgraded %s from %s to %s\n", exe, Version, latest.TagName)
+}
+
+// releaseAssetName returns the name of the release binary for this platform, as built by the Makefile
+func releaseAssetName() string {
+	name := "aws-vault-" + runtime.GOOS + "-" + runtime.GOARCH
+	if runtime.GOOS == "windows" {
+		name += ".exe"
+	}
+	return name
+}
+
+func latestRelease(client *http.Client) (release, error) {
+	var r release
+
+	b, err := httpGet(client, latestReleaseURL)
+	if err != nil {
+		return r, err
+	}
+	if err = json.Unmarshal(b, &r); err != nil {
+		return r, fmt.Errorf("Failed to parse the release: %v", err)
+	}
+	if r.TagName == "" {
+		return r, fmt.Errorf("Expected a release with a tag_name")
+	}
+	return r, nil
+}
+
+// downloadRelease downloads the binary for this platform from r, checking the signature of the release
+// checksums and the checksum of the binary
+func downloadRelease(client *http.Client, r release, publicKey ed25519.PublicKey) ([]byte, error) {
+	download := func(name string) ([]byte, error) {
+		url, err := r.assetURL(name)
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("Downloading %s", url)
+		return httpGet(client, url)
+	}
+
+	sums, err := download(checksumsAsset)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := download(checksumsSigAsset)
+	if err != nil {
+		return nil, err
+	}
+	if !ed25519.Verify(publicKey, releaseSignedMessage(r.TagName, sums), sig) {
+		return nil, fmt.Errorf("The signature of the checksums of release %s is invalid, not upgrading", r.TagName)
+	}
+
+	name := releaseAssetName()
+	want, err := findChecksum(sums, name)
+	if err != nil {
+		return nil, err
+	}
+	binary, err := download(name)
+	if err != nil {
+		return nil, err
+	}
+	if got := sha256.Sum256(binary); !bytes.Equal(got[:], want) {
+		return nil, fmt.Errorf("The checksum of %s doesn't match the signed checksum, not upgrading", name)
+	}
+	return binary, nil
+}
+
+// releaseSignedMessage is what's signed for a release: its version and checksums, so the checksums of an
+// older release can't be passed off as a newer one's
+func releaseSignedMessage(version string, sums []byte) []byte {
+	return append([]byte("aws-vault "+version+"\n"), sums...)
+}
+
+// findChecksum finds the checksum of name in the output of sha256sum
+func findChecksum(sums []byte, name string) ([]byte, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(sums))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && strings.TrimPrefix(fields[1], "*") == name {
+			sum, err := hex.DecodeString(fields[0])
+			if err != nil || len(sum) != sha256.Size {
+				return nil, fmt.Errorf("%s has an invalid checksum for %s", checksumsAsset, name)
+			}
+			return sum, nil
+		}
+	}
+	return nil, fmt.Errorf("%s has no checksum for %s", checksumsAsset, name)
+}
+
+// replaceExecutable writes binary next to exe and renames it over exe, so exe is never left half written
+func replaceExecutable(exe string, binary []byte) error {
+	f, err := ioutil.TempFile(filepath.Dir(exe), ".aws-vault-upgrade")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err = f.Write(binary); err != nil {
+		f.Close()
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	if err = os.Chmod(f.Name(), 0755); err != nil {
+		return err
+	}
+
+	// windows can't replace a running executable, but it can rename it. It's renamed back if the new
+	// binary can't be put in its place, so aws-vault isn't left missing
+	if runtime.GOOS == "windows" {
+		old := exe + ".old"
+		os.Remove(old)
+		if err = os.Rename(exe, old); err != nil {
+			return err
+		}
+		if err = os.Rename(f.Name(), exe); err != nil {
+			if restoreErr := os.Rename(old, exe); restoreErr != nil {
+				logging.Warnf("Failed to restore %s from %s: %v", exe, old, restoreErr)
+			}
+			return err
+		}
+		return nil
+	}
+	return os.Rename(f.Name(), exe)
+}
+
+func httpGet(client *http.Client, url string) ([]byte, error) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "aws-vault/"+Version)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s failed with %s", url, resp.Status)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+// parseVersion parses a version like v5.1.2, or v5.1.2-3-gabcdef for builds after a tag
+func parseVersion(v string) ([3]int, bool) {
+	var parsed [3]int
+	v = strings.TrimPrefix(v, "v")
+	if i := strings.IndexAny(v, "-+"); i >= 0 {
+		v = v[:i]
+	}
+	parts := strings.Split(v, ".")
+	if len(parts) != 3 {
+		return parsed, false
+	}
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil {
+			return parsed, false
+		}
+		parsed[i] = n
+	}
+	return parsed, true
+}
+
+// isNewerVersion returns whether latest is newer than current. Development builds aren't compared, so
+// are never out of date
+func isNewerVersion(latest string, current string) bool {
+	l, ok := parseVersion(latest)
+	if !ok {
+		return false
+	}
+	c, ok := parseVersion(current)
+	if !ok {
+		return false
+	}
+	for i := range l {
+		if l[i] != c[i] {
+			return l[i] > c[i]
+		}
+	}
+	return false
+}
+
+// notifyNewVersion tells the user on stderr when a newer release is available. GitHub is asked at most
+// once a day, whether or not it answers, and the latest version is remembered in between
+func notifyNewVersion() {
+	if _, ok := parseVersion(Version); !ok {
+		return
+	}
+	path, err := homedir.Expand(updateCheckFile)
+	if err != nil {
+		logging.Warnf("Failed to check for a new release: %v", err)
+		return
+	}
+
+	var latest string
+	if b, err := ioutil.ReadFile(path); err == nil {
+		latest = strings.TrimSpace(string(b))
+	}
+	if stat, err := os.Stat(path); err != nil || time.Since(stat.ModTime()) >= updateCheckInterval {
+		// the check is remembered even when it fails, so being offline doesn't hold up every command
+		if r, err := latestRelease(&http.Client{Timeout: 2 * time.Second}); err != nil {
+			logging.Warnf("Failed to check for a new release: %v", err)
+		} else {
+			latest = r.TagName
+		}
+		if err = os.MkdirAll(filepath.Dir(path), 0700); err == nil {
+			err = ioutil.WriteFile(path, []byte(latest+"\n"), 0600)
+		}
+		if err != nil {
+			logging.Warnf("Failed to remember the latest release: %v", err)
+		}
+	}
+
+	if isNewerVersion(latest, Version) {
+		infof("aws-vault %s is available, you have %s. Run aws-vault upgrade to install it\n", latest, Version)
+	}
+}
@@ -0,0 +1,196 @@
+package cli
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ed25519"
+)
+
+func TestParseVersion(t *testing.T) {
+	var testCases = []struct {
+		Version string
+		Parsed  [3]int
+		Ok      bool
+	}{
+		{"v5.1.2", [3]int{5, 1, 2}, true},
+		{"5.1.2", [3]int{5, 1, 2}, true},
+		{"v5.1.2-3-gabcdef", [3]int{5, 1, 2}, true},
+		{"v5.1.2+dirty", [3]int{5, 1, 2}, true},
+		{"v5.1", [3]int{}, false},
+		{"v5.x.2", [3]int{}, false},
+		{"dev", [3]int{}, false},
+	}
+
+	for _, tc := range testCases {
+		parsed, ok := parseVersion(tc.Version)
+		if ok != tc.Ok || (ok && parsed != tc.Parsed) {
+			t.Errorf("parseVersion(%q) = %v, %v, want %v, %v", tc.Version, parsed, ok, tc.Parsed, tc.Ok)
+		}
+	}
+}
+
+func TestIsNewerVersion(t *testing.T) {
+	var testCases = []struct {
+		Latest  string
+		Current string
+		Newer   bool
+	}{
+		{"v5.1.3", "v5.1.2", true},
+		{"v5.2.0", "v5.1.9", true},
+		{"v6.0.0", "v5.10.10", true},
+		{"v5.10.0", "v5.9.0", true},
+		{"v5.1.2", "v5.1.2", false},
+		{"v5.1.2", "v5.1.2-3-gabcdef", false},
+		{"v5.1.1", "v5.1.2", false},
+		{"v5.1.3", "dev", false},
+		{"latest", "v5.1.2", false},
+	}
+
+	for _, tc := range testCases {
+		if newer := isNewerVersion(tc.Latest, tc.Current); newer != tc.Newer {
+			t.Errorf("isNewerVersion(%q, %q) = %v, want %v", tc.Latest, tc.Current, newer, tc.Newer)
+		}
+	}
+}
+
+func TestFindChecksum(t *testing.T) {
+	sum := sha256.Sum256([]byte("llamas"))
+	valid := hex.EncodeToString(sum[:])
+
+	var testCases = []struct {
+		Sums string
+		Ok   bool
+	}{
+		{valid + "  aws-vault-linux-amd64\n", true},
+		{valid + " *aws-vault-linux-amd64\n", true},
+		{"0000  aws-vault-darwin-amd64\n" + valid + "  aws-vault-linux-amd64\n", true},
+		{valid + "  aws-vault-darwin-amd64\n", false},
+		{valid + "  aws-vault-linux-amd64.sig\n", false},
+		{"not-hex  aws-vault-linux-amd64\n", false},
+		{valid[:62] + "  aws-vault-linux-amd64\n", false},
+		{valid + " aws-vault-linux-amd64 extra\n", false},
+		{"", false},
+	}
+
+	for _, tc := range testCases {
+		got, err := findChecksum([]byte(tc.Sums), "aws-vault-linux-amd64")
+		if tc.Ok && (err != nil || hex.EncodeToString(got) != valid) {
+			t.Errorf("findChecksum(%q) = %x, %v, want %s", tc.Sums, got, err, valid)
+		} else if !tc.Ok && err == nil {
+			t.Errorf("findChecksum(%q) = %x, want an error", tc.Sums, got)
+		}
+	}
+}
+
+func TestReleaseSignedMessage(t *testing.T) {
+	sums := []byte("abc  aws-vault-linux-amd64\n")
+	if string(releaseSignedMessage("v5.1.2", sums)) != "aws-vault v5.1.2\nabc  aws-vault-linux-amd64\n" {
+		t.Fatalf("Unexpected signed message %q", releaseSignedMessage("v5.1.2", sums))
+	}
+	if string(releaseSignedMessage("v5.1.2", sums)) == string(releaseSignedMessage("v5.1.3", sums)) {
+		t.Fatal("Expected the signed message to include the version")
+	}
+}
+
+// releaseServer serves the assets of a release, returning it with the asset URLs pointing at the server
+func releaseServer(tag string, assets map[string][]byte) (*httptest.Server, release) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, ok := assets[strings.TrimPrefix(r.URL.Path, "/")]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(b)
+	}))
+
+	r := release{TagName: tag}
+	for name := range assets {
+		r.Assets = append(r.Assets, struct {
+			Name string `json:"name"`
+			URL  string `json:"browser_download_url"`
+		}{name, ts.URL + "/" + name})
+	}
+	return ts, r
+}
+
+func TestDownloadRelease(t *testing.T) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, otherKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	name := releaseAssetName()
+	binary := []byte("new aws-vault")
+	sum := sha256.Sum256(binary)
+	sums := []byte(fmt.Sprintf("%x  %s\n", sum, name))
+	badSum := sha256.Sum256([]byte("another binary"))
+	badSums := []byte(fmt.Sprintf("%x  %s\n", badSum, name))
+
+	var testCases = []struct {
+		Name   string
+		Tag    string
+		Assets map[string][]byte
+		Error  string
+	}{
+		{"valid", "v5.1.2", map[string][]byte{
+			checksumsAsset:    sums,
+			checksumsSigAsset: ed25519.Sign(privateKey, releaseSignedMessage("v5.1.2", sums)),
+			name:              binary,
+		}, ""},
+		{"signed with another key", "v5.1.2", map[string][]byte{
+			checksumsAsset:    sums,
+			checksumsSigAsset: ed25519.Sign(otherKey, releaseSignedMessage("v5.1.2", sums)),
+			name:              binary,
+		}, "signature"},
+		{"signed for another version", "v5.1.3", map[string][]byte{
+			checksumsAsset:    sums,
+			checksumsSigAsset: ed25519.Sign(privateKey, releaseSignedMessage("v5.1.2", sums)),
+			name:              binary,
+		}, "signature"},
+		{"checksums changed after signing", "v5.1.2", map[string][]byte{
+			checksumsAsset:    badSums,
+			checksumsSigAsset: ed25519.Sign(privateKey, releaseSignedMessage("v5.1.2", sums)),
+			name:              binary,
+		}, "signature"},
+		{"binary doesn't match its checksum", "v5.1.2", map[string][]byte{
+			checksumsAsset:    badSums,
+			checksumsSigAsset: ed25519.Sign(privateKey, releaseSignedMessage("v5.1.2", badSums)),
+			name:              binary,
+		}, "checksum"},
+		{"no signature", "v5.1.2", map[string][]byte{
+			checksumsAsset: sums,
+			name:           binary,
+		}, checksumsSigAsset},
+		{"no binary for this platform", "v5.1.2", map[string][]byte{
+			checksumsAsset:    []byte(fmt.Sprintf("%x  aws-vault-plan9-mips\n", sum)),
+			checksumsSigAsset: ed25519.Sign(privateKey, releaseSignedMessage("v5.1.2", []byte(fmt.Sprintf("%x  aws-vault-plan9-mips\n", sum)))),
+		}, "no checksum"},
+	}
+
+	for _, tc := range testCases {
+		ts, r := releaseServer(tc.Tag, tc.Assets)
+		got, err := downloadRelease(ts.Client(), r, publicKey)
+		ts.Close()
+
+		if tc.Error == "" {
+			if err != nil {
+				t.Errorf("%s: %v", tc.Name, err)
+			} else if string(got) != string(binary) {
+				t.Errorf("%s: expected %q, got %q", tc.Name, binary, got)
+			}
+		} else if err == nil || !strings.Contains(err.Error(), tc.Error) {
+			t.Errorf("%s: expected an error about %s, got %v", tc.Name, tc.Error, err)
+		}
+	}
+}
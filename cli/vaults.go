@@ -0,0 +1,73 @@
+package cli
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+
+	"github.com/99designs/aws-vault/vault"
+)
+
+const defaultFileDir = "~/.awsvault/keys/"
+
+var vaultNameRegexp = regexp.MustCompile(`^[A-Za-z0-9_-][A-Za-z0-9_.-]*$`)
+
+// applyVault points the backend flags at the named vault, so its credentials and sessions are kept
+// apart from those of other vaults. Settings in the vault's section of the config file are used,
+// otherwise names for the vault are derived from the defaults. Flags that were changed from their
+// defaults are left as they are.
+func applyVault(v vault.VaultSection, backendsAvailable []string) error {
+	if !vaultNameRegexp.MatchString(v.Name) {
+		return fmt.Errorf("Invalid vault name %q, it can only contain letters, digits, '-', '_' and '.'", v.Name)
+	}
+
+	if GlobalFlags.Backend == "" && v.Backend != "" {
+		if !contains(backendsAvailable, v.Backend) {
+			return fmt.Errorf("Vault %s uses backend %q, which isn't one of %v", v.Name, v.Backend, backendsAvailable)
+		}
+		GlobalFlags.Backend = v.Backend
+	}
+
+	if GlobalFlags.SessionBackend == "" && v.SessionBackend != "" {
+		if !contains(backendsAvailable, v.SessionBackend) {
+			return fmt.Errorf("Vault %s uses session backend %q, which isn't one of %v", v.Name, v.SessionBackend, backendsAvailable)
+		}
+		GlobalFlags.SessionBackend = v.SessionBackend
+	}
+
+	if v.KeychainAccess != "" && !contains(keychainAccessModes, v.KeychainAccess) {
+		return fmt.Errorf("Vault %s has keychain_access %q, which isn't one of %v", v.Name, v.KeychainAccess, keychainAccessModes)
+	}
+
+	name := v.Name
+	setDefault(&GlobalFlags.KeychainName, "aws-vault", v.Keychain, "aws-vault-"+name)
+	setDefault(&GlobalFlags.SessionDir, "", v.SessionDir, "")
+	setDefault(&GlobalFlags.KeychainAccess, keychainTrusted, v.KeychainAccess, "")
+	setDefault(&GlobalFlags.FileDir, defaultFileDir, v.FileDir, "~/.awsvault/vaults/"+name+"/keys/")
+	setDefault(&GlobalFlags.PassPrefix, "", v.PassPrefix, name)
+	setDefault(&GlobalFlags.SecretServiceCollection, "awsvault", v.SecretServiceCollection, "awsvault-"+name)
+	setDefault(&GlobalFlags.KWalletFolder, "aws-vault", v.KWalletFolder, "aws-vault-"+name)
+	setDefault(&GlobalFlags.WinCredPrefix, "aws-vault", v.WinCredPrefix, "aws-vault-"+name)
+	setDefault(&GlobalFlags.EncryptedFilePath, "~/.awsvault/encrypted/", v.EncryptedFilePath, "~/.awsvault/vaults/"+name+"/encrypted/")
+	setDefault(&GlobalFlags.TPMPath, "~/.awsvault/tpm/", v.TPMPath, "~/.awsvault/vaults/"+name+"/tpm/")
+	setDefault(&GlobalFlags.AgePath, "~/.awsvault/age/", v.AgePath, "~/.awsvault/vaults/"+name+"/age/")
+	setDefault(&GlobalFlags.AgeRecipientsFile, "", v.AgeRecipientsFile, "")
+	setDefault(&GlobalFlags.AgeIdentity, "", v.AgeIdentity, "")
+	setDefault(&GlobalFlags.GPGPath, "~/.awsvault/gpg/", v.GPGPath, "~/.awsvault/vaults/"+name+"/gpg/")
+	setDefault(&GlobalFlags.OpVault, "", v.OpVault, "")
+	setDefault(&GlobalFlags.HashiCorpVaultPath, "aws-vault", v.HashiCorpVaultPath, path.Join("aws-vault", name))
+
+	return nil
+}
+
+// setDefault sets a flag still at its default to the configured value, or the derived value
+func setDefault(flag *string, defaultValue, configured, derived string) {
+	if *flag != defaultValue {
+		return
+	}
+	if configured != "" {
+		*flag = configured
+	} else if derived != "" {
+		*flag = derived
+	}
+}
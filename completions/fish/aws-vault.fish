@@ -1,17 +1,18 @@
-complete -c aws-vault -x -a '(__fish_aws_vault_completion)'
-
 function __fish_aws_vault_completion
-  if [ (count (commandline -opc)) = 1 ]
-    __fish_print_aws_vault_commands
-  else
-    __fish_print_aws_roles
-  end
-end
+    set -l words (commandline -opc)
+    set -l cur (commandline -ct)
 
-function __fish_print_aws_vault_commands
-  aws-vault --help |awk '/^  [a-z]/ {print $1}'
-end
+    # complete the command after -- as a command of its own
+    if set -l i (contains -i -- -- $words)
+        complete -C (string join ' ' -- $words[(math $i + 1)..-1] $cur)
+        return
+    end
 
-function __fish_print_aws_roles
-  awk '/^\[profile/ {print $2}' ~/.aws/config |tr -d ']'
+    # a partly typed argument is left out, so that aws-vault offers all of its values for fish to match
+    string match -q -- '-*' $cur
+    or set cur ''
+
+    aws-vault --completion-bash $words[2..-1] $cur
 end
+
+complete -c aws-vault -f -a '(__fish_aws_vault_completion)'
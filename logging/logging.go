@@ -0,0 +1,31 @@
+// Package logging writes messages with the standard logger, which --debug turns on, marking their level
+// so it doesn't have to be guessed from the message
+package logging
+
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+// warnMarker starts a warning. The output of --debug removes it and gives the line the warn level
+const warnMarker = "WARN "
+
+// Warnf logs something that went wrong but didn't stop aws-vault
+func Warnf(format string, v ...interface{}) {
+	log.Output(2, warnMarker+fmt.Sprintf(format, v...))
+}
+
+// Debugf logs what aws-vault is doing, as log.Printf does
+func Debugf(format string, v ...interface{}) {
+	log.Output(2, fmt.Sprintf(format, v...))
+}
+
+// Level returns the level of a message written by the standard logger, warn or debug, and the message
+// without the marker of its level
+func Level(msg string) (string, string) {
+	if strings.HasPrefix(msg, warnMarker) {
+		return "warn", msg[len(warnMarker):]
+	}
+	return "debug", msg
+}
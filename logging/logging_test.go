@@ -0,0 +1,29 @@
+package logging_test
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/99designs/aws-vault/logging"
+)
+
+func TestLevel(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetFlags(0)
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	logging.Warnf("Failed to cache %s", "aliases")
+	logging.Debugf("Failed attempts are counted")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if level, msg := logging.Level(lines[0]); level != "warn" || msg != "Failed to cache aliases" {
+		t.Fatalf("Expected a warning, got %s %q", level, msg)
+	}
+	if level, msg := logging.Level(lines[1]); level != "debug" || msg != "Failed attempts are counted" {
+		t.Fatalf("Expected a debug message whatever it starts with, got %s %q", level, msg)
+	}
+}
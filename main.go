@@ -1,9 +1,11 @@
 package main
 
 import (
+	"fmt"
 	"os"
 
 	"github.com/99designs/aws-vault/cli"
+	"github.com/99designs/aws-vault/telemetry"
 	"gopkg.in/alecthomas/kingpin.v2"
 )
 
@@ -23,16 +25,40 @@ func run(args []string, exit func(int)) {
 	app.ErrorWriter(os.Stderr)
 	app.Writer(os.Stdout)
 	app.Version(Version)
-	app.Terminate(exit)
+	cli.Version = Version
+	app.Terminate(func(code int) {
+		telemetry.Flush()
+		fmt.Fprint(os.Stderr, telemetry.Summary())
+		exit(cli.ExitStatus(code))
+	})
 
 	cli.ConfigureGlobals(app)
 	cli.ConfigureAddCommand(app)
 	cli.ConfigureListCommand(app)
+	cli.ConfigureBackendsCommand(app)
+	cli.ConfigureMigrateCommand(app)
+	cli.ConfigureExportVaultCommand(app)
+	cli.ConfigureImportVaultCommand(app)
+	cli.ConfigureImportCommand(app)
+	cli.ConfigureDoctorCommand(app)
+	cli.ConfigureLockCommand(app)
 	cli.ConfigureRotateCommand(app)
 	cli.ConfigureExecCommand(app)
+	cli.ConfigureExportCommand(app)
 	cli.ConfigureRemoveCommand(app)
+	cli.ConfigureClearCommand(app)
+	cli.ConfigureRenewCommand(app)
+	cli.ConfigureShowCommand(app)
 	cli.ConfigureLoginCommand(app)
 	cli.ConfigureServerCommand(app)
+	cli.ConfigurePsCommand(app)
+	cli.ConfigureStatusCommand(app)
+	cli.ConfigureConfigureProfileCommand(app)
+	cli.ConfigureUpgradeCommand(app)
+	cli.ConfigureCompletionCommand(app)
+	cli.ConfigureEncryptedFileAgentCommand(app)
 
 	kingpin.MustParse(app.Parse(args))
+	telemetry.Flush()
+	fmt.Fprint(os.Stderr, telemetry.Summary())
 }
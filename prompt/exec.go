@@ -0,0 +1,50 @@
+package prompt
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// commandMfaPrompt gets an MFA token from the output of a password manager or device tool
+func commandMfaPrompt(name string, args ...string) (string, error) {
+	log.Printf("Getting MFA token with %s %s", name, strings.Join(args, " "))
+
+	cmd := exec.Command(name, args...)
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("Failed to get a token from %s: %v", name, err)
+	}
+
+	return strings.TrimSpace(string(out)), nil
+}
+
+// PassMfaPrompt gets a token with pass-otp, from the entry named by $AWS_VAULT_PASS_OTP_NAME or the MFA serial
+func PassMfaPrompt(mfaSerial string) (string, error) {
+	name := os.Getenv("AWS_VAULT_PASS_OTP_NAME")
+	if name == "" {
+		name = mfaSerial
+	}
+	passCmd := os.Getenv("AWS_VAULT_PASS_CMD")
+	if passCmd == "" {
+		passCmd = "pass"
+	}
+	return commandMfaPrompt(passCmd, "otp", name)
+}
+
+// OpMfaPrompt gets a token with the 1Password CLI, from the item named by $AWS_VAULT_OP_ITEM or the MFA serial
+func OpMfaPrompt(mfaSerial string) (string, error) {
+	item := os.Getenv("AWS_VAULT_OP_ITEM")
+	if item == "" {
+		item = mfaSerial
+	}
+	return commandMfaPrompt("op", "item", "get", item, "--otp")
+}
+
+func init() {
+	MfaMethods["pass"] = PassMfaPrompt
+	MfaMethods["op"] = OpMfaPrompt
+}
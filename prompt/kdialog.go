@@ -0,0 +1,22 @@
+package prompt
+
+import (
+	"os/exec"
+	"strings"
+)
+
+// KDialogPrompt prompts with a KDE dialog
+func KDialogPrompt(prompt string) (string, error) {
+	cmd := exec.Command("kdialog", "--title", "aws-vault", "--inputbox", prompt)
+
+	out, err := cmd.Output()
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(out)), nil
+}
+
+func init() {
+	Methods["kdialog"] = KDialogPrompt
+}
@@ -0,0 +1,16 @@
+package prompt
+
+import "github.com/99designs/aws-vault/logging"
+
+// NotifyPrompt raises a desktop notification to draw attention to the prompt, which is then shown in a
+// dialog. It's for when aws-vault is run by a GUI tool and there's no terminal to see the prompt in
+func NotifyPrompt(prompt string) (string, error) {
+	if err := Notify("aws-vault", prompt); err != nil {
+		logging.Warnf("Failed to show notification: %v", err)
+	}
+	return dialogPrompt(prompt)
+}
+
+func init() {
+	Methods["notify"] = NotifyPrompt
+}
@@ -0,0 +1,23 @@
+// +build darwin
+
+package prompt
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// Notify shows a desktop notification in the macOS notification centre
+func Notify(title, message string) error {
+	return exec.Command("osascript", "-e", fmt.Sprintf(`display notification %s with title %s`,
+		appleScriptString(message), appleScriptString(title))).Run()
+}
+
+func appleScriptString(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+func dialogPrompt(prompt string) (string, error) {
+	return OSAScriptPrompt(prompt)
+}
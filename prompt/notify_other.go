@@ -0,0 +1,20 @@
+// +build !darwin,!windows
+
+package prompt
+
+import "os/exec"
+
+// Notify shows a desktop notification with libnotify's notify-send
+func Notify(title, message string) error {
+	return exec.Command("notify-send", "--app-name=aws-vault", title, message).Run()
+}
+
+// dialogPrompt uses zenity, or kdialog if zenity isn't installed
+func dialogPrompt(prompt string) (string, error) {
+	if _, err := exec.LookPath("zenity"); err != nil {
+		if _, err := exec.LookPath("kdialog"); err == nil {
+			return KDialogPrompt(prompt)
+		}
+	}
+	return ZenityPrompt(prompt)
+}
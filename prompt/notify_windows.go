@@ -0,0 +1,32 @@
+// +build windows
+
+package prompt
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// Notify shows a desktop notification as a Windows toast, raised with PowerShell
+func Notify(title, message string) error {
+	script := fmt.Sprintf(`
+		[Windows.UI.Notifications.ToastNotificationManager, Windows.UI.Notifications, ContentType = WindowsRuntime] | Out-Null
+		$xml = [Windows.UI.Notifications.ToastNotificationManager]::GetTemplateContent([Windows.UI.Notifications.ToastTemplateType]::ToastText02)
+		$text = $xml.GetElementsByTagName('text')
+		$text.Item(0).AppendChild($xml.CreateTextNode('%s')) | Out-Null
+		$text.Item(1).AppendChild($xml.CreateTextNode('%s')) | Out-Null
+		$toast = [Windows.UI.Notifications.ToastNotification]::new($xml)
+		[Windows.UI.Notifications.ToastNotificationManager]::CreateToastNotifier('aws-vault').Show($toast)`,
+		powerShellString(title), powerShellString(message))
+
+	return exec.Command("powershell.exe", "-NoProfile", "-NonInteractive", "-Command", script).Run()
+}
+
+func powerShellString(s string) string {
+	return strings.Replace(s, "'", "''", -1)
+}
+
+func dialogPrompt(prompt string) (string, error) {
+	return WinCredUIPrompt(prompt)
+}
@@ -6,6 +6,7 @@ import (
 	"strings"
 )
 
+// OSAScriptPrompt prompts with a macOS dialog
 func OSAScriptPrompt(prompt string) (string, error) {
 	cmd := exec.Command("osascript", "-e", fmt.Sprintf(`
 		display dialog "%s" default answer "" buttons {"OK", "Cancel"} default button 1
@@ -1,21 +1,36 @@
+// Package prompt provides the drivers aws-vault uses to ask for MFA tokens. Embedders can pass any
+// PromptFunc as vault.Config.MfaPrompt, or register their own driver in Methods
 package prompt
 
 import "fmt"
 
+// PromptFunc asks the user for a value, showing them the given prompt
 type PromptFunc func(string) (string, error)
 
+// MfaPromptFunc gets a token for the MFA device with the given serial
+type MfaPromptFunc func(mfaSerial string) (string, error)
+
+// Methods are the prompt drivers available on this platform, by name
 var Methods = map[string]PromptFunc{
 	"terminal": TerminalPrompt,
 }
 
+// MfaMethods are drivers that get MFA tokens from somewhere other than the user, by name
+var MfaMethods = map[string]MfaPromptFunc{}
+
+// Available returns the names of the available prompt drivers
 func Available() []string {
 	methods := []string{}
 	for k := range Methods {
 		methods = append(methods, k)
 	}
+	for k := range MfaMethods {
+		methods = append(methods, k)
+	}
 	return methods
 }
 
+// Method returns the named prompt driver, it panics if it doesn't exist
 func Method(s string) PromptFunc {
 	m, ok := Methods[s]
 	if !ok {
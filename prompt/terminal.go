@@ -1,19 +1,43 @@
 package prompt
 
 import (
-	"bufio"
 	"fmt"
+	"io"
+	"log"
 	"os"
 	"strings"
 )
 
+// TerminalPrompt prompts on stderr and reads the answer from stdin
 func TerminalPrompt(prompt string) (string, error) {
 	fmt.Fprint(os.Stderr, prompt)
+	return readLine(os.Stdin)
+}
+
+// StdinMfaPrompt reads an MFA token from stdin without prompting, for scripts and CI jobs that pipe one in
+func StdinMfaPrompt(mfaSerial string) (string, error) {
+	log.Printf("Reading token for %s from stdin", mfaSerial)
+	return readLine(os.Stdin)
+}
 
-	reader := bufio.NewReader(os.Stdin)
-	text, err := reader.ReadString('\n')
-	if err != nil {
-		return "", err
+// readLine reads a line a byte at a time, so that nothing after it is consumed from stdin, which exec
+// passes on to the command it runs
+func readLine(r io.Reader) (string, error) {
+	var line []byte
+	b := make([]byte, 1)
+	for {
+		n, err := r.Read(b)
+		if n > 0 {
+			if b[0] == '\n' {
+				break
+			}
+			line = append(line, b[0])
+		}
+		if err == io.EOF && len(line) > 0 {
+			break
+		} else if err != nil {
+			return "", err
+		}
 	}
-	return strings.TrimSpace(text), nil
+	return strings.TrimSpace(string(line)), nil
 }
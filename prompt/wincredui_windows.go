@@ -0,0 +1,28 @@
+// +build windows
+
+package prompt
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// WinCredUIPrompt prompts with the Windows credential dialog, shown by PowerShell
+func WinCredUIPrompt(prompt string) (string, error) {
+	script := fmt.Sprintf(
+		`$c = $Host.UI.PromptForCredential('aws-vault', '%s', 'aws-vault', ''); if ($c) { $c.GetNetworkCredential().Password }`,
+		strings.Replace(prompt, "'", "''", -1))
+	cmd := exec.Command("powershell.exe", "-NoProfile", "-NonInteractive", "-Command", script)
+
+	out, err := cmd.Output()
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(out)), nil
+}
+
+func init() {
+	Methods["wincredui"] = WinCredUIPrompt
+}
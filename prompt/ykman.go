@@ -0,0 +1,24 @@
+package prompt
+
+import "os"
+
+// YkmanMfaPrompt gets a token from the OATH-TOTP account on a YubiKey with `ykman oath accounts code`.
+// The account is named by $AWS_VAULT_YKMAN_ACCOUNT, or is the MFA serial, as set up with
+// `ykman oath accounts add <mfa_serial> <secret>`
+func YkmanMfaPrompt(mfaSerial string) (string, error) {
+	account := os.Getenv("AWS_VAULT_YKMAN_ACCOUNT")
+	if account == "" {
+		account = mfaSerial
+	}
+
+	args := []string{"oath", "accounts", "code", "--single", account}
+	if device := os.Getenv("AWS_VAULT_YKMAN_DEVICE"); device != "" {
+		args = append([]string{"--device", device}, args...)
+	}
+
+	return commandMfaPrompt("ykman", args...)
+}
+
+func init() {
+	MfaMethods["ykman"] = YkmanMfaPrompt
+}
@@ -6,6 +6,7 @@ import (
 	"strings"
 )
 
+// ZenityPrompt prompts with a zenity dialog
 func ZenityPrompt(prompt string) (string, error) {
 	cmd := exec.Command("zenity", "--entry", "--title=aws-vault", fmt.Sprintf(`--text=%s`, prompt))
 
@@ -0,0 +1,134 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	ec2TokenHeader    = "X-aws-ec2-metadata-token"
+	ec2TokenTTLHeader = "X-aws-ec2-metadata-token-ttl-seconds"
+	ec2MaxTokenTTL    = 6 * time.Hour
+)
+
+// ec2Tokens are the IMDSv2 session tokens handed out by the EC2 metadata server
+type ec2Tokens struct {
+	mu      sync.Mutex
+	expires map[string]time.Time
+}
+
+func (t *ec2Tokens) issue(ttl time.Duration) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(b)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := time.Now()
+	for tok, expires := range t.expires {
+		if now.After(expires) {
+			delete(t.expires, tok)
+		}
+	}
+	t.expires[token] = now.Add(ttl)
+	return token, nil
+}
+
+// hostOnly rejects requests for any Host but the server's own address, so a web page can't reach the
+// server by rebinding its DNS name to the loopback address
+func hostOnly(host string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Host != host {
+			http.Error(w, "Invalid Host", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (t *ec2Tokens) valid(token string) bool {
+	if token == "" {
+		return false
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	expires, ok := t.expires[token]
+	return ok && time.Now().Before(expires)
+}
+
+// StartEc2CredentialsServer serves creds on a random port of the loopback address using the EC2 instance
+// metadata protocol, so unlike the metadata proxy it doesn't need root to bind 169.254.169.254. SDKs are
+// pointed at it with AWS_EC2_METADATA_SERVICE_ENDPOINT, and it returns that endpoint. The token is needed
+// to stop the server, as EC2 metadata clients can't be given it
+func StartEc2CredentialsServer(creds Credentials, token *Token) (string, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", err
+	}
+
+	tokens := &ec2Tokens{expires: map[string]time.Time{}}
+	host := l.Addr().String()
+
+	router := http.NewServeMux()
+	router.HandleFunc("/latest/api/token", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		// like EC2, tokens aren't issued to requests forwarded by a proxy, which may be an SSRF
+		if r.Header.Get("X-Forwarded-For") != "" {
+			http.Error(w, "Forwarded requests aren't allowed", http.StatusForbidden)
+			return
+		}
+		seconds, err := strconv.Atoi(r.Header.Get(ec2TokenTTLHeader))
+		ttl := time.Duration(seconds) * time.Second
+		if err != nil || ttl <= 0 || ttl > ec2MaxTokenTTL {
+			http.Error(w, "Invalid "+ec2TokenTTLHeader, http.StatusBadRequest)
+			return
+		}
+		token, err := tokens.issue(ttl)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set(ec2TokenTTLHeader, strconv.Itoa(seconds))
+		fmt.Fprint(w, token)
+	})
+
+	metadata := http.NewServeMux()
+	metadata.HandleFunc("/latest/meta-data/iam/security-credentials/", indexHandler)
+	metadata.HandleFunc("/latest/meta-data/iam/security-credentials/local-credentials", func(w http.ResponseWriter, r *http.Request) {
+		writeCredentials(w, creds)
+	})
+	metadata.HandleFunc("/latest/meta-data/instance-id/", instanceIdHandler)
+	metadata.HandleFunc("/latest/meta-data/iam/info/", infoHandlerStub)
+
+	// only IMDSv2 is served, as a plain IMDSv1 GET can be made by a browser or through an SSRF
+	router.HandleFunc("/latest/meta-data/", func(w http.ResponseWriter, r *http.Request) {
+		if !tokens.valid(r.Header.Get(ec2TokenHeader)) {
+			http.Error(w, "Missing, invalid or expired "+ec2TokenHeader, http.StatusUnauthorized)
+			return
+		}
+		metadata.ServeHTTP(w, r)
+	})
+
+	srv := &http.Server{Handler: loopbackOnly(hostOnly(host, router))}
+	router.HandleFunc("/stop", stopHandler(func() {
+		srv.Shutdown(context.Background())
+	}, token))
+
+	log.Printf("Local EC2 metadata server running on %s", l.Addr())
+	go srv.Serve(l)
+
+	return "http://" + l.Addr().String() + "/", nil
+}
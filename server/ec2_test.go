@@ -0,0 +1,223 @@
+package server
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// ec2Request makes a request to the EC2 metadata server, with the given headers
+func ec2Request(t *testing.T, method, url string, headers map[string]string) (*http.Response, string) {
+	req, err := http.NewRequest(method, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range headers {
+		if k == "Host" {
+			req.Host = v
+		} else {
+			req.Header.Set(k, v)
+		}
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp, string(b)
+}
+
+// startEc2Server starts an EC2 metadata server, returning its endpoint and a func that stops it
+func startEc2Server(t *testing.T) (string, func()) {
+	token := newTestToken(t)
+	endpoint, err := StartEc2CredentialsServer(newStaticCredentials(), token)
+	if err != nil {
+		token.Remove()
+		t.Fatal(err)
+	}
+	return endpoint, func() {
+		if err := StopCredentialsServer(endpoint, os.Getpid(), token.Path); err != nil {
+			t.Error(err)
+		}
+		token.Remove()
+	}
+}
+
+func ec2Token(t *testing.T, endpoint string, ttl string) string {
+	resp, body := ec2Request(t, http.MethodPut, endpoint+"latest/api/token", map[string]string{ec2TokenTTLHeader: ttl})
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected a token, got %d: %s", resp.StatusCode, body)
+	}
+	if resp.Header.Get(ec2TokenTTLHeader) != ttl {
+		t.Fatalf("Expected the TTL %s to be returned, got %q", ttl, resp.Header.Get(ec2TokenTTLHeader))
+	}
+	return body
+}
+
+func TestEc2ServerCredentials(t *testing.T) {
+	endpoint, stop := startEc2Server(t)
+	defer stop()
+
+	token := ec2Token(t, endpoint, "21600")
+	headers := map[string]string{ec2TokenHeader: token}
+
+	resp, body := ec2Request(t, http.MethodGet, endpoint+"latest/meta-data/iam/security-credentials/", headers)
+	if resp.StatusCode != http.StatusOK || body != "local-credentials" {
+		t.Fatalf("Expected the role name, got %d: %s", resp.StatusCode, body)
+	}
+
+	resp, body = ec2Request(t, http.MethodGet, endpoint+"latest/meta-data/iam/security-credentials/local-credentials", headers)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected credentials, got %d: %s", resp.StatusCode, body)
+	}
+	var creds map[string]string
+	if err := json.Unmarshal([]byte(body), &creds); err != nil {
+		t.Fatal(err)
+	}
+	if creds["AccessKeyId"] != "ASIAEXAMPLE" || creds["SecretAccessKey"] != "SECRET" || creds["Token"] != "TOKEN" {
+		t.Fatalf("Unexpected credentials %v", creds)
+	}
+}
+
+func TestEc2ServerTokenRequests(t *testing.T) {
+	endpoint, stop := startEc2Server(t)
+	defer stop()
+
+	var testCases = []struct {
+		Name    string
+		Method  string
+		Headers map[string]string
+		Status  int
+	}{
+		{"GET instead of PUT", http.MethodGet, map[string]string{ec2TokenTTLHeader: "60"}, http.StatusMethodNotAllowed},
+		{"forwarded by a proxy", http.MethodPut, map[string]string{ec2TokenTTLHeader: "60", "X-Forwarded-For": "192.0.2.1"}, http.StatusForbidden},
+		{"no TTL", http.MethodPut, map[string]string{}, http.StatusBadRequest},
+		{"TTL that isn't a number", http.MethodPut, map[string]string{ec2TokenTTLHeader: "forever"}, http.StatusBadRequest},
+		{"zero TTL", http.MethodPut, map[string]string{ec2TokenTTLHeader: "0"}, http.StatusBadRequest},
+		{"negative TTL", http.MethodPut, map[string]string{ec2TokenTTLHeader: "-1"}, http.StatusBadRequest},
+		{"TTL over 6 hours", http.MethodPut, map[string]string{ec2TokenTTLHeader: strconv.Itoa(int(ec2MaxTokenTTL.Seconds()) + 1)}, http.StatusBadRequest},
+		{"minimum TTL", http.MethodPut, map[string]string{ec2TokenTTLHeader: "1"}, http.StatusOK},
+	}
+
+	for _, tc := range testCases {
+		resp, body := ec2Request(t, tc.Method, endpoint+"latest/api/token", tc.Headers)
+		if resp.StatusCode != tc.Status {
+			t.Errorf("%s: expected %d, got %d: %s", tc.Name, tc.Status, resp.StatusCode, body)
+		}
+	}
+}
+
+func TestEc2ServerRejectsCredentialRequests(t *testing.T) {
+	endpoint, stop := startEc2Server(t)
+	defer stop()
+
+	token := ec2Token(t, endpoint, "60")
+	host := strings.TrimSuffix(strings.TrimPrefix(endpoint, "http://"), "/")
+	credentialsURL := endpoint + "latest/meta-data/iam/security-credentials/local-credentials"
+
+	var testCases = []struct {
+		Name    string
+		Headers map[string]string
+		Status  int
+	}{
+		{"IMDSv1 request without a token", map[string]string{}, http.StatusUnauthorized},
+		{"invalid token", map[string]string{ec2TokenHeader: "not-a-token"}, http.StatusUnauthorized},
+		{"rebound DNS name", map[string]string{ec2TokenHeader: token, "Host": "attacker.example.com"}, http.StatusForbidden},
+		{"rebound DNS name with the port", map[string]string{ec2TokenHeader: token, "Host": "attacker.example.com:" + strings.Split(host, ":")[1]}, http.StatusForbidden},
+		{"localhost instead of the address", map[string]string{ec2TokenHeader: token, "Host": strings.Replace(host, "127.0.0.1", "localhost", 1)}, http.StatusForbidden},
+		{"valid token", map[string]string{ec2TokenHeader: token}, http.StatusOK},
+	}
+
+	for _, tc := range testCases {
+		resp, body := ec2Request(t, http.MethodGet, credentialsURL, tc.Headers)
+		if resp.StatusCode != tc.Status {
+			t.Errorf("%s: expected %d, got %d: %s", tc.Name, tc.Status, resp.StatusCode, body)
+		}
+		if tc.Status != http.StatusOK && strings.Contains(body, "SECRET") {
+			t.Errorf("%s: credentials were returned", tc.Name)
+		}
+	}
+
+	// the token endpoint is guarded against DNS rebinding too
+	resp, _ := ec2Request(t, http.MethodPut, endpoint+"latest/api/token", map[string]string{ec2TokenTTLHeader: "60", "Host": "attacker.example.com"})
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("Expected a token request for another Host to be forbidden, got %d", resp.StatusCode)
+	}
+}
+
+func TestEc2ServerTokenExpires(t *testing.T) {
+	endpoint, stop := startEc2Server(t)
+	defer stop()
+
+	token := ec2Token(t, endpoint, "1")
+	credentialsURL := endpoint + "latest/meta-data/iam/security-credentials/local-credentials"
+
+	if resp, body := ec2Request(t, http.MethodGet, credentialsURL, map[string]string{ec2TokenHeader: token}); resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected credentials before the token expires, got %d: %s", resp.StatusCode, body)
+	}
+	time.Sleep(1100 * time.Millisecond)
+	if resp, body := ec2Request(t, http.MethodGet, credentialsURL, map[string]string{ec2TokenHeader: token}); resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("Expected the expired token to be rejected, got %d: %s", resp.StatusCode, body)
+	}
+}
+
+func TestEc2TokensExpire(t *testing.T) {
+	tokens := &ec2Tokens{expires: map[string]time.Time{}}
+
+	expired, err := tokens.issue(time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	valid, err := tokens.issue(time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	if tokens.valid(expired) {
+		t.Fatal("Expected the expired token to be invalid")
+	}
+	if !tokens.valid(valid) {
+		t.Fatal("Expected the token to be valid")
+	}
+	if tokens.valid("") {
+		t.Fatal("Expected an empty token to be invalid")
+	}
+
+	// issuing a token cleans up those that expired
+	if _, err = tokens.issue(time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := tokens.expires[expired]; ok {
+		t.Fatal("Expected the expired token to be removed")
+	}
+}
+
+func TestLoopbackOnly(t *testing.T) {
+	handler := loopbackOnly(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	for remoteAddr, status := range map[string]int{
+		"127.0.0.1:1234": http.StatusOK,
+		"[::1]:1234":     http.StatusOK,
+		"192.0.2.1:1234": http.StatusUnauthorized,
+		"not-an-address": http.StatusBadRequest,
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = remoteAddr
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if w.Code != status {
+			t.Errorf("Expected %d from %s, got %d", status, remoteAddr, w.Code)
+		}
+	}
+}
@@ -1,16 +1,22 @@
 package server
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"log"
 	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"os/exec"
 	"runtime"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws/credentials"
@@ -19,8 +25,10 @@ import (
 const (
 	metadataBind    = "169.254.169.254:80"
 	awsTimeFormat   = "2006-01-02T15:04:05Z"
-	localServerUrl  = "http://127.0.0.1:9099"
 	localServerBind = "127.0.0.1:9099"
+
+	// LocalServerURL is the address of the credentials server started by StartCredentialsServer
+	LocalServerURL = "http://127.0.0.1:9099"
 )
 
 func StartMetadataServer() error {
@@ -58,14 +66,14 @@ func indexHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func credentialsHandler(w http.ResponseWriter, r *http.Request) {
-	resp, err := http.Get(localServerUrl)
+	resp, err := http.Get(LocalServerURL)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusGatewayTimeout)
 		return
 	}
 	defer resp.Body.Close()
 
-	log.Printf("Fetched credentials from %s", localServerUrl)
+	log.Printf("Fetched credentials from %s", LocalServerURL)
 
 	w.Header().Set("Content-Type", "text/plain")
 	w.WriteHeader(http.StatusOK)
@@ -114,8 +122,20 @@ func StartCredentialProxy() error {
 	return StartCredentialProxyWithSudo()
 }
 
-func StartCredentialsServer(creds *credentials.Credentials) error {
-	if !checkServerRunning(metadataBind) {
+// Credentials are the credentials served by the credentials server, satisfied by *credentials.Credentials
+type Credentials interface {
+	Get() (credentials.Value, error)
+	ExpiresAt() (time.Time, error)
+	IsExpired() bool
+	Expire()
+}
+
+// StartCredentialsServer serves creds on the local server, refresh is called to discard any cached
+// credentials when the master credentials for credentialsName are rotated. Every request must carry
+// token, except that with anyProcess the credentials are served to any local process, including via the
+// metadata proxy
+func StartCredentialsServer(creds Credentials, credentialsName string, refresh func(), token *Token, anyProcess bool) error {
+	if anyProcess && !checkServerRunning(metadataBind) {
 		if err := StartCredentialProxy(); err != nil {
 			return err
 		}
@@ -126,51 +146,197 @@ func StartCredentialsServer(creds *credentials.Credentials) error {
 		return err
 	}
 
+	srv := &http.Server{}
+	srv.Handler = credentialsServerHandler(creds, credentialsName, refresh, token, anyProcess, func() {
+		srv.Shutdown(context.Background())
+	})
+
 	log.Printf("Local instance role server running on %s", l.Addr())
-	go http.Serve(l, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		ip, _, err := net.SplitHostPort(r.RemoteAddr)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+	go srv.Serve(l)
+
+	return nil
+}
+
+// authorized returns whether r carries the token, if there is one
+func authorized(r *http.Request, token *Token) bool {
+	return token == nil || token.Authorizes(r.Header.Get("Authorization"))
+}
+
+// credentialsServerHandler handles requests to the local credentials server started by StartCredentialsServer
+func credentialsServerHandler(creds Credentials, credentialsName string, refresh func(), token *Token, anyProcess bool, stop func()) http.Handler {
+	// in-flight credential requests hold a read lock, so a refresh waits for them to finish
+	var mu sync.RWMutex
+
+	router := http.NewServeMux()
+	router.HandleFunc("/refresh", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 			return
 		}
-
-		// Must make sure the remote ip is from the loopback, otherwise clients on the same network segment could
-		// potentially route traffic via 169.254.169.254:80
-		// See https://developer.apple.com/library/content/qa/qa1357/_index.html
-		if !net.ParseIP(ip).IsLoopback() {
-			http.Error(w, "Access denied from non-localhost address", http.StatusUnauthorized)
+		if !authorized(r, token) {
+			http.Error(w, "Missing or invalid authorization token", http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Query().Get("credentials") != credentialsName {
+			http.Error(w, "Not serving those credentials", http.StatusNotFound)
 			return
 		}
 
+		mu.Lock()
+		defer mu.Unlock()
+
+		log.Printf("Master credentials for %s were rotated, refreshing", credentialsName)
+		refresh()
+		creds.Expire()
+		if token != nil {
+			if err := token.Rotate(); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			log.Printf("Rotated the credentials server token")
+		}
+		fmt.Fprintf(w, "refreshed")
+	})
+	router.HandleFunc("/stop", stopHandler(stop, token))
+	router.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		mu.RLock()
+		defer mu.RUnlock()
+
 		log.Printf("RemoteAddr = %v", r.RemoteAddr)
+
+		if !anyProcess && !authorized(r, token) {
+			http.Error(w, "Missing or invalid authorization token", http.StatusUnauthorized)
+			return
+		}
 		log.Printf("Credentials.IsExpired() = %#v", creds.IsExpired())
 
-		val, err := creds.Get()
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusGatewayTimeout)
+		writeCredentials(w, creds)
+	})
+
+	return loopbackOnly(router)
+}
+
+// stopHandler stops the server, for aws-vault lock. The token must be given if there is one, along with the
+// pid of the exec running the server, so a request meant for an exec that has exited can't stop another
+// exec's server on the same port
+func stopHandler(stop func(), token *Token) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 			return
 		}
-		credsExpiresAt, err := creds.ExpiresAt()
+		if !authorized(r, token) {
+			http.Error(w, "Missing or invalid authorization token", http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Query().Get("pid") != strconv.Itoa(os.Getpid()) {
+			http.Error(w, "Not served by that process", http.StatusNotFound)
+			return
+		}
+
+		log.Printf("Stopping the credentials server")
+		fmt.Fprintf(w, "stopped")
+		go stop()
+	}
+}
+
+// StopCredentialsServer asks the credentials server at serverURL, run by the exec with pid, to stop,
+// authorizing with the token in tokenFile if it's given. The command exec runs keeps running, but can't
+// get credentials from it anymore
+func StopCredentialsServer(serverURL string, pid int, tokenFile string) error {
+	resp, err := postWithToken(strings.TrimSuffix(serverURL, "/")+"/stop?pid="+strconv.Itoa(pid), tokenFile)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Credentials server failed to stop: %s", resp.Status)
+	}
+	return nil
+}
+
+// writeCredentials writes the credentials in the JSON format of the EC2 instance metadata and container
+// credentials endpoints
+func writeCredentials(w http.ResponseWriter, creds Credentials) {
+	val, err := creds.Get()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusGatewayTimeout)
+		return
+	}
+	credsExpiresAt, err := creds.ExpiresAt()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusGatewayTimeout)
+		return
+	}
+
+	log.Printf("Serving credentials via http ****************%s, expiration of %s (%s)",
+		val.AccessKeyID[len(val.AccessKeyID)-4:],
+		credsExpiresAt.Format(awsTimeFormat),
+		credsExpiresAt.Sub(time.Now()).String())
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"Code":            "Success",
+		"LastUpdated":     time.Now().Format(awsTimeFormat),
+		"Type":            "AWS-HMAC",
+		"AccessKeyId":     val.AccessKeyID,
+		"SecretAccessKey": val.SecretAccessKey,
+		"Token":           val.SessionToken,
+		"Expiration":      credsExpiresAt.Format(awsTimeFormat),
+	})
+}
+
+// loopbackOnly makes sure the remote ip is from the loopback, otherwise clients on the same network segment
+// could potentially route traffic via 169.254.169.254:80
+// See https://developer.apple.com/library/content/qa/qa1357/_index.html
+func loopbackOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip, _, err := net.SplitHostPort(r.RemoteAddr)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusGatewayTimeout)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if !net.ParseIP(ip).IsLoopback() {
+			http.Error(w, "Access denied from non-localhost address", http.StatusUnauthorized)
 			return
 		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RefreshCredentialsServer asks a running credentials server to switch over to rotated master
+// credentials, authorizing with the token in tokenFile. It's a no-op if no server is running or it's
+// serving other credentials
+func RefreshCredentialsServer(credentialsName string, tokenFile string) error {
+	if !checkServerRunning(localServerBind) {
+		return nil
+	}
 
-		log.Printf("Serving credentials via http ****************%s, expiration of %s (%s)",
-			val.AccessKeyID[len(val.AccessKeyID)-4:],
-			credsExpiresAt.Format(awsTimeFormat),
-			credsExpiresAt.Sub(time.Now()).String())
-
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"Code":            "Success",
-			"LastUpdated":     time.Now().Format(awsTimeFormat),
-			"Type":            "AWS-HMAC",
-			"AccessKeyId":     val.AccessKeyID,
-			"SecretAccessKey": val.SecretAccessKey,
-			"Token":           val.SessionToken,
-			"Expiration":      credsExpiresAt.Format(awsTimeFormat),
-		})
-	}))
+	log.Printf("Asking the local credentials server to refresh %s", credentialsName)
+	resp, err := postWithToken(LocalServerURL+"/refresh?credentials="+url.QueryEscape(credentialsName), tokenFile)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
 
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotFound {
+		return fmt.Errorf("Local credentials server failed to refresh: %s", resp.Status)
+	}
 	return nil
 }
+
+// postWithToken makes a POST request to a server, with the token in tokenFile if it's given
+func postWithToken(url string, tokenFile string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodPost, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if tokenFile != "" {
+		token, err := ioutil.ReadFile(tokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to read the server token: %v", err)
+		}
+		req.Header.Set("Authorization", strings.TrimSpace(string(token)))
+	}
+	return http.DefaultClient.Do(req)
+}
@@ -0,0 +1,228 @@
+package server
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/credentials"
+)
+
+// staticCredentials are credentials that expire in an hour, and count how often they're expired
+type staticCredentials struct {
+	value   credentials.Value
+	expired int
+}
+
+func (c *staticCredentials) Get() (credentials.Value, error) { return c.value, nil }
+func (c *staticCredentials) ExpiresAt() (time.Time, error)   { return time.Now().Add(time.Hour), nil }
+func (c *staticCredentials) IsExpired() bool                 { return false }
+func (c *staticCredentials) Expire()                         { c.expired++ }
+
+func newStaticCredentials() *staticCredentials {
+	return &staticCredentials{value: credentials.Value{AccessKeyID: "ASIAEXAMPLE", SecretAccessKey: "SECRET", SessionToken: "TOKEN"}}
+}
+
+func newTestToken(t *testing.T) *Token {
+	token, err := NewToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func request(t *testing.T, method, url, authorization string) (int, string) {
+	req, err := http.NewRequest(method, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, string(b)
+}
+
+func TestCredentialsServerRequiresToken(t *testing.T) {
+	token := newTestToken(t)
+	defer token.Remove()
+
+	ts := httptest.NewServer(credentialsServerHandler(newStaticCredentials(), "work", func() {}, token, false, func() {}))
+	defer ts.Close()
+
+	var testCases = []struct {
+		Authorization string
+		Status        int
+	}{
+		{"", http.StatusUnauthorized},
+		{"not-the-token", http.StatusUnauthorized},
+		{token.Value(), http.StatusOK},
+		{"Bearer " + token.Value(), http.StatusOK},
+	}
+
+	for _, tc := range testCases {
+		status, body := request(t, http.MethodGet, ts.URL+"/", tc.Authorization)
+		if status != tc.Status {
+			t.Fatalf("Expected %d with Authorization %q, got %d: %s", tc.Status, tc.Authorization, status, body)
+		}
+		if status == http.StatusOK {
+			var creds map[string]string
+			if err := json.Unmarshal([]byte(body), &creds); err != nil {
+				t.Fatal(err)
+			}
+			if creds["AccessKeyId"] != "ASIAEXAMPLE" || creds["Token"] != "TOKEN" {
+				t.Fatalf("Unexpected credentials %v", creds)
+			}
+		}
+	}
+}
+
+func TestCredentialsServerForAnyProcess(t *testing.T) {
+	token := newTestToken(t)
+	defer token.Remove()
+
+	ts := httptest.NewServer(credentialsServerHandler(newStaticCredentials(), "work", func() {}, token, true, func() {}))
+	defer ts.Close()
+
+	if status, body := request(t, http.MethodGet, ts.URL+"/", ""); status != http.StatusOK {
+		t.Fatalf("Expected credentials without a token, got %d: %s", status, body)
+	}
+	if status, _ := request(t, http.MethodPost, ts.URL+"/refresh?credentials=work", ""); status != http.StatusUnauthorized {
+		t.Fatalf("Expected a refresh without the token to be unauthorized, got %d", status)
+	}
+	if status, _ := request(t, http.MethodPost, ts.URL+"/stop?pid="+strconv.Itoa(os.Getpid()), ""); status != http.StatusUnauthorized {
+		t.Fatalf("Expected a stop without the token to be unauthorized, got %d", status)
+	}
+}
+
+func TestCredentialsServerRefresh(t *testing.T) {
+	token := newTestToken(t)
+	defer token.Remove()
+
+	creds := newStaticCredentials()
+	refreshed := 0
+	ts := httptest.NewServer(credentialsServerHandler(creds, "work", func() { refreshed++ }, token, false, func() {}))
+	defer ts.Close()
+
+	old := token.Value()
+	var testCases = []struct {
+		Method        string
+		Path          string
+		Authorization string
+		Status        int
+	}{
+		{http.MethodGet, "/refresh?credentials=work", old, http.StatusMethodNotAllowed},
+		{http.MethodPost, "/refresh?credentials=work", "", http.StatusUnauthorized},
+		{http.MethodPost, "/refresh?credentials=work", "not-the-token", http.StatusUnauthorized},
+		{http.MethodPost, "/refresh?credentials=home", old, http.StatusNotFound},
+		{http.MethodPost, "/refresh?credentials=work", old, http.StatusOK},
+	}
+	for _, tc := range testCases {
+		if status, body := request(t, tc.Method, ts.URL+tc.Path, tc.Authorization); status != tc.Status {
+			t.Fatalf("Expected %d for %s %s, got %d: %s", tc.Status, tc.Method, tc.Path, status, body)
+		}
+	}
+
+	if refreshed != 1 || creds.expired != 1 {
+		t.Fatalf("Expected one refresh, got %d refreshes and %d expiries", refreshed, creds.expired)
+	}
+	if token.Value() == old {
+		t.Fatal("Expected the token to be rotated")
+	}
+	b, err := ioutil.ReadFile(token.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != token.Value() {
+		t.Fatal("Expected the token file to have the new token")
+	}
+	if status, _ := request(t, http.MethodGet, ts.URL+"/", old); status != http.StatusUnauthorized {
+		t.Fatalf("Expected the old token to be unauthorized, got %d", status)
+	}
+}
+
+func TestRefreshCredentialsServerSendsToken(t *testing.T) {
+	token := newTestToken(t)
+	defer token.Remove()
+
+	var got string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Get("Authorization")
+	}))
+	defer ts.Close()
+
+	resp, err := postWithToken(ts.URL+"/refresh", token.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if got != token.Value() {
+		t.Fatalf("Expected the token from %s, got %q", token.Path, got)
+	}
+
+	if _, err = postWithToken(ts.URL+"/refresh", token.Path+".missing"); err == nil || !strings.Contains(err.Error(), "token") {
+		t.Fatalf("Expected an error reading a missing token file, got %v", err)
+	}
+}
+
+func TestStopHandler(t *testing.T) {
+	token := newTestToken(t)
+	defer token.Remove()
+
+	stopped := make(chan struct{}, 1)
+	ts := httptest.NewServer(stopHandler(func() { stopped <- struct{}{} }, token))
+	defer ts.Close()
+
+	pid := strconv.Itoa(os.Getpid())
+	var testCases = []struct {
+		Method        string
+		Pid           string
+		Authorization string
+		Status        int
+	}{
+		{http.MethodGet, pid, token.Value(), http.StatusMethodNotAllowed},
+		{http.MethodPost, pid, "", http.StatusUnauthorized},
+		{http.MethodPost, pid, "not-the-token", http.StatusUnauthorized},
+		{http.MethodPost, strconv.Itoa(os.Getpid() + 1), token.Value(), http.StatusNotFound},
+		{http.MethodPost, "", token.Value(), http.StatusNotFound},
+	}
+	for _, tc := range testCases {
+		if status, body := request(t, tc.Method, ts.URL+"/?pid="+tc.Pid, tc.Authorization); status != tc.Status {
+			t.Fatalf("Expected %d for %s with pid %q, got %d: %s", tc.Status, tc.Method, tc.Pid, status, body)
+		}
+	}
+	select {
+	case <-stopped:
+		t.Fatal("Expected the server not to be stopped")
+	default:
+	}
+
+	if err := StopCredentialsServer(ts.URL, os.Getpid()+1, token.Path); err == nil {
+		t.Fatal("Expected an error stopping the server of another process")
+	}
+	if err := StopCredentialsServer(ts.URL, os.Getpid(), ""); err == nil {
+		t.Fatal("Expected an error stopping the server without the token")
+	}
+	if err := StopCredentialsServer(ts.URL+"/", os.Getpid(), token.Path); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("Expected the server to be stopped")
+	}
+}
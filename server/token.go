@@ -0,0 +1,88 @@
+package server
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Token is a bearer token required to get credentials from the credentials server, or to refresh it. It's
+// also written to a file that only the current user can read, so that it can be rotated without restarting
+// the processes using it, and so other aws-vault commands can use it
+type Token struct {
+	Path string
+
+	mu    sync.RWMutex
+	value string
+}
+
+// NewToken generates a random token and writes it to a new private temp file
+func NewToken() (*Token, error) {
+	dir, err := ioutil.TempDir("", "aws-vault")
+	if err != nil {
+		return nil, err
+	}
+	t := &Token{Path: filepath.Join(dir, "token")}
+	if err = t.Rotate(); err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	return t, nil
+}
+
+// Rotate replaces the token with a new random one
+func (t *Token) Rotate() error {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return err
+	}
+	value := hex.EncodeToString(b)
+
+	// write to a temp file and rename, so readers never see a partially written token
+	tmp := t.Path + ".tmp"
+	if err := ioutil.WriteFile(tmp, []byte(value), 0600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, t.Path); err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.value = value
+	return nil
+}
+
+// Value returns the current token
+func (t *Token) Value() string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.value
+}
+
+// Authorizes checks the value of an Authorization header. The container credentials protocol sends
+// the token as is, other clients may prefix it with "Bearer "
+func (t *Token) Authorizes(header string) bool {
+	header = strings.TrimPrefix(header, "Bearer ")
+	return subtle.ConstantTimeCompare([]byte(header), []byte(t.Value())) == 1
+}
+
+// Env returns the environment variables that point a child process's AWS SDK at the local
+// credentials server using the container credentials protocol
+func (t *Token) Env() map[string]string {
+	return map[string]string{
+		"AWS_CONTAINER_CREDENTIALS_FULL_URI":     LocalServerURL + "/",
+		"AWS_CONTAINER_AUTHORIZATION_TOKEN":      t.Value(),
+		"AWS_CONTAINER_AUTHORIZATION_TOKEN_FILE": t.Path,
+	}
+}
+
+// Remove deletes the token file
+func (t *Token) Remove() error {
+	return os.RemoveAll(filepath.Dir(t.Path))
+}
@@ -0,0 +1,324 @@
+// Package stsclient is a minimal client for the handful of STS and IAM Query API operations that
+// aws-vault uses, to create temporary credentials and manage access keys, so it doesn't need the full
+// aws-sdk-go request machinery
+package stsclient
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/99designs/aws-vault/telemetry"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+)
+
+const (
+	stsAPIVersion = "2011-06-15"
+	iamAPIVersion = "2010-05-08"
+)
+
+// Credentials are temporary credentials returned by STS. The field names match those of the
+// aws-sdk-go sts.Credentials, so they serialise to the same JSON
+type Credentials struct {
+	AccessKeyId     *string
+	SecretAccessKey *string
+	SessionToken    *string
+	Expiration      *time.Time
+}
+
+// checkCredentials returns an error if STS answered without credentials, or with some of their fields
+// missing, so callers can rely on them being set
+func checkCredentials(creds *Credentials) (*Credentials, error) {
+	if creds == nil {
+		return nil, errors.New("STS returned no credentials")
+	}
+	if creds.AccessKeyId == nil || creds.SecretAccessKey == nil || creds.SessionToken == nil || creds.Expiration == nil {
+		return nil, errors.New("STS returned incomplete credentials")
+	}
+	return creds, nil
+}
+
+// Client calls STS and IAM, signing requests with Credentials. Requests are unsigned if Credentials is nil,
+// which only works for AssumeRoleWithWebIdentity
+type Client struct {
+	Credentials *credentials.Credentials
+	Region      string
+	HTTPClient  *http.Client
+}
+
+// New returns a client for the STS endpoint of the region, and the IAM endpoint of its partition
+func New(creds *credentials.Credentials, region string) *Client {
+	return &Client{
+		Credentials: creds,
+		Region:      region,
+		HTTPClient:  http.DefaultClient,
+	}
+}
+
+// endpoint returns the STS endpoint and the region to sign requests for. Like the AWS SDKs, the
+// global endpoint is used unless AWS_STS_REGIONAL_ENDPOINTS=regional or the region is in
+// a partition without one
+func (c *Client) endpoint() (string, string) {
+	switch {
+	case strings.HasPrefix(c.Region, "cn-"):
+		return "https://sts." + c.Region + ".amazonaws.com.cn/", c.Region
+	case strings.HasPrefix(c.Region, "us-gov-"):
+		return "https://sts." + c.Region + ".amazonaws.com/", c.Region
+	case c.Region != "" && os.Getenv("AWS_STS_REGIONAL_ENDPOINTS") == "regional":
+		return "https://sts." + c.Region + ".amazonaws.com/", c.Region
+	}
+	return "https://sts.amazonaws.com/", "us-east-1"
+}
+
+// iamEndpoint returns the IAM endpoint and the region to sign requests for. IAM is global, so there's
+// one endpoint for each partition
+func (c *Client) iamEndpoint() (string, string) {
+	switch {
+	case strings.HasPrefix(c.Region, "cn-"):
+		return "https://iam.cn-north-1.amazonaws.com.cn/", "cn-north-1"
+	case strings.HasPrefix(c.Region, "us-gov-"):
+		return "https://iam.us-gov.amazonaws.com/", "us-gov-west-1"
+	}
+	return "https://iam.amazonaws.com/", "us-east-1"
+}
+
+// call sends an STS action with the params and decodes the XML response into result
+func (c *Client) call(action string, params url.Values, result interface{}) error {
+	endpoint, signingRegion := c.endpoint()
+	return c.query("sts", endpoint, signingRegion, stsAPIVersion, action, params, result)
+}
+
+// callIAM sends an IAM action with the params and decodes the XML response into result
+func (c *Client) callIAM(action string, params url.Values, result interface{}) error {
+	endpoint, signingRegion := c.iamEndpoint()
+	return c.query("iam", endpoint, signingRegion, iamAPIVersion, action, params, result)
+}
+
+// query sends a Query API action to the service's endpoint and decodes the XML response into result
+func (c *Client) query(service, endpoint, signingRegion, version, action string, params url.Values, result interface{}) (err error) {
+	span := telemetry.Start(service+"."+action, map[string]string{
+		"rpc.system":  "aws-api",
+		"rpc.service": service,
+		"rpc.method":  action,
+	})
+	defer func() { span.End(err) }()
+
+	params.Set("Action", action)
+	params.Set("Version", version)
+	body := []byte(params.Encode())
+
+	req, err := http.NewRequest("POST", endpoint, strings.NewReader(string(body)))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+	if c.Credentials != nil {
+		creds, err := c.Credentials.Get()
+		if err != nil {
+			return err
+		}
+		Sign(req, body, creds, signingRegion, service, time.Now())
+	}
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	log.Printf("%s %s returned %s, request id %s", service, action, resp.Status, resp.Header.Get("X-Amzn-Requestid"))
+
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return newError(resp.StatusCode, b)
+	}
+	if result == nil {
+		return nil
+	}
+	if err = xml.Unmarshal(b, result); err != nil {
+		return fmt.Errorf("Error decoding %s response: %v", action, err)
+	}
+	return nil
+}
+
+// GetSessionTokenInput are the parameters of sts:GetSessionToken
+type GetSessionTokenInput struct {
+	DurationSeconds int64
+	SerialNumber    string
+	TokenCode       string
+}
+
+// GetSessionToken calls sts:GetSessionToken
+func (c *Client) GetSessionToken(input GetSessionTokenInput) (*Credentials, error) {
+	params := url.Values{}
+	setInt(params, "DurationSeconds", input.DurationSeconds)
+	setString(params, "SerialNumber", input.SerialNumber)
+	setString(params, "TokenCode", input.TokenCode)
+
+	var resp struct {
+		Credentials *Credentials `xml:"GetSessionTokenResult>Credentials"`
+	}
+	if err := c.call("GetSessionToken", params, &resp); err != nil {
+		return nil, err
+	}
+	return checkCredentials(resp.Credentials)
+}
+
+// AssumeRoleInput are the parameters of sts:AssumeRole
+type AssumeRoleInput struct {
+	RoleArn         string
+	RoleSessionName string
+	DurationSeconds int64
+	ExternalId      string
+	SerialNumber    string
+	TokenCode       string
+	Tags            map[string]string
+}
+
+// AssumeRole calls sts:AssumeRole
+func (c *Client) AssumeRole(input AssumeRoleInput) (*Credentials, error) {
+	params := url.Values{}
+	setString(params, "RoleArn", input.RoleArn)
+	setString(params, "RoleSessionName", input.RoleSessionName)
+	setInt(params, "DurationSeconds", input.DurationSeconds)
+	setString(params, "ExternalId", input.ExternalId)
+	setString(params, "SerialNumber", input.SerialNumber)
+	setString(params, "TokenCode", input.TokenCode)
+	setTags(params, input.Tags)
+
+	var resp struct {
+		Credentials *Credentials `xml:"AssumeRoleResult>Credentials"`
+	}
+	if err := c.call("AssumeRole", params, &resp); err != nil {
+		return nil, err
+	}
+	return checkCredentials(resp.Credentials)
+}
+
+// AssumeRoleWithWebIdentityInput are the parameters of sts:AssumeRoleWithWebIdentity
+type AssumeRoleWithWebIdentityInput struct {
+	RoleArn          string
+	RoleSessionName  string
+	WebIdentityToken string
+	DurationSeconds  int64
+}
+
+// AssumeRoleWithWebIdentity calls sts:AssumeRoleWithWebIdentity, the request doesn't need to be signed
+func (c *Client) AssumeRoleWithWebIdentity(input AssumeRoleWithWebIdentityInput) (*Credentials, error) {
+	params := url.Values{}
+	setString(params, "RoleArn", input.RoleArn)
+	setString(params, "RoleSessionName", input.RoleSessionName)
+	setString(params, "WebIdentityToken", input.WebIdentityToken)
+	setInt(params, "DurationSeconds", input.DurationSeconds)
+
+	var resp struct {
+		Credentials *Credentials `xml:"AssumeRoleWithWebIdentityResult>Credentials"`
+	}
+	if err := c.call("AssumeRoleWithWebIdentity", params, &resp); err != nil {
+		return nil, err
+	}
+	return checkCredentials(resp.Credentials)
+}
+
+// AssumeRootInput are the parameters of sts:AssumeRoot
+type AssumeRootInput struct {
+	TargetPrincipal string
+	TaskPolicyArn   string
+	DurationSeconds int64
+}
+
+// AssumeRoot calls sts:AssumeRoot
+func (c *Client) AssumeRoot(input AssumeRootInput) (*Credentials, error) {
+	params := url.Values{}
+	setString(params, "TargetPrincipal", input.TargetPrincipal)
+	setString(params, "TaskPolicyArn.arn", input.TaskPolicyArn)
+	setInt(params, "DurationSeconds", input.DurationSeconds)
+
+	var resp struct {
+		Credentials *Credentials `xml:"AssumeRootResult>Credentials"`
+	}
+	if err := c.call("AssumeRoot", params, &resp); err != nil {
+		return nil, err
+	}
+	return checkCredentials(resp.Credentials)
+}
+
+// GetFederationTokenInput are the parameters of sts:GetFederationToken
+type GetFederationTokenInput struct {
+	Name            string
+	DurationSeconds int64
+	Policy          string
+}
+
+// GetFederationToken calls sts:GetFederationToken
+func (c *Client) GetFederationToken(input GetFederationTokenInput) (*Credentials, error) {
+	params := url.Values{}
+	setString(params, "Name", input.Name)
+	setInt(params, "DurationSeconds", input.DurationSeconds)
+	setString(params, "Policy", input.Policy)
+
+	var resp struct {
+		Credentials *Credentials `xml:"GetFederationTokenResult>Credentials"`
+	}
+	if err := c.call("GetFederationToken", params, &resp); err != nil {
+		return nil, err
+	}
+	return checkCredentials(resp.Credentials)
+}
+
+// CallerIdentity is the result of sts:GetCallerIdentity
+type CallerIdentity struct {
+	Account string
+	Arn     string
+	UserId  string
+}
+
+// GetCallerIdentity calls sts:GetCallerIdentity
+func (c *Client) GetCallerIdentity() (*CallerIdentity, error) {
+	var resp struct {
+		Identity CallerIdentity `xml:"GetCallerIdentityResult"`
+	}
+	if err := c.call("GetCallerIdentity", url.Values{}, &resp); err != nil {
+		return nil, err
+	}
+	return &resp.Identity, nil
+}
+
+func setString(params url.Values, key, value string) {
+	if value != "" {
+		params.Set(key, value)
+	}
+}
+
+// setTags adds session tags, sorted by key so that requests are deterministic
+func setTags(params url.Values, tags map[string]string) {
+	var keys []string
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for i, k := range keys {
+		n := strconv.Itoa(i + 1)
+		params.Set("Tags.member."+n+".Key", k)
+		params.Set("Tags.member."+n+".Value", tags[k])
+	}
+}
+
+func setInt(params url.Values, key string, value int64) {
+	if value != 0 {
+		params.Set(key, strconv.FormatInt(value, 10))
+	}
+}
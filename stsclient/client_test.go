@@ -0,0 +1,166 @@
+package stsclient_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/99designs/aws-vault/stsclient"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+)
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+func newTestClient(status int, body string, check func(*http.Request)) *stsclient.Client {
+	c := stsclient.New(credentials.NewStaticCredentials("AKIDEXAMPLE", "SECRET", ""), "us-east-1")
+	c.HTTPClient = &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		check(r)
+		return &http.Response{
+			StatusCode: status,
+			Body:       ioutil.NopCloser(strings.NewReader(body)),
+			Header:     http.Header{},
+		}, nil
+	})}
+	return c
+}
+
+func TestGetSessionToken(t *testing.T) {
+	c := newTestClient(http.StatusOK, `<GetSessionTokenResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/">
+  <GetSessionTokenResult>
+    <Credentials>
+      <SessionToken>TOKEN</SessionToken>
+      <SecretAccessKey>SESSIONSECRET</SecretAccessKey>
+      <Expiration>2019-11-01T12:00:00Z</Expiration>
+      <AccessKeyId>ASIAEXAMPLE</AccessKeyId>
+    </Credentials>
+  </GetSessionTokenResult>
+  <ResponseMetadata>
+    <RequestId>58c5dbae-abef-11e0-8cfe-09039844ac7d</RequestId>
+  </ResponseMetadata>
+</GetSessionTokenResponse>`, func(r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Fatal(err)
+		}
+		if r.PostForm.Get("Action") != "GetSessionToken" || r.PostForm.Get("SerialNumber") != "arn:aws:iam::111111111111:mfa/me" {
+			t.Fatalf("Unexpected request params %v", r.PostForm)
+		}
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/") {
+			t.Fatalf("Request wasn't signed: %q", r.Header.Get("Authorization"))
+		}
+	})
+
+	creds, err := c.GetSessionToken(stsclient.GetSessionTokenInput{
+		DurationSeconds: 3600,
+		SerialNumber:    "arn:aws:iam::111111111111:mfa/me",
+		TokenCode:       "123456",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *creds.AccessKeyId != "ASIAEXAMPLE" || *creds.SessionToken != "TOKEN" || creds.Expiration.Unix() != 1572609600 {
+		t.Fatalf("Unexpected credentials %#v", creds)
+	}
+}
+
+func TestMissingCredentials(t *testing.T) {
+	for _, body := range []string{
+		`<GetSessionTokenResponse><GetSessionTokenResult></GetSessionTokenResult></GetSessionTokenResponse>`,
+		`<GetSessionTokenResponse><GetSessionTokenResult><Credentials><AccessKeyId>ASIAEXAMPLE</AccessKeyId></Credentials></GetSessionTokenResult></GetSessionTokenResponse>`,
+	} {
+		c := newTestClient(http.StatusOK, body, func(*http.Request) {})
+		creds, err := c.GetSessionToken(stsclient.GetSessionTokenInput{DurationSeconds: 3600})
+		if err == nil || !strings.Contains(err.Error(), "STS returned") {
+			t.Fatalf("Expected an error about the missing credentials, got %#v, %v", creds, err)
+		}
+	}
+
+	c := newTestClient(http.StatusOK, `<AssumeRoleResponse><AssumeRoleResult></AssumeRoleResult></AssumeRoleResponse>`, func(*http.Request) {})
+	if _, err := c.AssumeRole(stsclient.AssumeRoleInput{RoleArn: "arn:aws:iam::111111111111:role/admin"}); err == nil {
+		t.Fatal("Expected an error when AssumeRole returns no credentials")
+	}
+}
+
+func TestErrorResponse(t *testing.T) {
+	c := newTestClient(http.StatusForbidden, `<ErrorResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/">
+  <Error>
+    <Type>Sender</Type>
+    <Code>AccessDenied</Code>
+    <Message>MultiFactorAuthentication failed with invalid MFA one time pass code.</Message>
+  </Error>
+  <RequestId>a1b2c3</RequestId>
+</ErrorResponse>`, func(r *http.Request) {})
+
+	_, err := c.AssumeRole(stsclient.AssumeRoleInput{RoleArn: "arn:aws:iam::111111111111:role/admin"})
+
+	awsErr, ok := err.(awserr.RequestFailure)
+	if !ok {
+		t.Fatalf("Expected an awserr.RequestFailure, got %#v", err)
+	}
+	if awsErr.Code() != "AccessDenied" || awsErr.StatusCode() != http.StatusForbidden || awsErr.RequestID() != "a1b2c3" {
+		t.Fatalf("Unexpected error %v", awsErr)
+	}
+}
+
+func TestAssumeRoleWithWebIdentityIsUnsigned(t *testing.T) {
+	c := newTestClient(http.StatusOK, `<AssumeRoleWithWebIdentityResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/">
+  <AssumeRoleWithWebIdentityResult>
+    <Credentials>
+      <SessionToken>TOKEN</SessionToken>
+      <SecretAccessKey>ROLESECRET</SecretAccessKey>
+      <Expiration>2019-11-01T12:00:00Z</Expiration>
+      <AccessKeyId>ASIAEXAMPLE</AccessKeyId>
+    </Credentials>
+  </AssumeRoleWithWebIdentityResult>
+</AssumeRoleWithWebIdentityResponse>`, func(r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Fatal(err)
+		}
+		if r.PostForm.Get("Action") != "AssumeRoleWithWebIdentity" || r.PostForm.Get("WebIdentityToken") != "OIDCTOKEN" {
+			t.Fatalf("Unexpected request params %v", r.PostForm)
+		}
+		if r.Header.Get("Authorization") != "" {
+			t.Fatalf("Request shouldn't be signed: %q", r.Header.Get("Authorization"))
+		}
+	})
+	c.Credentials = nil
+
+	creds, err := c.AssumeRoleWithWebIdentity(stsclient.AssumeRoleWithWebIdentityInput{
+		RoleArn:          "arn:aws:iam::111111111111:role/ci",
+		RoleSessionName:  "ci",
+		WebIdentityToken: "OIDCTOKEN",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *creds.AccessKeyId != "ASIAEXAMPLE" || *creds.SecretAccessKey != "ROLESECRET" {
+		t.Fatalf("Unexpected credentials %#v", creds)
+	}
+}
+
+func TestGetCallerIdentity(t *testing.T) {
+	c := newTestClient(http.StatusOK, `<GetCallerIdentityResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/">
+  <GetCallerIdentityResult>
+    <Arn>arn:aws:iam::111111111111:user/me</Arn>
+    <UserId>AIDAEXAMPLE</UserId>
+    <Account>111111111111</Account>
+  </GetCallerIdentityResult>
+</GetCallerIdentityResponse>`, func(r *http.Request) {
+		if r.URL.Host != "sts.amazonaws.com" {
+			t.Fatalf("Expected the STS endpoint, got %s", r.URL.Host)
+		}
+	})
+
+	identity, err := c.GetCallerIdentity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if identity.Arn != "arn:aws:iam::111111111111:user/me" || identity.Account != "111111111111" {
+		t.Fatalf("Unexpected identity %#v", identity)
+	}
+}
@@ -0,0 +1,56 @@
+package stsclient
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+)
+
+// Error is an error response from STS or IAM. It satisfies the awserr.Error and awserr.RequestFailure
+// interfaces, so callers can inspect it the same way as errors from aws-sdk-go
+type Error struct {
+	code       string
+	message    string
+	statusCode int
+	requestID  string
+}
+
+func newError(statusCode int, body []byte) *Error {
+	var resp struct {
+		Code      string `xml:"Error>Code"`
+		Message   string `xml:"Error>Message"`
+		RequestID string `xml:"RequestId"`
+	}
+	if err := xml.Unmarshal(body, &resp); err != nil || resp.Code == "" {
+		return &Error{
+			code:       "UnknownError",
+			message:    http.StatusText(statusCode),
+			statusCode: statusCode,
+		}
+	}
+	return &Error{
+		code:       resp.Code,
+		message:    resp.Message,
+		statusCode: statusCode,
+		requestID:  resp.RequestID,
+	}
+}
+
+// Code returns the error code, e.g. AccessDenied
+func (e *Error) Code() string { return e.code }
+
+// Message returns the error message
+func (e *Error) Message() string { return e.message }
+
+// OrigErr is always nil, it's only there to satisfy awserr.Error
+func (e *Error) OrigErr() error { return nil }
+
+// StatusCode returns the HTTP status code of the response
+func (e *Error) StatusCode() int { return e.statusCode }
+
+// RequestID returns the id of the failed request
+func (e *Error) RequestID() string { return e.requestID }
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %s\n\tstatus code: %d, request id: %s", e.code, e.message, e.statusCode, e.requestID)
+}
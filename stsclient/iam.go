@@ -0,0 +1,81 @@
+package stsclient
+
+import (
+	"errors"
+	"net/url"
+)
+
+// User is the IAM user returned by iam:GetUser
+type User struct {
+	UserName string
+	Arn      string
+}
+
+// GetUser calls iam:GetUser for the user the credentials belong to
+func (c *Client) GetUser() (*User, error) {
+	var resp struct {
+		User User `xml:"GetUserResult>User"`
+	}
+	if err := c.callIAM("GetUser", url.Values{}, &resp); err != nil {
+		return nil, err
+	}
+	return &resp.User, nil
+}
+
+// ListMFADevices calls iam:ListMFADevices for the user the credentials belong to, returning the serials
+// of the devices
+func (c *Client) ListMFADevices() ([]string, error) {
+	var resp struct {
+		SerialNumbers []string `xml:"ListMFADevicesResult>MFADevices>member>SerialNumber"`
+	}
+	if err := c.callIAM("ListMFADevices", url.Values{}, &resp); err != nil {
+		return nil, err
+	}
+	return resp.SerialNumbers, nil
+}
+
+// ListAccountAliases calls iam:ListAccountAliases
+func (c *Client) ListAccountAliases() ([]string, error) {
+	var resp struct {
+		AccountAliases []string `xml:"ListAccountAliasesResult>AccountAliases>member"`
+	}
+	if err := c.callIAM("ListAccountAliases", url.Values{}, &resp); err != nil {
+		return nil, err
+	}
+	return resp.AccountAliases, nil
+}
+
+// AccessKey is the access key returned by iam:CreateAccessKey
+type AccessKey struct {
+	UserName        string
+	AccessKeyId     string
+	SecretAccessKey string
+}
+
+// CreateAccessKey calls iam:CreateAccessKey, for userName or without one for the user the credentials
+// belong to
+func (c *Client) CreateAccessKey(userName string) (*AccessKey, error) {
+	params := url.Values{}
+	setString(params, "UserName", userName)
+
+	var resp struct {
+		AccessKey AccessKey `xml:"CreateAccessKeyResult>AccessKey"`
+	}
+	if err := c.callIAM("CreateAccessKey", params, &resp); err != nil {
+		return nil, err
+	}
+	if resp.AccessKey.AccessKeyId == "" || resp.AccessKey.SecretAccessKey == "" {
+		return nil, errors.New("IAM returned no access key")
+	}
+	return &resp.AccessKey, nil
+}
+
+// DeleteAccessKey calls iam:DeleteAccessKey, for userName or without one for the user the credentials
+// belong to
+func (c *Client) DeleteAccessKey(accessKeyID string, userName string) error {
+	params := url.Values{}
+	setString(params, "AccessKeyId", accessKeyID)
+	setString(params, "UserName", userName)
+
+	return c.callIAM("DeleteAccessKey", params, nil)
+}
@@ -0,0 +1,70 @@
+package stsclient_test
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestCreateAccessKey(t *testing.T) {
+	c := newTestClient(http.StatusOK, `<CreateAccessKeyResponse xmlns="https://iam.amazonaws.com/doc/2010-05-08/">
+  <CreateAccessKeyResult>
+    <AccessKey>
+      <UserName>ci</UserName>
+      <AccessKeyId>AKIAEXAMPLE</AccessKeyId>
+      <Status>Active</Status>
+      <SecretAccessKey>NEWSECRET</SecretAccessKey>
+    </AccessKey>
+  </CreateAccessKeyResult>
+  <ResponseMetadata>
+    <RequestId>7a62c49f-347e-4fc4-9331-6e8eEXAMPLE</RequestId>
+  </ResponseMetadata>
+</CreateAccessKeyResponse>`, func(r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Fatal(err)
+		}
+		if r.URL.Host != "iam.amazonaws.com" {
+			t.Fatalf("Expected the IAM endpoint, got %s", r.URL.Host)
+		}
+		if r.PostForm.Get("Action") != "CreateAccessKey" || r.PostForm.Get("Version") != "2010-05-08" || r.PostForm.Get("UserName") != "ci" {
+			t.Fatalf("Unexpected request params %v", r.PostForm)
+		}
+		if !strings.Contains(r.Header.Get("Authorization"), "/us-east-1/iam/aws4_request") {
+			t.Fatalf("Request wasn't signed for IAM: %q", r.Header.Get("Authorization"))
+		}
+	})
+
+	key, err := c.CreateAccessKey("ci")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key.AccessKeyId != "AKIAEXAMPLE" || key.SecretAccessKey != "NEWSECRET" {
+		t.Fatalf("Unexpected access key %#v", key)
+	}
+}
+
+func TestListMFADevices(t *testing.T) {
+	c := newTestClient(http.StatusOK, `<ListMFADevicesResponse xmlns="https://iam.amazonaws.com/doc/2010-05-08/">
+  <ListMFADevicesResult>
+    <IsTruncated>false</IsTruncated>
+    <MFADevices>
+      <member>
+        <UserName>me</UserName>
+        <SerialNumber>arn:aws:iam::111111111111:mfa/phone</SerialNumber>
+      </member>
+      <member>
+        <UserName>me</UserName>
+        <SerialNumber>arn:aws:iam::111111111111:mfa/yubikey</SerialNumber>
+      </member>
+    </MFADevices>
+  </ListMFADevicesResult>
+</ListMFADevicesResponse>`, func(r *http.Request) {})
+
+	serials, err := c.ListMFADevices()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(serials) != 2 || serials[1] != "arn:aws:iam::111111111111:mfa/yubikey" {
+		t.Fatalf("Unexpected serials %v", serials)
+	}
+}
@@ -0,0 +1,31 @@
+package stsclient_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/99designs/aws-vault/stsclient"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+)
+
+// uses the get-vanilla case from the AWS Signature Version 4 test suite
+func TestSignGetVanilla(t *testing.T) {
+	req, err := http.NewRequest("GET", "https://example.amazonaws.com/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	creds := credentials.Value{
+		AccessKeyID:     "AKIDEXAMPLE",
+		SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+	}
+
+	stsclient.Sign(req, nil, creds, "us-east-1", "service", time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC))
+
+	expected := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, " +
+		"SignedHeaders=host;x-amz-date, " +
+		"Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31"
+	if got := req.Header.Get("Authorization"); got != expected {
+		t.Fatalf("Expected Authorization %q, got %q", expected, got)
+	}
+}
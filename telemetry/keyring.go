@@ -0,0 +1,56 @@
+package telemetry
+
+import "github.com/99designs/keyring"
+
+// Keyring wraps a keyring so that each access is recorded as a span
+func Keyring(k keyring.Keyring, backend string) keyring.Keyring {
+	return &tracingKeyring{k, backend}
+}
+
+type tracingKeyring struct {
+	keyring keyring.Keyring
+	backend string
+}
+
+func (t *tracingKeyring) span(op string, key string) *Span {
+	attrs := map[string]string{"keyring.backend": t.backend}
+	if key != "" {
+		attrs["keyring.key"] = key
+	}
+	return Start("keyring."+op, attrs)
+}
+
+func (t *tracingKeyring) Get(key string) (keyring.Item, error) {
+	s := t.span("Get", key)
+	item, err := t.keyring.Get(key)
+	s.End(err)
+	return item, err
+}
+
+func (t *tracingKeyring) GetMetadata(key string) (keyring.Metadata, error) {
+	s := t.span("GetMetadata", key)
+	md, err := t.keyring.GetMetadata(key)
+	s.End(err)
+	return md, err
+}
+
+func (t *tracingKeyring) Set(item keyring.Item) error {
+	s := t.span("Set", item.Key)
+	err := t.keyring.Set(item)
+	s.End(err)
+	return err
+}
+
+func (t *tracingKeyring) Remove(key string) error {
+	s := t.span("Remove", key)
+	err := t.keyring.Remove(key)
+	s.End(err)
+	return err
+}
+
+func (t *tracingKeyring) Keys() ([]string, error) {
+	s := t.span("Keys", "")
+	keys, err := t.keyring.Keys()
+	s.End(err)
+	return keys, err
+}
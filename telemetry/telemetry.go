@@ -0,0 +1,321 @@
+// Package telemetry records optional trace spans around keyring access and AWS API calls, and
+// exports them to an OpenTelemetry collector using OTLP over HTTP with JSON encoding, or summarises
+// where the time went
+package telemetry
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/99designs/aws-vault/logging"
+)
+
+const (
+	spanKindInternal = 1
+	spanKindClient   = 3
+	statusCodeOk     = 1
+	statusCodeError  = 2
+)
+
+var (
+	mu       sync.Mutex
+	endpoint string
+	traceID  string
+	root     *Span
+	spans    []*Span
+
+	// timed are the spans kept for Summary, which aren't dropped by Flush
+	timing bool
+	timed  []*Span
+)
+
+// Span is a timed operation
+type Span struct {
+	name       string
+	kind       int
+	id         string
+	parentID   string
+	start      time.Time
+	end        time.Time
+	attributes map[string]string
+	err        error
+}
+
+// Enable starts recording spans for the command, to be exported to the OTLP endpoint on Flush
+func Enable(otlpEndpoint string, command string) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	endpoint = strings.TrimSuffix(otlpEndpoint, "/")
+	startRoot(command)
+}
+
+// EnableTiming starts recording spans for the command, to be summarised by Summary
+func EnableTiming(command string) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	timing = true
+	startRoot(command)
+}
+
+func startRoot(command string) {
+	if root != nil {
+		return
+	}
+	traceID = randomHex(16)
+	root = &Span{
+		name:       "aws-vault " + command,
+		kind:       spanKindInternal,
+		id:         randomHex(8),
+		start:      time.Now(),
+		attributes: map[string]string{},
+	}
+}
+
+// Enabled returns whether spans are being recorded
+func Enabled() bool {
+	mu.Lock()
+	defer mu.Unlock()
+	return root != nil
+}
+
+// Start begins a client span, it's a no-op if telemetry isn't enabled
+func Start(name string, attributes map[string]string) *Span {
+	return Record(name, time.Now(), attributes)
+}
+
+// Record begins a client span that started at a given time
+func Record(name string, start time.Time, attributes map[string]string) *Span {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if root == nil {
+		return nil
+	}
+	if attributes == nil {
+		attributes = map[string]string{}
+	}
+
+	return &Span{
+		name:       name,
+		kind:       spanKindClient,
+		id:         randomHex(8),
+		parentID:   root.id,
+		start:      start,
+		attributes: attributes,
+	}
+}
+
+// End finishes the span, recording the error if there was one
+func (s *Span) End(err error) {
+	if s == nil {
+		return
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	s.end = time.Now()
+	s.err = err
+	spans = append(spans, s)
+	if timing {
+		timed = append(timed, s)
+	}
+}
+
+// Flush exports the recorded spans to the OTLP endpoint. Export errors are logged rather than
+// returned, as telemetry must never break the command
+func Flush() {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if root == nil || len(spans) == 0 {
+		return
+	}
+	if endpoint == "" {
+		spans = nil
+		return
+	}
+
+	root.end = time.Now()
+	payload := exportRequest(append([]*Span{root}, spans...))
+	spans = nil
+
+	b, err := json.Marshal(payload)
+	if err != nil {
+		logging.Warnf("Failed to encode spans: %v", err)
+		return
+	}
+
+	client := http.Client{Timeout: 2 * time.Second}
+	resp, err := client.Post(endpoint+"/v1/traces", "application/json", bytes.NewReader(b))
+	if err != nil {
+		logging.Warnf("Failed to export spans to %s: %v", endpoint, err)
+		return
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		logging.Warnf("Failed to export spans to %s: %s", endpoint, resp.Status)
+		return
+	}
+	log.Printf("Exported trace %s to %s", traceID, endpoint)
+}
+
+// Summary describes how long the command has taken, and how much of that was spent in each kind of span,
+// e.g. keyring.Get or sts.AssumeRole. It's empty unless EnableTiming was called
+func Summary() string {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if !timing {
+		return ""
+	}
+
+	type total struct {
+		name     string
+		count    int
+		failed   int
+		duration time.Duration
+	}
+	var totals []*total
+	byName := map[string]*total{}
+	for _, s := range timed {
+		t, ok := byName[s.name]
+		if !ok {
+			t = &total{name: s.name}
+			byName[s.name] = t
+			totals = append(totals, t)
+		}
+		t.count++
+		if s.err != nil {
+			t.failed++
+		}
+		t.duration += s.end.Sub(s.start)
+	}
+
+	var b strings.Builder
+	elapsed := time.Since(root.start)
+	fmt.Fprintf(&b, "%s took %s\n", root.name, elapsed.Round(time.Millisecond))
+
+	w := tabwriter.NewWriter(&b, 0, 4, 2, ' ', 0)
+	for _, t := range totals {
+		calls := fmt.Sprintf("%d", t.count)
+		if t.failed > 0 {
+			calls += fmt.Sprintf(" (%d failed)", t.failed)
+		}
+		fmt.Fprintf(w, "  %s\t%s\t%s\n", t.name, calls, t.duration.Round(time.Millisecond))
+	}
+	if other := elapsed - spanned(timed); other > 0 {
+		fmt.Fprintf(w, "  other\t\t%s\n", other.Round(time.Millisecond))
+	}
+	w.Flush()
+	return b.String()
+}
+
+// spanned returns how much time the spans cover, counting the time of overlapping spans once, as an STS
+// call's span includes reading the credentials it's signed with
+func spanned(spans []*Span) time.Duration {
+	sorted := append([]*Span{}, spans...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].start.Before(sorted[j].start) })
+
+	var covered time.Duration
+	var until time.Time
+	for _, s := range sorted {
+		start := s.start
+		if start.Before(until) {
+			start = until
+		}
+		if s.end.After(start) {
+			covered += s.end.Sub(start)
+			until = s.end
+		}
+	}
+	return covered
+}
+
+type keyValue struct {
+	Key   string            `json:"key"`
+	Value map[string]string `json:"value"`
+}
+
+type otlpSpan struct {
+	TraceID           string     `json:"traceId"`
+	SpanID            string     `json:"spanId"`
+	ParentSpanID      string     `json:"parentSpanId,omitempty"`
+	Name              string     `json:"name"`
+	Kind              int        `json:"kind"`
+	StartTimeUnixNano string     `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string     `json:"endTimeUnixNano"`
+	Attributes        []keyValue `json:"attributes,omitempty"`
+	Status            otlpStatus `json:"status"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+func exportRequest(ss []*Span) map[string]interface{} {
+	var otlpSpans []otlpSpan
+	for _, s := range ss {
+		o := otlpSpan{
+			TraceID:           traceID,
+			SpanID:            s.id,
+			ParentSpanID:      s.parentID,
+			Name:              s.name,
+			Kind:              s.kind,
+			StartTimeUnixNano: fmt.Sprintf("%d", s.start.UnixNano()),
+			EndTimeUnixNano:   fmt.Sprintf("%d", s.end.UnixNano()),
+			Attributes:        attributes(s.attributes),
+			Status:            otlpStatus{Code: statusCodeOk},
+		}
+		if s.err != nil {
+			o.Status = otlpStatus{Code: statusCodeError, Message: s.err.Error()}
+		}
+		otlpSpans = append(otlpSpans, o)
+	}
+
+	return map[string]interface{}{
+		"resourceSpans": []interface{}{
+			map[string]interface{}{
+				"resource": map[string]interface{}{
+					"attributes": attributes(map[string]string{"service.name": "aws-vault"}),
+				},
+				"scopeSpans": []interface{}{
+					map[string]interface{}{
+						"scope": map[string]string{"name": "github.com/99designs/aws-vault"},
+						"spans": otlpSpans,
+					},
+				},
+			},
+		},
+	}
+}
+
+func attributes(m map[string]string) []keyValue {
+	var kvs []keyValue
+	for k, v := range m {
+		kvs = append(kvs, keyValue{Key: k, Value: map[string]string{"stringValue": v}})
+	}
+	return kvs
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
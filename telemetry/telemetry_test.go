@@ -0,0 +1,79 @@
+package telemetry_test
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/99designs/aws-vault/telemetry"
+)
+
+func TestFlushExportsSpans(t *testing.T) {
+	var body []byte
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/traces" {
+			t.Errorf("Expected path /v1/traces, got %s", r.URL.Path)
+		}
+		body, _ = ioutil.ReadAll(r.Body)
+	}))
+	defer ts.Close()
+
+	telemetry.Enable(ts.URL, "exec")
+	telemetry.Start("keyring.Get", map[string]string{"keyring.key": "llamas"}).End(nil)
+	telemetry.Start("sts.GetSessionToken", nil).End(errors.New("ExpiredToken"))
+	telemetry.Flush()
+
+	var payload struct {
+		ResourceSpans []struct {
+			ScopeSpans []struct {
+				Spans []struct {
+					Name   string `json:"name"`
+					Status struct {
+						Code int `json:"code"`
+					} `json:"status"`
+				} `json:"spans"`
+			} `json:"scopeSpans"`
+		} `json:"resourceSpans"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for _, s := range payload.ResourceSpans[0].ScopeSpans[0].Spans {
+		names = append(names, s.Name)
+		if s.Name == "sts.GetSessionToken" && s.Status.Code != 2 {
+			t.Fatalf("Expected error status for %s, got %d", s.Name, s.Status.Code)
+		}
+	}
+
+	expected := "aws-vault exec,keyring.Get,sts.GetSessionToken"
+	if strings.Join(names, ",") != expected {
+		t.Fatalf("Expected spans %q, got %q", expected, strings.Join(names, ","))
+	}
+}
+
+func TestSummary(t *testing.T) {
+	telemetry.EnableTiming("exec")
+	telemetry.Start("keyring.Get", nil).End(nil)
+	telemetry.Start("keyring.Get", nil).End(nil)
+	telemetry.Start("sts.AssumeRole", nil).End(errors.New("AccessDenied"))
+
+	calls := map[string]string{}
+	for _, line := range strings.Split(telemetry.Summary(), "\n") {
+		if fields := strings.Fields(line); len(fields) > 2 {
+			calls[fields[0]] = strings.Join(fields[1:len(fields)-1], " ")
+		}
+	}
+
+	if calls["keyring.Get"] != "2" {
+		t.Fatalf("Expected 2 keyring.Get calls, got %q", calls["keyring.Get"])
+	}
+	if calls["sts.AssumeRole"] != "1 (1 failed)" {
+		t.Fatalf("Expected 1 failed sts.AssumeRole call, got %q", calls["sts.AssumeRole"])
+	}
+}
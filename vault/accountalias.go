@@ -0,0 +1,67 @@
+package vault
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/99designs/aws-vault/logging"
+)
+
+const accountAliasCacheTTL = 24 * time.Hour
+
+type accountAliasCache struct {
+	Alias   string    `json:"alias"`
+	Expires time.Time `json:"expires"`
+}
+
+// roleName returns the name of the role in a role ARN
+func roleName(roleARN string) string {
+	return roleARN[strings.LastIndex(roleARN, "/")+1:]
+}
+
+// accountAlias looks up the alias of the account the master credentials are in with iam:ListAccountAliases,
+// caching it for a day. It's only used to describe the account, so "" is returned if it can't be found
+func (p *TempCredentialsProvider) accountAlias() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	cachePath := filepath.Join(dir, "aws-vault", "aliases", base64Encoding.EncodeToString([]byte(p.config.CredentialsName))+".json")
+
+	var cache accountAliasCache
+	if b, err := ioutil.ReadFile(cachePath); err == nil {
+		if err = json.Unmarshal(b, &cache); err == nil && time.Now().Before(cache.Expires) {
+			return cache.Alias
+		}
+	}
+
+	client, err := newStsClient(p.masterCreds, p.config)
+	if err != nil {
+		logging.Warnf("Failed to look up the account alias: %v", err)
+		return ""
+	}
+	aliases, err := client.ListAccountAliases()
+	if err != nil {
+		logging.Warnf("Failed to look up the account alias: %v", err)
+		return ""
+	}
+
+	cache = accountAliasCache{Expires: time.Now().Add(accountAliasCacheTTL)}
+	if len(aliases) > 0 {
+		cache.Alias = aliases[0]
+	}
+	if b, err := json.Marshal(cache); err == nil {
+		if err = os.MkdirAll(filepath.Dir(cachePath), 0700); err == nil {
+			err = ioutil.WriteFile(cachePath, b, 0600)
+		}
+		if err != nil {
+			logging.Warnf("Failed to cache the account alias: %v", err)
+		}
+	}
+
+	return cache.Alias
+}
@@ -0,0 +1,65 @@
+package vault
+
+import (
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/99designs/aws-vault/stsclient"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+)
+
+const (
+	rootTaskPolicyArnPrefix = "arn:aws:iam::aws:policy/root-task/"
+
+	// AssumeRootDuration is the maximum duration of a root session
+	AssumeRootDuration = time.Minute * 15
+)
+
+// RootTaskPolicyArn returns the ARN of a root task policy, which can be given by name
+// (e.g. IAMAuditRootUserCredentials) or as a full ARN
+func RootTaskPolicyArn(policy string) string {
+	if strings.HasPrefix(policy, "arn:") {
+		return policy
+	}
+	return rootTaskPolicyArnPrefix + policy
+}
+
+// getCredsWithRoot uses the profile's credentials to create a task-scoped root session in a member account
+func (p *TempCredentialsProvider) getCredsWithRoot() (credentials.Value, error) {
+	if p.config.RootTaskPolicy == "" {
+		return credentials.Value{}, errors.New("A root task policy is required to assume root")
+	}
+
+	base, err := p.getCredsWith(rootBasePath(p.config))
+	if err != nil {
+		return credentials.Value{}, err
+	}
+
+	client, err := newStsClient(credentials.NewStaticCredentialsFromCreds(base), p.config)
+	if err != nil {
+		return credentials.Value{}, err
+	}
+
+	input := stsclient.AssumeRootInput{
+		TargetPrincipal: p.config.AssumeRootTarget,
+		TaskPolicyArn:   RootTaskPolicyArn(p.config.RootTaskPolicy),
+		DurationSeconds: int64(AssumeRootDuration.Seconds()),
+	}
+
+	log.Printf("Assuming root in %s with task policy %s", p.config.AssumeRootTarget, input.TaskPolicyArn)
+	root, err := client.AssumeRoot(input)
+	if err != nil {
+		return credentials.Value{}, err
+	}
+
+	p.SetExpiration(*root.Expiration, p.config.RoleExpirationWindow)
+
+	log.Printf("Using root session ****************%s, expires in %s", (*root.AccessKeyId)[len(*root.AccessKeyId)-4:], root.Expiration.Sub(time.Now()).String())
+	return credentials.Value{
+		AccessKeyID:     *root.AccessKeyId,
+		SecretAccessKey: *root.SecretAccessKey,
+		SessionToken:    *root.SessionToken,
+	}, nil
+}
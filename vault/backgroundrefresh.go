@@ -0,0 +1,122 @@
+package vault
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/99designs/aws-vault/logging"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+)
+
+const (
+	// backgroundRefreshMinInterval is the least time between refreshes, so credentials that are already
+	// in the expiration window when they're fetched aren't refreshed continuously
+	backgroundRefreshMinInterval = 10 * time.Second
+
+	// a failed refresh is retried after backgroundRefreshRetryInterval, doubling after each failure up to
+	// backgroundRefreshMaxRetryInterval
+	backgroundRefreshRetryInterval    = 30 * time.Second
+	backgroundRefreshMaxRetryInterval = 10 * time.Minute
+)
+
+// BackgroundRefreshingCredentials serves cached credentials while refreshing them in the background
+// once they enter the expiration window, so callers never block on a synchronous STS call
+type BackgroundRefreshingCredentials struct {
+	creds *credentials.Credentials
+
+	mu        sync.RWMutex
+	value     credentials.Value
+	expiresAt time.Time
+}
+
+// NewBackgroundRefreshingCredentials retrieves the initial credentials and starts refreshing them in the background
+func NewBackgroundRefreshingCredentials(creds *credentials.Credentials) (*BackgroundRefreshingCredentials, error) {
+	c := &BackgroundRefreshingCredentials{creds: creds}
+	if err := c.refresh(); err != nil {
+		return nil, err
+	}
+	go c.refreshLoop()
+	return c, nil
+}
+
+func (c *BackgroundRefreshingCredentials) refresh() error {
+	val, err := c.creds.Get()
+	if err != nil {
+		return err
+	}
+	expiresAt, err := c.creds.ExpiresAt()
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.value = val
+	c.expiresAt = expiresAt
+	return nil
+}
+
+func (c *BackgroundRefreshingCredentials) refreshLoop() {
+	wait, retry := c.untilExpiry(), backgroundRefreshRetryInterval
+	for {
+		if wait < backgroundRefreshMinInterval {
+			wait = backgroundRefreshMinInterval
+		}
+		time.Sleep(wait)
+
+		log.Printf("Refreshing credentials in the background")
+		if err := c.refresh(); err != nil {
+			logging.Warnf("Background refresh failed, retrying in %s: %v", retry, err)
+			wait = retry
+			if retry *= 2; retry > backgroundRefreshMaxRetryInterval {
+				retry = backgroundRefreshMaxRetryInterval
+			}
+			continue
+		}
+		wait, retry = c.untilExpiry(), backgroundRefreshRetryInterval
+	}
+}
+
+func (c *BackgroundRefreshingCredentials) untilExpiry() time.Duration {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return time.Until(c.expiresAt)
+}
+
+// Get returns the cached credentials, only refreshing synchronously if they were expired with Expire
+func (c *BackgroundRefreshingCredentials) Get() (credentials.Value, error) {
+	c.mu.RLock()
+	val, expiresAt := c.value, c.expiresAt
+	c.mu.RUnlock()
+
+	if expiresAt.IsZero() {
+		if err := c.refresh(); err != nil {
+			return credentials.Value{}, err
+		}
+		return c.Get()
+	}
+	return val, nil
+}
+
+// ExpiresAt returns when the cached credentials enter the expiration window
+func (c *BackgroundRefreshingCredentials) ExpiresAt() (time.Time, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.expiresAt, nil
+}
+
+// IsExpired returns whether the cached credentials are in the expiration window
+func (c *BackgroundRefreshingCredentials) IsExpired() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return !c.expiresAt.After(time.Now())
+}
+
+// Expire discards the cached credentials, so they are refreshed on the next Get
+func (c *BackgroundRefreshingCredentials) Expire() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.creds.Expire()
+	c.expiresAt = time.Time{}
+}
@@ -6,10 +6,12 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/99designs/aws-vault/prompt"
+	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/mitchellh/go-homedir"
 	ini "gopkg.in/ini.v1"
 )
@@ -20,8 +22,14 @@ const (
 	MinAssumeRoleDuration = time.Minute * 15
 	MaxAssumeRoleDuration = time.Hour * 12
 
+	// MaxChainedAssumeRoleDuration is the limit STS puts on roles assumed with temporary credentials
+	MaxChainedAssumeRoleDuration = time.Hour
+
 	DefaultSessionDuration    = time.Hour * 4
 	DefaultAssumeRoleDuration = time.Minute * 15
+
+	// DefaultExpirationWindow is how long before they expire that credentials are refreshed
+	DefaultExpirationWindow = time.Minute * 5
 )
 
 func init() {
@@ -121,6 +129,7 @@ func (c *ConfigFile) parseFile() error {
 type ProfileSection struct {
 	Name            string `ini:"-"`
 	MfaSerial       string `ini:"mfa_serial,omitempty"`
+	MfaSerials      string `ini:"mfa_serials,omitempty"`
 	RoleARN         string `ini:"role_arn,omitempty"`
 	ExternalID      string `ini:"external_id,omitempty"`
 	Region          string `ini:"region,omitempty"`
@@ -128,6 +137,37 @@ type ProfileSection struct {
 	DurationSeconds string `ini:"duration_seconds,omitempty"`
 	SourceProfile   string `ini:"source_profile,omitempty"`
 	ParentProfile   string `ini:"parent_profile,omitempty"`
+	NoExport        string `ini:"no_export,omitempty"`
+	EnvFormat       string `ini:"env_format,omitempty"`
+	PostureHook     string `ini:"posture_hook,omitempty"`
+	MfaProcess      string `ini:"mfa_process,omitempty"`
+	Prompt          string `ini:"prompt,omitempty"`
+
+	WebIdentityTokenFile string `ini:"web_identity_token_file,omitempty"`
+	AssumeRoleWithMfa    bool   `ini:"assume_role_with_mfa,omitempty"`
+
+	SessionExpirationWindow string `ini:"session_expiration_window,omitempty"`
+	RoleExpirationWindow    string `ini:"role_expiration_window,omitempty"`
+
+	CABundle       string `ini:"ca_bundle,omitempty"`
+	HTTPSProxy     string `ini:"https_proxy,omitempty"`
+	ConnectTimeout string `ini:"connect_timeout,omitempty"`
+	RequestTimeout string `ini:"request_timeout,omitempty"`
+
+	// Alias is a comma separated list of other names the profile can be given as, e.g. a short name for a
+	// long generated one
+	Alias string `ini:"alias,omitempty"`
+}
+
+// Aliases returns the other names the profile can be given as
+func (p ProfileSection) Aliases() []string {
+	var aliases []string
+	for _, alias := range strings.Split(p.Alias, ",") {
+		if alias = strings.TrimSpace(alias); alias != "" {
+			aliases = append(aliases, alias)
+		}
+	}
+	return aliases
 }
 
 // Profiles returns all the profile sections in the config
@@ -139,7 +179,7 @@ func (c *ConfigFile) ProfileSections() []ProfileSection {
 	}
 
 	for _, section := range c.iniFile.SectionStrings() {
-		if section != "DEFAULT" {
+		if section != "DEFAULT" && !strings.HasPrefix(section, vaultSectionPrefix) {
 			profile, _ := c.ProfileSection(strings.TrimPrefix(section, "profile "))
 			result = append(result, profile)
 		}
@@ -157,12 +197,7 @@ func (c *ConfigFile) ProfileSection(name string) (ProfileSection, bool) {
 	if c.iniFile == nil {
 		return profile, false
 	}
-	// default profile name has a slightly different section format
-	sectionName := "profile " + name
-	if name == "default" {
-		sectionName = "default"
-	}
-	section, err := c.iniFile.GetSection(sectionName)
+	section, err := c.iniFile.GetSection(profileSectionName(name))
 	if err != nil {
 		return profile, false
 	}
@@ -177,12 +212,7 @@ func (c *ConfigFile) Add(profile ProfileSection) error {
 	if c.iniFile == nil {
 		return errors.New("No iniFile to add to")
 	}
-	// default profile name has a slightly different section format
-	sectionName := "profile " + profile.Name
-	if profile.Name == "default" {
-		sectionName = "default"
-	}
-	section, err := c.iniFile.NewSection(sectionName)
+	section, err := c.iniFile.NewSection(profileSectionName(profile.Name))
 	if err != nil {
 		return fmt.Errorf("Error creating section %q: %v", profile.Name, err)
 	}
@@ -192,6 +222,41 @@ func (c *ConfigFile) Add(profile ProfileSection) error {
 	return c.iniFile.SaveTo(c.Path)
 }
 
+// SetProfileValue sets a single key in a profile section and saves the configuration file
+func (c *ConfigFile) SetProfileValue(profileName, key, value string) error {
+	if c.iniFile == nil {
+		return errors.New("No iniFile to update")
+	}
+	c.iniFile.Section(profileSectionName(profileName)).Key(key).SetValue(value)
+	return c.iniFile.SaveTo(c.Path)
+}
+
+// profileSectionName returns the ini section name for a profile. The default profile name
+// has a slightly different section format
+func profileSectionName(name string) string {
+	if name == "default" {
+		return "default"
+	}
+	return "profile " + name
+}
+
+// ResolveAlias returns the name of the profile that name is an alias of, or name itself if it's the name of
+// a profile or not an alias
+func (c *ConfigFile) ResolveAlias(name string) string {
+	if _, ok := c.ProfileSection(name); ok {
+		return name
+	}
+	for _, profile := range c.ProfileSections() {
+		for _, alias := range profile.Aliases() {
+			if alias == name {
+				log.Printf("Using profile %s for alias %s", profile.Name, name)
+				return profile.Name
+			}
+		}
+	}
+	return name
+}
+
 // ProfileNames returns a slice of profile names from the AWS config
 func (c *ConfigFile) ProfileNames() []string {
 	var profileNames []string
@@ -201,11 +266,78 @@ func (c *ConfigFile) ProfileNames() []string {
 	return profileNames
 }
 
+const vaultSectionPrefix = "vault "
+
+// VaultSection is a vault section of config, it configures where the credentials of a
+// vault chosen with --vault are kept
+type VaultSection struct {
+	Name                    string `ini:"-"`
+	Backend                 string `ini:"backend,omitempty"`
+	SessionBackend          string `ini:"session_backend,omitempty"`
+	SessionDir              string `ini:"session_dir,omitempty"`
+	Keychain                string `ini:"keychain,omitempty"`
+	KeychainAccess          string `ini:"keychain_access,omitempty"`
+	FileDir                 string `ini:"file_dir,omitempty"`
+	PassPrefix              string `ini:"pass_prefix,omitempty"`
+	SecretServiceCollection string `ini:"secret_service_collection,omitempty"`
+	KWalletFolder           string `ini:"kwallet_folder,omitempty"`
+	WinCredPrefix           string `ini:"wincred_prefix,omitempty"`
+	EncryptedFilePath       string `ini:"encrypted_file_path,omitempty"`
+	TPMPath                 string `ini:"tpm_path,omitempty"`
+	AgePath                 string `ini:"age_path,omitempty"`
+	AgeRecipientsFile       string `ini:"age_recipients_file,omitempty"`
+	AgeIdentity             string `ini:"age_identity,omitempty"`
+	GPGPath                 string `ini:"gpg_path,omitempty"`
+	OpVault                 string `ini:"op_vault,omitempty"`
+	HashiCorpVaultPath      string `ini:"hashicorp_vault_path,omitempty"`
+}
+
+// VaultSection returns the vault section with the matching name. If there isn't any,
+// an empty vault with the provided name is returned, along with false.
+func (c *ConfigFile) VaultSection(name string) (VaultSection, bool) {
+	v := VaultSection{
+		Name: name,
+	}
+	if c.iniFile == nil {
+		return v, false
+	}
+	section, err := c.iniFile.GetSection(vaultSectionPrefix + name)
+	if err != nil {
+		return v, false
+	}
+	if err = section.MapTo(&v); err != nil {
+		panic(err)
+	}
+	return v, true
+}
+
+// VaultNames returns the names of the vaults with a section in the config
+func (c *ConfigFile) VaultNames() []string {
+	var names []string
+	if c.iniFile == nil {
+		return names
+	}
+	for _, section := range c.iniFile.SectionStrings() {
+		if strings.HasPrefix(section, vaultSectionPrefix) {
+			names = append(names, strings.TrimPrefix(section, vaultSectionPrefix))
+		}
+	}
+	return names
+}
+
+// ConfigLoader loads a Config for a profile, merging the environment, the profile and its parents in the
+// config file, and defaults
 type ConfigLoader struct {
 	File            *ConfigFile
 	visitedProfiles []string
 }
 
+// ProfileChain returns the profiles the last LoadFromProfile read settings from, the profile first and then
+// its parent_profiles
+func (c *ConfigLoader) ProfileChain() []string {
+	return append([]string(nil), c.visitedProfiles...)
+}
+
 func (c *ConfigLoader) visitProfile(name string) bool {
 	for _, p := range c.visitedProfiles {
 		if p == name {
@@ -227,6 +359,15 @@ func (c *ConfigLoader) populateFromDefaults(config *Config) {
 	if config.SessionDuration == 0 {
 		config.SessionDuration = DefaultSessionDuration
 	}
+	if config.SessionExpirationWindow == 0 {
+		config.SessionExpirationWindow = DefaultExpirationWindow
+	}
+	if config.RoleExpirationWindow == 0 {
+		config.RoleExpirationWindow = DefaultExpirationWindow
+	}
+	if config.PromptDriver == "" {
+		config.PromptDriver = "terminal"
+	}
 }
 
 func (c *ConfigLoader) populateFromConfigFile(config *Config, profileName string) error {
@@ -243,6 +384,11 @@ func (c *ConfigLoader) populateFromConfigFile(config *Config, profileName string
 	if config.MfaSerial == "" {
 		config.MfaSerial = psection.MfaSerial
 	}
+	if len(config.MfaSerials) == 0 && psection.MfaSerials != "" {
+		for _, serial := range strings.Split(psection.MfaSerials, ",") {
+			config.MfaSerials = append(config.MfaSerials, strings.TrimSpace(serial))
+		}
+	}
 	if config.RoleARN == "" {
 		config.RoleARN = psection.RoleARN
 	}
@@ -255,16 +401,78 @@ func (c *ConfigLoader) populateFromConfigFile(config *Config, profileName string
 	if config.RoleSessionName == "" {
 		config.RoleSessionName = psection.RoleSessionName
 	}
+	// no_export is parsed here rather than by go-ini, which ignores values it can't parse as a bool, so a
+	// typo would leave the credentials exportable
+	if !config.NoExport && psection.NoExport != "" {
+		noExport, err := strconv.ParseBool(psection.NoExport)
+		if err != nil {
+			return fmt.Errorf("Invalid no_export in profile '%s': %q isn't true or false", profileName, psection.NoExport)
+		}
+		config.NoExport = noExport
+	}
+	if config.EnvFormat == "" {
+		config.EnvFormat = psection.EnvFormat
+	}
+	if config.PostureHook == "" {
+		config.PostureHook = psection.PostureHook
+	}
+	if config.MfaProcess == "" {
+		config.MfaProcess = psection.MfaProcess
+	}
+	if config.PromptDriver == "" {
+		config.PromptDriver = psection.Prompt
+	}
+	if !config.AssumeRoleWithMfa {
+		config.AssumeRoleWithMfa = psection.AssumeRoleWithMfa
+	}
+	if config.WebIdentityTokenFile == "" {
+		config.WebIdentityTokenFile = psection.WebIdentityTokenFile
+	}
 	if config.AssumeRoleDuration == 0 {
 		if d, err := time.ParseDuration(psection.DurationSeconds + "s"); err == nil {
 			config.AssumeRoleDuration = d
 		}
 	}
+	if config.SessionExpirationWindow == 0 && psection.SessionExpirationWindow != "" {
+		d, err := time.ParseDuration(psection.SessionExpirationWindow)
+		if err != nil {
+			return fmt.Errorf("Invalid session_expiration_window in profile '%s': %v", profileName, err)
+		}
+		config.SessionExpirationWindow = d
+	}
+	if config.RoleExpirationWindow == 0 && psection.RoleExpirationWindow != "" {
+		d, err := time.ParseDuration(psection.RoleExpirationWindow)
+		if err != nil {
+			return fmt.Errorf("Invalid role_expiration_window in profile '%s': %v", profileName, err)
+		}
+		config.RoleExpirationWindow = d
+	}
+
+	if config.CABundle == "" {
+		config.CABundle = psection.CABundle
+	}
+	if config.HTTPSProxy == "" {
+		config.HTTPSProxy = psection.HTTPSProxy
+	}
+	if config.ConnectTimeout == 0 && psection.ConnectTimeout != "" {
+		d, err := parseTimeout(psection.ConnectTimeout)
+		if err != nil {
+			return fmt.Errorf("Invalid connect_timeout in profile '%s': %v", profileName, err)
+		}
+		config.ConnectTimeout = d
+	}
+	if config.RequestTimeout == 0 && psection.RequestTimeout != "" {
+		d, err := parseTimeout(psection.RequestTimeout)
+		if err != nil {
+			return fmt.Errorf("Invalid request_timeout in profile '%s': %v", profileName, err)
+		}
+		config.RequestTimeout = d
+	}
 
-	if psection.SourceProfile != "" {
+	// the nearest source_profile wins, so profiles can share one set of master credentials (e.g. a
+	// "company-base" keypair) through a common parent_profile while still being able to override it
+	if config.CredentialsName == "" && psection.SourceProfile != "" {
 		config.CredentialsName = psection.SourceProfile
-	} else {
-		config.CredentialsName = profileName
 	}
 
 	if psection.ParentProfile != "" {
@@ -274,17 +482,22 @@ func (c *ConfigLoader) populateFromConfigFile(config *Config, profileName string
 		}
 	}
 
+	if config.CredentialsName == "" {
+		config.CredentialsName = profileName
+	}
+
 	return nil
 }
 
-func (c *ConfigLoader) populateFromEnv(profile *Config) {
-	if region := os.Getenv("AWS_DEFAULT_REGION"); region != "" && profile.Region == "" {
-		log.Printf("Using region %q from AWS_DEFAULT_REGION", region)
+func (c *ConfigLoader) populateFromEnv(profile *Config) error {
+	// AWS_REGION takes precedence over AWS_DEFAULT_REGION, as it does in the SDKs
+	if region := os.Getenv("AWS_REGION"); region != "" && profile.Region == "" {
+		log.Printf("Using region %q from AWS_REGION", region)
 		profile.Region = region
 	}
 
-	if region := os.Getenv("AWS_REGION"); region != "" && profile.Region == "" {
-		log.Printf("Using region %q from AWS_REGION", region)
+	if region := os.Getenv("AWS_DEFAULT_REGION"); region != "" && profile.Region == "" {
+		log.Printf("Using region %q from AWS_DEFAULT_REGION", region)
 		profile.Region = region
 	}
 
@@ -292,11 +505,66 @@ func (c *ConfigLoader) populateFromEnv(profile *Config) {
 		log.Printf("Using mfa_serial %q from AWS_MFA_SERIAL", mfaSerial)
 		profile.MfaSerial = mfaSerial
 	}
+
+	if roleARN := os.Getenv("AWS_ROLE_ARN"); roleARN != "" && profile.RoleARN == "" {
+		log.Printf("Using role_arn %q from AWS_ROLE_ARN", roleARN)
+		profile.RoleARN = roleARN
+	}
+
+	if sessionName := os.Getenv("AWS_ROLE_SESSION_NAME"); sessionName != "" && profile.RoleSessionName == "" {
+		log.Printf("Using role_session_name %q from AWS_ROLE_SESSION_NAME", sessionName)
+		profile.RoleSessionName = sessionName
+	}
+
+	if tokenFile := os.Getenv("AWS_WEB_IDENTITY_TOKEN_FILE"); tokenFile != "" && profile.WebIdentityTokenFile == "" {
+		log.Printf("Using web_identity_token_file %q from AWS_WEB_IDENTITY_TOKEN_FILE", tokenFile)
+		profile.WebIdentityTokenFile = tokenFile
+	}
+
+	if caBundle := os.Getenv("AWS_CA_BUNDLE"); caBundle != "" && profile.CABundle == "" {
+		log.Printf("Using ca_bundle %q from AWS_CA_BUNDLE", caBundle)
+		profile.CABundle = caBundle
+	}
+
+	if timeout := os.Getenv("AWS_VAULT_CONNECT_TIMEOUT"); timeout != "" && profile.ConnectTimeout == 0 {
+		d, err := parseTimeout(timeout)
+		if err != nil {
+			return fmt.Errorf("Invalid AWS_VAULT_CONNECT_TIMEOUT for profile '%s': %v", profile.ProfileName, err)
+		}
+		log.Printf("Using connect_timeout %s from AWS_VAULT_CONNECT_TIMEOUT", d)
+		profile.ConnectTimeout = d
+	}
+
+	if timeout := os.Getenv("AWS_VAULT_REQUEST_TIMEOUT"); timeout != "" && profile.RequestTimeout == 0 {
+		d, err := parseTimeout(timeout)
+		if err != nil {
+			return fmt.Errorf("Invalid AWS_VAULT_REQUEST_TIMEOUT for profile '%s': %v", profile.ProfileName, err)
+		}
+		log.Printf("Using request_timeout %s from AWS_VAULT_REQUEST_TIMEOUT", d)
+		profile.RequestTimeout = d
+	}
+
+	return nil
+}
+
+// parseTimeout parses a connect or request timeout, e.g. "30s"
+func parseTimeout(s string) (time.Duration, error) {
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, err
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("%q isn't a positive duration", s)
+	}
+	return d, nil
 }
 
+// LoadFromProfile populates the empty fields of config for the given profile
 func (c *ConfigLoader) LoadFromProfile(profileName string, config *Config) error {
 	config.ProfileName = profileName
-	c.populateFromEnv(config)
+	if err := c.populateFromEnv(config); err != nil {
+		return err
+	}
 
 	c.resetLoopDetection()
 	err := c.populateFromConfigFile(config, profileName)
@@ -306,11 +574,10 @@ func (c *ConfigLoader) LoadFromProfile(profileName string, config *Config) error
 
 	c.populateFromDefaults(config)
 
-	config.Validate()
-
-	return nil
+	return config.Validate()
 }
 
+// Config is everything needed to get credentials for a profile
 type Config struct {
 	ProfileName     string
 	CredentialsName string
@@ -321,26 +588,117 @@ type Config struct {
 	Region          string
 	RoleSessionName string
 
+	// MfaSerials are the MFA devices to choose from when no MfaSerial is set, MfaDevice picks one by name
+	MfaSerials []string
+	MfaDevice  string
+
 	SessionDuration    time.Duration
 	AssumeRoleDuration time.Duration
-	MfaToken           string
-	MfaPrompt          prompt.PromptFunc
-	NoSession          bool
+
+	// SessionExpirationWindow and RoleExpirationWindow are how long before session and role credentials
+	// expire that they are considered expired and refreshed
+	SessionExpirationWindow time.Duration
+	RoleExpirationWindow    time.Duration
+
+	MfaToken  string
+	MfaPrompt prompt.PromptFunc
+	NoSession bool
+
+	// NoSessionCache uses sessions and role credentials that are already cached, but doesn't cache new
+	// ones, for a keyring that can't be written to
+	NoSessionCache bool
+
+	// MfaProcess is a command whose output is the MFA token, e.g. `pass otp aws/work`
+	MfaProcess string
+
+	// MfaTokenProvider gets MFA tokens instead of MfaPrompt if it's set, e.g. from a YubiKey
+	MfaTokenProvider prompt.MfaPromptFunc
+
+	// PromptDriver names the driver in prompt.Methods or prompt.MfaMethods to use when neither MfaPrompt
+	// nor MfaTokenProvider is set
+	PromptDriver string
+
+	// MfaPromptTimeout is how long to wait for MfaPrompt or MfaTokenProvider before failing with a
+	// MfaPromptTimeoutError, zero waits forever
+	MfaPromptTimeout time.Duration
+
+	// AssumeRoleWithMfa skips GetSessionToken and passes the MFA token to AssumeRole, caching the role credentials
+	AssumeRoleWithMfa bool
+
+	// MfaDeviceSelector is used to choose an MFA device when STS requires MFA but no mfa_serial is configured
+	MfaDeviceSelector MfaDeviceSelector
+
+	// SourceCredentials, if set, are used to assume RoleARN instead of the stored credentials, e.g. those
+	// of an enclosing aws-vault session when chaining roles
+	SourceCredentials *credentials.Value
+
+	// AssumeRootTarget is a member account to create a root session in with sts:AssumeRoot, scoped to RootTaskPolicy
+	AssumeRootTarget string
+	RootTaskPolicy   string
+
+	// CABundle, HTTPSProxy, ConnectTimeout and RequestTimeout configure the HTTP client used for STS calls
+	CABundle       string
+	HTTPSProxy     string
+	ConnectTimeout time.Duration
+	RequestTimeout time.Duration
+
+	// WebIdentityTokenFile holds an OIDC token to assume RoleARN with, instead of using stored credentials
+	WebIdentityTokenFile string
+
+	// PostureHook is a command that checks the device before credentials are issued, see runPostureHook
+	PostureHook string
+
+	// EnvFormat is the set of environment variables exec puts credentials in, standard or legacy
+	EnvFormat string
+
+	// NoExport prevents credentials from being written out as text, only exec and server modes are allowed
+	NoExport bool
 }
 
+// Validate checks that the durations are within the limits STS allows, so that a clear error is
+// returned before calling STS rather than its ValidationError
 func (c *Config) Validate() error {
-	if c.SessionDuration < MinSessionDuration {
-		return errors.New("Minimum session duration is " + MinSessionDuration.String())
+	if c.SessionDuration < MinSessionDuration || c.SessionDuration > MaxSessionDuration {
+		return fmt.Errorf("Session duration %s must be between %s and %s, see --session-ttl",
+			c.SessionDuration, MinSessionDuration, MaxSessionDuration)
 	}
-	if c.SessionDuration > MaxSessionDuration {
-		return errors.New("Maximum session duration is " + MaxSessionDuration.String())
+	if c.AssumeRoleDuration < MinAssumeRoleDuration || c.AssumeRoleDuration > MaxAssumeRoleDuration {
+		return fmt.Errorf("Assumed role duration %s must be between %s and %s, see duration_seconds or --assume-role-ttl",
+			c.AssumeRoleDuration, MinAssumeRoleDuration, MaxAssumeRoleDuration)
 	}
-	if c.AssumeRoleDuration < MinAssumeRoleDuration {
-		return errors.New("Minimum duration for assumed roles is " + MinAssumeRoleDuration.String())
+	if c.chainsRole() && c.AssumeRoleDuration > MaxChainedAssumeRoleDuration {
+		return fmt.Errorf("Assumed role duration %s is longer than %s, the limit for a role assumed from a session. "+
+			"Use --no-session or assume_role_with_mfa to assume %s for longer", c.AssumeRoleDuration, MaxChainedAssumeRoleDuration, c.RoleARN)
 	}
-	if c.AssumeRoleDuration > MaxAssumeRoleDuration {
-		return errors.New("Maximum duration for assumed roles is " + MaxAssumeRoleDuration.String())
+	if isSecurityKeySerial(c.MfaSerial) {
+		return securityKeyError(c.MfaSerial)
+	}
+	for _, serial := range c.MfaSerials {
+		if isSecurityKeySerial(serial) {
+			return securityKeyError(serial)
+		}
+	}
+	if c.SessionExpirationWindow < 0 || c.SessionExpirationWindow >= c.SessionDuration {
+		return errors.New("Session expiration window must be shorter than the session duration of " + c.SessionDuration.String())
+	}
+	if c.RoleExpirationWindow < 0 || c.RoleExpirationWindow >= c.AssumeRoleDuration {
+		return errors.New("Role expiration window must be shorter than the assumed role duration of " + c.AssumeRoleDuration.String())
+	}
+	if c.PromptDriver != "" && prompt.Methods[c.PromptDriver] == nil && prompt.MfaMethods[c.PromptDriver] == nil {
+		return fmt.Errorf("Unknown prompt %q, must be one of %v", c.PromptDriver, prompt.Available())
+	}
+	if c.EnvFormat != "" && c.EnvFormat != "standard" && c.EnvFormat != "legacy" {
+		return fmt.Errorf("Unknown env_format %q, must be standard or legacy", c.EnvFormat)
 	}
 
 	return nil
 }
+
+// chainsRole returns whether the role is assumed with session credentials, from GetSessionToken or
+// SourceCredentials, which STS treats as role chaining
+func (c *Config) chainsRole() bool {
+	if c.SourceCredentials != nil {
+		return c.RoleARN != "" && c.SourceCredentials.SessionToken != ""
+	}
+	return c.RoleARN != "" && !c.NoSession && !c.AssumeRoleWithMfa && c.WebIdentityTokenFile == ""
+}
@@ -6,9 +6,12 @@ import (
 	"io/ioutil"
 	"os"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/99designs/aws-vault/vault"
+	"github.com/aws/aws-sdk-go/aws/credentials"
 )
 
 // see http://docs.aws.amazon.com/cli/latest/userguide/cli-multiple-profiles.html
@@ -245,4 +248,382 @@ func TestParentProfile(t *testing.T) {
 	if config.Region != "us-east-1" {
 		t.Fatalf("Expected CredentialsName name %q, got %q", "us-east-1", config.CredentialsName)
 	}
+	if chain := configLoader.ProfileChain(); !reflect.DeepEqual(chain, []string{"testparentprofile2", "testparentprofile1"}) {
+		t.Fatalf("Expected profile chain testparentprofile2, testparentprofile1, got %v", chain)
+	}
+}
+
+func TestSetProfileValue(t *testing.T) {
+	f := newConfigFile(t, exampleConfig)
+	defer os.Remove(f)
+
+	cfg, err := vault.LoadConfig(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = cfg.SetProfileValue("user2", "mfa_serial", "arn:aws:iam::1234513441:mfa/user2")
+	if err != nil {
+		t.Fatalf("Error setting profile value: %#v", err)
+	}
+
+	cfg, err = vault.LoadConfig(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	profile, ok := cfg.ProfileSection("user2")
+	if !ok {
+		t.Fatalf("Expected to find profile user2")
+	}
+	if profile.MfaSerial != "arn:aws:iam::1234513441:mfa/user2" {
+		t.Fatalf("Expected mfa_serial %q, got %q", "arn:aws:iam::1234513441:mfa/user2", profile.MfaSerial)
+	}
+	if profile.Region != "us-east-1" {
+		t.Fatalf("Expected region %q, got %q", "us-east-1", profile.Region)
+	}
+}
+
+func TestExpirationWindows(t *testing.T) {
+	f := newConfigFile(t, []byte(`[profile withwindow]
+role_arn=arn:aws:iam::123456789012:role/admin
+duration_seconds=3600
+role_expiration_window=10m
+`))
+	defer os.Remove(f)
+
+	configFile, err := vault.LoadConfig(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	configLoader := &vault.ConfigLoader{File: configFile}
+	config := vault.Config{}
+	if err = configLoader.LoadFromProfile("withwindow", &config); err != nil {
+		t.Fatal(err)
+	}
+
+	if config.RoleExpirationWindow != 10*time.Minute {
+		t.Fatalf("Expected RoleExpirationWindow %v, got %v", 10*time.Minute, config.RoleExpirationWindow)
+	}
+	if config.SessionExpirationWindow != vault.DefaultExpirationWindow {
+		t.Fatalf("Expected SessionExpirationWindow %v, got %v", vault.DefaultExpirationWindow, config.SessionExpirationWindow)
+	}
+}
+
+func TestMfaSerials(t *testing.T) {
+	f := newConfigFile(t, []byte(`[profile llamas]
+mfa_serials=arn:aws:iam::111111111111:mfa/phone, arn:aws:iam::111111111111:mfa/yubikey
+`))
+	defer os.Remove(f)
+
+	configFile, err := vault.LoadConfig(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	configLoader := &vault.ConfigLoader{File: configFile}
+	config := vault.Config{}
+	if err = configLoader.LoadFromProfile("llamas", &config); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"arn:aws:iam::111111111111:mfa/phone", "arn:aws:iam::111111111111:mfa/yubikey"}
+	if !reflect.DeepEqual(config.MfaSerials, expected) {
+		t.Fatalf("Expected MfaSerials %v, got %v", expected, config.MfaSerials)
+	}
+	if config.MfaSerial != "" {
+		t.Fatalf("Expected no MfaSerial until a device is chosen, got %q", config.MfaSerial)
+	}
+}
+
+func TestNoExport(t *testing.T) {
+	f := newConfigFile(t, []byte(`[profile locked]
+no_export = true
+[profile open]
+no_export = false
+[profile typo]
+no_export = yes!
+`))
+	defer os.Remove(f)
+
+	configFile, err := vault.LoadConfig(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	configLoader := &vault.ConfigLoader{File: configFile}
+
+	for profileName, expected := range map[string]bool{"locked": true, "open": false} {
+		config := vault.Config{}
+		if err = configLoader.LoadFromProfile(profileName, &config); err != nil {
+			t.Fatal(err)
+		}
+		if config.NoExport != expected {
+			t.Fatalf("Expected NoExport %v for profile %s, got %v", expected, profileName, config.NoExport)
+		}
+	}
+
+	err = configLoader.LoadFromProfile("typo", &vault.Config{})
+	if err == nil || !strings.Contains(err.Error(), "'typo'") {
+		t.Fatalf("Expected an error naming profile typo, got %v", err)
+	}
+}
+
+func TestInvalidTimeouts(t *testing.T) {
+	f := newConfigFile(t, []byte(`[profile slow]
+connect_timeout=10
+[profile negative]
+request_timeout=-5s
+`))
+	defer os.Remove(f)
+
+	configFile, err := vault.LoadConfig(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	configLoader := &vault.ConfigLoader{File: configFile}
+
+	for _, profileName := range []string{"slow", "negative"} {
+		err = configLoader.LoadFromProfile(profileName, &vault.Config{})
+		if err == nil || !strings.Contains(err.Error(), "'"+profileName+"'") {
+			t.Fatalf("Expected an error naming profile %s, got %v", profileName, err)
+		}
+	}
+
+	os.Setenv("AWS_VAULT_CONNECT_TIMEOUT", "soon")
+	defer os.Unsetenv("AWS_VAULT_CONNECT_TIMEOUT")
+	if err = configLoader.LoadFromProfile("ci", &vault.Config{}); err == nil || !strings.Contains(err.Error(), "AWS_VAULT_CONNECT_TIMEOUT") {
+		t.Fatalf("Expected an error about AWS_VAULT_CONNECT_TIMEOUT, got %v", err)
+	}
+}
+
+func TestWebIdentityFromEnv(t *testing.T) {
+	f := newConfigFile(t, []byte(``))
+	defer os.Remove(f)
+
+	os.Setenv("AWS_ROLE_ARN", "arn:aws:iam::123456789012:role/ci")
+	os.Setenv("AWS_WEB_IDENTITY_TOKEN_FILE", "/var/run/secrets/token")
+	defer os.Unsetenv("AWS_ROLE_ARN")
+	defer os.Unsetenv("AWS_WEB_IDENTITY_TOKEN_FILE")
+
+	configFile, err := vault.LoadConfig(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	configLoader := &vault.ConfigLoader{File: configFile}
+	config := vault.Config{}
+	if err = configLoader.LoadFromProfile("ci", &config); err != nil {
+		t.Fatal(err)
+	}
+
+	if config.RoleARN != "arn:aws:iam::123456789012:role/ci" {
+		t.Fatalf("Expected RoleARN from AWS_ROLE_ARN, got %q", config.RoleARN)
+	}
+	if config.WebIdentityTokenFile != "/var/run/secrets/token" {
+		t.Fatalf("Expected WebIdentityTokenFile from AWS_WEB_IDENTITY_TOKEN_FILE, got %q", config.WebIdentityTokenFile)
+	}
+}
+
+func TestValidateDurations(t *testing.T) {
+	var testCases = []struct {
+		Config vault.Config
+		Valid  bool
+	}{
+		{vault.Config{SessionDuration: time.Hour, AssumeRoleDuration: time.Hour}, true},
+		{vault.Config{SessionDuration: 37 * time.Hour, AssumeRoleDuration: time.Hour}, false},
+		{vault.Config{SessionDuration: time.Hour, AssumeRoleDuration: 5 * time.Minute}, false},
+		{vault.Config{SessionDuration: time.Hour, AssumeRoleDuration: 13 * time.Hour}, false},
+		{vault.Config{SessionDuration: time.Hour, AssumeRoleDuration: 2 * time.Hour, RoleARN: "arn:aws:iam::123456789012:role/admin"}, false},
+		{vault.Config{SessionDuration: time.Hour, AssumeRoleDuration: 2 * time.Hour, RoleARN: "arn:aws:iam::123456789012:role/admin", NoSession: true}, true},
+		{vault.Config{SessionDuration: time.Hour, AssumeRoleDuration: 2 * time.Hour, RoleARN: "arn:aws:iam::123456789012:role/admin", AssumeRoleWithMfa: true}, true},
+		{vault.Config{SessionDuration: time.Hour, AssumeRoleDuration: time.Hour, MfaSerial: "arn:aws:iam::123456789012:u2f/user/jonsmith/yubikey-ABCDEF"}, false},
+		{vault.Config{SessionDuration: time.Hour, AssumeRoleDuration: 2 * time.Hour, RoleARN: "arn:aws:iam::123456789012:role/admin", NoSession: true, SourceCredentials: &credentials.Value{SessionToken: "token"}}, false},
+		{vault.Config{SessionDuration: time.Hour, AssumeRoleDuration: 2 * time.Hour, RoleARN: "arn:aws:iam::123456789012:role/admin", SourceCredentials: &credentials.Value{}}, true},
+	}
+
+	for _, tc := range testCases {
+		err := tc.Config.Validate()
+		if tc.Valid && err != nil {
+			t.Fatalf("Expected %+v to be valid, got %v", tc.Config, err)
+		} else if !tc.Valid && err == nil {
+			t.Fatalf("Expected %+v to be invalid", tc.Config)
+		}
+	}
+}
+
+func TestSharedSourceProfile(t *testing.T) {
+	f := newConfigFile(t, []byte(`[profile company]
+source_profile=company-base
+region=eu-west-1
+
+[profile company-dev]
+parent_profile=company
+
+[profile company-audit]
+parent_profile=company
+source_profile=auditor
+`))
+	defer os.Remove(f)
+
+	configFile, err := vault.LoadConfig(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	configLoader := &vault.ConfigLoader{File: configFile}
+	for profileName, credentialsName := range map[string]string{
+		"company":       "company-base",
+		"company-dev":   "company-base",
+		"company-audit": "auditor",
+	} {
+		config := vault.Config{}
+		if err = configLoader.LoadFromProfile(profileName, &config); err != nil {
+			t.Fatal(err)
+		}
+		if config.CredentialsName != credentialsName {
+			t.Fatalf("Expected CredentialsName %q for %s, got %q", credentialsName, profileName, config.CredentialsName)
+		}
+	}
+}
+
+func TestProfilePrompt(t *testing.T) {
+	f := newConfigFile(t, []byte(`[profile work]
+prompt=osascript
+
+[profile work-admin]
+parent_profile=work
+
+[profile personal]
+`))
+	defer os.Remove(f)
+
+	configFile, err := vault.LoadConfig(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	configLoader := &vault.ConfigLoader{File: configFile}
+	for _, tc := range []struct {
+		profileName, flag, expected string
+	}{
+		{"work", "", "osascript"},
+		{"work-admin", "", "osascript"},
+		{"personal", "", "terminal"},
+		{"work", "zenity", "zenity"},
+	} {
+		config := vault.Config{PromptDriver: tc.flag}
+		if err = configLoader.LoadFromProfile(tc.profileName, &config); err != nil {
+			t.Fatal(err)
+		}
+		if config.PromptDriver != tc.expected {
+			t.Fatalf("Expected prompt %q for %s, got %q", tc.expected, tc.profileName, config.PromptDriver)
+		}
+	}
+}
+
+func TestVaultSections(t *testing.T) {
+	f := newConfigFile(t, []byte(`[profile work]
+region=us-east-1
+
+[vault personal]
+backend=file
+file_dir=~/personal/keys
+
+[default]
+region=us-west-2
+`))
+	defer os.Remove(f)
+
+	configFile, err := vault.LoadConfig(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if names := configFile.ProfileNames(); !reflect.DeepEqual(names, []string{"work", "default"}) {
+		t.Fatalf("Expected profiles work and default, got %v", names)
+	}
+	if names := configFile.VaultNames(); !reflect.DeepEqual(names, []string{"personal"}) {
+		t.Fatalf("Expected vault personal, got %v", names)
+	}
+
+	v, ok := configFile.VaultSection("personal")
+	if !ok {
+		t.Fatal("Expected vault personal to exist")
+	}
+	expected := vault.VaultSection{Name: "personal", Backend: "file", FileDir: "~/personal/keys"}
+	if v != expected {
+		t.Fatalf("Expected %+v, got %+v", expected, v)
+	}
+
+	if _, ok = configFile.VaultSection("work"); ok {
+		t.Fatal("Expected no vault work")
+	}
+}
+
+func TestRegionPrecedence(t *testing.T) {
+	f := newConfigFile(t, []byte("[profile work]\nregion = eu-west-1\n"))
+	defer os.Remove(f)
+
+	configFile, err := vault.LoadConfig(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	configLoader := &vault.ConfigLoader{File: configFile}
+
+	var testCases = []struct {
+		Flag, Region, DefaultRegion string
+		Expected                    string
+	}{
+		{"", "", "", "eu-west-1"},
+		{"", "", "us-west-2", "us-west-2"},
+		{"", "ap-southeast-2", "us-west-2", "ap-southeast-2"},
+		{"ca-central-1", "ap-southeast-2", "us-west-2", "ca-central-1"},
+	}
+
+	defer os.Unsetenv("AWS_REGION")
+	defer os.Unsetenv("AWS_DEFAULT_REGION")
+
+	for _, tc := range testCases {
+		os.Setenv("AWS_REGION", tc.Region)
+		os.Setenv("AWS_DEFAULT_REGION", tc.DefaultRegion)
+
+		config := vault.Config{Region: tc.Flag}
+		if err = configLoader.LoadFromProfile("work", &config); err != nil {
+			t.Fatal(err)
+		}
+		if config.Region != tc.Expected {
+			t.Fatalf("Expected region %q with flag %q, AWS_REGION %q and AWS_DEFAULT_REGION %q, got %q",
+				tc.Expected, tc.Flag, tc.Region, tc.DefaultRegion, config.Region)
+		}
+	}
+}
+
+func TestResolveAlias(t *testing.T) {
+	f := newConfigFile(t, []byte(`[profile acme-production-admin]
+alias = prod, prod-admin
+
+[profile prod-readonly]
+alias = prod
+`))
+	defer os.Remove(f)
+
+	configFile, err := vault.LoadConfig(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var testCases = []struct {
+		name     string
+		expected string
+	}{
+		{"prod", "acme-production-admin"},
+		{"prod-admin", "acme-production-admin"},
+		{"prod-readonly", "prod-readonly"},
+		{"staging", "staging"},
+	}
+	for _, tc := range testCases {
+		if profile := configFile.ResolveAlias(tc.name); profile != tc.expected {
+			t.Errorf("Expected %s to resolve to %s, got %s", tc.name, tc.expected, profile)
+		}
+	}
 }
@@ -0,0 +1,108 @@
+package vault
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mitchellh/go-homedir"
+	ini "gopkg.in/ini.v1"
+)
+
+// SharedCredentials are the keys of a profile in the plaintext shared credentials file
+type SharedCredentials struct {
+	ProfileName     string
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+}
+
+// SharedCredentialsPath returns either $AWS_SHARED_CREDENTIALS_FILE or ~/.aws/credentials
+func SharedCredentialsPath() (string, error) {
+	file := os.Getenv("AWS_SHARED_CREDENTIALS_FILE")
+	if file == "" {
+		home, err := homedir.Dir()
+		if err != nil {
+			return "", err
+		}
+		file = filepath.Join(home, "/.aws/credentials")
+	} else {
+		log.Printf("Using AWS_SHARED_CREDENTIALS_FILE value: %s", file)
+	}
+	return file, nil
+}
+
+// LoadSharedCredentials reads the profiles of a shared credentials file that have an access key
+func LoadSharedCredentials(path string) ([]SharedCredentials, error) {
+	f, err := ini.Load(path)
+	if err != nil {
+		return nil, fmt.Errorf("Error parsing credentials file %q: %v", path, err)
+	}
+
+	var result []SharedCredentials
+	for _, section := range f.Sections() {
+		if !section.HasKey("aws_access_key_id") {
+			continue
+		}
+		result = append(result, SharedCredentials{
+			ProfileName:     section.Name(),
+			AccessKeyID:     section.Key("aws_access_key_id").String(),
+			SecretAccessKey: section.Key("aws_secret_access_key").String(),
+			SessionToken:    section.Key("aws_session_token").String(),
+		})
+	}
+	return result, nil
+}
+
+// CommentOutSharedCredentials comments out the sections of the given profiles in a shared credentials file,
+// so that their keys aren't used or left readable but can still be restored by hand
+func CommentOutSharedCredentials(path string, profileNames []string) error {
+	stat, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	lines := strings.SplitAfter(string(b), "\n")
+	inProfile := false
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "[") && strings.HasSuffix(trimmed, "]") {
+			name := strings.TrimSpace(strings.Trim(trimmed, "[]"))
+			inProfile = false
+			for _, profileName := range profileNames {
+				if name == profileName {
+					inProfile = true
+				}
+			}
+		}
+		if inProfile && trimmed != "" && !strings.HasPrefix(trimmed, "#") && !strings.HasPrefix(trimmed, ";") {
+			lines[i] = "# " + line
+		}
+	}
+
+	f, err := ioutil.TempFile(filepath.Dir(path), ".credentials-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err = f.WriteString(strings.Join(lines, "")); err != nil {
+		f.Close()
+		return err
+	}
+	if err = f.Chmod(stat.Mode().Perm()); err != nil {
+		f.Close()
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
@@ -0,0 +1,95 @@
+package vault_test
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/99designs/aws-vault/vault"
+)
+
+var sharedCredentials = []byte(`# my keys
+[default]
+aws_access_key_id = AKIADEFAULT
+aws_secret_access_key = default-secret
+
+[work]
+; from the console
+aws_access_key_id=AKIAWORK
+aws_secret_access_key=work-secret
+
+[temp]
+aws_access_key_id = ASIATEMP
+aws_secret_access_key = temp-secret
+aws_session_token = temp-token
+
+[empty]
+region = us-east-1
+`)
+
+func TestLoadSharedCredentials(t *testing.T) {
+	f := newConfigFile(t, sharedCredentials)
+	defer os.Remove(f)
+
+	creds, err := vault.LoadSharedCredentials(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []vault.SharedCredentials{
+		{ProfileName: "default", AccessKeyID: "AKIADEFAULT", SecretAccessKey: "default-secret"},
+		{ProfileName: "work", AccessKeyID: "AKIAWORK", SecretAccessKey: "work-secret"},
+		{ProfileName: "temp", AccessKeyID: "ASIATEMP", SecretAccessKey: "temp-secret", SessionToken: "temp-token"},
+	}
+	if len(creds) != len(expected) {
+		t.Fatalf("Expected %d profiles, got %#v", len(expected), creds)
+	}
+	for i := range expected {
+		if creds[i] != expected[i] {
+			t.Fatalf("Expected %#v, got %#v", expected[i], creds[i])
+		}
+	}
+}
+
+func TestCommentOutSharedCredentials(t *testing.T) {
+	f := newConfigFile(t, sharedCredentials)
+	defer os.Remove(f)
+
+	if err := vault.CommentOutSharedCredentials(f, []string{"default", "work"}); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := ioutil.ReadFile(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `# my keys
+# [default]
+# aws_access_key_id = AKIADEFAULT
+# aws_secret_access_key = default-secret
+
+# [work]
+; from the console
+# aws_access_key_id=AKIAWORK
+# aws_secret_access_key=work-secret
+
+[temp]
+aws_access_key_id = ASIATEMP
+aws_secret_access_key = temp-secret
+aws_session_token = temp-token
+
+[empty]
+region = us-east-1
+`
+	if string(b) != expected {
+		t.Fatalf("Unexpected credentials file:\n%s", b)
+	}
+
+	creds, err := vault.LoadSharedCredentials(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(creds) != 1 || creds[0].ProfileName != "temp" {
+		t.Fatalf("Expected only temp to be left, got %#v", creds)
+	}
+}
@@ -0,0 +1,12 @@
+// Package vault is the credential logic behind the aws-vault command, usable by other Go programs
+// that want aws-vault's credentials without shelling out to the binary.
+//
+// Master credentials are kept in a Storage, which any keyring.Keyring satisfies. A Config for a
+// profile is loaded from ~/.aws/config with a ConfigLoader, and NewTempCredentials turns the two
+// into session or role credentials, caching sessions in the same Storage. MFA tokens are asked for
+// with Config.MfaPrompt, see the prompt package for the drivers aws-vault uses.
+//
+// The exported identifiers of this package and the prompt package follow semantic versioning:
+// they won't be removed or change signature outside of a major release. Fields may be added to
+// Config, so construct it with field names.
+package vault
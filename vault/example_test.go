@@ -0,0 +1,48 @@
+package vault_test
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/99designs/aws-vault/prompt"
+	"github.com/99designs/aws-vault/vault"
+	"github.com/99designs/keyring"
+)
+
+func ExampleNewProfileCredentials() {
+	k, err := keyring.Open(keyring.Config{ServiceName: "aws-vault"})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	creds, err := vault.NewProfileCredentials(k, "work", prompt.TerminalPrompt)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	val, err := creds.Get()
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println(val.AccessKeyID)
+}
+
+func ExampleNewSigningTransport() {
+	k, err := keyring.Open(keyring.Config{ServiceName: "aws-vault"})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	creds, err := vault.NewProfileCredentials(k, "work", prompt.TerminalPrompt)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	client := &http.Client{Transport: vault.NewSigningTransport(creds, "us-east-1", "execute-api")}
+	resp, err := client.Get("https://abc123.execute-api.us-east-1.amazonaws.com/prod/pets")
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println(resp.Status)
+}
@@ -0,0 +1,61 @@
+package vault
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/99designs/keyring"
+)
+
+const (
+	externalIDEnvPrefix     = "env:"
+	externalIDKeyringPrefix = "keyring://"
+	externalIDKeyPrefix     = "external-id,"
+)
+
+// IsExternalIDKey returns whether a keyring key holds an external id rather than credentials
+func IsExternalIDKey(s string) bool {
+	return strings.HasPrefix(s, externalIDKeyPrefix)
+}
+
+// StoreExternalID stores an external id in the keyring, so that config can reference it as keyring://name
+func StoreExternalID(k Storage, name string, externalID string) error {
+	return k.Set(keyring.Item{
+		Key:   externalIDKeyPrefix + name,
+		Label: fmt.Sprintf("aws-vault external id (%s)", name),
+		Data:  []byte(externalID),
+
+		// specific Keychain settings
+		KeychainNotTrustApplication: true,
+	})
+}
+
+// resolveExternalID returns the external id for an external_id config value, which is either a
+// literal, env:NAME to read it from the environment or keyring://name to read it from the keyring
+func resolveExternalID(k Storage, ref string) (string, error) {
+	switch {
+	case strings.HasPrefix(ref, externalIDEnvPrefix):
+		name := strings.TrimPrefix(ref, externalIDEnvPrefix)
+		externalID := os.Getenv(name)
+		if externalID == "" {
+			return "", fmt.Errorf("external_id refers to $%s, which isn't set", name)
+		}
+		log.Printf("Using external_id from $%s", name)
+		return externalID, nil
+
+	case strings.HasPrefix(ref, externalIDKeyringPrefix):
+		name := strings.TrimPrefix(ref, externalIDKeyringPrefix)
+		item, err := k.Get(externalIDKeyPrefix + name)
+		if err == keyring.ErrKeyNotFound {
+			return "", fmt.Errorf("external_id refers to %q, which isn't in the keyring. Add it with `aws-vault add --external-id %s`", name, name)
+		} else if err != nil {
+			return "", err
+		}
+		log.Printf("Using external_id %q from keyring", name)
+		return string(item.Data), nil
+	}
+
+	return ref, nil
+}
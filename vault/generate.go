@@ -0,0 +1,45 @@
+package vault
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/aws/aws-sdk-go/aws/credentials"
+)
+
+// GenerateAccessKey creates an access key for the IAM user userName with the credentials of config, e.g. of a
+// profile assuming an admin role. Without a userName it's created for the user the credentials belong to.
+// The key is returned along with the user it was created for, and a func deleting it again for when it can't be
+// stored
+func GenerateAccessKey(k Storage, config *Config, userName string) (credentials.Value, string, func() error, error) {
+	creds, err := NewTempCredentials(k, config)
+	if err != nil {
+		return credentials.Value{}, "", nil, err
+	}
+	client, err := newStsClient(creds, config)
+	if err != nil {
+		return credentials.Value{}, "", nil, err
+	}
+
+	if userName == "" {
+		if userName, err = GetUsername(client); err != nil {
+			return credentials.Value{}, "", nil, fmt.Errorf("Can't find the IAM user of profile %s, choose one to create an access key for: %v", config.ProfileName, err)
+		}
+	}
+
+	log.Printf("Creating access key for IAM user %s with profile %s", userName, config.ProfileName)
+	key, err := client.CreateAccessKey(userName)
+	if err != nil {
+		return credentials.Value{}, userName, nil, err
+	}
+
+	deleteKey := func() error {
+		log.Printf("Deleting access key %s of IAM user %s", key.AccessKeyId, userName)
+		return client.DeleteAccessKey(key.AccessKeyId, userName)
+	}
+
+	return credentials.Value{
+		AccessKeyID:     key.AccessKeyId,
+		SecretAccessKey: key.SecretAccessKey,
+	}, userName, deleteKey, nil
+}
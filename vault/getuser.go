@@ -5,15 +5,14 @@ import (
 	"regexp"
 	"strings"
 
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/99designs/aws-vault/stsclient"
 )
 
 var getUserErrorRegexp = regexp.MustCompile(`^AccessDenied: User: arn:aws:iam::(\d+):user/(.+) is not`)
 
-// GetUsernameFromSession returns the IAM username (or root) associated with the current aws session
-func GetUsernameFromSession(sess *session.Session) (string, error) {
-	resp, err := iam.New(sess).GetUser(&iam.GetUserInput{})
+// GetUsername returns the IAM username (or root) associated with the client's credentials
+func GetUsername(client *stsclient.Client) (string, error) {
+	user, err := client.GetUser()
 	if err != nil {
 		// Even if GetUser fails, the current user is included in the error. This happens when you have o IAM permissions
 		// on the master credentials, but have permission to use assumeRole later
@@ -26,12 +25,12 @@ func GetUsernameFromSession(sess *session.Session) (string, error) {
 		return "", err
 	}
 
-	if resp.User.UserName != nil {
-		return *resp.User.UserName, nil
+	if user.UserName != "" {
+		return user.UserName, nil
 	}
 
-	if resp.User.Arn != nil {
-		arnParts := strings.Split(*resp.User.Arn, ":")
+	if user.Arn != "" {
+		arnParts := strings.Split(user.Arn, ":")
 		return arnParts[len(arnParts)-1], nil
 	}
 
@@ -0,0 +1,55 @@
+package vault
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// Messages is where informational messages are written, such as that aws-vault is waiting for another
+// process. Set it to ioutil.Discard to silence them
+var Messages io.Writer = os.Stderr
+
+// lockSessionCreation serialises creating a session across aws-vault processes, so that when several
+// start at once (e.g. terragrunt run-all) one prompts for MFA and stores the session, and the others
+// wait and then reuse it. key identifies the session, the returned func releases the lock
+func lockSessionCreation(profileName string, key string) (func(), error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return nil, err
+	}
+	dir = filepath.Join(dir, "aws-vault", "locks")
+	if err = os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+
+	sum := sha256.Sum256([]byte(key))
+	path := filepath.Join(dir, hex.EncodeToString(sum[:8])+".lock")
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	locked, err := tryLockFile(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if !locked {
+		fmt.Fprintf(Messages, "Waiting for another aws-vault process to create a session for %s\n", profileName)
+		if err = lockFile(f); err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+	log.Printf("Acquired session lock %s", path)
+
+	return func() {
+		unlockFile(f)
+		f.Close()
+	}, nil
+}
@@ -5,48 +5,61 @@ import (
 	"fmt"
 	"log"
 
+	"github.com/99designs/aws-vault/logging"
 	"github.com/99designs/keyring"
 	"github.com/aws/aws-sdk-go/aws/credentials"
 )
 
-func NewMasterCredentials(k keyring.Keyring, credentialsName string) *credentials.Credentials {
+// IsCredentialsKey returns whether a keyring key holds master credentials, rather than a session or one of
+// the other items aws-vault keeps alongside them
+func IsCredentialsKey(s string) bool {
+	return !IsSessionKey(s) && !IsTotpKey(s) && !IsExternalIDKey(s) && !IsMetadataKey(s)
+}
+
+// NewMasterCredentials returns the long-term credentials stored under credentialsName
+func NewMasterCredentials(k Storage, credentialsName string) *credentials.Credentials {
 	return credentials.NewCredentials(NewMasterCredentialsProvider(k, credentialsName))
 }
 
-func NewMasterCredentialsProvider(k keyring.Keyring, credentialsName string) *MasterCredentialsProvider {
+// NewMasterCredentialsProvider returns a provider for the long-term credentials stored under credentialsName
+func NewMasterCredentialsProvider(k Storage, credentialsName string) *MasterCredentialsProvider {
 	return &MasterCredentialsProvider{k, credentialsName}
 }
 
 // MasterCredentialsProvider stores and retrieves master credentials
 type MasterCredentialsProvider struct {
-	keyring         keyring.Keyring
+	keyring         Storage
 	credentialsName string
 }
 
+// IsExpired always returns false, master credentials don't expire
 func (p *MasterCredentialsProvider) IsExpired() bool {
 	return false
 }
 
+// Retrieve reads the credentials from storage
 func (p *MasterCredentialsProvider) Retrieve() (val credentials.Value, err error) {
 	log.Printf("Looking up keyring for %s", p.credentialsName)
 	item, err := p.keyring.Get(p.credentialsName)
 	if err != nil {
-		log.Println("Error from keyring", err)
+		logging.Warnf("Error from keyring: %v", err)
 		return val, err
 	}
 	if err = json.Unmarshal(item.Data, &val); err != nil {
 		return val, fmt.Errorf("Invalid data in keyring: %v", err)
 	}
+	recordUsed(p.keyring, p.credentialsName, val.AccessKeyID)
 	return val, err
 }
 
+// Store writes the credentials to storage
 func (p *MasterCredentialsProvider) Store(val credentials.Value) error {
 	bytes, err := json.Marshal(val)
 	if err != nil {
 		return err
 	}
 
-	return p.keyring.Set(keyring.Item{
+	err = p.keyring.Set(keyring.Item{
 		Key:   p.credentialsName,
 		Label: fmt.Sprintf("aws-vault (%s)", p.credentialsName),
 		Data:  bytes,
@@ -54,8 +67,17 @@ func (p *MasterCredentialsProvider) Store(val credentials.Value) error {
 		// specific Keychain settings
 		KeychainNotTrustApplication: true,
 	})
+	if err != nil {
+		return err
+	}
+	recordStored(p.keyring, p.credentialsName, val.AccessKeyID)
+	return nil
 }
 
+// Delete removes the credentials, and their metadata, from storage
 func (p *MasterCredentialsProvider) Delete() error {
+	if err := p.keyring.Remove(metadataKeyPrefix + p.credentialsName); err != nil && err != keyring.ErrKeyNotFound {
+		logging.Warnf("Failed to remove metadata for %s: %v", p.credentialsName, err)
+	}
 	return p.keyring.Remove(p.credentialsName)
 }
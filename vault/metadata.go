@@ -0,0 +1,108 @@
+package vault
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/99designs/aws-vault/logging"
+	"github.com/99designs/keyring"
+)
+
+const metadataKeyPrefix = "metadata,"
+
+// CredentialsMetadata is kept alongside master credentials, so that stale access keys and their use can
+// be seen without digging through CloudTrail
+type CredentialsMetadata struct {
+	AccessKeyID string    `json:"access_key_id"`
+	Created     time.Time `json:"created"`
+	LastUsed    time.Time `json:"last_used"` // only updated once a day
+	LastRotated time.Time `json:"last_rotated"`
+}
+
+// KeyCreated returns when the current access key was stored, by adding or rotating the credentials
+func (m CredentialsMetadata) KeyCreated() time.Time {
+	if m.LastRotated.After(m.Created) {
+		return m.LastRotated
+	}
+	return m.Created
+}
+
+// IsMetadataKey returns whether a keyring key holds the metadata of credentials rather than credentials
+func IsMetadataKey(s string) bool {
+	return strings.HasPrefix(s, metadataKeyPrefix)
+}
+
+// LoadCredentialsMetadata returns the metadata of the credentials stored under credentialsName, and false
+// if there isn't any, e.g. for credentials added before metadata was kept
+func LoadCredentialsMetadata(k Storage, credentialsName string) (CredentialsMetadata, bool, error) {
+	var m CredentialsMetadata
+	item, err := k.Get(metadataKeyPrefix + credentialsName)
+	if err == keyring.ErrKeyNotFound {
+		return m, false, nil
+	} else if err != nil {
+		return m, false, err
+	}
+	if err = json.Unmarshal(item.Data, &m); err != nil {
+		return m, false, fmt.Errorf("Invalid metadata for %s: %v", credentialsName, err)
+	}
+	return m, true, nil
+}
+
+func storeCredentialsMetadata(k Storage, credentialsName string, m CredentialsMetadata) error {
+	b, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	return k.Set(keyring.Item{
+		Key:   metadataKeyPrefix + credentialsName,
+		Label: fmt.Sprintf("aws-vault metadata (%s)", credentialsName),
+		Data:  b,
+	})
+}
+
+// recordStored updates the metadata when credentials are stored. A different access key than before
+// means the credentials were rotated
+func recordStored(k Storage, credentialsName string, accessKeyID string) {
+	now := time.Now().UTC()
+	m, ok, err := LoadCredentialsMetadata(k, credentialsName)
+	if err != nil {
+		logging.Warnf("Replacing metadata for %s: %v", credentialsName, err)
+	}
+	if !ok || err != nil {
+		m = CredentialsMetadata{Created: now}
+	} else if m.AccessKeyID != accessKeyID {
+		m.LastRotated = now
+	}
+	m.AccessKeyID = accessKeyID
+
+	if err = storeCredentialsMetadata(k, credentialsName, m); err != nil {
+		logging.Warnf("Failed to store metadata for %s: %v", credentialsName, err)
+	}
+}
+
+// recordUsed updates when credentials were last used. It's only written when the day changes, so that using
+// credentials doesn't write to the backend each time, which can mean unlocking or syncing it
+func recordUsed(k Storage, credentialsName string, accessKeyID string) {
+	now := time.Now().UTC()
+	m, ok, err := LoadCredentialsMetadata(k, credentialsName)
+	if err != nil {
+		logging.Warnf("Failed to load metadata for %s: %v", credentialsName, err)
+		return
+	}
+	if !ok {
+		m.AccessKeyID = accessKeyID
+	} else if sameDay(m.LastUsed, now) {
+		return
+	}
+	m.LastUsed = now
+
+	if err = storeCredentialsMetadata(k, credentialsName, m); err != nil {
+		logging.Warnf("Failed to store metadata for %s: %v", credentialsName, err)
+	}
+}
+
+func sameDay(a, b time.Time) bool {
+	return a.UTC().Format("2006-01-02") == b.UTC().Format("2006-01-02")
+}
@@ -0,0 +1,74 @@
+package vault_test
+
+import (
+	"testing"
+
+	"github.com/99designs/aws-vault/vault"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+)
+
+func TestCredentialsMetadata(t *testing.T) {
+	storage := mapStorage{}
+	provider := vault.NewMasterCredentialsProvider(storage, "work")
+
+	if err := provider.Store(credentials.Value{AccessKeyID: "ABC", SecretAccessKey: "XYZ"}); err != nil {
+		t.Fatal(err)
+	}
+	m, ok, err := vault.LoadCredentialsMetadata(storage, "work")
+	if err != nil || !ok {
+		t.Fatalf("Expected metadata to be stored, got %v", err)
+	}
+	if m.AccessKeyID != "ABC" || m.Created.IsZero() || !m.LastRotated.IsZero() || !m.LastUsed.IsZero() {
+		t.Fatalf("Expected only the key and when it was added, got %+v", m)
+	}
+
+	if _, err = provider.Retrieve(); err != nil {
+		t.Fatal(err)
+	}
+	if m, _, _ = vault.LoadCredentialsMetadata(storage, "work"); m.LastUsed.IsZero() {
+		t.Fatalf("Expected the last use to be recorded, got %+v", m)
+	}
+	lastUsed := m.LastUsed
+	if _, err = provider.Retrieve(); err != nil {
+		t.Fatal(err)
+	}
+	if m, _, _ = vault.LoadCredentialsMetadata(storage, "work"); !m.LastUsed.Equal(lastUsed) {
+		t.Fatalf("Expected the last use to only be recorded once a day, got %v then %v", lastUsed, m.LastUsed)
+	}
+
+	if err = provider.Store(credentials.Value{AccessKeyID: "DEF", SecretAccessKey: "UVW"}); err != nil {
+		t.Fatal(err)
+	}
+	if m, _, _ = vault.LoadCredentialsMetadata(storage, "work"); m.AccessKeyID != "DEF" || m.LastRotated.IsZero() {
+		t.Fatalf("Expected a new key to be recorded as a rotation, got %+v", m)
+	}
+	if m.KeyCreated() != m.LastRotated {
+		t.Fatalf("Expected the key to have been created when rotated, got %v", m.KeyCreated())
+	}
+
+	if err = provider.Delete(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, _ = vault.LoadCredentialsMetadata(storage, "work"); ok {
+		t.Fatal("Expected the metadata to be removed with the credentials")
+	}
+}
+
+func TestIsCredentialsKey(t *testing.T) {
+	var testCases = []struct {
+		Key           string
+		IsCredentials bool
+	}{
+		{"work", true},
+		{"session,c2Vzc2lvbg,,1572281751", false},
+		{vault.TotpKey("arn:aws:iam::123456789012:mfa/me"), false},
+		{"external-id,work", false},
+		{"metadata,work", false},
+	}
+
+	for _, tc := range testCases {
+		if vault.IsCredentialsKey(tc.Key) != tc.IsCredentials {
+			t.Fatalf("Expected IsCredentialsKey(%q) to be %v", tc.Key, tc.IsCredentials)
+		}
+	}
+}
@@ -0,0 +1,343 @@
+package vault
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/99designs/aws-vault/prompt"
+	"github.com/99designs/aws-vault/telemetry"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+)
+
+// MaxMfaAttempts is how many times an MFA token is asked for when STS rejects it
+const MaxMfaAttempts = 3
+
+var mfaRequiredMessagePattern = regexp.MustCompile(`(?i)multi-?factor|\bmfa\b`)
+
+// MfaDeviceSelector chooses one of the MFA device serials for the current IAM user. discovered is true
+// when the serials were looked up via IAM rather than configured with mfa_serials
+type MfaDeviceSelector func(serials []string, discovered bool) (string, error)
+
+// isMfaRequiredError returns whether an STS error indicates that the call needs MFA
+func isMfaRequiredError(err error) bool {
+	if awsErr, ok := err.(awserr.Error); ok && awsErr.Code() == "AccessDenied" {
+		return mfaRequiredMessagePattern.MatchString(awsErr.Message())
+	}
+	return false
+}
+
+// isInvalidMfaTokenError returns whether STS rejected the MFA token, usually because it was mistyped or
+// rolled over while being entered
+func isInvalidMfaTokenError(err error) bool {
+	if awsErr, ok := err.(awserr.Error); ok && awsErr.Code() == "AccessDenied" {
+		return strings.Contains(awsErr.Message(), "invalid MFA one time pass code") ||
+			strings.Contains(awsErr.Message(), "unable to validate MFA code")
+	}
+	return false
+}
+
+// isAssumeRoleDeniedError returns whether an error is an AssumeRole access denied error. When a role's
+// trust policy requires MFA, this is all STS reports, so it's worth retrying with an MFA device
+func isAssumeRoleDeniedError(err error) bool {
+	if awsErr, ok := err.(awserr.Error); ok && awsErr.Code() == "AccessDenied" {
+		return strings.Contains(awsErr.Message(), "not authorized to perform: sts:AssumeRole")
+	}
+	return false
+}
+
+// IsMfaError returns whether err is because STS needs an MFA token that wasn't given, the token was
+// rejected, or none was entered in time
+func IsMfaError(err error) bool {
+	if _, ok := err.(*MfaPromptTimeoutError); ok {
+		return true
+	}
+	return isMfaRequiredError(err) || isInvalidMfaTokenError(err)
+}
+
+// IsAccessDeniedError returns whether AWS denied the request
+func IsAccessDeniedError(err error) bool {
+	awsErr, ok := err.(awserr.Error)
+	return ok && awsErr.Code() == "AccessDenied"
+}
+
+// isSecurityKeySerial returns whether an MFA serial is a FIDO security key. AWS only accepts these when
+// signing in to the console with a password, STS needs a TOTP code from a virtual or hardware device
+func isSecurityKeySerial(serial string) bool {
+	return strings.Contains(serial, ":u2f/")
+}
+
+// securityKeyError explains that a FIDO security key can't be used for MFA with aws-vault
+func securityKeyError(serial string) error {
+	return fmt.Errorf("%s is a FIDO security key, which AWS only accepts for console sign-in with a password. "+
+		"aws-vault gets credentials (and console logins) from STS, which needs a TOTP code, so register a virtual or hardware TOTP MFA device and use it as mfa_serial", serial)
+}
+
+// mfaToken returns a token for the MFA device, either given with MfaToken, one got moments ago for the same
+// device, or a new one. reason says what the token is for. repeats is whether getting another one before the
+// next TOTP step would give the same token again, as it does when it's reused or generated
+func (p *TempCredentialsProvider) mfaToken(reason string) (token string, repeats bool, err error) {
+	if p.config.MfaToken != "" {
+		return p.config.MfaToken, true, nil
+	}
+	if token, ok := recentMfaToken(p.config.MfaSerial); ok {
+		log.Printf("Reusing the token got for %s moments ago", p.config.MfaSerial)
+		return token, true, nil
+	}
+
+	span := telemetry.Start("mfa.token", map[string]string{"mfa.serial": p.config.MfaSerial})
+	token, repeats, err = p.newMfaToken(reason)
+	span.End(err)
+	if err != nil {
+		return "", false, err
+	}
+	rememberMfaToken(p.config.MfaSerial, token)
+	return token, repeats, nil
+}
+
+// newMfaToken gets a token from mfa_process, generates it from a TOTP secret in the keyring, or gets
+// it from the configured provider or prompt. generated is true for the first two, which give the same
+// token until the next TOTP step
+func (p *TempCredentialsProvider) newMfaToken(reason string) (token string, generated bool, err error) {
+	if p.config.MfaProcess != "" {
+		token, err = runMfaProcess(p.config.MfaProcess, p.config.ProfileName, p.config.MfaSerial)
+		return token, true, err
+	}
+	if code, ok, err := totpCodeFromKeyring(p.sessions.keyring, p.config.MfaSerial); ok || err != nil {
+		return code, true, err
+	}
+
+	provider, promptFunc := p.config.MfaTokenProvider, p.config.MfaPrompt
+	if provider == nil && promptFunc == nil {
+		provider, promptFunc = prompt.MfaMethods[p.config.PromptDriver], prompt.Methods[p.config.PromptDriver]
+	}
+	if provider != nil {
+		token, err = p.withPromptTimeout(func() (string, error) {
+			return provider(p.config.MfaSerial)
+		})
+		return token, false, err
+	}
+	if promptFunc == nil {
+		return "", false, fmt.Errorf("No way to get a token for %s, set MfaPrompt", p.config.MfaSerial)
+	}
+	text := p.mfaPromptText(reason)
+	token, err = p.withPromptTimeout(func() (string, error) {
+		return promptFunc(text)
+	})
+	return token, false, err
+}
+
+// MfaPromptTimeoutError is returned when no MFA token was entered within Config.MfaPromptTimeout
+type MfaPromptTimeoutError struct {
+	MfaSerial string
+	Timeout   time.Duration
+}
+
+func (e *MfaPromptTimeoutError) Error() string {
+	return fmt.Sprintf("Timed out after %s waiting for a token for %s", e.Timeout, e.MfaSerial)
+}
+
+// withPromptTimeout runs the prompt, giving up after MfaPromptTimeout. The prompt is left running, as
+// there's no way to interrupt a read from the terminal
+func (p *TempCredentialsProvider) withPromptTimeout(fn func() (string, error)) (string, error) {
+	if p.config.MfaPromptTimeout <= 0 {
+		return fn()
+	}
+
+	type result struct {
+		token string
+		err   error
+	}
+	ch := make(chan result, 1)
+	go func() {
+		token, err := fn()
+		ch <- result{token, err}
+	}()
+
+	select {
+	case r := <-ch:
+		return r.token, r.err
+	case <-time.After(p.config.MfaPromptTimeout):
+		return "", &MfaPromptTimeoutError{p.config.MfaSerial, p.config.MfaPromptTimeout}
+	}
+}
+
+// mfaPromptText says which profile, account and call the token is for, so that users juggling many
+// accounts enter the code from the right device
+func (p *TempCredentialsProvider) mfaPromptText(reason string) string {
+	account := arnAccountID(p.config.MfaSerial)
+	if strings.HasPrefix(reason, "to assume role") {
+		account = arnAccountID(p.config.RoleARN)
+	}
+	if account != "" && account == arnAccountID(p.config.MfaSerial) {
+		if alias := p.accountAlias(); alias != "" {
+			account = alias + " " + account
+		}
+	}
+
+	details := []string{"profile " + p.config.ProfileName}
+	if account != "" {
+		details = append(details, "account "+account)
+	}
+	details = append(details, reason)
+
+	return fmt.Sprintf("Enter token for %s (%s): ", p.config.MfaSerial, strings.Join(details, ", "))
+}
+
+// arnAccountID returns the account id in an ARN, or "" if it isn't one
+func arnAccountID(arn string) string {
+	parts := strings.Split(arn, ":")
+	if len(parts) < 6 || parts[0] != "arn" {
+		return ""
+	}
+	return parts[4]
+}
+
+// withMfaToken calls fn with an MFA token, asking for another one if STS rejects it, up to MaxMfaAttempts times.
+// A token given with MfaToken isn't retried, as it can't change. A rejected token that was reused or generated
+// would be the same if got again straight away, so the retry waits for the next TOTP step
+func (p *TempCredentialsProvider) withMfaToken(reason string, fn func(token string) error) error {
+	for attempt := 1; ; attempt++ {
+		token, repeats, err := p.mfaToken(reason)
+		if err != nil {
+			return err
+		}
+
+		err = fn(token)
+		if !isInvalidMfaTokenError(err) || p.config.MfaToken != "" || attempt >= MaxMfaAttempts {
+			return err
+		}
+
+		log.Printf("MFA token was rejected: %v", err)
+		forgetMfaToken(p.config.MfaSerial)
+		if repeats {
+			wait := untilNextTotpStep(time.Now())
+			fmt.Fprintf(os.Stderr, "Invalid MFA token for %s, waiting %ds for the next one\n", p.config.MfaSerial, int(wait.Seconds()+0.5))
+			time.Sleep(wait)
+		} else {
+			fmt.Fprintf(os.Stderr, "Invalid MFA token for %s, please try again\n", p.config.MfaSerial)
+		}
+	}
+}
+
+// runMfaProcess runs a profile's mfa_process command, which prints the MFA token on stdout
+func runMfaProcess(command string, profileName string, mfaSerial string) (string, error) {
+	log.Printf("Getting MFA token from mfa_process %q", command)
+
+	cmd := shellCommand(command)
+	cmd.Env = append(os.Environ(), "AWS_VAULT_PROFILE="+profileName, "AWS_VAULT_MFA_SERIAL="+mfaSerial)
+	cmd.Stdin = os.Stdin
+	cmd.Stderr = os.Stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("mfa_process for profile %s failed: %v", profileName, err)
+	}
+
+	token := strings.TrimSpace(string(out))
+	if token == "" {
+		return "", fmt.Errorf("mfa_process for profile %s didn't output a token", profileName)
+	}
+	return token, nil
+}
+
+// ListMfaSerials returns the serials of the MFA devices attached to the IAM user that owns the credentials,
+// calling IAM with the region and HTTP settings of config
+func ListMfaSerials(creds *credentials.Credentials, config *Config) ([]string, error) {
+	client, err := newStsClient(creds, config)
+	if err != nil {
+		return nil, err
+	}
+	return client.ListMFADevices()
+}
+
+// discoverMfaSerial looks up the user's MFA devices with the master credentials and asks the
+// configured selector to pick one
+func (p *TempCredentialsProvider) discoverMfaSerial() error {
+	log.Printf("Looking up MFA devices for %s", p.config.CredentialsName)
+	serials, err := ListMfaSerials(p.masterCreds, p.config)
+	if err != nil {
+		return err
+	}
+	if len(serials) == 0 {
+		return errors.New("No MFA devices found")
+	}
+
+	var totpSerials []string
+	for _, serial := range serials {
+		if isSecurityKeySerial(serial) {
+			log.Printf("Ignoring security key %s, STS doesn't accept them", serial)
+			continue
+		}
+		totpSerials = append(totpSerials, serial)
+	}
+	if len(totpSerials) == 0 {
+		return securityKeyError(serials[0])
+	}
+
+	serial, err := p.config.MfaDeviceSelector(totpSerials, true)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Using discovered mfa_serial %s", serial)
+	p.config.MfaSerial = serial
+	return nil
+}
+
+// matchMfaDevice finds the serial matching a device, which is either a serial or the name of the device
+func matchMfaDevice(serials []string, device string) (string, bool) {
+	for _, serial := range serials {
+		if serial == device || strings.HasSuffix(serial, ":mfa/"+device) {
+			return serial, true
+		}
+	}
+	return "", false
+}
+
+// resolveMfaSerial chooses one of the configured mfa_serials, preferring one with a cached session
+func (p *TempCredentialsProvider) resolveMfaSerial() error {
+	serials := p.config.MfaSerials
+
+	if p.config.MfaDevice != "" {
+		serial, ok := matchMfaDevice(serials, p.config.MfaDevice)
+		if !ok {
+			return fmt.Errorf("MFA device %q isn't one of the mfa_serials configured", p.config.MfaDevice)
+		}
+		p.config.MfaSerial = serial
+		return nil
+	}
+
+	if !p.config.NoSession && !p.forceSessionRefresh {
+		for _, serial := range serials {
+			if _, err := p.sessions.Retrieve(p.config.CredentialsName, serial); err == nil {
+				log.Printf("Found a cached session for mfa_serial %s", serial)
+				p.config.MfaSerial = serial
+				return nil
+			}
+		}
+	}
+
+	// a token given up front is from one particular device, which can't be guessed
+	if len(serials) > 1 && p.config.MfaToken != "" {
+		return fmt.Errorf("An MFA token was given, but profile %s has %d mfa_serials. Choose the device it's from with --mfa-device",
+			p.config.ProfileName, len(serials))
+	}
+
+	if len(serials) == 1 || p.config.MfaDeviceSelector == nil {
+		p.config.MfaSerial = serials[0]
+		return nil
+	}
+
+	serial, err := p.config.MfaDeviceSelector(serials, false)
+	if err != nil {
+		return err
+	}
+	p.config.MfaSerial = serial
+	return nil
+}
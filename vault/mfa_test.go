@@ -0,0 +1,204 @@
+package vault_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/99designs/aws-vault/stsclient"
+	"github.com/99designs/aws-vault/vault"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+)
+
+func TestMfaPromptTimeout(t *testing.T) {
+	storage := mapStorage{}
+	if err := vault.NewMasterCredentialsProvider(storage, "llamas").Store(credentials.Value{AccessKeyID: "ABC", SecretAccessKey: "XYZ"}); err != nil {
+		t.Fatal(err)
+	}
+
+	block := make(chan struct{})
+	defer close(block)
+
+	config := vault.Config{
+		ProfileName:        "llamas",
+		CredentialsName:    "llamas",
+		MfaSerial:          "GAHT12345678",
+		SessionDuration:    time.Hour,
+		AssumeRoleDuration: 15 * time.Minute,
+		MfaPromptTimeout:   10 * time.Millisecond,
+		MfaTokenProvider: func(string) (string, error) {
+			<-block
+			return "", nil
+		},
+	}
+	provider, err := vault.NewTempCredentialsProvider(storage, &config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = provider.Retrieve()
+	if _, ok := err.(*vault.MfaPromptTimeoutError); !ok {
+		t.Fatalf("Expected a MfaPromptTimeoutError, got %#v", err)
+	}
+}
+
+func TestErrorClasses(t *testing.T) {
+	var testCases = []struct {
+		err          error
+		mfa          bool
+		accessDenied bool
+	}{
+		{awserr.New("AccessDenied", "MultiFactorAuthentication failed with invalid MFA one time pass code.", nil), true, true},
+		{awserr.New("AccessDenied", "Cannot call GetSessionToken with session credentials", nil), false, true},
+		{awserr.New("InvalidClientTokenId", "The security token included in the request is invalid.", nil), false, false},
+		{&vault.MfaPromptTimeoutError{MfaSerial: "GAHT12345678", Timeout: time.Minute}, true, false},
+		{errors.New("AccessDenied"), false, false},
+	}
+
+	for _, tc := range testCases {
+		if mfa := vault.IsMfaError(tc.err); mfa != tc.mfa {
+			t.Errorf("IsMfaError(%q) = %v, want %v", tc.err, mfa, tc.mfa)
+		}
+		if denied := vault.IsAccessDeniedError(tc.err); denied != tc.accessDenied {
+			t.Errorf("IsAccessDeniedError(%q) = %v, want %v", tc.err, denied, tc.accessDenied)
+		}
+	}
+}
+
+func TestMfaTokenNeedsDeviceWithSeveralSerials(t *testing.T) {
+	config := vault.Config{
+		ProfileName:        "llamas",
+		CredentialsName:    "llamas",
+		MfaSerials:         []string{"arn:aws:iam::111111111111:mfa/phone", "arn:aws:iam::111111111111:mfa/yubikey"},
+		MfaToken:           "123456",
+		SessionDuration:    time.Hour,
+		AssumeRoleDuration: 15 * time.Minute,
+		MfaDeviceSelector: func([]string, bool) (string, error) {
+			t.Fatal("Expected not to be asked for an MFA device when a token is given")
+			return "", nil
+		},
+	}
+	provider, err := vault.NewTempCredentialsProvider(mapStorage{}, &config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = provider.Retrieve(); err == nil || !strings.Contains(err.Error(), "--mfa-device") {
+		t.Fatalf("Expected an error asking for --mfa-device, got %v", err)
+	}
+}
+
+var errNoToken = errors.New("no token")
+
+// mfaSerialsConfig has two mfa_serials, and records which serial a token is asked for
+func mfaSerialsConfig(asked *string) vault.Config {
+	return vault.Config{
+		ProfileName:        "llamas",
+		CredentialsName:    "llamas",
+		MfaSerials:         []string{"arn:aws:iam::111111111111:mfa/phone", "arn:aws:iam::111111111111:mfa/yubikey"},
+		SessionDuration:    time.Hour,
+		AssumeRoleDuration: 15 * time.Minute,
+		MfaTokenProvider: func(serial string) (string, error) {
+			*asked = serial
+			return "", errNoToken
+		},
+	}
+}
+
+func TestMfaDeviceChoosesSerial(t *testing.T) {
+	storage := mapStorage{}
+	if err := vault.NewMasterCredentialsProvider(storage, "llamas").Store(credentials.Value{AccessKeyID: "ABC", SecretAccessKey: "XYZ"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var asked string
+	config := mfaSerialsConfig(&asked)
+	config.MfaDevice = "yubikey"
+	provider, err := vault.NewTempCredentialsProvider(storage, &config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = provider.Retrieve(); err != errNoToken {
+		t.Fatalf("Expected to be asked for a token, got %v", err)
+	}
+	if asked != "arn:aws:iam::111111111111:mfa/yubikey" {
+		t.Fatalf("Expected a token for the yubikey, got one for %q", asked)
+	}
+
+	config = mfaSerialsConfig(&asked)
+	config.MfaDevice = "laptop"
+	provider, err = vault.NewTempCredentialsProvider(storage, &config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = provider.Retrieve(); err == nil || !strings.Contains(err.Error(), "laptop") {
+		t.Fatalf("Expected an error about the laptop device, got %v", err)
+	}
+}
+
+func TestMfaSerialsPreferCachedSession(t *testing.T) {
+	storage := mapStorage{}
+	if err := vault.NewMasterCredentialsProvider(storage, "llamas").Store(credentials.Value{AccessKeyID: "ABC", SecretAccessKey: "XYZ"}); err != nil {
+		t.Fatal(err)
+	}
+	expiration := time.Now().Add(time.Hour)
+	id, secret, token := "ASIAYUBIKEY", "secret", "token"
+	session := &stsclient.Credentials{AccessKeyId: &id, SecretAccessKey: &secret, SessionToken: &token, Expiration: &expiration}
+	if err := vault.NewKeyringSessions(storage).Store("llamas", "arn:aws:iam::111111111111:mfa/yubikey", session); err != nil {
+		t.Fatal(err)
+	}
+
+	var asked string
+	config := mfaSerialsConfig(&asked)
+	config.MfaDeviceSelector = func([]string, bool) (string, error) {
+		t.Fatal("Expected not to be asked for an MFA device with a cached session")
+		return "", nil
+	}
+	provider, err := vault.NewTempCredentialsProvider(storage, &config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	creds, err := provider.Retrieve()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if creds.AccessKeyID != "ASIAYUBIKEY" {
+		t.Fatalf("Expected the cached session, got %q", creds.AccessKeyID)
+	}
+	if asked != "" {
+		t.Fatalf("Expected not to be asked for a token, was asked for %q", asked)
+	}
+}
+
+func TestMfaSerialsAskForDevice(t *testing.T) {
+	storage := mapStorage{}
+	if err := vault.NewMasterCredentialsProvider(storage, "llamas").Store(credentials.Value{AccessKeyID: "ABC", SecretAccessKey: "XYZ"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var asked string
+	var offered []string
+	config := mfaSerialsConfig(&asked)
+	config.MfaDeviceSelector = func(serials []string, discovered bool) (string, error) {
+		if discovered {
+			t.Fatal("Expected the configured mfa_serials not to be treated as discovered")
+		}
+		offered = serials
+		return serials[1], nil
+	}
+	provider, err := vault.NewTempCredentialsProvider(storage, &config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = provider.Retrieve(); err != errNoToken {
+		t.Fatalf("Expected to be asked for a token, got %v", err)
+	}
+	if len(offered) != 2 {
+		t.Fatalf("Expected both mfa_serials to be offered, got %v", offered)
+	}
+	if asked != "arn:aws:iam::111111111111:mfa/yubikey" {
+		t.Fatalf("Expected a token for the chosen device, got one for %q", asked)
+	}
+}
@@ -0,0 +1,47 @@
+package vault
+
+import (
+	"sync"
+	"time"
+)
+
+// mfaTokenTTL is how long a TOTP token is valid for
+const mfaTokenTTL = 30 * time.Second
+
+type recentToken struct {
+	token   string
+	expires time.Time
+}
+
+// recentMfaTokens remembers tokens for the rest of their validity, so that when one invocation needs MFA
+// more than once, e.g. for several profiles sharing an mfa_serial, the user isn't asked twice in a row
+var recentMfaTokens = struct {
+	sync.Mutex
+	tokens map[string]recentToken
+}{tokens: map[string]recentToken{}}
+
+func recentMfaToken(mfaSerial string) (string, bool) {
+	recentMfaTokens.Lock()
+	defer recentMfaTokens.Unlock()
+
+	t, ok := recentMfaTokens.tokens[mfaSerial]
+	if !ok || time.Now().After(t.expires) {
+		return "", false
+	}
+	return t.token, true
+}
+
+func rememberMfaToken(mfaSerial string, token string) {
+	recentMfaTokens.Lock()
+	defer recentMfaTokens.Unlock()
+
+	recentMfaTokens.tokens[mfaSerial] = recentToken{token, time.Now().Add(mfaTokenTTL)}
+}
+
+// forgetMfaToken drops a token that STS rejected, which it does if a token is reused too soon
+func forgetMfaToken(mfaSerial string) {
+	recentMfaTokens.Lock()
+	defer recentMfaTokens.Unlock()
+
+	delete(recentMfaTokens.tokens, mfaSerial)
+}
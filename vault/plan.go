@@ -0,0 +1,250 @@
+package vault
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// PlanStep is a step of getting credentials, as described by Plan without taking it
+type PlanStep struct {
+	// Description says what the step does, including the stored or cached item it uses
+	Description string
+
+	// Call is the API action the step calls, e.g. sts:AssumeRole, if it calls one
+	Call string
+
+	// Params are the parameters of Call, as name and value pairs
+	Params [][2]string
+}
+
+// CredentialsPlan describes how a TempCredentialsProvider would get credentials
+type CredentialsPlan struct {
+	// Path is the method used, e.g. "session and role"
+	Path  string
+	Steps []PlanStep
+}
+
+// Plan describes how Retrieve would get credentials, which cached sessions and stored credentials it would use
+// and the parameters of the STS calls it would make, without making them or prompting for anything
+func (p *TempCredentialsProvider) Plan() (CredentialsPlan, error) {
+	plan := CredentialsPlan{}
+	config := *p.config
+
+	keys, err := p.sessions.keyring.Keys()
+	if err != nil {
+		return plan, err
+	}
+
+	if config.PostureHook != "" {
+		desc := fmt.Sprintf("Run the posture hook %s", config.PostureHook)
+		if config.RoleARN != "" {
+			desc += ", sending its results as session tags"
+		}
+		plan.Steps = append(plan.Steps, PlanStep{Description: desc})
+	}
+	if config.MfaSerial == "" && len(config.MfaSerials) > 0 {
+		serial, step := p.planMfaSerial(keys)
+		config.MfaSerial = serial
+		plan.Steps = append(plan.Steps, step)
+	}
+
+	switch credentialsPathFor(&config) {
+	case pathSourceCredentials:
+		plan.Path = "role, assumed with the source credentials"
+		plan.Steps = append(plan.Steps,
+			PlanStep{Description: "Use the credentials of the enclosing aws-vault session"},
+			p.planAssumeRole(config, false))
+	case pathWebIdentity:
+		plan.Path = "role, assumed with a web identity token"
+		plan.Steps = append(plan.Steps, PlanStep{
+			Description: "Assume the role with the token in " + config.WebIdentityTokenFile,
+			Call:        "sts:AssumeRoleWithWebIdentity",
+			Params: [][2]string{
+				{"RoleArn", config.RoleARN},
+				{"RoleSessionName", p.planRoleSessionName()},
+				{"WebIdentityToken", "<contents of " + config.WebIdentityTokenFile + ">"},
+				{"DurationSeconds", seconds(config.AssumeRoleDuration)},
+			},
+		})
+	case pathRoot:
+		switch rootBasePath(&config) {
+		case pathRole:
+			plan.Path = "root session, with role credentials"
+			plan.Steps = append(plan.Steps, p.planMasterCredentials(config, keys), p.planAssumeRole(config, true))
+		case pathSessionAndRole:
+			plan.Path = "root session, with session and role credentials"
+			plan.Steps = append(plan.Steps, p.planSession(config, keys)...)
+			plan.Steps = append(plan.Steps, p.planAssumeRole(config, false))
+		default:
+			plan.Path = "root session, with the stored credentials"
+			plan.Steps = append(plan.Steps, p.planMasterCredentials(config, keys))
+		}
+		plan.Steps = append(plan.Steps, PlanStep{
+			Description: "Create a root session in account " + config.AssumeRootTarget,
+			Call:        "sts:AssumeRoot",
+			Params: [][2]string{
+				{"TargetPrincipal", config.AssumeRootTarget},
+				{"TaskPolicyArn", RootTaskPolicyArn(config.RootTaskPolicy)},
+				{"DurationSeconds", seconds(AssumeRootDuration)},
+			},
+		})
+	case pathMasterCredentials:
+		plan.Path = "stored credentials only"
+		plan.Steps = append(plan.Steps, p.planMasterCredentials(config, keys))
+	case pathRole:
+		plan.Path = "role, assumed with the stored credentials"
+		plan.Steps = append(plan.Steps, p.planMasterCredentials(config, keys), p.planAssumeRole(config, true))
+	case pathCachedRole:
+		plan.Path = "role with MFA, cached"
+		if s, ok := findSession(keys, config.ProfileName, config.MfaSerial, config.RoleARN); ok && !p.forceSessionRefresh {
+			plan.Steps = append(plan.Steps, PlanStep{
+				Description: fmt.Sprintf("Use the cached role credentials %s, which expire in %s", s.Key, planExpiry(s.Expiration)),
+			})
+		} else {
+			plan.Steps = append(plan.Steps, p.planMasterCredentials(config, keys), p.planAssumeRole(config, true),
+				planCache(config, "role credentials"))
+		}
+	case pathSession:
+		plan.Path = "session"
+		plan.Steps = append(plan.Steps, p.planSession(config, keys)...)
+	default:
+		plan.Path = "session and role"
+		plan.Steps = append(plan.Steps, p.planSession(config, keys)...)
+		plan.Steps = append(plan.Steps, p.planAssumeRole(config, false))
+	}
+
+	return plan, nil
+}
+
+// planMfaSerial picks the serial from mfa_serials the way resolveMfaSerial does, without asking which to use
+func (p *TempCredentialsProvider) planMfaSerial(keys []string) (string, PlanStep) {
+	serials := p.config.MfaSerials
+	if p.config.MfaDevice != "" {
+		if serial, ok := matchMfaDevice(serials, p.config.MfaDevice); ok {
+			return serial, PlanStep{Description: fmt.Sprintf("Use the MFA device %s, given by --mfa-device", serial)}
+		}
+		return "<unknown device " + p.config.MfaDevice + ">", PlanStep{
+			Description: fmt.Sprintf("Fail, as the MFA device %q isn't one of the mfa_serials configured", p.config.MfaDevice),
+		}
+	}
+	if !p.config.NoSession && !p.forceSessionRefresh {
+		for _, serial := range serials {
+			if _, ok := findSession(keys, p.config.CredentialsName, serial, ""); ok {
+				return serial, PlanStep{Description: fmt.Sprintf("Use the MFA device %s, which has a cached session", serial)}
+			}
+		}
+	}
+	if len(serials) > 1 && p.config.MfaToken != "" {
+		return "<unknown device>", PlanStep{
+			Description: "Fail, as an MFA token was given but the device it's from can't be chosen without --mfa-device",
+		}
+	}
+	if len(serials) == 1 || p.config.MfaDeviceSelector == nil {
+		return serials[0], PlanStep{Description: fmt.Sprintf("Use the MFA device %s, the first of the mfa_serials", serials[0])}
+	}
+	return "<chosen device>", PlanStep{
+		Description: fmt.Sprintf("Ask which of the MFA devices %s to use", strings.Join(serials, ", ")),
+	}
+}
+
+func (p *TempCredentialsProvider) planMasterCredentials(config Config, keys []string) PlanStep {
+	for _, key := range keys {
+		if key == config.CredentialsName {
+			return PlanStep{Description: "Use the stored credentials " + config.CredentialsName}
+		}
+	}
+	return PlanStep{Description: "Use the stored credentials " + config.CredentialsName + ", which aren't stored, so this fails"}
+}
+
+// planSession describes the steps of getSessionToken
+func (p *TempCredentialsProvider) planSession(config Config, keys []string) []PlanStep {
+	if s, ok := findSession(keys, config.CredentialsName, config.MfaSerial, ""); ok && !p.forceSessionRefresh {
+		return []PlanStep{{
+			Description: fmt.Sprintf("Use the cached session %s, which expires in %s", s.Key, planExpiry(s.Expiration)),
+		}}
+	}
+
+	step := PlanStep{
+		Description: "Create a session for " + config.CredentialsName,
+		Call:        "sts:GetSessionToken",
+		Params:      [][2]string{{"DurationSeconds", seconds(config.SessionDuration)}},
+	}
+	if config.MfaSerial != "" {
+		step.Description += ", asking for an MFA token"
+		step.Params = append(step.Params, [2]string{"SerialNumber", config.MfaSerial}, [2]string{"TokenCode", "<MFA token>"})
+	}
+	return []PlanStep{
+		p.planMasterCredentials(config, keys),
+		step,
+		planCache(config, "session"),
+	}
+}
+
+// planAssumeRole describes the AssumeRole call of assumeRoleFromCreds if withMfa, otherwise of assumeRoleFromSession
+func (p *TempCredentialsProvider) planAssumeRole(config Config, withMfa bool) PlanStep {
+	step := PlanStep{
+		Description: "Assume the role " + config.RoleARN,
+		Call:        "sts:AssumeRole",
+		Params: [][2]string{
+			{"RoleArn", config.RoleARN},
+			{"RoleSessionName", p.planRoleSessionName()},
+			{"DurationSeconds", seconds(config.AssumeRoleDuration)},
+		},
+	}
+	if config.ExternalID != "" {
+		externalID := config.ExternalID
+		if strings.HasPrefix(externalID, externalIDEnvPrefix) || strings.HasPrefix(externalID, externalIDKeyringPrefix) {
+			externalID = "<from " + externalID + ">"
+		}
+		step.Params = append(step.Params, [2]string{"ExternalId", externalID})
+	}
+	if withMfa && config.MfaSerial != "" {
+		step.Description += ", asking for an MFA token"
+		step.Params = append(step.Params, [2]string{"SerialNumber", config.MfaSerial}, [2]string{"TokenCode", "<MFA token>"})
+	}
+	if config.PostureHook != "" {
+		step.Params = append(step.Params, [2]string{"Tags", "<posture hook results>"})
+	}
+	return step
+}
+
+func planCache(config Config, what string) PlanStep {
+	if config.NoSessionCache {
+		return PlanStep{Description: "Don't cache the " + what + ", as the keyring is read-only"}
+	}
+	return PlanStep{Description: "Cache the " + what}
+}
+
+func (p *TempCredentialsProvider) planRoleSessionName() string {
+	if p.config.RoleSessionName != "" {
+		return expandRoleSessionName(p.config.RoleSessionName, p.config.ProfileName)
+	}
+	return "<current time in nanoseconds>"
+}
+
+// findSession finds an unexpired cached session in keys, like KeyringSessions.retrieve but without
+// reading or deleting anything
+func findSession(keys []string, profileName string, mfaSerial string, roleARN string) (KeyringSession, bool) {
+	for _, key := range keys {
+		if !IsSessionKey(key) {
+			continue
+		}
+		s, err := parseSessionKey(key)
+		if err != nil || time.Now().After(s.Expiration) {
+			continue
+		}
+		if s.ProfileName == profileName && s.MfaSerial == mfaSerial && s.RoleARN == roleARN {
+			return s, true
+		}
+	}
+	return KeyringSession{}, false
+}
+
+func planExpiry(t time.Time) string {
+	return time.Until(t).Round(time.Second).String()
+}
+
+func seconds(d time.Duration) string {
+	return fmt.Sprintf("%d", int64(d.Seconds()))
+}
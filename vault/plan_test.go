@@ -0,0 +1,108 @@
+package vault_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/99designs/aws-vault/stsclient"
+	"github.com/99designs/aws-vault/vault"
+	"github.com/99designs/keyring"
+)
+
+func planCalls(plan vault.CredentialsPlan) []string {
+	var calls []string
+	for _, step := range plan.Steps {
+		if step.Call != "" {
+			calls = append(calls, step.Call)
+		}
+	}
+	return calls
+}
+
+func planParam(plan vault.CredentialsPlan, call string, name string) string {
+	for _, step := range plan.Steps {
+		if step.Call != call {
+			continue
+		}
+		for _, param := range step.Params {
+			if param[0] == name {
+				return param[1]
+			}
+		}
+	}
+	return ""
+}
+
+func TestPlan(t *testing.T) {
+	mfaSerial := "arn:aws:iam::111111111111:mfa/me"
+	config := vault.Config{
+		ProfileName:        "admin",
+		CredentialsName:    "work",
+		MfaSerial:          mfaSerial,
+		RoleARN:            "arn:aws:iam::123456789012:role/admin",
+		SessionDuration:    4 * time.Hour,
+		AssumeRoleDuration: 15 * time.Minute,
+	}
+	k := mapStorage{"work": keyring.Item{Key: "work"}}
+
+	provider, err := vault.NewTempCredentialsProvider(k, &config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan, err := provider.Plan()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plan.Path != "session and role" {
+		t.Fatalf("Expected a session and role, got %q", plan.Path)
+	}
+	if calls := planCalls(plan); len(calls) != 2 || calls[0] != "sts:GetSessionToken" || calls[1] != "sts:AssumeRole" {
+		t.Fatalf("Expected GetSessionToken then AssumeRole, got %v", calls)
+	}
+	if serial := planParam(plan, "sts:GetSessionToken", "SerialNumber"); serial != mfaSerial {
+		t.Fatalf("Expected the session to be created with MFA, got SerialNumber %q", serial)
+	}
+	if duration := planParam(plan, "sts:AssumeRole", "DurationSeconds"); duration != "900" {
+		t.Fatalf("Expected the role to be assumed for 900 seconds, got %q", duration)
+	}
+
+	expiration := time.Now().Add(time.Hour)
+	id, secret, token := "ASIASESSION", "secret", "token"
+	session := &stsclient.Credentials{AccessKeyId: &id, SecretAccessKey: &secret, SessionToken: &token, Expiration: &expiration}
+	if err = vault.NewKeyringSessions(k).Store("work", mfaSerial, session); err != nil {
+		t.Fatal(err)
+	}
+
+	if plan, err = provider.Plan(); err != nil {
+		t.Fatal(err)
+	}
+	if calls := planCalls(plan); len(calls) != 1 || calls[0] != "sts:AssumeRole" {
+		t.Fatalf("Expected only AssumeRole with the cached session, got %v", calls)
+	}
+	if planParam(plan, "sts:AssumeRole", "SerialNumber") != "" {
+		t.Fatal("Expected no MFA when assuming the role from a session")
+	}
+}
+
+func TestPlanWithoutSessionCache(t *testing.T) {
+	config := vault.Config{
+		ProfileName:        "work",
+		CredentialsName:    "work",
+		SessionDuration:    time.Hour,
+		AssumeRoleDuration: 15 * time.Minute,
+		NoSessionCache:     true,
+	}
+	provider, err := vault.NewTempCredentialsProvider(mapStorage{"work": keyring.Item{Key: "work"}}, &config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan, err := provider.Plan()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, step := range plan.Steps {
+		if step.Description == "Cache the session" {
+			t.Fatal("Expected the session not to be cached")
+		}
+	}
+}
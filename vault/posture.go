@@ -0,0 +1,76 @@
+package vault
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/99designs/aws-vault/logging"
+)
+
+const (
+	postureTagPrefix = "posture:"
+	maxSessionTags   = 50
+)
+
+var invalidTagChars = regexp.MustCompile(`[^\pL\pZ\pN_.:/=+\-@]`)
+
+// runPostureHook runs a profile's posture_hook command, which checks the device (e.g. disk encryption,
+// screen lock, OS version) before credentials are issued. The hook reports its results on stdout
+// as key=value lines, and exits non-zero if the device shouldn't be given credentials
+func runPostureHook(command string, profileName string) (map[string]string, error) {
+	log.Printf("Running posture hook %q", command)
+
+	cmd := shellCommand(command)
+	cmd.Env = append(os.Environ(), "AWS_VAULT_PROFILE="+profileName)
+	cmd.Stderr = os.Stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("Device posture check for profile %s failed: %v", profileName, err)
+	}
+
+	results := map[string]string{}
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 {
+			logging.Warnf("Ignoring posture hook output %q, expected key=value", line)
+			continue
+		}
+		results[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+	}
+
+	log.Printf("Posture hook passed with %d results", len(results))
+	return results, nil
+}
+
+// postureSessionTags converts posture results into session tags, so role policies can use them as
+// conditions on aws:PrincipalTag/posture:<key>
+func postureSessionTags(results map[string]string) map[string]string {
+	tags := map[string]string{}
+	for k, v := range results {
+		if len(tags) == maxSessionTags {
+			log.Printf("Only the first %d posture results are recorded as session tags", maxSessionTags)
+			break
+		}
+		key := invalidTagChars.ReplaceAllString(postureTagPrefix+k, "_")
+		if len(key) > 128 {
+			key = key[:128]
+		}
+		v = invalidTagChars.ReplaceAllString(v, "_")
+		if len(v) > 256 {
+			v = v[:256]
+		}
+		tags[key] = v
+	}
+	return tags
+}
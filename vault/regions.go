@@ -0,0 +1,147 @@
+package vault
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/99designs/aws-vault/logging"
+	"github.com/99designs/aws-vault/stsclient"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+)
+
+const (
+	regionDisabledErrorCode = "RegionDisabledException"
+	enabledRegionsCacheTTL  = 24 * time.Hour
+)
+
+// isRegionDisabledError returns whether an STS error is because STS isn't activated in the region
+func isRegionDisabledError(err error) bool {
+	if awsErr, ok := err.(awserr.Error); ok {
+		return awsErr.Code() == regionDisabledErrorCode
+	}
+	return false
+}
+
+// regionDisabledError adds the regions that are enabled for the account to a RegionDisabledException
+func (p *TempCredentialsProvider) regionDisabledError(err error) error {
+	regions, listErr := enabledRegions(p.masterCreds, p.config)
+	if listErr != nil {
+		logging.Warnf("Failed to list enabled regions: %v", listErr)
+		return fmt.Errorf("%v\nRegion %s isn't enabled for this account, set region in the profile, AWS_REGION or --region to an enabled region", err, p.config.Region)
+	}
+
+	return fmt.Errorf("%v\nRegion %s isn't enabled for this account, try region = %s (enabled regions are %s)",
+		err, p.config.Region, suggestRegion(p.config.Region, regions), strings.Join(regions, ", "))
+}
+
+// suggestRegion picks the enabled region closest to the one that's disabled, going by the name
+func suggestRegion(disabled string, enabled []string) string {
+	best, bestLen := "us-east-1", 0
+	for _, r := range enabled {
+		n := 0
+		for n < len(r) && n < len(disabled) && r[n] == disabled[n] {
+			n++
+		}
+		if n > bestLen {
+			best, bestLen = r, n
+		}
+	}
+	return best
+}
+
+type enabledRegionsCache struct {
+	Regions []string  `json:"regions"`
+	Expires time.Time `json:"expires"`
+}
+
+func enabledRegionsCachePath(credentialsName string) (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "aws-vault", "regions", base64Encoding.EncodeToString([]byte(credentialsName))+".json"), nil
+}
+
+// enabledRegions lists the regions enabled for the account with ec2:DescribeRegions, caching the result for a day
+func enabledRegions(creds *credentials.Credentials, config *Config) ([]string, error) {
+	cachePath, err := enabledRegionsCachePath(config.CredentialsName)
+	if err != nil {
+		return nil, err
+	}
+
+	var cache enabledRegionsCache
+	if b, err := ioutil.ReadFile(cachePath); err == nil {
+		if err = json.Unmarshal(b, &cache); err == nil && time.Now().Before(cache.Expires) {
+			log.Printf("Using cached enabled regions for %s", config.CredentialsName)
+			return cache.Regions, nil
+		}
+	}
+
+	regions, err := describeRegions(creds, config)
+	if err != nil {
+		return nil, err
+	}
+
+	cache = enabledRegionsCache{Regions: regions, Expires: time.Now().Add(enabledRegionsCacheTTL)}
+	if b, err := json.Marshal(cache); err == nil {
+		if err = os.MkdirAll(filepath.Dir(cachePath), 0700); err == nil {
+			err = ioutil.WriteFile(cachePath, b, 0600)
+		}
+		if err != nil {
+			logging.Warnf("Failed to cache enabled regions: %v", err)
+		}
+	}
+
+	return regions, nil
+}
+
+// describeRegions calls ec2:DescribeRegions in us-east-1, which is always enabled
+func describeRegions(creds *credentials.Credentials, config *Config) ([]string, error) {
+	val, err := creds.Get()
+	if err != nil {
+		return nil, err
+	}
+	httpClient, err := NewHTTPClient(config)
+	if err != nil {
+		return nil, err
+	}
+
+	body := []byte(url.Values{"Action": {"DescribeRegions"}, "Version": {"2016-11-15"}}.Encode())
+	req, err := http.NewRequest("POST", "https://ec2.us-east-1.amazonaws.com/", strings.NewReader(string(body)))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+	stsclient.Sign(req, body, val, "us-east-1", "ec2", time.Now())
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("DescribeRegions failed: %s", resp.Status)
+	}
+
+	var result struct {
+		Regions []string `xml:"regionInfo>item>regionName"`
+	}
+	if err = xml.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+
+	sort.Strings(result.Regions)
+	return result.Regions, nil
+}
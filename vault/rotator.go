@@ -5,13 +5,14 @@ import (
 	"log"
 	"time"
 
-	"github.com/99designs/keyring"
-	"github.com/aws/aws-sdk-go/aws"
+	"github.com/99designs/aws-vault/logging"
 	"github.com/aws/aws-sdk-go/aws/credentials"
-	"github.com/aws/aws-sdk-go/service/iam"
 )
 
-func Rotate(profileName string, keyring keyring.Keyring, config *Config) error {
+// Rotate creates a new access key for the profile's credentials and deletes the old one. handover is
+// called after the new key is stored and before the old one is deleted, so that anything holding the
+// old key can switch over
+func Rotate(profileName string, keyring Storage, config *Config, handover func(credentialsName string) error) error {
 	if profileName != config.CredentialsName {
 		return fmt.Errorf("Profile '%s' uses credentials from '%s'. Try rotating '%s' instead", profileName, config.CredentialsName, config.CredentialsName)
 	}
@@ -37,9 +38,12 @@ func Rotate(profileName string, keyring keyring.Keyring, config *Config) error {
 	if err != nil {
 		return err
 	}
-	oldVaultSession := newSession(creds, config.Region)
+	oldVaultClient, err := newStsClient(creds, config)
+	if err != nil {
+		return err
+	}
 
-	currentUserName, err := GetUsernameFromSession(oldVaultSession)
+	currentUserName, err := GetUsername(oldVaultClient)
 	if err != nil {
 		return err
 	}
@@ -48,21 +52,28 @@ func Rotate(profileName string, keyring keyring.Keyring, config *Config) error {
 		oldMasterCreds.AccessKeyID[len(oldMasterCreds.AccessKeyID)-4:],
 		currentUserName)
 
+	oldMasterClient, err := newStsClient(credentials.NewStaticCredentialsFromCreds(oldMasterCreds), config)
+	if err != nil {
+		return err
+	}
+	oldIdentity, err := oldMasterClient.GetCallerIdentity()
+	if err != nil {
+		return err
+	}
+
 	// --------------------------------
 	// Create new access key
 
 	log.Println("Using old credentials to create a new access key")
 
-	var iamUserName *string
+	var iamUserName string
 
 	// A username is needed for some IAM calls if the credentials have assumed a role
 	if oldCredentialsValue.SessionToken != "" || currentUserName != "root" {
-		iamUserName = aws.String(currentUserName)
+		iamUserName = currentUserName
 	}
 
-	createOut, err := iam.New(oldVaultSession).CreateAccessKey(&iam.CreateAccessKeyInput{
-		UserName: iamUserName,
-	})
+	createOut, err := oldVaultClient.CreateAccessKey(iamUserName)
 	if err != nil {
 		return err
 	}
@@ -70,14 +81,33 @@ func Rotate(profileName string, keyring keyring.Keyring, config *Config) error {
 	log.Println("Created new access key")
 
 	newMasterCreds := credentials.Value{
-		AccessKeyID:     *createOut.AccessKey.AccessKeyId,
-		SecretAccessKey: *createOut.AccessKey.SecretAccessKey,
+		AccessKeyID:     createOut.AccessKeyId,
+		SecretAccessKey: createOut.SecretAccessKey,
 	}
 
 	if err := keyringProvider.Store(newMasterCreds); err != nil {
 		return fmt.Errorf("Error storing new access key %v: %v", newMasterCreds.AccessKeyID, err)
 	}
 
+	// --------------------------------
+	// Check the new access key works before the old one is gone
+
+	log.Println("Waiting for new IAM credentials to propagate (takes up to 10 seconds)")
+
+	if err = verifyAccessKey(newMasterCreds, oldIdentity.Arn, config); err != nil {
+		log.Println("Restoring old access key")
+		if storeErr := keyringProvider.Store(oldMasterCreds); storeErr != nil {
+			return fmt.Errorf("New access key %v doesn't work (%v), and restoring the old one failed: %v", newMasterCreds.AccessKeyID, err, storeErr)
+		}
+		deleteErr := oldVaultClient.DeleteAccessKey(newMasterCreds.AccessKeyID, iamUserName)
+		if deleteErr != nil {
+			logging.Warnf("Can't delete new access key %v: %v", newMasterCreds.AccessKeyID, deleteErr)
+		}
+		return fmt.Errorf("New access key %v doesn't work, kept the old one: %v", newMasterCreds.AccessKeyID, err)
+	}
+
+	log.Printf("Verified new access key ****************%s", newMasterCreds.AccessKeyID[len(newMasterCreds.AccessKeyID)-4:])
+
 	// --------------------------------
 	// Delete old sessions
 
@@ -90,20 +120,22 @@ func Rotate(profileName string, keyring keyring.Keyring, config *Config) error {
 	tempCredsProvider.ForceRefresh()
 	creds.Expire()
 
+	if err := handover(config.CredentialsName); err != nil {
+		logging.Warnf("Handover of new access key failed: %v", err)
+	}
+
 	// --------------------------------
 	// Use new credentials to delete old access key
 
-	log.Println("Using new credentials to delete the old new access key")
-	log.Println("Waiting for new IAM credentials to propagate (takes up to 10 seconds)")
+	log.Println("Using new credentials to delete the old access key")
 
-	newIamClient := iam.New(newSession(creds, config.Region))
+	newVaultClient, err := newStsClient(creds, config)
+	if err != nil {
+		return err
+	}
 
 	err = retry(time.Second*60, time.Second*5, func() error {
-		_, err = newIamClient.DeleteAccessKey(&iam.DeleteAccessKeyInput{
-			AccessKeyId: aws.String(oldMasterCreds.AccessKeyID),
-			UserName:    iamUserName,
-		})
-		return err
+		return newVaultClient.DeleteAccessKey(oldMasterCreds.AccessKeyID, iamUserName)
 	})
 	if err != nil {
 		return fmt.Errorf("Can't delete old access key %v: %v", oldMasterCreds.AccessKeyID, err)
@@ -113,6 +145,26 @@ func Rotate(profileName string, keyring keyring.Keyring, config *Config) error {
 	return nil
 }
 
+// verifyAccessKey checks that creds can be used to sign requests as the identity arn, retrying while a new
+// access key propagates through IAM
+func verifyAccessKey(creds credentials.Value, arn string, config *Config) error {
+	client, err := newStsClient(credentials.NewStaticCredentialsFromCreds(creds), config)
+	if err != nil {
+		return err
+	}
+
+	return retry(time.Second*60, time.Second*5, func() error {
+		identity, err := client.GetCallerIdentity()
+		if err != nil {
+			return err
+		}
+		if identity.Arn != arn {
+			return fmt.Errorf("Access key %s belongs to %s, not %s", creds.AccessKeyID, identity.Arn, arn)
+		}
+		return nil
+	})
+}
+
 func retry(duration time.Duration, sleep time.Duration, callback func() error) (err error) {
 	t0 := time.Now()
 	i := 0
@@ -10,17 +10,20 @@ import (
 	"strconv"
 	"time"
 
+	"github.com/99designs/aws-vault/logging"
+	"github.com/99designs/aws-vault/stsclient"
 	"github.com/99designs/keyring"
-	"github.com/aws/aws-sdk-go/service/sts"
 )
 
-var sessionKeyPattern = regexp.MustCompile(`^session,(?P<profile>[^,]+),(?P<mfaSerial>[^,]*),(?P<expiration>[^:]+)$`)
+// sessionKeyPattern matches session keys, role credentials cached for assume_role_with_mfa have the role ARN too
+var sessionKeyPattern = regexp.MustCompile(`^session,(?P<profile>[^,]+),(?P<mfaSerial>[^,]*),(?:(?P<roleArn>[^,]+),)?(?P<expiration>[^:,]+)$`)
 var oldSessionKeyPatterns = []*regexp.Regexp{
 	regexp.MustCompile(`^session:(?P<profile>[^ ]+):(?P<mfaSerial>[^ ]*):(?P<expiration>[^:]+)$`),
 	regexp.MustCompile(`^(.+?) session \((\d+)\)$`),
 }
 var base64Encoding = base64.URLEncoding.WithPadding(base64.NoPadding)
 
+// IsSessionKey returns whether a storage key holds a session rather than master credentials
 func IsSessionKey(s string) bool {
 	if sessionKeyPattern.MatchString(s) {
 		return true
@@ -46,7 +49,11 @@ func parseSessionKey(key string) (KeyringSession, error) {
 	if err != nil {
 		return KeyringSession{}, err
 	}
-	tsInt, err := strconv.ParseInt(matches[3], 10, 64)
+	roleARN, err := base64Encoding.DecodeString(matches[3])
+	if err != nil {
+		return KeyringSession{}, err
+	}
+	tsInt, err := strconv.ParseInt(matches[4], 10, 64)
 	if err != nil {
 		return KeyringSession{}, err
 	}
@@ -56,10 +63,20 @@ func parseSessionKey(key string) (KeyringSession, error) {
 		Key:         key,
 		Expiration:  time.Unix(tsInt, 0),
 		MfaSerial:   string(mfaSerial),
+		RoleARN:     string(roleARN),
 	}, nil
 }
 
-func formatSessionKey(profileName string, mfaSerial string, expiration *time.Time) string {
+func formatSessionKey(profileName string, mfaSerial string, roleARN string, expiration *time.Time) string {
+	if roleARN != "" {
+		return fmt.Sprintf(
+			"session,%s,%s,%s,%d",
+			base64Encoding.EncodeToString([]byte(profileName)),
+			base64Encoding.EncodeToString([]byte(mfaSerial)),
+			base64Encoding.EncodeToString([]byte(roleARN)),
+			expiration.Unix(),
+		)
+	}
 	return fmt.Sprintf(
 		"session,%s,%s,%d",
 		base64Encoding.EncodeToString([]byte(profileName)),
@@ -68,26 +85,34 @@ func formatSessionKey(profileName string, mfaSerial string, expiration *time.Tim
 	)
 }
 
+// KeyringSession is a cached session, identified by its storage key
 type KeyringSession struct {
 	ProfileName string
 	Key         string
 	Expiration  time.Time
 	MfaSerial   string
+
+	// RoleARN is set for cached role credentials, rather than a session from GetSessionToken
+	RoleARN string
 }
 
+// IsExpired returns whether the session has expired
 func (ks KeyringSession) IsExpired() bool {
 	log.Printf("Session %q expires in %v", ks.Key, ks.Expiration.Sub(time.Now()).String())
 	return time.Now().After(ks.Expiration)
 }
 
+// KeyringSessions is a cache of session credentials kept in Storage alongside the master credentials
 type KeyringSessions struct {
-	keyring keyring.Keyring
+	keyring Storage
 }
 
-func NewKeyringSessions(k keyring.Keyring) *KeyringSessions {
+// NewKeyringSessions returns the session cache kept in k
+func NewKeyringSessions(k Storage) *KeyringSessions {
 	return &KeyringSessions{keyring: k}
 }
 
+// Sessions lists the cached sessions
 func (s *KeyringSessions) Sessions() ([]KeyringSession, error) {
 	log.Printf("Looking up all keys in keyring")
 	keys, err := s.keyring.Keys()
@@ -103,7 +128,7 @@ func (s *KeyringSessions) Sessions() ([]KeyringSession, error) {
 			if err != nil || ks.IsExpired() {
 				log.Printf("Session %s is obsolete, attempting deleting", k)
 				if err := s.keyring.Remove(k); err != nil {
-					log.Printf("Error deleting session: %v", err)
+					logging.Warnf("Error deleting session: %v", err)
 				}
 				continue
 			}
@@ -116,7 +141,16 @@ func (s *KeyringSessions) Sessions() ([]KeyringSession, error) {
 }
 
 // Retrieve searches sessions for specific profile, expects the profile to be provided, not the source
-func (s *KeyringSessions) Retrieve(profileName string, mfaSerial string) (creds *sts.Credentials, err error) {
+func (s *KeyringSessions) Retrieve(profileName string, mfaSerial string) (creds *stsclient.Credentials, err error) {
+	return s.retrieve(profileName, mfaSerial, "")
+}
+
+// RetrieveRole searches the cached role credentials of a profile
+func (s *KeyringSessions) RetrieveRole(profileName string, mfaSerial string, roleARN string) (creds *stsclient.Credentials, err error) {
+	return s.retrieve(profileName, mfaSerial, roleARN)
+}
+
+func (s *KeyringSessions) retrieve(profileName string, mfaSerial string, roleARN string) (creds *stsclient.Credentials, err error) {
 	log.Printf("Looking for sessions for %s", profileName)
 	sessions, err := s.Sessions()
 	if err != nil {
@@ -124,7 +158,7 @@ func (s *KeyringSessions) Retrieve(profileName string, mfaSerial string) (creds
 	}
 
 	for _, session := range sessions {
-		if session.ProfileName == profileName && session.MfaSerial == mfaSerial {
+		if session.ProfileName == profileName && session.MfaSerial == mfaSerial && session.RoleARN == roleARN {
 			item, err := s.keyring.Get(session.Key)
 			if err != nil {
 				return creds, err
@@ -150,13 +184,22 @@ func (s *KeyringSessions) Retrieve(profileName string, mfaSerial string) (creds
 }
 
 // Store stores a sessions for a specific profile, expects the profile to be provided, not the source
-func (s *KeyringSessions) Store(profileName string, mfaSerial string, session *sts.Credentials) error {
+func (s *KeyringSessions) Store(profileName string, mfaSerial string, session *stsclient.Credentials) error {
+	return s.store(profileName, mfaSerial, "", session)
+}
+
+// StoreRole stores role credentials for a profile
+func (s *KeyringSessions) StoreRole(profileName string, mfaSerial string, roleARN string, role *stsclient.Credentials) error {
+	return s.store(profileName, mfaSerial, roleARN, role)
+}
+
+func (s *KeyringSessions) store(profileName string, mfaSerial string, roleARN string, session *stsclient.Credentials) error {
 	bytes, err := json.Marshal(session)
 	if err != nil {
 		return err
 	}
 
-	key := formatSessionKey(profileName, mfaSerial, session.Expiration)
+	key := formatSessionKey(profileName, mfaSerial, roleARN, session.Expiration)
 	log.Printf("Writing session for %s to keyring: %q", profileName, key)
 
 	return s.keyring.Set(keyring.Item{
@@ -190,3 +233,23 @@ func (s *KeyringSessions) Delete(profileName string) (n int, err error) {
 
 	return
 }
+
+// DeleteAll deletes every cached session, including expired ones and ones in older formats
+func (s *KeyringSessions) DeleteAll() (n int, err error) {
+	keys, err := s.keyring.Keys()
+	if err != nil {
+		return n, err
+	}
+
+	for _, k := range keys {
+		if IsSessionKey(k) {
+			log.Printf("Deleting session %q", k)
+			if err = s.keyring.Remove(k); err != nil {
+				return n, err
+			}
+			n++
+		}
+	}
+
+	return
+}
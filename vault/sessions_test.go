@@ -2,8 +2,11 @@ package vault_test
 
 import (
 	"testing"
+	"time"
 
+	"github.com/99designs/aws-vault/stsclient"
 	"github.com/99designs/aws-vault/vault"
+	"github.com/99designs/keyring"
 )
 
 func TestIsSessionKey(t *testing.T) {
@@ -16,6 +19,7 @@ func TestIsSessionKey(t *testing.T) {
 		{"blah-iam session (32383863333237616430)", true},
 		{"session,c2Vzc2lvbg,,1572281751", true},
 		{"session,c2Vzc2lvbg,YXJuOmF3czppYW06OjEyMzQ1Njc4OTA6bWZhL2pzdGV3bW9u,1572281751", true},
+		{"session,c2Vzc2lvbg,YXJuOmF3czppYW06OjEyMzQ1Njc4OTA6bWZhL2pzdGV3bW9u,YXJuOmF3czppYW06OjEyMzQ1Njc4OTA6cm9sZS9hZG1pbg,1572281751", true},
 	}
 
 	for _, tc := range testCases {
@@ -25,5 +29,58 @@ func TestIsSessionKey(t *testing.T) {
 			t.Fatalf("%q isn't a session key, but was detected as one", tc.Key)
 		}
 	}
+}
+
+func TestRoleCredentialsAreCachedSeparately(t *testing.T) {
+	sessions := vault.NewKeyringSessions(mapStorage{})
+	expiration := time.Now().Add(time.Hour)
+	id, secret, token := "ASIAROLE", "secret", "token"
+	role := &stsclient.Credentials{AccessKeyId: &id, SecretAccessKey: &secret, SessionToken: &token, Expiration: &expiration}
+
+	if err := sessions.StoreRole("work-admin", "arn:aws:iam::123456789012:mfa/me", "arn:aws:iam::123456789012:role/admin", role); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := sessions.Retrieve("work-admin", "arn:aws:iam::123456789012:mfa/me"); err == nil {
+		t.Fatal("Expected role credentials not to be returned as a session")
+	}
+	if _, err := sessions.RetrieveRole("work-admin", "arn:aws:iam::123456789012:mfa/me", "arn:aws:iam::123456789012:role/other"); err == nil {
+		t.Fatal("Expected role credentials not to be returned for another role")
+	}
+
+	cached, err := sessions.RetrieveRole("work-admin", "arn:aws:iam::123456789012:mfa/me", "arn:aws:iam::123456789012:role/admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *cached.AccessKeyId != "ASIAROLE" {
+		t.Fatalf("Expected the cached role credentials, got %q", *cached.AccessKeyId)
+	}
+}
+
+func TestDeleteAllSessions(t *testing.T) {
+	storage := mapStorage{}
+	sessions := vault.NewKeyringSessions(storage)
+	expiration := time.Now().Add(time.Hour)
+	id, secret, token := "ASIASESSION", "secret", "token"
+	creds := &stsclient.Credentials{AccessKeyId: &id, SecretAccessKey: &secret, SessionToken: &token, Expiration: &expiration}
 
+	if err := sessions.Store("work", "", creds); err != nil {
+		t.Fatal(err)
+	}
+	if err := sessions.StoreRole("work-admin", "", "arn:aws:iam::123456789012:role/admin", creds); err != nil {
+		t.Fatal(err)
+	}
+	storage["work session (61633665646639303539)"] = keyring.Item{Key: "work session (61633665646639303539)"}
+	storage["work"] = keyring.Item{Key: "work"}
+
+	n, err := sessions.DeleteAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 3 {
+		t.Fatalf("Expected 3 sessions to be deleted, got %d", n)
+	}
+	if _, ok := storage["work"]; !ok || len(storage) != 1 {
+		t.Fatalf("Expected only the credentials to be left, got %v", storage)
+	}
 }
@@ -0,0 +1,14 @@
+package vault
+
+import (
+	"os/exec"
+	"runtime"
+)
+
+// shellCommand runs a command from the config with the platform's shell
+func shellCommand(command string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.Command("cmd", "/C", command)
+	}
+	return exec.Command("/bin/sh", "-c", command)
+}
@@ -0,0 +1,68 @@
+package vault
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/99designs/aws-vault/stsclient"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+)
+
+// SigningTransport is an http.RoundTripper that signs requests with Signature Version 4, so tools can
+// call API Gateway, Elasticsearch and other AWS endpoints with a profile's credentials without them
+// being exported to the environment
+type SigningTransport struct {
+	Credentials *credentials.Credentials
+	Region      string
+	Service     string
+
+	// Base sends the signed requests, http.DefaultTransport is used if it's nil
+	Base http.RoundTripper
+}
+
+// NewSigningTransport returns a transport signing requests for service in region, e.g. "execute-api"
+// or "es", with creds from NewProfileCredentials
+func NewSigningTransport(creds *credentials.Credentials, region, service string) *SigningTransport {
+	return &SigningTransport{
+		Credentials: creds,
+		Region:      region,
+		Service:     service,
+	}
+}
+
+// RoundTrip signs a copy of the request and sends it
+func (t *SigningTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	val, err := t.Credentials.Get()
+	if err != nil {
+		return nil, err
+	}
+
+	var body []byte
+	if req.Body != nil {
+		body, err = ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// a RoundTripper mustn't modify the request, so sign a copy
+	signed := req.WithContext(req.Context())
+	signed.Header = make(http.Header, len(req.Header))
+	for k, v := range req.Header {
+		signed.Header[k] = append([]string(nil), v...)
+	}
+	if body != nil {
+		signed.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+
+	stsclient.Sign(signed, body, val, t.Region, t.Service, time.Now())
+
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return base.RoundTrip(signed)
+}
@@ -0,0 +1,45 @@
+package vault_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/99designs/aws-vault/vault"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+)
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+func TestSigningTransport(t *testing.T) {
+	transport := vault.NewSigningTransport(credentials.NewStaticCredentials("ASIAEXAMPLE", "SECRET", "TOKEN"), "us-east-1", "execute-api")
+	transport.Base = roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=ASIAEXAMPLE/") ||
+			!strings.Contains(r.Header.Get("Authorization"), "/us-east-1/execute-api/aws4_request") {
+			t.Fatalf("Request wasn't signed: %q", r.Header.Get("Authorization"))
+		}
+		if r.Header.Get("X-Amz-Security-Token") != "TOKEN" {
+			t.Fatalf("Expected the session token to be sent, got %q", r.Header.Get("X-Amz-Security-Token"))
+		}
+		if b, _ := ioutil.ReadAll(r.Body); string(b) != `{"name":"llama"}` {
+			t.Fatalf("Expected the body to be sent, got %q", b)
+		}
+		return &http.Response{StatusCode: http.StatusOK, Body: ioutil.NopCloser(strings.NewReader("")), Header: http.Header{}}, nil
+	})
+
+	req, err := http.NewRequest("POST", "https://abc123.execute-api.us-east-1.amazonaws.com/prod/pets", strings.NewReader(`{"name":"llama"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = transport.RoundTrip(req); err != nil {
+		t.Fatal(err)
+	}
+	if req.Header.Get("Authorization") != "" {
+		t.Fatal("Expected the original request not to be modified")
+	}
+}
@@ -0,0 +1,13 @@
+package vault
+
+import "github.com/99designs/keyring"
+
+// Storage is where master credentials, sessions and external ids are kept. Every keyring.Keyring
+// satisfies it, and embedders can supply their own store (e.g. S3, Redis or an HSM) by implementing it.
+// Get must return keyring.ErrKeyNotFound for a missing key.
+type Storage interface {
+	Get(key string) (keyring.Item, error)
+	Set(item keyring.Item) error
+	Remove(key string) error
+	Keys() ([]string, error)
+}
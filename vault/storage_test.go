@@ -0,0 +1,62 @@
+package vault_test
+
+import (
+	"testing"
+
+	"github.com/99designs/aws-vault/vault"
+	"github.com/99designs/keyring"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+)
+
+// mapStorage is a minimal custom Storage, like an embedder might supply
+type mapStorage map[string]keyring.Item
+
+func (m mapStorage) Get(key string) (keyring.Item, error) {
+	if item, ok := m[key]; ok {
+		return item, nil
+	}
+	return keyring.Item{}, keyring.ErrKeyNotFound
+}
+
+func (m mapStorage) Set(item keyring.Item) error {
+	m[item.Key] = item
+	return nil
+}
+
+func (m mapStorage) Remove(key string) error {
+	delete(m, key)
+	return nil
+}
+
+func (m mapStorage) Keys() ([]string, error) {
+	var keys []string
+	for k := range m {
+		keys = append(keys, k)
+	}
+	return keys, nil
+}
+
+func TestCustomStorage(t *testing.T) {
+	storage := mapStorage{}
+	provider := vault.NewMasterCredentialsProvider(storage, "llamas")
+
+	if err := provider.Store(credentials.Value{AccessKeyID: "ABC", SecretAccessKey: "XYZ"}); err != nil {
+		t.Fatal(err)
+	}
+
+	val, err := provider.Retrieve()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if val.AccessKeyID != "ABC" || val.SecretAccessKey != "XYZ" {
+		t.Fatalf("Expected the stored credentials, got %#v", val)
+	}
+
+	sessions, err := vault.NewKeyringSessions(storage).Sessions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 0 {
+		t.Fatalf("Expected no sessions, got %d", len(sessions))
+	}
+}
@@ -4,27 +4,32 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"os"
+	"os/user"
+	"regexp"
+	"strings"
 	"time"
 
-	"github.com/99designs/keyring"
-	"github.com/aws/aws-sdk-go/aws"
+	"github.com/99designs/aws-vault/logging"
+	"github.com/99designs/aws-vault/prompt"
+	"github.com/99designs/aws-vault/stsclient"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/credentials"
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/sts"
 )
 
-const DefaultExpirationWindow = 5 * time.Minute
-
-func newSession(creds *credentials.Credentials, region string) *session.Session {
-	return session.Must(session.NewSession(aws.NewConfig().WithRegion(region).WithCredentials(creds)))
-}
+func newStsClient(creds *credentials.Credentials, config *Config) (*stsclient.Client, error) {
+	httpClient, err := NewHTTPClient(config)
+	if err != nil {
+		return nil, err
+	}
 
-func newStsClient(creds *credentials.Credentials, region string) *sts.STS {
-	return sts.New(newSession(creds, region))
+	client := stsclient.New(creds, config.Region)
+	client.HTTPClient = httpClient
+	return client, nil
 }
 
 // NewTempCredentials creates temporary credentials
-func NewTempCredentials(k keyring.Keyring, config *Config) (*credentials.Credentials, error) {
+func NewTempCredentials(k Storage, config *Config) (*credentials.Credentials, error) {
 	provider, err := NewTempCredentialsProvider(k, config)
 	if err != nil {
 		return nil, err
@@ -33,8 +38,25 @@ func NewTempCredentials(k keyring.Keyring, config *Config) (*credentials.Credent
 	return credentials.NewCredentials(provider), nil
 }
 
-// NewTempCredentials creates a provider for temporary credentials
-func NewTempCredentialsProvider(k keyring.Keyring, config *Config) (*TempCredentialsProvider, error) {
+// NewProfileCredentials loads the config for a profile from ~/.aws/config (or $AWS_CONFIG_FILE) and
+// returns temporary credentials for it, prompting for MFA tokens with mfaPrompt
+func NewProfileCredentials(k Storage, profileName string, mfaPrompt prompt.PromptFunc) (*credentials.Credentials, error) {
+	file, err := LoadConfigFromEnv()
+	if err != nil {
+		return nil, err
+	}
+
+	config := Config{MfaPrompt: mfaPrompt}
+	loader := &ConfigLoader{File: file}
+	if err = loader.LoadFromProfile(profileName, &config); err != nil {
+		return nil, err
+	}
+
+	return NewTempCredentials(k, &config)
+}
+
+// NewTempCredentialsProvider creates a provider for temporary credentials
+func NewTempCredentialsProvider(k Storage, config *Config) (*TempCredentialsProvider, error) {
 	if err := config.Validate(); err != nil {
 		return nil, err
 	}
@@ -53,25 +75,146 @@ type TempCredentialsProvider struct {
 	sessions            *KeyringSessions
 	config              *Config
 	forceSessionRefresh bool
+	sessionTags         map[string]string
 }
 
+// ForceRefresh discards the cached master credentials and creates a new session on the next Retrieve
 func (p *TempCredentialsProvider) ForceRefresh() {
 	p.masterCreds.Expire()
 	p.forceSessionRefresh = true
 }
 
+// roleDeniedError adds a hint to an AssumeRole access denied error, keeping its code
+type roleDeniedError struct {
+	err     awserr.Error
+	roleARN string
+}
+
+func (e *roleDeniedError) Error() string {
+	return fmt.Sprintf("%v\nIf the trust policy of %s requires MFA, set mfa_serial in the profile or use --mfa-serial", e.err, e.roleARN)
+}
+
+func (e *roleDeniedError) Code() string    { return e.err.Code() }
+func (e *roleDeniedError) Message() string { return e.err.Message() }
+func (e *roleDeniedError) OrigErr() error  { return e.err.OrigErr() }
+
+// Retrieve returns cached session or role credentials if they are still valid, otherwise new ones from STS
 func (p *TempCredentialsProvider) Retrieve() (credentials.Value, error) {
-	if p.config.NoSession && p.config.RoleARN == "" {
+	val, err := p.retrieve()
+	if isRegionDisabledError(err) {
+		return val, p.regionDisabledError(err)
+	}
+	if err == nil || p.config.MfaSerial != "" {
+		return val, err
+	}
+
+	roleDenied := p.config.RoleARN != "" && isAssumeRoleDeniedError(err)
+	if !roleDenied && !isMfaRequiredError(err) {
+		return val, err
+	}
+
+	if p.config.MfaDeviceSelector == nil {
+		if roleDenied {
+			return val, &roleDeniedError{err.(awserr.Error), p.config.RoleARN}
+		}
+		return val, err
+	}
+
+	log.Printf("MFA may be required but no mfa_serial is configured: %v", err)
+	if discoverErr := p.discoverMfaSerial(); discoverErr != nil {
+		logging.Warnf("Failed to discover mfa_serial: %v", discoverErr)
+		return val, err
+	}
+
+	// retry with MFA, a new session is created as sessions are keyed by mfa_serial
+	return p.retrieve()
+}
+
+func (p *TempCredentialsProvider) retrieve() (credentials.Value, error) {
+	if p.config.PostureHook != "" {
+		results, err := runPostureHook(p.config.PostureHook, p.config.ProfileName)
+		if err != nil {
+			return credentials.Value{}, err
+		}
+		if p.config.RoleARN == "" {
+			log.Printf("Posture results aren't recorded as session tags, as profile %s doesn't assume a role", p.config.ProfileName)
+		}
+		p.sessionTags = postureSessionTags(results)
+	}
+	if p.config.MfaSerial == "" && len(p.config.MfaSerials) > 0 {
+		if err := p.resolveMfaSerial(); err != nil {
+			return credentials.Value{}, err
+		}
+	}
+	return p.getCredsWith(credentialsPathFor(p.config))
+}
+
+// credentialsPath is how a TempCredentialsProvider gets credentials. It's chosen by credentialsPathFor, which
+// both retrieve and Plan use so they always agree
+type credentialsPath int
+
+const (
+	pathSourceCredentials credentialsPath = iota
+	pathWebIdentity
+	pathRoot
+	pathMasterCredentials
+	pathRole
+	pathCachedRole
+	pathSession
+	pathSessionAndRole
+)
+
+// credentialsPathFor chooses how credentials are got for config
+func credentialsPathFor(config *Config) credentialsPath {
+	switch {
+	case config.SourceCredentials != nil:
+		return pathSourceCredentials
+	case config.WebIdentityTokenFile != "":
+		return pathWebIdentity
+	case config.AssumeRootTarget != "":
+		return pathRoot
+	case config.NoSession && config.RoleARN == "":
+		return pathMasterCredentials
+	case config.NoSession:
+		return pathRole
+	case config.AssumeRoleWithMfa && config.RoleARN != "":
+		return pathCachedRole
+	case config.RoleARN == "":
+		return pathSession
+	}
+	return pathSessionAndRole
+}
+
+// rootBasePath chooses how the credentials that assume root are got. Sessions from GetSessionToken can't
+// call sts:AssumeRoot, so without a role the master credentials are used
+func rootBasePath(config *Config) credentialsPath {
+	switch {
+	case config.RoleARN != "" && config.NoSession:
+		return pathRole
+	case config.RoleARN != "":
+		return pathSessionAndRole
+	}
+	return pathMasterCredentials
+}
+
+func (p *TempCredentialsProvider) getCredsWith(path credentialsPath) (credentials.Value, error) {
+	switch path {
+	case pathSourceCredentials:
+		return p.getCredsWithSourceCredentials()
+	case pathWebIdentity:
+		return p.getCredsWithWebIdentity()
+	case pathRoot:
+		return p.getCredsWithRoot()
+	case pathMasterCredentials:
 		log.Println("Using master credentials")
 		return p.masterCreds.Get()
-	}
-	if p.config.NoSession {
+	case pathRole:
 		return p.getCredsWithRole()
-	}
-	if p.config.RoleARN == "" {
+	case pathCachedRole:
+		return p.getCredsWithCachedRole()
+	case pathSession:
 		return p.getCredsWithSession()
 	}
-
 	return p.getCredsWithSessionAndRole()
 }
 
@@ -80,10 +223,10 @@ func (p *TempCredentialsProvider) getCredsWithSession() (credentials.Value, erro
 
 	session, err := p.getSessionToken()
 	if err != nil {
-		return credentials.Value{}, nil
+		return credentials.Value{}, err
 	}
 
-	p.SetExpiration(*session.Expiration, DefaultExpirationWindow)
+	p.SetExpiration(*session.Expiration, p.config.SessionExpirationWindow)
 
 	value := credentials.Value{
 		AccessKeyID:     *session.AccessKeyId,
@@ -100,7 +243,7 @@ func (p *TempCredentialsProvider) getCredsWithSessionAndRole() (credentials.Valu
 
 	session, err := p.getSessionToken()
 	if err != nil {
-		return credentials.Value{}, nil
+		return credentials.Value{}, err
 	}
 
 	role, err := p.assumeRoleFromSession(session)
@@ -108,7 +251,7 @@ func (p *TempCredentialsProvider) getCredsWithSessionAndRole() (credentials.Valu
 		return credentials.Value{}, err
 	}
 
-	p.SetExpiration(*role.Expiration, DefaultExpirationWindow)
+	p.SetExpiration(*role.Expiration, p.config.RoleExpirationWindow)
 
 	creds := credentials.Value{
 		AccessKeyID:     *role.AccessKeyId,
@@ -142,7 +285,7 @@ func (p *TempCredentialsProvider) getCredsWithRole() (credentials.Value, error)
 		return credentials.Value{}, err
 	}
 
-	p.SetExpiration(*role.Expiration, DefaultExpirationWindow)
+	p.SetExpiration(*role.Expiration, p.config.RoleExpirationWindow)
 
 	log.Printf("Using role ****************%s, expires in %s", (*role.AccessKeyId)[len(*role.AccessKeyId)-4:], role.Expiration.Sub(time.Now()).String())
 	return credentials.Value{
@@ -152,51 +295,126 @@ func (p *TempCredentialsProvider) getCredsWithRole() (credentials.Value, error)
 	}, nil
 }
 
-func (p *TempCredentialsProvider) createSessionToken() (*sts.Credentials, error) {
-	log.Printf("Creating new session token for profile %s", p.config.CredentialsName)
+// getCredsWithSourceCredentials assumes the role with Config.SourceCredentials rather than the stored
+// credentials
+func (p *TempCredentialsProvider) getCredsWithSourceCredentials() (credentials.Value, error) {
+	log.Println("Getting credentials with AssumeRole from the source credentials")
 
-	params := &sts.GetSessionTokenInput{
-		DurationSeconds: aws.Int64(int64(p.config.SessionDuration.Seconds())),
+	role, err := p.assumeRoleFromCreds(*p.config.SourceCredentials)
+	if err != nil {
+		return credentials.Value{}, err
 	}
 
-	if p.config.MfaSerial != "" {
-		params.SerialNumber = aws.String(p.config.MfaSerial)
-		if p.config.MfaToken == "" {
-			token, err := p.config.MfaPrompt(fmt.Sprintf("Enter token for %s: ", p.config.MfaSerial))
-			if err != nil {
-				return nil, err
-			}
-			params.TokenCode = aws.String(token)
+	p.SetExpiration(*role.Expiration, p.config.RoleExpirationWindow)
+
+	log.Printf("Using role ****************%s, expires in %s", (*role.AccessKeyId)[len(*role.AccessKeyId)-4:], role.Expiration.Sub(time.Now()).String())
+	return credentials.Value{
+		AccessKeyID:     *role.AccessKeyId,
+		SecretAccessKey: *role.SecretAccessKey,
+		SessionToken:    *role.SessionToken,
+	}, nil
+}
+
+// getCredsWithCachedRole assumes the role directly with the master credentials and MFA, like
+// getCredsWithRole, but caches the role credentials so the MFA token isn't asked for every time
+func (p *TempCredentialsProvider) getCredsWithCachedRole() (credentials.Value, error) {
+	log.Println("Getting credentials with AssumeRole, using cached role credentials where possible")
+
+	role, err := p.sessions.RetrieveRole(p.config.ProfileName, p.config.MfaSerial, p.config.RoleARN)
+	if err != nil && !p.forceSessionRefresh {
+		unlock, lockErr := lockSessionCreation(p.config.ProfileName, p.config.ProfileName+","+p.config.MfaSerial+","+p.config.RoleARN)
+		if lockErr != nil {
+			logging.Warnf("Failed to lock role creation: %v", lockErr)
 		} else {
-			params.TokenCode = aws.String(p.config.MfaToken)
+			defer unlock()
+			// another process may have assumed the role while we waited for the lock
+			role, err = p.sessions.RetrieveRole(p.config.ProfileName, p.config.MfaSerial, p.config.RoleARN)
+		}
+	}
+	if err != nil || p.forceSessionRefresh {
+		creds, err := p.masterCreds.Get()
+		if err != nil {
+			return credentials.Value{}, err
+		}
+
+		newRole, err := p.assumeRoleFromCreds(creds)
+		if err != nil {
+			return credentials.Value{}, err
+		}
+		p.forceSessionRefresh = false
+
+		if err = p.storeSession(p.config.ProfileName, p.config.RoleARN, &newRole); err != nil {
+			return credentials.Value{}, err
 		}
+		role = &newRole
 	}
 
-	client := newStsClient(p.masterCreds, p.config.Region)
+	p.SetExpiration(*role.Expiration, p.config.RoleExpirationWindow)
 
-	resp, err := client.GetSessionToken(params)
+	log.Printf("Using role ****************%s, expires in %s", (*role.AccessKeyId)[len(*role.AccessKeyId)-4:], role.Expiration.Sub(time.Now()).String())
+	return credentials.Value{
+		AccessKeyID:     *role.AccessKeyId,
+		SecretAccessKey: *role.SecretAccessKey,
+		SessionToken:    *role.SessionToken,
+	}, nil
+}
+
+func (p *TempCredentialsProvider) createSessionToken() (*stsclient.Credentials, error) {
+	log.Printf("Creating new session token for profile %s", p.config.CredentialsName)
+
+	params := stsclient.GetSessionTokenInput{
+		DurationSeconds: int64(p.config.SessionDuration.Seconds()),
+	}
+
+	client, err := newStsClient(p.masterCreds, p.config)
 	if err != nil {
 		return nil, err
 	}
 
-	return resp.Credentials, nil
+	if p.config.MfaSerial == "" {
+		return client.GetSessionToken(params)
+	}
+
+	params.SerialNumber = p.config.MfaSerial
+	var session *stsclient.Credentials
+	err = p.withMfaToken("to create a session", func(token string) (err error) {
+		params.TokenCode = token
+		session, err = client.GetSessionToken(params)
+		return err
+	})
+	return session, err
 }
 
-func (p *TempCredentialsProvider) getSessionToken() (*sts.Credentials, error) {
+func (p *TempCredentialsProvider) getSessionToken() (*stsclient.Credentials, error) {
 	if p.forceSessionRefresh {
-		return p.createSessionToken()
+		session, err := p.createSessionToken()
+		if err != nil {
+			return nil, err
+		}
+		p.forceSessionRefresh = false
+		return session, p.storeSession(p.config.CredentialsName, "", session)
 	}
 
 	session, err := p.sessions.Retrieve(p.config.CredentialsName, p.config.MfaSerial)
 	if err != nil {
+		unlock, lockErr := lockSessionCreation(p.config.CredentialsName, p.config.CredentialsName+","+p.config.MfaSerial)
+		if lockErr != nil {
+			logging.Warnf("Failed to lock session creation: %v", lockErr)
+		} else {
+			defer unlock()
+			// another process may have created the session while we waited for the lock
+			if session, err = p.sessions.Retrieve(p.config.CredentialsName, p.config.MfaSerial); err == nil {
+				return session, nil
+			}
+		}
+
 		// session lookup missed, we need to create a new one.
 		session, err = p.createSessionToken()
 		if err != nil {
 			return nil, err
 		}
 
-		err = p.sessions.Store(p.config.CredentialsName, p.config.MfaSerial, session)
-		if err != nil {
+		if err = p.storeSession(p.config.CredentialsName, "", session); err != nil {
 			return nil, err
 		}
 	}
@@ -204,75 +422,129 @@ func (p *TempCredentialsProvider) getSessionToken() (*sts.Credentials, error) {
 	return session, err
 }
 
+// storeSession caches a session, or role credentials if roleARN is given, unless NoSessionCache is set
+func (p *TempCredentialsProvider) storeSession(profileName string, roleARN string, session *stsclient.Credentials) error {
+	if p.config.NoSessionCache {
+		log.Printf("Not caching the session for %s", profileName)
+		return nil
+	}
+	return p.sessions.StoreRole(profileName, p.config.MfaSerial, roleARN, session)
+}
+
 func (p *TempCredentialsProvider) roleSessionName() string {
 	if p.config.RoleSessionName != "" {
-		return p.config.RoleSessionName
+		return expandRoleSessionName(p.config.RoleSessionName, p.config.ProfileName)
 	}
 
 	// Try to work out a role name that will hopefully end up unique.
 	return fmt.Sprintf("%d", time.Now().UTC().UnixNano())
 }
 
+var invalidRoleSessionNameChars = regexp.MustCompile(`[^\w+=,.@-]`)
+
+// expandRoleSessionName replaces ${user}, ${hostname}, ${profile} and ${timestamp} in a
+// role_session_name template, so CloudTrail entries identify the operator
+func expandRoleSessionName(template string, profileName string) string {
+	name := os.Expand(template, func(v string) string {
+		switch v {
+		case "user":
+			if u, err := user.Current(); err == nil {
+				// windows usernames are in the form DOMAIN\user
+				parts := strings.Split(u.Username, `\`)
+				return parts[len(parts)-1]
+			}
+		case "hostname":
+			if h, err := os.Hostname(); err == nil {
+				return strings.Split(h, ".")[0]
+			}
+		case "profile":
+			return profileName
+		case "timestamp":
+			return fmt.Sprintf("%d", time.Now().UTC().Unix())
+		default:
+			log.Printf("Unknown variable ${%s} in role_session_name", v)
+		}
+		return ""
+	})
+
+	// role session names are limited to 64 characters of [\w+=,.@-]
+	name = invalidRoleSessionNameChars.ReplaceAllString(name, "-")
+	if len(name) > 64 {
+		name = name[:64]
+	}
+	return name
+}
+
 // assumeRoleFromSession takes a session created with GetSessionToken and uses that to assume a role
-func (p *TempCredentialsProvider) assumeRoleFromSession(session *sts.Credentials) (sts.Credentials, error) {
-	client := newStsClient(credentials.NewStaticCredentials(*session.AccessKeyId, *session.SecretAccessKey, *session.SessionToken), p.config.Region)
+func (p *TempCredentialsProvider) assumeRoleFromSession(session *stsclient.Credentials) (stsclient.Credentials, error) {
+	client, err := newStsClient(credentials.NewStaticCredentials(*session.AccessKeyId, *session.SecretAccessKey, *session.SessionToken), p.config)
+	if err != nil {
+		return stsclient.Credentials{}, err
+	}
 
-	input := &sts.AssumeRoleInput{
-		RoleArn:         aws.String(p.config.RoleARN),
-		RoleSessionName: aws.String(p.roleSessionName()),
-		DurationSeconds: aws.Int64(int64(p.config.AssumeRoleDuration.Seconds())),
+	externalID, err := resolveExternalID(p.sessions.keyring, p.config.ExternalID)
+	if err != nil {
+		return stsclient.Credentials{}, err
 	}
 
-	if p.config.ExternalID != "" {
-		input.ExternalId = aws.String(p.config.ExternalID)
+	input := stsclient.AssumeRoleInput{
+		RoleArn:         p.config.RoleARN,
+		RoleSessionName: p.roleSessionName(),
+		DurationSeconds: int64(p.config.AssumeRoleDuration.Seconds()),
+		ExternalId:      externalID,
+		Tags:            p.sessionTags,
 	}
 
 	log.Printf("Assuming role %s from session token", p.config.RoleARN)
-	resp, err := client.AssumeRole(input)
+	role, err := client.AssumeRole(input)
 	if err != nil {
-		return sts.Credentials{}, err
+		return stsclient.Credentials{}, err
 	}
 
-	return *resp.Credentials, nil
+	return *role, nil
 }
 
 // assumeRoleFromCreds uses IAM credentials to assume a role
-func (p *TempCredentialsProvider) assumeRoleFromCreds(creds credentials.Value) (sts.Credentials, error) {
+func (p *TempCredentialsProvider) assumeRoleFromCreds(creds credentials.Value) (stsclient.Credentials, error) {
 	if p.config.RoleARN == "" {
-		return sts.Credentials{}, errors.New("No role defined")
+		return stsclient.Credentials{}, errors.New("No role defined")
 	}
 
-	client := newStsClient(credentials.NewStaticCredentialsFromCreds(creds), p.config.Region)
+	client, err := newStsClient(credentials.NewStaticCredentialsFromCreds(creds), p.config)
+	if err != nil {
+		return stsclient.Credentials{}, err
+	}
 
-	input := &sts.AssumeRoleInput{
-		RoleArn:         aws.String(p.config.RoleARN),
-		RoleSessionName: aws.String(p.roleSessionName()),
-		DurationSeconds: aws.Int64(int64(p.config.AssumeRoleDuration.Seconds())),
+	externalID, err := resolveExternalID(p.sessions.keyring, p.config.ExternalID)
+	if err != nil {
+		return stsclient.Credentials{}, err
 	}
 
-	if p.config.ExternalID != "" {
-		input.ExternalId = aws.String(p.config.ExternalID)
+	input := stsclient.AssumeRoleInput{
+		RoleArn:         p.config.RoleARN,
+		RoleSessionName: p.roleSessionName(),
+		DurationSeconds: int64(p.config.AssumeRoleDuration.Seconds()),
+		ExternalId:      externalID,
+		Tags:            p.sessionTags,
 	}
 
+	log.Printf("Assuming role %s with iam credentials", p.config.RoleARN)
+
 	// if we don't have a session, we need to include MFA token in the AssumeRole call
+	var role *stsclient.Credentials
 	if p.config.MfaSerial != "" {
-		input.SerialNumber = aws.String(p.config.MfaSerial)
-		if p.config.MfaToken == "" {
-			token, err := p.config.MfaPrompt(fmt.Sprintf("Enter token for %s: ", p.config.MfaSerial))
-			if err != nil {
-				return sts.Credentials{}, err
-			}
-			input.TokenCode = aws.String(token)
-		} else {
-			input.TokenCode = aws.String(p.config.MfaToken)
-		}
+		input.SerialNumber = p.config.MfaSerial
+		err = p.withMfaToken("to assume role "+roleName(p.config.RoleARN), func(token string) (err error) {
+			input.TokenCode = token
+			role, err = client.AssumeRole(input)
+			return err
+		})
+	} else {
+		role, err = client.AssumeRole(input)
 	}
-
-	log.Printf("Assuming role %s with iam credentials", p.config.RoleARN)
-	resp, err := client.AssumeRole(input)
 	if err != nil {
-		return sts.Credentials{}, err
+		return stsclient.Credentials{}, err
 	}
 
-	return *resp.Credentials, nil
+	return *role, nil
 }
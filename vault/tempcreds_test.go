@@ -0,0 +1,82 @@
+package vault_test
+
+import (
+	"os"
+	"os/user"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/99designs/aws-vault/vault"
+	"github.com/99designs/keyring"
+)
+
+// plannedRoleSessionName returns the role session name a profile with the role_session_name template
+// would assume its role with
+func plannedRoleSessionName(t *testing.T, template string, profileName string) string {
+	config := vault.Config{
+		ProfileName:        profileName,
+		CredentialsName:    "work",
+		RoleARN:            "arn:aws:iam::123456789012:role/admin",
+		RoleSessionName:    template,
+		NoSession:          true,
+		SessionDuration:    time.Hour,
+		AssumeRoleDuration: 15 * time.Minute,
+	}
+	provider, err := vault.NewTempCredentialsProvider(mapStorage{"work": keyring.Item{Key: "work"}}, &config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan, err := provider.Plan()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return planParam(plan, "sts:AssumeRole", "RoleSessionName")
+}
+
+func TestRoleSessionNameTemplate(t *testing.T) {
+	u, err := user.Current()
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := strings.Split(u.Username, `\`)
+	username := regexp.MustCompile(`[^\w+=,.@-]`).ReplaceAllString(parts[len(parts)-1], "-")
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		t.Fatal(err)
+	}
+	hostname = strings.Split(hostname, ".")[0]
+
+	os.Setenv("AWS_VAULT_TEST_SESSION", "from-env")
+	defer os.Unsetenv("AWS_VAULT_TEST_SESSION")
+
+	var testCases = []struct {
+		Template    string
+		ProfileName string
+		Expected    string
+	}{
+		{"${profile}", "admin", "admin"},
+		{"$profile-ops", "admin", "admin-ops"},
+		{"${user}", "admin", username},
+		{"${user}@${hostname}", "admin", username + "@" + hostname},
+		{"ci-${unknown}", "admin", "ci-"},
+		{"${AWS_VAULT_TEST_SESSION}", "admin", ""},
+		{"jon smith/${profile}", "my profile", "jon-smith-my-profile"},
+		{"${profile}", "a:b*c", "a-b-c"},
+		{"${profile}", strings.Repeat("p", 70), strings.Repeat("p", 64)},
+		{"session-${profile}", strings.Repeat("p", 60), "session-" + strings.Repeat("p", 56)},
+	}
+
+	for _, tc := range testCases {
+		if name := plannedRoleSessionName(t, tc.Template, tc.ProfileName); name != tc.Expected {
+			t.Errorf("Expected %q with profile %q to be %q, got %q", tc.Template, tc.ProfileName, tc.Expected, name)
+		}
+	}
+
+	name := plannedRoleSessionName(t, "aws-vault-${timestamp}", "admin")
+	if !regexp.MustCompile(`^aws-vault-\d{10}$`).MatchString(name) {
+		t.Errorf("Expected a unix timestamp, got %q", name)
+	}
+}
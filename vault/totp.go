@@ -0,0 +1,109 @@
+package vault
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/99designs/keyring"
+)
+
+const (
+	totpKeyPrefix = "totp,"
+	totpPeriod    = 30
+	totpDigits    = 6
+)
+
+// IsTotpKey returns whether a keyring key holds a virtual MFA secret rather than credentials
+func IsTotpKey(s string) bool {
+	return strings.HasPrefix(s, totpKeyPrefix)
+}
+
+// TotpKey returns the keyring key of the virtual MFA secret for mfaSerial. The serial is encoded, as
+// serials contain slashes, which backends that keep each item in a file can't have in a key
+func TotpKey(mfaSerial string) string {
+	return totpKeyPrefix + base64Encoding.EncodeToString([]byte(mfaSerial))
+}
+
+// legacyTotpKey is the key secrets were stored under before the serial was encoded
+func legacyTotpKey(mfaSerial string) string {
+	return totpKeyPrefix + mfaSerial
+}
+
+// StoreTotpSecret stores the base32 secret of a virtual MFA device, so that tokens for it are
+// generated rather than asked for
+func StoreTotpSecret(k Storage, mfaSerial string, secret string) error {
+	secret = normaliseTotpSecret(secret)
+	if _, err := decodeTotpSecret(secret); err != nil {
+		return err
+	}
+
+	return k.Set(keyring.Item{
+		Key:   TotpKey(mfaSerial),
+		Label: fmt.Sprintf("aws-vault totp secret (%s)", mfaSerial),
+		Data:  []byte(secret),
+
+		// specific Keychain settings
+		KeychainNotTrustApplication: true,
+	})
+}
+
+// TotpCode generates the RFC 6238 token for a base32 secret at the given time, as virtual MFA devices do
+func TotpCode(secret string, t time.Time) (string, error) {
+	key, err := decodeTotpSecret(normaliseTotpSecret(secret))
+	if err != nil {
+		return "", err
+	}
+
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(t.Unix()/totpPeriod))
+
+	h := hmac.New(sha1.New, key)
+	h.Write(counter[:])
+	sum := h.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0xf
+	code := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	return fmt.Sprintf("%0*d", totpDigits, code%1000000), nil
+}
+
+// untilNextTotpStep returns how long it is from t until the next token, when a different token is generated
+func untilNextTotpStep(t time.Time) time.Duration {
+	next := time.Unix((t.Unix()/totpPeriod+1)*totpPeriod, 0)
+	return next.Sub(t)
+}
+
+// totpCodeFromKeyring generates a token for the MFA device if its secret is stored, ok is false if it isn't
+func totpCodeFromKeyring(k Storage, mfaSerial string) (code string, ok bool, err error) {
+	item, err := k.Get(TotpKey(mfaSerial))
+	if err == keyring.ErrKeyNotFound {
+		item, err = k.Get(legacyTotpKey(mfaSerial))
+	}
+	if err == keyring.ErrKeyNotFound {
+		return "", false, nil
+	} else if err != nil {
+		return "", false, err
+	}
+
+	log.Printf("Generating token for %s from the secret in the keyring", mfaSerial)
+	code, err = TotpCode(string(item.Data), time.Now())
+	return code, true, err
+}
+
+func normaliseTotpSecret(secret string) string {
+	return strings.ToUpper(strings.Replace(strings.TrimSpace(secret), " ", "", -1))
+}
+
+func decodeTotpSecret(secret string) ([]byte, error) {
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(strings.TrimRight(secret, "="))
+	if err != nil {
+		return nil, fmt.Errorf("Invalid TOTP secret, it should be base32: %v", err)
+	}
+	return key, nil
+}
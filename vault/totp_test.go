@@ -0,0 +1,51 @@
+package vault_test
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/99designs/aws-vault/vault"
+)
+
+// test vectors from RFC 6238, truncated to 6 digits
+func TestTotpCode(t *testing.T) {
+	secret := base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+
+	var testCases = []struct {
+		Time int64
+		Code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+
+	for _, tc := range testCases {
+		code, err := vault.TotpCode(secret, time.Unix(tc.Time, 0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code != tc.Code {
+			t.Fatalf("Expected code %s at %d, got %s", tc.Code, tc.Time, code)
+		}
+	}
+}
+
+func TestTotpSecretKeyHasNoSlashes(t *testing.T) {
+	storage := mapStorage{}
+	serial := "arn:aws:iam::111111111111:mfa/jonsmith"
+	if err := vault.StoreTotpSecret(storage, serial, "JBSWY3DPEHPK3PXP"); err != nil {
+		t.Fatal(err)
+	}
+
+	key := vault.TotpKey(serial)
+	if _, ok := storage[key]; !ok {
+		t.Fatalf("Expected the secret to be stored as %s, got %v", key, storage)
+	}
+	if strings.Contains(key, "/") || !vault.IsTotpKey(key) {
+		t.Fatalf("Expected a TOTP key without slashes, got %s", key)
+	}
+}
@@ -0,0 +1,53 @@
+package vault
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/99designs/aws-vault/stsclient"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+)
+
+// getCredsWithWebIdentity assumes the role with the OIDC token in the web identity token file, as
+// injected by CI systems and EKS. No stored credentials are needed
+func (p *TempCredentialsProvider) getCredsWithWebIdentity() (credentials.Value, error) {
+	if p.config.RoleARN == "" {
+		return credentials.Value{}, errors.New("A role_arn is required with web_identity_token_file")
+	}
+
+	b, err := ioutil.ReadFile(p.config.WebIdentityTokenFile)
+	if err != nil {
+		return credentials.Value{}, fmt.Errorf("Failed to read web identity token: %v", err)
+	}
+
+	client, err := newStsClient(nil, p.config)
+	if err != nil {
+		return credentials.Value{}, err
+	}
+
+	input := stsclient.AssumeRoleWithWebIdentityInput{
+		RoleArn:          p.config.RoleARN,
+		RoleSessionName:  p.roleSessionName(),
+		WebIdentityToken: strings.TrimSpace(string(b)),
+		DurationSeconds:  int64(p.config.AssumeRoleDuration.Seconds()),
+	}
+
+	log.Printf("Assuming role %s with web identity token from %s", p.config.RoleARN, p.config.WebIdentityTokenFile)
+	role, err := client.AssumeRoleWithWebIdentity(input)
+	if err != nil {
+		return credentials.Value{}, err
+	}
+
+	p.SetExpiration(*role.Expiration, p.config.RoleExpirationWindow)
+
+	log.Printf("Using role ****************%s, expires in %s", (*role.AccessKeyId)[len(*role.AccessKeyId)-4:], role.Expiration.Sub(time.Now()).String())
+	return credentials.Value{
+		AccessKeyID:     *role.AccessKeyId,
+		SecretAccessKey: *role.SecretAccessKey,
+		SessionToken:    *role.SessionToken,
+	}, nil
+}